@@ -0,0 +1,111 @@
+// Command mllp-stub stands in for the hospital information system when
+// trying the HL7 integration locally. By default it listens for the SIU
+// messages the application sends, prints them and acknowledges them; with
+// -send it pushes the ADT messages of a file to the application's MLLP
+// listener and prints the acknowledgements.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"log"
+	"medical-center/pkg/hl7"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":2575", "Listen address, must match HL7_SEND_ADDR")
+	reply := flag.String("reply", hl7.AckAccept, "Acknowledgement code: AA, AE or AR")
+	failFirst := flag.Int("fail-first", 0, "Answer AE to this many messages before using -reply, to exercise retries")
+	silent := flag.Bool("no-ack", false, "Never acknowledge, so that deliveries time out")
+	send := flag.String("send", "", "Send the messages of this file to the address instead of listening; messages start with MSH, segments are one per line")
+	to := flag.String("to", "localhost:2576", "Address to send to with -send, must match HL7_LISTEN_ADDR")
+	flag.Parse()
+
+	if *send != "" {
+		if err := sendFile(*send, *to); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var mu sync.Mutex
+	received := 0
+	server := &hl7.Server{Handler: func(ctx context.Context, payload []byte) []byte {
+		mu.Lock()
+		received++
+		n := received
+		mu.Unlock()
+
+		log.Printf("message %d:\n%s", n, printable(payload))
+		if *silent {
+			return nil
+		}
+		msg, err := hl7.Parse(payload)
+		if err != nil {
+			return hl7.NewACK(nil, hl7.AckReject, err.Error(), "STUB", time.Now()).Bytes()
+		}
+		code := *reply
+		if n <= *failFirst {
+			code = hl7.AckError
+		}
+		log.Printf("message %d acknowledged %s", n, code)
+		return hl7.NewACK(msg, code, "", msg.ControlID(), time.Now()).Bytes()
+	}}
+
+	log.Printf("MLLP stub listening on %s", *addr)
+	log.Fatal(server.ListenAndServe(context.Background(), *addr))
+}
+
+func sendFile(path, addr string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	client := hl7.NewClient(addr, 10*time.Second)
+	defer client.Close()
+
+	for _, payload := range splitMessages(data) {
+		msg, err := hl7.Parse(payload)
+		if err != nil {
+			return err
+		}
+		ack, err := client.Send(context.Background(), payload)
+		if err != nil {
+			return err
+		}
+		code, text, err := hl7.ReadACK(ack)
+		if err != nil {
+			return err
+		}
+		log.Printf("%s: %s %s", msg.ControlID(), code, text)
+	}
+	return nil
+}
+
+// splitMessages splits a file into messages at every MSH segment
+func splitMessages(data []byte) [][]byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\r"))
+	data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r"))
+
+	var messages [][]byte
+	for _, segment := range bytes.Split(data, []byte("\r")) {
+		if len(bytes.TrimSpace(segment)) == 0 {
+			continue
+		}
+		if bytes.HasPrefix(segment, []byte("MSH|")) || len(messages) == 0 {
+			messages = append(messages, nil)
+		}
+		last := len(messages) - 1
+		messages[last] = append(append(messages[last], segment...), '\r')
+	}
+	return messages
+}
+
+func printable(payload []byte) string {
+	return strings.TrimSpace(strings.ReplaceAll(string(payload), "\r", "\n"))
+}
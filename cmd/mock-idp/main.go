@@ -0,0 +1,28 @@
+// Command mock-idp is a minimal OpenID provider for trying single sign-on
+// locally. It shows a form where any email, name and group list can be
+// entered and signs ID tokens for them. Never expose it outside a
+// development machine.
+package main
+
+import (
+	"flag"
+	"log"
+	"medical-center/pkg/oidc/oidctest"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "Listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "Issuer URL, must match OIDC_ISSUER")
+	clientID := flag.String("client-id", "medical-center", "Accepted client ID")
+	clientSecret := flag.String("client-secret", "mock-secret", "Accepted client secret")
+	flag.Parse()
+
+	s, err := oidctest.NewServer(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatalf("Failed to generate signing key: %v", err)
+	}
+
+	log.Printf("Mock identity provider %s listening on %s", s.Issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
@@ -0,0 +1,23 @@
+// Command s3-stub is an in-memory S3-compatible store for trying the S3
+// attachment storage locally without MinIO or a real bucket. It checks
+// request signatures but keeps everything in memory; never expose it
+// outside a development machine.
+package main
+
+import (
+	"flag"
+	"log"
+	"medical-center/pkg/blobstore"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", ":9100", "Listen address")
+	accessKey := flag.String("access-key", "stub-access-key", "Access key, must match S3_ACCESS_KEY")
+	secretKey := flag.String("secret-key", "stub-secret-key", "Secret key, must match S3_SECRET_KEY")
+	region := flag.String("region", "us-east-1", "Region, must match S3_REGION")
+	flag.Parse()
+
+	log.Printf("S3 stub listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, blobstore.NewS3Stub(*accessKey, *secretKey, *region)))
+}
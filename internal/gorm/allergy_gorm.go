@@ -0,0 +1,151 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"medical-center/internal/models/allergy"
+	"medical-center/internal/models/appointment"
+)
+
+type AllergyRepository struct {
+	db *gorm.DB
+}
+
+func NewAllergyRepository(db *gorm.DB) *AllergyRepository {
+	return &AllergyRepository{db: db}
+}
+
+func (r *AllergyRepository) ListAllergies(ctx context.Context, patientID uint) ([]allergy.Allergy, error) {
+	var allergies []allergy.Allergy
+	err := r.db.WithContext(ctx).
+		Where("patient_id = ?", patientID).
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL: "CASE severity WHEN ? THEN 0 WHEN ? THEN 1 WHEN ? THEN 2 ELSE 3 END, substance",
+			Vars: []interface{}{
+				allergy.SeverityLifeThreatening, allergy.SeveritySevere, allergy.SeverityModerate,
+			},
+		}}).
+		Find(&allergies).Error
+	return allergies, err
+}
+
+func (r *AllergyRepository) GetAllergy(ctx context.Context, id uint) (*allergy.Allergy, error) {
+	var a allergy.Allergy
+	err := r.db.WithContext(ctx).First(&a, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("allergy not found")
+	}
+	return &a, err
+}
+
+func (r *AllergyRepository) CreateAllergy(ctx context.Context, a *allergy.Allergy) error {
+	return r.db.WithContext(ctx).Create(a).Error
+}
+
+func (r *AllergyRepository) SaveAllergy(ctx context.Context, a *allergy.Allergy) error {
+	return r.db.WithContext(ctx).Save(a).Error
+}
+
+func (r *AllergyRepository) DeleteAllergy(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&allergy.Allergy{}, id).Error
+}
+
+func (r *AllergyRepository) ListConditions(ctx context.Context, patientID uint) ([]allergy.Condition, error) {
+	var conditions []allergy.Condition
+	err := r.db.WithContext(ctx).
+		Where("patient_id = ?", patientID).
+		Order("resolved_at IS NOT NULL, since DESC NULLS LAST, id").
+		Find(&conditions).Error
+	return conditions, err
+}
+
+func (r *AllergyRepository) GetCondition(ctx context.Context, id uint) (*allergy.Condition, error) {
+	var c allergy.Condition
+	err := r.db.WithContext(ctx).First(&c, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("condition not found")
+	}
+	return &c, err
+}
+
+func (r *AllergyRepository) CreateCondition(ctx context.Context, c *allergy.Condition) error {
+	return r.db.WithContext(ctx).Create(c).Error
+}
+
+func (r *AllergyRepository) SaveCondition(ctx context.Context, c *allergy.Condition) error {
+	return r.db.WithContext(ctx).Save(c).Error
+}
+
+func (r *AllergyRepository) DeleteCondition(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&allergy.Condition{}, id).Error
+}
+
+func (r *AllergyRepository) ListAcknowledgements(ctx context.Context, patientID uint) ([]allergy.Acknowledgement, error) {
+	var acks []allergy.Acknowledgement
+	err := r.db.WithContext(ctx).Where("patient_id = ?", patientID).Order("id DESC").Find(&acks).Error
+	return acks, err
+}
+
+type ProcedureRepository struct {
+	db *gorm.DB
+}
+
+func NewProcedureRepository(db *gorm.DB) *ProcedureRepository {
+	return &ProcedureRepository{db: db}
+}
+
+func (r *ProcedureRepository) ListProcedures(ctx context.Context, includeInactive bool) ([]allergy.Procedure, error) {
+	query := r.db.WithContext(ctx)
+	if !includeInactive {
+		query = query.Where("active")
+	}
+	var procedures []allergy.Procedure
+	err := query.Order("name").Find(&procedures).Error
+	return procedures, err
+}
+
+func (r *ProcedureRepository) GetProcedure(ctx context.Context, id uint) (*allergy.Procedure, error) {
+	var p allergy.Procedure
+	err := r.db.WithContext(ctx).First(&p, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("procedure not found")
+	}
+	return &p, err
+}
+
+func (r *ProcedureRepository) GetProcedureByCode(ctx context.Context, code string) (*allergy.Procedure, error) {
+	var procedures []allergy.Procedure
+	err := r.db.WithContext(ctx).Where("code = ?", code).Limit(1).Find(&procedures).Error
+	if err != nil || len(procedures) == 0 {
+		return nil, err
+	}
+	return &procedures[0], nil
+}
+
+func (r *ProcedureRepository) CreateProcedure(ctx context.Context, p *allergy.Procedure) error {
+	return r.db.WithContext(ctx).Create(p).Error
+}
+
+func (r *ProcedureRepository) SaveProcedure(ctx context.Context, p *allergy.Procedure) error {
+	return r.db.WithContext(ctx).Save(p).Error
+}
+
+func (r *ProcedureRepository) SetAppointmentProcedure(ctx context.Context, appointmentID uint, procedureID *uint, acks []allergy.Acknowledgement) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&appointment.Appointment{}).
+			Where("id = ?", appointmentID).
+			Update("procedure_id", procedureID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("appointment not found")
+		}
+		if len(acks) == 0 {
+			return nil
+		}
+		return tx.Create(&acks).Error
+	})
+}
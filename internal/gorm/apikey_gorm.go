@@ -0,0 +1,76 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"medical-center/internal/models/apikey"
+	"time"
+)
+
+type APIKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+func (r *APIKeyRepository) CreateServiceAccount(ctx context.Context, account *apikey.ServiceAccount) error {
+	return r.db.WithContext(ctx).Create(account).Error
+}
+
+func (r *APIKeyRepository) GetServiceAccount(ctx context.Context, id uint) (*apikey.ServiceAccount, error) {
+	var account apikey.ServiceAccount
+	err := r.db.WithContext(ctx).First(&account, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("service account not found")
+	}
+	return &account, err
+}
+
+func (r *APIKeyRepository) GetServiceAccounts(ctx context.Context) ([]apikey.ServiceAccount, error) {
+	var accounts []apikey.ServiceAccount
+	err := r.db.WithContext(ctx).Order("name").Find(&accounts).Error
+	return accounts, err
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, key *apikey.APIKey) error {
+	return r.db.WithContext(ctx).Create(key).Error
+}
+
+func (r *APIKeyRepository) GetByID(ctx context.Context, id uint) (*apikey.APIKey, error) {
+	var key apikey.APIKey
+	err := r.db.WithContext(ctx).First(&key, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("api key not found")
+	}
+	return &key, err
+}
+
+func (r *APIKeyRepository) GetByHash(ctx context.Context, hash string) (*apikey.APIKey, error) {
+	var key apikey.APIKey
+	err := r.db.WithContext(ctx).Where("key_hash = ?", hash).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("api key not found")
+	}
+	return &key, err
+}
+
+func (r *APIKeyRepository) GetByServiceAccount(ctx context.Context, accountID uint) ([]apikey.APIKey, error) {
+	var keys []apikey.APIKey
+	err := r.db.WithContext(ctx).Where("service_account_id = ?", accountID).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+func (r *APIKeyRepository) Revoke(ctx context.Context, id uint, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&apikey.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at).Error
+}
+
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id uint, at time.Time) error {
+	return SkipAudit(r.db.WithContext(ctx)).Model(&apikey.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error
+}
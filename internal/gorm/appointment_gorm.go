@@ -1,60 +1,331 @@
 package gorm
 
 import (
+	"context"
 	"errors"
 	"gorm.io/gorm"
 	"medical-center/internal/models/appointment"
+	"medical-center/internal/models/patient"
+	"medical-center/pkg/fieldcrypt"
+	"strings"
+	"time"
 )
 
+// Blind index purposes, one per encrypted column
+const (
+	patientNameIndex = "appointments.patient_name"
+	emailIndex       = "appointments.email"
+	phoneIndex       = "appointments.phone"
+)
+
+// AppoinmentRepository stores the patient name, email and phone encrypted
+// with cipher. Lookups by these fields go through blind index columns.
 type AppoinmentRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	cipher *fieldcrypt.Cipher
 }
 
-func NewAppoinmentRepository(db *gorm.DB) *AppoinmentRepository {
-	return &AppoinmentRepository{db: db}
+func NewAppoinmentRepository(db *gorm.DB, cipher *fieldcrypt.Cipher) *AppoinmentRepository {
+	return &AppoinmentRepository{db: db, cipher: cipher}
 }
 
-func (r *AppoinmentRepository) Create(appoint *appointment.Appointment) error {
-	return r.db.Create(appoint).Error
+func (r *AppoinmentRepository) Create(ctx context.Context, appoint *appointment.Appointment) error {
+	row, err := r.seal(appoint, nil)
+	if err != nil {
+		return err
+	}
+	if err := r.db.WithContext(ctx).Create(row).Error; err != nil {
+		return err
+	}
+	appoint.Model = row.Model
+	return nil
 }
 
-func (r *AppoinmentRepository) GetByID(id uint) (*appointment.Appointment, error) {
+func (r *AppoinmentRepository) GetByID(ctx context.Context, id uint) (*appointment.Appointment, error) {
 	var appoint appointment.Appointment
-	err := r.db.First(&appoint, id).Error
+	err := r.db.WithContext(ctx).First(&appoint, id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, errors.New("appoint  not found")
 	}
-	return &appoint, err
+	if err != nil {
+		return nil, err
+	}
+	return &appoint, r.open(&appoint)
 }
 
-func (r *AppoinmentRepository) GetAll() ([]appointment.Appointment, error) {
+func (r *AppoinmentRepository) GetAll(ctx context.Context) ([]appointment.Appointment, error) {
 	var appoint []appointment.Appointment
-	err := r.db.Find(&appoint).Error
-	return appoint, err
+	err := r.db.WithContext(ctx).Find(&appoint).Error
+	return r.openAll(appoint, err)
 }
 
-func (r *AppoinmentRepository) GetByDepartment(departmentID uint) ([]appointment.Appointment, error) {
+func (r *AppoinmentRepository) GetByDepartment(ctx context.Context, departmentID uint) ([]appointment.Appointment, error) {
 	var appoint []appointment.Appointment
-	err := r.db.Where("department_id = ?", departmentID).Find(&appoint).Error
-	return appoint, err
+	err := r.db.WithContext(ctx).Where("department_id = ?", departmentID).Find(&appoint).Error
+	return r.openAll(appoint, err)
 }
 
-func (r *AppoinmentRepository) GetByPatient(name string) ([]appointment.Appointment, error) {
+// GetByPatient matches the name ignoring case and extra spaces
+func (r *AppoinmentRepository) GetByPatient(ctx context.Context, name string) ([]appointment.Appointment, error) {
 	var appoint []appointment.Appointment
-	err := r.db.Where("patient_name = ?", name).Find(&appoint).Error
-	return appoint, err
+	err := r.db.WithContext(ctx).Where("patient_name_bidx = ?", r.cipher.BlindIndex(patientNameIndex, patient.NormalizeName(name))).Find(&appoint).Error
+	return r.openAll(appoint, err)
+}
+
+func (r *AppoinmentRepository) Update(ctx context.Context, appoint *appointment.Appointment) error {
+	// Unchanged fields keep their ciphertext so that the audit log only
+	// shows the fields that were actually edited
+	var stored appointment.Appointment
+	if err := SkipAudit(r.db.WithContext(ctx)).Unscoped().First(&stored, appoint.ID).Error; err != nil {
+		return err
+	}
+
+	row, err := r.seal(appoint, &stored)
+	if err != nil {
+		return err
+	}
+	if err := r.db.WithContext(ctx).Save(row).Error; err != nil {
+		return err
+	}
+	appoint.Model = row.Model
+	return nil
+}
+
+func (r *AppoinmentRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&appointment.Appointment{}, id).Error
 }
 
-func (r *AppoinmentRepository) Update(appoint *appointment.Appointment) error {
-	return r.db.Save(appoint).Error
+func (r *AppoinmentRepository) GetByDoctor(ctx context.Context, doctorID uint) ([]appointment.Appointment, error) {
+	var appoint []appointment.Appointment
+	err := r.db.WithContext(ctx).Where("doctor_id = ?", doctorID).Find(&appoint).Error
+	return r.openAll(appoint, err)
 }
 
-func (r *AppoinmentRepository) Delete(id uint) error {
-	return r.db.Delete(&appointment.Appointment{}, id).Error
+func (r *AppoinmentRepository) GetByEmail(ctx context.Context, email string) ([]appointment.Appointment, error) {
+	var appoint []appointment.Appointment
+	err := r.db.WithContext(ctx).Where("email_bidx = ?", r.cipher.BlindIndex(emailIndex, patient.NormalizeEmail(email))).Find(&appoint).Error
+	return r.openAll(appoint, err)
 }
 
-func (r *AppoinmentRepository) GetByDoctor(doctorID uint) ([]appointment.Appointment, error) {
+func (r *AppoinmentRepository) GetByPatientID(ctx context.Context, patientID uint) ([]appointment.Appointment, error) {
+	var appoint []appointment.Appointment
+	err := r.db.WithContext(ctx).Where("patient_id = ?", patientID).Order("appointment_time").Find(&appoint).Error
+	return r.openAll(appoint, err)
+}
+
+func (r *AppoinmentRepository) IsPatientOf(ctx context.Context, patientID, doctorID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&appointment.Appointment{}).
+		Where("patient_id = ? AND doctor_id = ?", patientID, doctorID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Search finds cancelled appointments through their deletion, so it looks
+// at deleted rows as well
+func (r *AppoinmentRepository) Search(ctx context.Context, filter appointment.SearchFilter) ([]appointment.Appointment, int64, error) {
+	query := r.db.WithContext(ctx).Model(&appointment.Appointment{}).Unscoped()
+
+	states := filter.States
+	if len(states) == 0 {
+		states = []appointment.State{appointment.StateUpcoming, appointment.StatePast}
+	}
+	now := time.Now()
+	var conditions []string
+	var args []interface{}
+	for _, state := range states {
+		switch state {
+		case appointment.StateUpcoming:
+			conditions = append(conditions, "(deleted_at IS NULL AND appointment_time >= ?)")
+			args = append(args, now)
+		case appointment.StatePast:
+			conditions = append(conditions, "(deleted_at IS NULL AND appointment_time < ?)")
+			args = append(args, now)
+		case appointment.StateCancelled:
+			conditions = append(conditions, "deleted_at IS NOT NULL")
+		}
+	}
+	query = query.Where(strings.Join(conditions, " OR "), args...)
+
+	if filter.DoctorID != nil {
+		query = query.Where("doctor_id = ?", *filter.DoctorID)
+	}
+	if filter.From != nil {
+		query = query.Where("appointment_time >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("appointment_time < ?", *filter.To)
+	}
+	switch {
+	case filter.OwnerDoctorID != nil && filter.OwnerEmail != "":
+		query = query.Where("doctor_id = ? OR email_bidx = ?", *filter.OwnerDoctorID, r.cipher.BlindIndex(emailIndex, patient.NormalizeEmail(filter.OwnerEmail)))
+	case filter.OwnerDoctorID != nil:
+		query = query.Where("doctor_id = ?", *filter.OwnerDoctorID)
+	case filter.OwnerEmail != "":
+		query = query.Where("email_bidx = ?", r.cipher.BlindIndex(emailIndex, patient.NormalizeEmail(filter.OwnerEmail)))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = query.Order("appointment_time, id")
+	if filter.PageSize > 0 {
+		query = query.Offset((filter.Page - 1) * filter.PageSize).Limit(filter.PageSize)
+	}
 	var appoint []appointment.Appointment
-	err := r.db.Where("doctor_id = ?", doctorID).Find(&appoint).Error
-	return appoint, err
+	err := query.Find(&appoint).Error
+	appoint, err = r.openAll(appoint, err)
+	return appoint, total, err
+}
+
+// AnonymizeByEmail includes deleted appointments, they are kept for
+// statistics as well
+func (r *AppoinmentRepository) AnonymizeByEmail(ctx context.Context, email string) (int, error) {
+	var rows []appointment.Appointment
+	err := SkipAudit(r.db.WithContext(ctx)).Unscoped().
+		Where("email_bidx = ?", r.cipher.BlindIndex(emailIndex, patient.NormalizeEmail(email))).
+		Find(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range rows {
+		if err := r.anonymize(ctx, rows[i].ID); err != nil {
+			return i, err
+		}
+	}
+	return len(rows), nil
+}
+
+// anonymize replaces the patient details of an appointment
+func (r *AppoinmentRepository) anonymize(ctx context.Context, id uint) error {
+	erased := appointment.Appointment{PatientName: appointment.ErasedPatientName}
+	erased.ID = id
+	row, err := r.seal(&erased, nil)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Model(&appointment.Appointment{}).Unscoped().
+		Where("id = ?", row.ID).
+		Updates(map[string]interface{}{
+			"patient_name":      row.PatientName,
+			"email":             row.Email,
+			"phone":             row.Phone,
+			"patient_name_bidx": row.PatientNameIndex,
+			"email_bidx":        row.EmailIndex,
+			"phone_bidx":        row.PhoneIndex,
+		}).Error
+}
+
+// EncryptBatch encrypts the patient details of up to limit appointments
+// with an ID above afterID that are still stored in plaintext or under a
+// retired key, and recomputes their blind indexes. It returns the last ID
+// looked at and how many rows were rewritten; a last ID of 0 means there
+// are no more rows.
+func (r *AppoinmentRepository) EncryptBatch(ctx context.Context, afterID uint, limit int) (uint, int, error) {
+	var rows []appointment.Appointment
+	err := SkipAudit(r.db.WithContext(ctx)).Unscoped().
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return 0, 0, err
+	}
+
+	updated := 0
+	for i := range rows {
+		stored := rows[i]
+		plain := rows[i]
+		if err := r.open(&plain); err != nil {
+			return 0, updated, err
+		}
+		row, err := r.seal(&plain, &stored)
+		if err != nil {
+			return 0, updated, err
+		}
+		if row.PatientName == stored.PatientName && row.Email == stored.Email && row.Phone == stored.Phone &&
+			row.PatientNameIndex == stored.PatientNameIndex && row.EmailIndex == stored.EmailIndex && row.PhoneIndex == stored.PhoneIndex {
+			continue
+		}
+
+		// UpdateColumns leaves updated_at alone, this is not an edit
+		err = r.db.WithContext(ctx).Model(&appointment.Appointment{}).Unscoped().
+			Where("id = ?", row.ID).
+			UpdateColumns(map[string]interface{}{
+				"patient_name":      row.PatientName,
+				"email":             row.Email,
+				"phone":             row.Phone,
+				"patient_name_bidx": row.PatientNameIndex,
+				"email_bidx":        row.EmailIndex,
+				"phone_bidx":        row.PhoneIndex,
+			}).Error
+		if err != nil {
+			return 0, updated, err
+		}
+		updated++
+	}
+	return rows[len(rows)-1].ID, updated, nil
+}
+
+// seal returns a copy of appoint ready to be stored. When stored is given,
+// fields whose plaintext did not change reuse its ciphertext.
+func (r *AppoinmentRepository) seal(appoint, stored *appointment.Appointment) (*appointment.Appointment, error) {
+	row := *appoint
+	fields := []sealedField{{&row.PatientName, ""}, {&row.Email, ""}, {&row.Phone, ""}}
+	if stored != nil {
+		fields[0].stored, fields[1].stored, fields[2].stored = stored.PatientName, stored.Email, stored.Phone
+	}
+	if err := sealFields(r.cipher, fields); err != nil {
+		return nil, err
+	}
+
+	row.PatientNameIndex = r.cipher.BlindIndex(patientNameIndex, patient.NormalizeName(appoint.PatientName))
+	row.EmailIndex = r.cipher.BlindIndex(emailIndex, patient.NormalizeEmail(appoint.Email))
+	row.PhoneIndex = r.cipher.BlindIndex(phoneIndex, patient.NormalizePhone(appoint.Phone))
+	return &row, nil
+}
+
+// UnlinkedBatch returns up to limit appointments with an ID above afterID
+// that are not linked to a patient yet, deleted ones included
+func (r *AppoinmentRepository) UnlinkedBatch(ctx context.Context, afterID uint, limit int) ([]appointment.Appointment, error) {
+	var rows []appointment.Appointment
+	err := SkipAudit(r.db.WithContext(ctx)).Unscoped().
+		Where("id > ? AND patient_id IS NULL", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&rows).Error
+	return r.openAll(rows, err)
+}
+
+func (r *AppoinmentRepository) LinkPatient(ctx context.Context, id, patientID uint) error {
+	return r.db.WithContext(ctx).Model(&appointment.Appointment{}).Unscoped().
+		Where("id = ?", id).
+		Update("patient_id", patientID).Error
+}
+
+// open decrypts the patient details in place
+func (r *AppoinmentRepository) open(appoint *appointment.Appointment) error {
+	for _, value := range []*string{&appoint.PatientName, &appoint.Email, &appoint.Phone} {
+		plain, err := r.cipher.Decrypt(*value)
+		if err != nil {
+			return err
+		}
+		*value = plain
+	}
+	return nil
+}
+
+func (r *AppoinmentRepository) openAll(appoints []appointment.Appointment, err error) ([]appointment.Appointment, error) {
+	if err != nil {
+		return appoints, err
+	}
+	for i := range appoints {
+		if err := r.open(&appoints[i]); err != nil {
+			return nil, err
+		}
+	}
+	return appoints, nil
 }
@@ -0,0 +1,45 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"medical-center/internal/models/attachment"
+)
+
+type AttachmentRepository struct {
+	db *gorm.DB
+}
+
+func NewAttachmentRepository(db *gorm.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+func (r *AttachmentRepository) Create(ctx context.Context, a *attachment.Attachment) error {
+	return r.db.WithContext(ctx).Create(a).Error
+}
+
+func (r *AttachmentRepository) GetByID(ctx context.Context, id uint) (*attachment.Attachment, error) {
+	var a attachment.Attachment
+	err := r.db.WithContext(ctx).First(&a, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("attachment not found")
+	}
+	return &a, err
+}
+
+func (r *AttachmentRepository) GetByPatient(ctx context.Context, patientID uint) ([]attachment.Attachment, error) {
+	var attachments []attachment.Attachment
+	err := r.db.WithContext(ctx).Where("patient_id = ?", patientID).Order("created_at DESC, id DESC").Find(&attachments).Error
+	return attachments, err
+}
+
+func (r *AttachmentRepository) GetByAppointment(ctx context.Context, appointmentID uint) ([]attachment.Attachment, error) {
+	var attachments []attachment.Attachment
+	err := r.db.WithContext(ctx).Where("appointment_id = ?", appointmentID).Order("created_at DESC, id DESC").Find(&attachments).Error
+	return attachments, err
+}
+
+func (r *AttachmentRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&attachment.Attachment{}, id).Error
+}
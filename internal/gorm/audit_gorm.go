@@ -0,0 +1,83 @@
+package gorm
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"medical-center/internal/models/audit"
+)
+
+type AuditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) List(ctx context.Context, filter audit.Filter) ([]audit.Entry, int64, error) {
+	query := r.db.WithContext(ctx).Model(&audit.Entry{})
+	if filter.ActorType != "" {
+		query = query.Where("actor_type = ?", filter.ActorType)
+	}
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Entity != "" {
+		query = query.Where("entity = ?", filter.Entity)
+	}
+	if filter.EntityID != "" {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []audit.Entry
+	err := query.Order("id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&entries).Error
+	return entries, total, err
+}
+
+func (r *AuditRepository) GetAfter(ctx context.Context, afterID uint, limit int) ([]audit.Entry, error) {
+	var entries []audit.Entry
+	err := r.db.WithContext(ctx).Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&entries).Error
+	return entries, err
+}
+
+func (r *AuditRepository) CreateCheckpoint(ctx context.Context) (*audit.Checkpoint, error) {
+	var entries []audit.Entry
+	if err := r.db.WithContext(ctx).Order("id DESC").Limit(1).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	checkpoint := &audit.Checkpoint{EntryID: entries[0].ID, Hash: entries[0].Hash}
+	if err := r.db.WithContext(ctx).Create(checkpoint).Error; err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func (r *AuditRepository) ListCheckpoints(ctx context.Context) ([]audit.Checkpoint, error) {
+	var checkpoints []audit.Checkpoint
+	err := r.db.WithContext(ctx).Order("entry_id, id").Find(&checkpoints).Error
+	return checkpoints, err
+}
@@ -0,0 +1,581 @@
+package gorm
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"log"
+	"medical-center/internal/models/audit"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	auditSkipKey   = "audit:skip"
+	auditBeforeKey = "audit:before"
+
+	// auditChainLock is the advisory lock serialising appends to the hash
+	// chain, so that each entry sees the hash of the one before it
+	auditChainLock = 0x61756469746c6f67
+
+	redactedValue = "[redacted]"
+
+	// auditReadBatch is the most read entries appended in one transaction
+	auditReadBatch = 500
+	// auditReadQueue is how many reads may wait for the next batch. Reads
+	// beyond it are dropped rather than holding up queries.
+	auditReadQueue = 10 * auditReadBatch
+)
+
+// SkipAudit keeps the statements run on db out of the audit log. It is
+// meant for bookkeeping writes such as last-seen timestamps, not for data
+// changes.
+func SkipAudit(db *gorm.DB) *gorm.DB {
+	return db.Set(auditSkipKey, true)
+}
+
+type AuditConfig struct {
+	// SkipTables are never audited, e.g. short-lived login state
+	SkipTables []string
+	// ReadTables hold patient-identifying data; reading them is logged too
+	ReadTables []string
+	// RedactColumns are logged as changed without their values. Entries are
+	// column names, or "table.column" to redact a column of one table only.
+	RedactColumns []string
+	// ReadFlushInterval is how often reads are appended to the log. Reads
+	// are written in batches so that they do not queue up one by one
+	// behind the lock of the hash chain.
+	ReadFlushInterval time.Duration
+}
+
+// DefaultAuditConfig is the audit setup for the tables of this application
+func DefaultAuditConfig() AuditConfig {
+	return AuditConfig{
+		SkipTables: []string{"login_attempts", "oidc_auth_requests", "audit_checkpoints"},
+		ReadTables: []string{"appointments", "patients", "encounter_notes", "encounter_note_versions", "encounter_addenda", "prescriptions", "lab_orders", "lab_results", "attachments", "hl7_messages", "diagnoses", "patient_allergies", "patient_conditions", "allergy_acknowledgements"},
+		RedactColumns: []string{
+			"password", "mfa_secret", "token_hash", "code_hash", "key_hash", "code_verifier", "nonce",
+			// Stored encrypted, the ciphertext tells nothing and plaintext
+			// written before encryption must not end up in the log
+			"appointments.patient_name", "appointments.email", "appointments.phone",
+			"patients.full_name", "patients.email", "patients.phone", "patients.iin", "patients.birth_date",
+			"hl7_messages.payload",
+			// Clinical notes stay in their own tables, which keep every version
+			"encounter_notes.subjective", "encounter_notes.objective", "encounter_notes.assessment", "encounter_notes.plan",
+			"encounter_note_versions.subjective", "encounter_note_versions.objective",
+			"encounter_note_versions.assessment", "encounter_note_versions.plan", "encounter_addenda.text",
+			// The log cannot be erased, keep personal details of accounts
+			// out of it so that erasure requests can be honoured
+			"users.email", "users.name", "notifications.recipient", "sessions.ip", "sessions.user_agent",
+		},
+		ReadFlushInterval: time.Second,
+	}
+}
+
+// AuditPlugin records every create, update and delete made through GORM,
+// and reads of ReadTables, in the audit_logs table. Entries for changes are
+// written in the transaction of the change, so a change is never committed
+// without its audit entry. Reads are queued and appended in the background
+// every ReadFlushInterval; Close appends the last ones.
+type AuditPlugin struct {
+	skipTables    map[string]bool
+	readTables    map[string]bool
+	redactColumns map[string]bool
+
+	db            *gorm.DB
+	reads         chan audit.Entry
+	droppedReads  atomic.Int64
+	flushInterval time.Duration
+	closing       chan struct{}
+	closeOnce     sync.Once
+	flushed       chan struct{}
+}
+
+func NewAuditPlugin(cfg AuditConfig) *AuditPlugin {
+	toSet := func(names []string) map[string]bool {
+		set := make(map[string]bool, len(names))
+		for _, name := range names {
+			set[name] = true
+		}
+		return set
+	}
+
+	if cfg.ReadFlushInterval <= 0 {
+		cfg.ReadFlushInterval = time.Second
+	}
+	p := &AuditPlugin{
+		skipTables:    toSet(cfg.SkipTables),
+		readTables:    toSet(cfg.ReadTables),
+		redactColumns: toSet(cfg.RedactColumns),
+		reads:         make(chan audit.Entry, auditReadQueue),
+		flushInterval: cfg.ReadFlushInterval,
+		closing:       make(chan struct{}),
+		flushed:       make(chan struct{}),
+	}
+	p.skipTables[audit.Entry{}.TableName()] = true
+	return p
+}
+
+func (p *AuditPlugin) Name() string {
+	return "audit"
+}
+
+// Initialize registers the callbacks and starts appending queued reads.
+// Entries for writes are added before GORM commits the transaction of the
+// statement.
+func (p *AuditPlugin) Initialize(db *gorm.DB) error {
+	p.db = db
+	go p.flushReads()
+
+	callback := db.Callback()
+	if err := callback.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("audit:after_create", p.afterCreate); err != nil {
+		return err
+	}
+	if err := callback.Update().After("gorm:before_update").Before("gorm:update").Register("audit:before_update", p.snapshot); err != nil {
+		return err
+	}
+	if err := callback.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("audit:after_update", p.afterUpdate); err != nil {
+		return err
+	}
+	if err := callback.Delete().After("gorm:before_delete").Before("gorm:delete").Register("audit:before_delete", p.snapshot); err != nil {
+		return err
+	}
+	if err := callback.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("audit:after_delete", p.afterDelete); err != nil {
+		return err
+	}
+	return callback.Query().After("gorm:query").Register("audit:after_query", p.afterQuery)
+}
+
+func (p *AuditPlugin) enabled(db *gorm.DB) bool {
+	if db.Error != nil || db.Statement.Schema == nil || p.skipTables[db.Statement.Table] {
+		return false
+	}
+	skip, ok := db.Get(auditSkipKey)
+	return !ok || skip != true
+}
+
+func (p *AuditPlugin) afterCreate(db *gorm.DB) {
+	if !p.enabled(db) || db.RowsAffected == 0 {
+		return
+	}
+
+	var entries []audit.Entry
+	for _, row := range p.modelRows(db) {
+		id := p.entityID(db, row)
+		if id == "" {
+			// Not inserted, e.g. skipped by ON CONFLICT DO NOTHING
+			continue
+		}
+		entries = append(entries, audit.Entry{
+			Action:   audit.ActionCreate,
+			EntityID: id,
+			Changes:  p.changes(db.Statement.Table, nil, row),
+		})
+	}
+	p.write(db, entries)
+}
+
+// snapshot loads the rows an update or delete is about to change, locking
+// them until the end of the transaction
+func (p *AuditPlugin) snapshot(db *gorm.DB) {
+	if !p.enabled(db) {
+		return
+	}
+	stmt := db.Statement
+
+	var conditions []clause.Expression
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			conditions = append(conditions, where.Exprs...)
+		}
+	}
+	// GORM adds the primary key of the model to the WHERE clause only while
+	// building the statement, so it has to be added here as well
+	for _, value := range []reflect.Value{stmt.ReflectValue, reflect.ValueOf(stmt.Model)} {
+		if !value.IsValid() {
+			continue
+		}
+		_, keys := schema.GetIdentityFieldValuesMap(stmt.Context, value, stmt.Schema.PrimaryFields)
+		if len(keys) > 0 {
+			column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, keys)
+			conditions = append(conditions, clause.IN{Column: column, Values: values})
+		}
+	}
+	if len(conditions) == 0 {
+		// GORM refuses global updates and deletes
+		return
+	}
+
+	query := SkipAudit(db.Session(&gorm.Session{NewDB: true})).
+		Model(reflect.New(stmt.Schema.ModelType).Interface()).
+		Table(stmt.Table).
+		Clauses(clause.Where{Exprs: conditions}, clause.Locking{Strength: "UPDATE"})
+	if stmt.Unscoped {
+		query = query.Unscoped()
+	}
+
+	var rows []map[string]interface{}
+	if err := query.Find(&rows).Error; err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+	db.InstanceSet(auditBeforeKey, rows)
+}
+
+func (p *AuditPlugin) afterUpdate(db *gorm.DB) {
+	before := p.before(db)
+	if len(before) == 0 || db.RowsAffected == 0 {
+		return
+	}
+	pk := db.Statement.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return
+	}
+
+	ids := make([]interface{}, 0, len(before))
+	for _, row := range before {
+		ids = append(ids, row[pk.DBName])
+	}
+	var after []map[string]interface{}
+	err := SkipAudit(db.Session(&gorm.Session{NewDB: true})).
+		Table(db.Statement.Table).
+		Where(clause.IN{Column: clause.Column{Name: pk.DBName}, Values: ids}).
+		Find(&after).Error
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+	afterByID := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterByID[fmt.Sprint(row[pk.DBName])] = row
+	}
+
+	var entries []audit.Entry
+	for _, row := range before {
+		id := fmt.Sprint(row[pk.DBName])
+		newRow, ok := afterByID[id]
+		if !ok {
+			continue
+		}
+		changes := p.changes(db.Statement.Table, row, newRow)
+		if changes == "" {
+			continue
+		}
+		entries = append(entries, audit.Entry{
+			Action:   audit.ActionUpdate,
+			EntityID: id,
+			Changes:  changes,
+		})
+	}
+	p.write(db, entries)
+}
+
+func (p *AuditPlugin) afterDelete(db *gorm.DB) {
+	before := p.before(db)
+	if len(before) == 0 || db.RowsAffected == 0 {
+		return
+	}
+
+	entries := make([]audit.Entry, 0, len(before))
+	for _, row := range before {
+		entries = append(entries, audit.Entry{
+			Action:   audit.ActionDelete,
+			EntityID: p.entityID(db, row),
+			Changes:  p.changes(db.Statement.Table, row, nil),
+		})
+	}
+	p.write(db, entries)
+}
+
+// afterQuery logs which rows of ReadTables were returned to the caller
+func (p *AuditPlugin) afterQuery(db *gorm.DB) {
+	if !p.readTables[db.Statement.Table] || !p.enabled(db) || db.RowsAffected == 0 {
+		return
+	}
+
+	var entries []audit.Entry
+	for _, row := range p.modelRows(db) {
+		if id := p.entityID(db, row); id != "" {
+			entries = append(entries, audit.Entry{Action: audit.ActionRead, EntityID: id})
+		}
+	}
+	p.describe(db, entries)
+	for _, e := range entries {
+		select {
+		case p.reads <- e:
+		default:
+			p.droppedReads.Add(1)
+		}
+	}
+}
+
+// flushReads appends the queued reads in batches, at least every
+// flushInterval, until Close is called. A batch that cannot be written is
+// retried on the next tick while new reads wait in the queue.
+func (p *AuditPlugin) flushReads() {
+	defer close(p.flushed)
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	var batch []audit.Entry
+	for {
+		reads := p.reads
+		if len(batch) >= auditReadBatch {
+			reads = nil
+		}
+
+		select {
+		case e := <-reads:
+			batch = append(batch, e)
+			if len(batch) < auditReadBatch {
+				continue
+			}
+		case <-ticker.C:
+			p.logDroppedReads()
+			if len(batch) == 0 {
+				continue
+			}
+		case <-p.closing:
+			p.drainReads(batch)
+			return
+		}
+
+		if p.appendReads(batch) == nil {
+			batch = nil
+		}
+	}
+}
+
+// drainReads appends batch and the reads still queued
+func (p *AuditPlugin) drainReads(batch []audit.Entry) {
+	for {
+		select {
+		case e := <-p.reads:
+			batch = append(batch, e)
+			if len(batch) < auditReadBatch {
+				continue
+			}
+		default:
+			if len(batch) > 0 {
+				p.appendReads(batch)
+			}
+			p.logDroppedReads()
+			return
+		}
+		p.appendReads(batch)
+		batch = nil
+	}
+}
+
+func (p *AuditPlugin) appendReads(batch []audit.Entry) error {
+	err := p.db.Session(&gorm.Session{NewDB: true}).Transaction(func(tx *gorm.DB) error {
+		return appendEntries(tx, batch)
+	})
+	if err != nil {
+		log.Printf("audit: failed to append %d reads: %v", len(batch), err)
+	}
+	return err
+}
+
+func (p *AuditPlugin) logDroppedReads() {
+	if n := p.droppedReads.Swap(0); n > 0 {
+		log.Printf("audit: read queue full, %d reads were not logged", n)
+	}
+}
+
+// Close appends the queued reads and stops the background writer. Reads
+// made after Close are not logged.
+func (p *AuditPlugin) Close() {
+	if p.db == nil {
+		return
+	}
+	p.closeOnce.Do(func() { close(p.closing) })
+	<-p.flushed
+}
+
+func (p *AuditPlugin) before(db *gorm.DB) []map[string]interface{} {
+	if db.Error != nil {
+		return nil
+	}
+	rows, _ := db.InstanceGet(auditBeforeKey)
+	before, _ := rows.([]map[string]interface{})
+	return before
+}
+
+// modelRows returns the column values of the models in the statement
+// destination. Destinations of other types, such as counts, yield nothing.
+func (p *AuditPlugin) modelRows(db *gorm.DB) []map[string]interface{} {
+	stmt := db.Statement
+	modelType := stmt.Schema.ModelType
+
+	var values []reflect.Value
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Struct:
+		values = append(values, stmt.ReflectValue)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			values = append(values, reflect.Indirect(stmt.ReflectValue.Index(i)))
+		}
+	}
+
+	var rows []map[string]interface{}
+	for _, value := range values {
+		if value.Type() != modelType {
+			continue
+		}
+		row := make(map[string]interface{}, len(stmt.Schema.DBNames))
+		for _, name := range stmt.Schema.DBNames {
+			field := stmt.Schema.FieldsByDBName[name]
+			row[name], _ = field.ValueOf(stmt.Context, value)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (p *AuditPlugin) entityID(db *gorm.DB, row map[string]interface{}) string {
+	pk := db.Statement.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return ""
+	}
+	value := auditValue(row[pk.DBName])
+	if value == nil || reflect.ValueOf(value).IsZero() {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// changes encodes the columns that differ between before and after. Either
+// side may be nil for creates and deletes.
+func (p *AuditPlugin) changes(table string, before, after map[string]interface{}) string {
+	diff := map[string]map[string]interface{}{}
+	add := func(side, column string, value interface{}) {
+		if diff[side] == nil {
+			diff[side] = map[string]interface{}{}
+		}
+		if p.redactColumns[column] || p.redactColumns[table+"."+column] {
+			value = redactedValue
+		}
+		diff[side][column] = value
+	}
+
+	for column, value := range before {
+		oldValue := auditValue(value)
+		if after == nil {
+			add("before", column, oldValue)
+			continue
+		}
+		newValue := auditValue(after[column])
+		if !reflect.DeepEqual(oldValue, newValue) {
+			add("before", column, oldValue)
+			add("after", column, newValue)
+		}
+	}
+	if before == nil {
+		for column, value := range after {
+			add("after", column, auditValue(value))
+		}
+	}
+
+	if len(diff) == 0 {
+		return ""
+	}
+	encoded, err := json.Marshal(diff)
+	if err != nil {
+		return fmt.Sprintf(`{"error": %q}`, err.Error())
+	}
+	return string(encoded)
+}
+
+// auditValue normalises model field values and values scanned into maps so
+// that they compare and encode the same way
+func auditValue(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	value = v.Interface()
+
+	if valuer, ok := value.(driver.Valuer); ok {
+		var err error
+		if value, err = valuer.Value(); err != nil {
+			return nil
+		}
+	}
+
+	switch t := value.(type) {
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return string(t)
+	case int, int8, int16, int32, uint, uint8, uint16, uint32, uint64:
+		return reflect.ValueOf(t).Convert(reflect.TypeOf(int64(0))).Interface()
+	}
+	return value
+}
+
+// describe fills in who made the statement of db, when and on what
+func (p *AuditPlugin) describe(db *gorm.DB, entries []audit.Entry) {
+	ctx := db.Statement.Context
+	actor := audit.ActorFromContext(ctx)
+	req := audit.RequestFromContext(ctx)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	for i := range entries {
+		e := &entries[i]
+		e.CreatedAt = now
+		e.ActorType = actor.Type
+		e.ActorID = actor.ID
+		e.Entity = db.Statement.Table
+		e.IP = req.IP
+		e.RequestID = req.RequestID
+	}
+}
+
+// write appends entries to the hash chain within the transaction of db
+func (p *AuditPlugin) write(db *gorm.DB, entries []audit.Entry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	p.describe(db, entries)
+	err := db.Session(&gorm.Session{NewDB: true}).Transaction(func(tx *gorm.DB) error {
+		return appendEntries(tx, entries)
+	})
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+	}
+}
+
+// appendEntries links the entries to the end of the hash chain and inserts
+// them. The chain lock is held until tx ends.
+func appendEntries(tx *gorm.DB, entries []audit.Entry) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLock).Error; err != nil {
+		return err
+	}
+	var prevHash string
+	if err := tx.Raw("SELECT hash FROM audit_logs ORDER BY id DESC LIMIT 1").Scan(&prevHash).Error; err != nil {
+		return err
+	}
+
+	for i := range entries {
+		e := &entries[i]
+		// Set by an earlier attempt of a batch that was rolled back
+		e.ID = 0
+		e.PrevHash = prevHash
+		e.Hash = e.ComputeHash(prevHash)
+		prevHash = e.Hash
+	}
+	return tx.Create(&entries).Error
+}
@@ -0,0 +1,119 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"medical-center/internal/models/breakglass"
+	"time"
+)
+
+type BreakGlassRepository struct {
+	db *gorm.DB
+}
+
+func NewBreakGlassRepository(db *gorm.DB) *BreakGlassRepository {
+	return &BreakGlassRepository{db: db}
+}
+
+func (r *BreakGlassRepository) CreateGrant(ctx context.Context, grant *breakglass.Grant) error {
+	return r.db.WithContext(ctx).Create(grant).Error
+}
+
+func (r *BreakGlassRepository) GetGrant(ctx context.Context, id uint) (*breakglass.Grant, error) {
+	var grant breakglass.Grant
+	err := r.db.WithContext(ctx).First(&grant, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("break-glass grant not found")
+	}
+	return &grant, err
+}
+
+func (r *BreakGlassRepository) GetActiveGrant(ctx context.Context, userID uint, now time.Time) (*breakglass.Grant, error) {
+	var grants []breakglass.Grant
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND ended_at IS NULL AND expires_at > ?", userID, now).
+		Order("id DESC").
+		Limit(1).
+		Find(&grants).Error
+	if err != nil || len(grants) == 0 {
+		return nil, err
+	}
+	return &grants[0], nil
+}
+
+func (r *BreakGlassRepository) GetGrants(ctx context.Context, userID uint) ([]breakglass.Grant, error) {
+	query := r.db.WithContext(ctx)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	var grants []breakglass.Grant
+	err := query.Order("id DESC").Find(&grants).Error
+	return grants, err
+}
+
+func (r *BreakGlassRepository) EndGrant(ctx context.Context, id uint, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&breakglass.Grant{}).
+		Where("id = ? AND ended_at IS NULL", id).
+		Update("ended_at", at).Error
+}
+
+func (r *BreakGlassRepository) CreateAccess(ctx context.Context, access *breakglass.Access) error {
+	return r.db.WithContext(ctx).Create(access).Error
+}
+
+func (r *BreakGlassRepository) GetAccess(ctx context.Context, id uint) (*breakglass.Access, error) {
+	var access breakglass.Access
+	err := r.db.WithContext(ctx).First(&access, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("break-glass access not found")
+	}
+	return &access, err
+}
+
+func (r *BreakGlassRepository) ListAccesses(ctx context.Context, filter breakglass.AccessFilter) ([]breakglass.Access, int64, error) {
+	query := r.db.WithContext(ctx).Model(&breakglass.Access{})
+	if filter.ReviewStatus != "" {
+		query = query.Where("review_status = ?", filter.ReviewStatus)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.GrantID != 0 {
+		query = query.Where("grant_id = ?", filter.GrantID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var accesses []breakglass.Access
+	if filter.PageSize > 0 {
+		query = query.Offset((filter.Page - 1) * filter.PageSize).Limit(filter.PageSize)
+	}
+	err := query.Order("id").Find(&accesses).Error
+	return accesses, total, err
+}
+
+func (r *BreakGlassRepository) UpdateAccess(ctx context.Context, access *breakglass.Access) error {
+	return r.db.WithContext(ctx).Save(access).Error
+}
+
+func (r *BreakGlassRepository) ReviewPendingByGrant(ctx context.Context, grantID uint, status breakglass.ReviewStatus, reviewerID uint, note string, at time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&breakglass.Access{}).
+		Where("grant_id = ? AND review_status = ?", grantID, breakglass.ReviewPending).
+		Updates(map[string]interface{}{
+			"review_status":  status,
+			"reviewed_by_id": reviewerID,
+			"reviewed_at":    at,
+			"review_note":    note,
+		})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,41 @@
+package gorm
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"medical-center/internal/models/consent"
+	"medical-center/internal/models/patient"
+)
+
+type ConsentRepository struct {
+	db *gorm.DB
+}
+
+func NewConsentRepository(db *gorm.DB) *ConsentRepository {
+	return &ConsentRepository{db: db}
+}
+
+func (r *ConsentRepository) Create(ctx context.Context, record *consent.Record) error {
+	return r.db.WithContext(ctx).Create(record).Error
+}
+
+func (r *ConsentRepository) GetHistory(ctx context.Context, userID uint) ([]consent.Record, error) {
+	var records []consent.Record
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id DESC").Find(&records).Error
+	return records, err
+}
+
+func (r *ConsentRepository) GetLatest(ctx context.Context, userID uint) ([]consent.Record, error) {
+	latest := r.db.Model(&consent.Record{}).Select("MAX(id)").Where("user_id = ?", userID).Group("purpose")
+	var records []consent.Record
+	err := r.db.WithContext(ctx).Where("id IN (?)", latest).Order("purpose").Find(&records).Error
+	return records, err
+}
+
+// consentingPatients selects the IDs of the patients whose account's latest
+// choice for the purpose is a grant
+func consentingPatients(db *gorm.DB, purpose consent.Purpose) *gorm.DB {
+	latest := db.Model(&consent.Record{}).Select("MAX(id)").Where("purpose = ?", purpose).Group("user_id")
+	users := db.Model(&consent.Record{}).Select("user_id").Where("id IN (?) AND granted", latest)
+	return db.Model(&patient.Patient{}).Select("id").Where("user_id IN (?)", users)
+}
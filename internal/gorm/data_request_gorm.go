@@ -0,0 +1,58 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"medical-center/internal/models/datarequest"
+)
+
+type DataRequestRepository struct {
+	db *gorm.DB
+}
+
+func NewDataRequestRepository(db *gorm.DB) *DataRequestRepository {
+	return &DataRequestRepository{db: db}
+}
+
+func (r *DataRequestRepository) Create(ctx context.Context, req *datarequest.Request) error {
+	return r.db.WithContext(ctx).Create(req).Error
+}
+
+func (r *DataRequestRepository) GetByID(ctx context.Context, id uint) (*datarequest.Request, error) {
+	var req datarequest.Request
+	err := r.db.WithContext(ctx).First(&req, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("data request not found")
+	}
+	return &req, err
+}
+
+func (r *DataRequestRepository) List(ctx context.Context, filter datarequest.ListFilter) ([]datarequest.Request, int64, error) {
+	query := r.db.WithContext(ctx).Model(&datarequest.Request{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var requests []datarequest.Request
+	err := query.Order("id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&requests).Error
+	return requests, total, err
+}
+
+func (r *DataRequestRepository) Update(ctx context.Context, req *datarequest.Request) error {
+	return r.db.WithContext(ctx).Save(req).Error
+}
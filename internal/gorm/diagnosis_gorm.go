@@ -0,0 +1,225 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"medical-center/internal/models/diagnosis"
+	"strings"
+	"unicode"
+)
+
+// codeImportBatchSize is the number of codes inserted per statement
+const codeImportBatchSize = 500
+
+type ICDCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewICDCodeRepository(db *gorm.DB) *ICDCodeRepository {
+	return &ICDCodeRepository{db: db}
+}
+
+func (r *ICDCodeRepository) CreateCodes(ctx context.Context, codes []diagnosis.Code) error {
+	return r.db.WithContext(ctx).CreateInBatches(codes, codeImportBatchSize).Error
+}
+
+func (r *ICDCodeRepository) GetCode(ctx context.Context, id uint) (*diagnosis.Code, error) {
+	var code diagnosis.Code
+	err := r.db.WithContext(ctx).First(&code, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("ICD-10 code not found")
+	}
+	return &code, err
+}
+
+func (r *ICDCodeRepository) GetCodeByCode(ctx context.Context, code string) (*diagnosis.Code, error) {
+	var codes []diagnosis.Code
+	err := r.db.WithContext(ctx).Where("code = ?", code).Limit(1).Find(&codes).Error
+	if err != nil || len(codes) == 0 {
+		return nil, err
+	}
+	return &codes[0], nil
+}
+
+func (r *ICDCodeRepository) AllCodes(ctx context.Context) ([]diagnosis.Code, error) {
+	var codes []diagnosis.Code
+	err := r.db.WithContext(ctx).Order("code").Find(&codes).Error
+	return codes, err
+}
+
+// ListCodes searches codes through the index on the code without its dot,
+// and titles through the full-text index of the search_vector column
+func (r *ICDCodeRepository) ListCodes(ctx context.Context, filter diagnosis.CodeFilter) ([]diagnosis.Code, int64, error) {
+	query := r.db.WithContext(ctx).Model(&diagnosis.Code{})
+	if !filter.IncludeInactive {
+		query = query.Where("active")
+	}
+
+	order := clause.OrderBy{Columns: []clause.OrderByColumn{{Column: clause.Column{Name: "code"}}}}
+	q := strings.TrimSpace(filter.Query)
+	if looksLikeCode(q) {
+		prefix := strings.Map(func(r rune) rune {
+			if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return -1
+		}, strings.ToUpper(q))
+		query = query.Where("REPLACE(code, '.', '') LIKE ?", prefix+"%")
+	} else if terms := titleQuery(q); terms != "" {
+		query = query.Where("search_vector @@ to_tsquery('simple', ?)", terms)
+		order = clause.OrderBy{Expression: clause.Expr{
+			SQL:  "ts_rank(search_vector, to_tsquery('simple', ?)) DESC, code",
+			Vars: []interface{}{terms},
+		}}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var codes []diagnosis.Code
+	err := query.Clauses(order).
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&codes).Error
+	return codes, total, err
+}
+
+// looksLikeCode reports whether a query starts like an ICD-10 code, with a
+// letter followed by a digit
+func looksLikeCode(q string) bool {
+	if len(q) < 2 {
+		return false
+	}
+	letter := q[0] | 0x20
+	return letter >= 'a' && letter <= 'z' && q[1] >= '0' && q[1] <= '9'
+}
+
+// titleQuery turns the words of a query into a tsquery matching titles with
+// a word starting with each of them, e.g. "бронх астм" into
+// "бронх:* & астм:*". Punctuation is dropped so that the query is always
+// valid.
+func titleQuery(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+func (r *ICDCodeRepository) UpdateCode(ctx context.Context, code *diagnosis.Code) error {
+	return r.db.WithContext(ctx).Save(code).Error
+}
+
+func (r *ICDCodeRepository) DeactivateExcept(ctx context.Context, codes []string) (int64, error) {
+	query := r.db.WithContext(ctx).Model(&diagnosis.Code{}).Where("active")
+	if len(codes) > 0 {
+		query = query.Where("code NOT IN ?", codes)
+	}
+	result := query.Update("active", false)
+	return result.RowsAffected, result.Error
+}
+
+type DiagnosisRepository struct {
+	db *gorm.DB
+}
+
+func NewDiagnosisRepository(db *gorm.DB) *DiagnosisRepository {
+	return &DiagnosisRepository{db: db}
+}
+
+func (r *DiagnosisRepository) Create(ctx context.Context, d *diagnosis.Diagnosis) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := demotePrimary(tx, d); err != nil {
+			return err
+		}
+		return tx.Omit("Entry").Create(d).Error
+	})
+}
+
+func (r *DiagnosisRepository) GetByID(ctx context.Context, id uint) (*diagnosis.Diagnosis, error) {
+	var d diagnosis.Diagnosis
+	err := r.db.WithContext(ctx).Preload("Entry").First(&d, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("diagnosis not found")
+	}
+	return &d, err
+}
+
+func (r *DiagnosisRepository) GetByAppointment(ctx context.Context, appointmentID uint) ([]diagnosis.Diagnosis, error) {
+	var diagnoses []diagnosis.Diagnosis
+	err := r.db.WithContext(ctx).Preload("Entry").
+		Where("appointment_id = ?", appointmentID).
+		Clauses(clause.OrderBy{Expression: clause.Expr{SQL: "kind = ? DESC, id", Vars: []interface{}{diagnosis.KindPrimary}}}).
+		Find(&diagnoses).Error
+	return diagnoses, err
+}
+
+func (r *DiagnosisRepository) Save(ctx context.Context, d *diagnosis.Diagnosis) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := demotePrimary(tx, d); err != nil {
+			return err
+		}
+		return tx.Omit("Entry").Save(d).Error
+	})
+}
+
+// demotePrimary makes the other primary diagnosis of the appointment
+// secondary when d is primary
+func demotePrimary(tx *gorm.DB, d *diagnosis.Diagnosis) error {
+	if d.Kind != diagnosis.KindPrimary {
+		return nil
+	}
+	return tx.Model(&diagnosis.Diagnosis{}).
+		Where("appointment_id = ? AND kind = ? AND id <> ?", d.AppointmentID, diagnosis.KindPrimary, d.ID).
+		Update("kind", diagnosis.KindSecondary).Error
+}
+
+func (r *DiagnosisRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&diagnosis.Diagnosis{}, id).Error
+}
+
+// TopByDepartment counts the diagnoses of the appointments that took place,
+// cancelled appointments left out, and keeps the first Limit of each
+// department
+func (r *DiagnosisRepository) TopByDepartment(ctx context.Context, filter diagnosis.ReportFilter) ([]diagnosis.TopDiagnosis, error) {
+	key := "d.code"
+	if filter.GroupBy == diagnosis.GroupCategory {
+		key = "LEFT(d.code, 3)"
+	}
+
+	counted := r.db.Table("diagnoses AS d").
+		Select("a.department_id, " + key + " AS code, COUNT(*) AS count, COUNT(DISTINCT a.patient_id) AS patients, " +
+			"ROW_NUMBER() OVER (PARTITION BY a.department_id ORDER BY COUNT(*) DESC, " + key + ") AS rank").
+		Joins("JOIN appointments AS a ON a.id = d.appointment_id AND a.deleted_at IS NULL").
+		Where("d.deleted_at IS NULL").
+		Group("a.department_id, " + key)
+	if filter.DepartmentID != nil {
+		counted = counted.Where("a.department_id = ?", *filter.DepartmentID)
+	}
+	if filter.From != nil {
+		counted = counted.Where("a.appointment_time >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		counted = counted.Where("a.appointment_time < ?", *filter.To)
+	}
+	if filter.Kind != "" {
+		counted = counted.Where("d.kind = ?", filter.Kind)
+	}
+
+	var rows []diagnosis.TopDiagnosis
+	err := r.db.WithContext(ctx).Table("(?) AS ranked", counted).
+		Select("ranked.department_id, dep.name AS department_name, ranked.rank, ranked.code, "+
+			"COALESCE(c.title_ru, '') AS title_ru, COALESCE(c.title_en, '') AS title_en, ranked.count, ranked.patients").
+		Joins("JOIN departments AS dep ON dep.id = ranked.department_id").
+		Joins("LEFT JOIN icd10_codes AS c ON c.code = ranked.code").
+		Where("ranked.rank <= ?", filter.Limit).
+		Order("dep.name, ranked.department_id, ranked.rank").
+		Scan(&rows).Error
+	return rows, err
+}
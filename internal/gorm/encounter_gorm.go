@@ -0,0 +1,93 @@
+package gorm
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"medical-center/internal/models/encounter"
+)
+
+type EncounterRepository struct {
+	db *gorm.DB
+}
+
+func NewEncounterRepository(db *gorm.DB) *EncounterRepository {
+	return &EncounterRepository{db: db}
+}
+
+func (r *EncounterRepository) GetByAppointment(ctx context.Context, appointmentID uint) (*encounter.Note, error) {
+	var notes []encounter.Note
+	err := r.db.WithContext(ctx).
+		Preload("Addenda", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("appointment_id = ?", appointmentID).
+		Limit(1).
+		Find(&notes).Error
+	if err != nil || len(notes) == 0 {
+		return nil, err
+	}
+	return &notes[0], nil
+}
+
+func (r *EncounterRepository) Create(ctx context.Context, note *encounter.Note) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Addenda").Create(note).Error; err != nil {
+			return err
+		}
+		return tx.Create(versionOf(note)).Error
+	})
+}
+
+func (r *EncounterRepository) Save(ctx context.Context, note *encounter.Note, expectedVersion int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Checking the version in the update itself keeps concurrent saves
+		// from overwriting each other
+		result := tx.Model(&encounter.Note{}).
+			Where("id = ? AND version = ? AND status = ?", note.ID, expectedVersion, encounter.StatusDraft).
+			Updates(map[string]interface{}{
+				"subjective":    note.Subjective,
+				"objective":     note.Objective,
+				"assessment":    note.Assessment,
+				"plan":          note.Plan,
+				"status":        note.Status,
+				"version":       expectedVersion + 1,
+				"updated_by_id": note.UpdatedByID,
+				"signed_by_id":  note.SignedByID,
+				"signed_at":     note.SignedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			var stored encounter.Note
+			if err := SkipAudit(tx).Select("status").First(&stored, note.ID).Error; err != nil {
+				return err
+			}
+			if stored.IsSigned() {
+				return encounter.ErrSigned
+			}
+			return encounter.ErrVersionConflict
+		}
+
+		note.Version = expectedVersion + 1
+		return tx.Create(versionOf(note)).Error
+	})
+}
+
+func (r *EncounterRepository) GetVersions(ctx context.Context, noteID uint) ([]encounter.Version, error) {
+	var versions []encounter.Version
+	err := r.db.WithContext(ctx).Where("note_id = ?", noteID).Order("version").Find(&versions).Error
+	return versions, err
+}
+
+func (r *EncounterRepository) CreateAddendum(ctx context.Context, addendum *encounter.Addendum) error {
+	return r.db.WithContext(ctx).Create(addendum).Error
+}
+
+func versionOf(note *encounter.Note) *encounter.Version {
+	return &encounter.Version{
+		NoteID:    note.ID,
+		Version:   note.Version,
+		Content:   note.Content,
+		Status:    note.Status,
+		SavedByID: note.UpdatedByID,
+	}
+}
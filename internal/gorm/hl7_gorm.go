@@ -0,0 +1,112 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"medical-center/internal/models/hl7msg"
+	"medical-center/pkg/fieldcrypt"
+)
+
+// HL7MessageRepository stores the payload encrypted with cipher, messages
+// carry the same patient details as PatientRepository
+type HL7MessageRepository struct {
+	db     *gorm.DB
+	cipher *fieldcrypt.Cipher
+}
+
+func NewHL7MessageRepository(db *gorm.DB, cipher *fieldcrypt.Cipher) *HL7MessageRepository {
+	return &HL7MessageRepository{db: db, cipher: cipher}
+}
+
+func (r *HL7MessageRepository) Create(ctx context.Context, m *hl7msg.Message) error {
+	row := *m
+	sealed, err := r.cipher.Encrypt(m.Payload)
+	if err != nil {
+		return err
+	}
+	row.Payload = sealed
+	if err := r.db.WithContext(ctx).Create(&row).Error; err != nil {
+		return err
+	}
+	m.ID, m.CreatedAt = row.ID, row.CreatedAt
+	return nil
+}
+
+func (r *HL7MessageRepository) GetByID(ctx context.Context, id uint) (*hl7msg.Message, error) {
+	var m hl7msg.Message
+	err := r.db.WithContext(ctx).First(&m, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("hl7 message not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, r.open(&m)
+}
+
+func (r *HL7MessageRepository) List(ctx context.Context, filter hl7msg.Filter) ([]hl7msg.Message, int64, error) {
+	query := r.db.WithContext(ctx).Model(&hl7msg.Message{})
+	if filter.Direction != "" {
+		query = query.Where("direction = ?", filter.Direction)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.MessageType != "" {
+		query = query.Where("message_type = ?", filter.MessageType)
+	}
+	if filter.ControlID != "" {
+		query = query.Where("control_id = ?", filter.ControlID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var messages []hl7msg.Message
+	err := query.Order("id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&messages).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range messages {
+		if err := r.open(&messages[i]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return messages, total, nil
+}
+
+func (r *HL7MessageRepository) NextPending(ctx context.Context) (*hl7msg.Message, error) {
+	var m hl7msg.Message
+	err := r.db.WithContext(ctx).
+		Where("direction = ? AND status = ?", hl7msg.Outbound, hl7msg.StatusPending).
+		Order("id").
+		First(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, r.open(&m)
+}
+
+// Save records the delivery or processing state; the payload never changes
+func (r *HL7MessageRepository) Save(ctx context.Context, m *hl7msg.Message) error {
+	return r.db.WithContext(ctx).Omit("payload").Save(m).Error
+}
+
+// open decrypts the payload in place
+func (r *HL7MessageRepository) open(m *hl7msg.Message) error {
+	plain, err := r.cipher.Decrypt(m.Payload)
+	if err != nil {
+		return err
+	}
+	m.Payload = plain
+	return nil
+}
@@ -0,0 +1,192 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"medical-center/internal/models/appointment"
+	"medical-center/internal/models/lab"
+	"strings"
+	"time"
+)
+
+type LabTestRepository struct {
+	db *gorm.DB
+}
+
+func NewLabTestRepository(db *gorm.DB) *LabTestRepository {
+	return &LabTestRepository{db: db}
+}
+
+func (r *LabTestRepository) Create(ctx context.Context, test *lab.Test) error {
+	return r.db.WithContext(ctx).Create(test).Error
+}
+
+func (r *LabTestRepository) GetByID(ctx context.Context, id uint) (*lab.Test, error) {
+	var test lab.Test
+	err := r.db.WithContext(ctx).First(&test, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("lab test not found")
+	}
+	return &test, err
+}
+
+func (r *LabTestRepository) GetByCode(ctx context.Context, code string) (*lab.Test, error) {
+	var tests []lab.Test
+	err := r.db.WithContext(ctx).Where("code = ?", code).Limit(1).Find(&tests).Error
+	if err != nil || len(tests) == 0 {
+		return nil, err
+	}
+	return &tests[0], nil
+}
+
+func (r *LabTestRepository) List(ctx context.Context, filter lab.TestFilter) ([]lab.Test, int64, error) {
+	query := r.db.WithContext(ctx).Model(&lab.Test{})
+	if !filter.IncludeInactive {
+		query = query.Where("active")
+	}
+	if q := strings.TrimSpace(filter.Query); q != "" {
+		// Escape LIKE wildcards typed by the user
+		pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q)
+		query = query.Where("code ILIKE ? OR name ILIKE ?", pattern+"%", "%"+pattern+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var tests []lab.Test
+	err := query.Order("name").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&tests).Error
+	return tests, total, err
+}
+
+func (r *LabTestRepository) Update(ctx context.Context, test *lab.Test) error {
+	return r.db.WithContext(ctx).Save(test).Error
+}
+
+type LabOrderRepository struct {
+	db *gorm.DB
+}
+
+func NewLabOrderRepository(db *gorm.DB) *LabOrderRepository {
+	return &LabOrderRepository{db: db}
+}
+
+func (r *LabOrderRepository) Create(ctx context.Context, order *lab.Order) error {
+	return r.db.WithContext(ctx).Create(order).Error
+}
+
+func (r *LabOrderRepository) GetByID(ctx context.Context, id uint) (*lab.Order, error) {
+	var order lab.Order
+	err := r.withResults(ctx).First(&order, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("lab order not found")
+	}
+	return &order, err
+}
+
+func (r *LabOrderRepository) GetByAppointment(ctx context.Context, appointmentID uint) ([]lab.Order, error) {
+	var orders []lab.Order
+	err := r.withResults(ctx).Where("appointment_id = ?", appointmentID).Order("id").Find(&orders).Error
+	return orders, err
+}
+
+func (r *LabOrderRepository) List(ctx context.Context, filter lab.OrderFilter) ([]lab.Order, int64, error) {
+	query := r.db.WithContext(ctx).Model(&lab.Order{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.DoctorID != nil {
+		query = query.Where("doctor_id = ?", *filter.DoctorID)
+	}
+	if filter.TreatingDoctorID != nil {
+		patients := r.db.Model(&appointment.Appointment{}).Select("patient_id").Where("doctor_id = ?", *filter.TreatingDoctorID)
+		query = query.Where("doctor_id = ? OR patient_id IN (?)", *filter.TreatingDoctorID, patients)
+	}
+	if filter.ConsentPurpose != "" {
+		query = query.Where("patient_id IN (?)", consentingPatients(r.db, filter.ConsentPurpose))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var orders []lab.Order
+	err := query.Preload("Results", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Order("id").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&orders).Error
+	return orders, total, err
+}
+
+func (r *LabOrderRepository) Save(ctx context.Context, order *lab.Order) error {
+	return r.db.WithContext(ctx).Omit("Results").Save(order).Error
+}
+
+func (r *LabOrderRepository) RecordResult(ctx context.Context, result *lab.Result) (bool, error) {
+	completed := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locking the order serialises the results of one order, so that
+		// exactly one of them sees it complete
+		var order lab.Order
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&order, result.OrderID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("lab order not found")
+		}
+		if err != nil {
+			return err
+		}
+		if order.Status != lab.StatusCollected {
+			return fmt.Errorf("order %d is %s", order.ID, order.Status)
+		}
+
+		updated := tx.Model(result).Where("resulted_at IS NULL").
+			Select("value", "numeric_value", "unit", "ref_low", "ref_high", "ref_text", "flag", "comment",
+				"source", "entered_by_id", "resulted_at").
+			Updates(result)
+		if updated.Error != nil {
+			return updated.Error
+		}
+		if updated.RowsAffected == 0 {
+			return fmt.Errorf("%s of order %d already has a result", result.TestCode, result.OrderID)
+		}
+
+		var pending int64
+		err = tx.Model(&lab.Result{}).Where("order_id = ? AND resulted_at IS NULL", result.OrderID).Count(&pending).Error
+		if err != nil || pending > 0 {
+			return err
+		}
+		completed = true
+		return tx.Model(&order).Updates(map[string]interface{}{
+			"status":      lab.StatusResulted,
+			"resulted_at": time.Now(),
+		}).Error
+	})
+	return completed, err
+}
+
+func (r *LabOrderRepository) GetHistory(ctx context.Context, patientID uint, testCode string) ([]lab.HistoryEntry, error) {
+	query := r.db.WithContext(ctx).Model(&lab.Result{}).
+		Select("lab_results.*, lab_orders.appointment_id, lab_orders.doctor_id, lab_orders.collected_at").
+		Joins("JOIN lab_orders ON lab_orders.id = lab_results.order_id").
+		Where("lab_orders.patient_id = ? AND lab_results.resulted_at IS NOT NULL", patientID)
+	if testCode != "" {
+		query = query.Where("lab_results.test_code = ?", testCode)
+	}
+
+	var entries []lab.HistoryEntry
+	err := query.Order("lab_results.resulted_at DESC, lab_results.id DESC").Scan(&entries).Error
+	return entries, err
+}
+
+func (r *LabOrderRepository) withResults(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Preload("Results", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
+}
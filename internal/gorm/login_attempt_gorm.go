@@ -0,0 +1,68 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"medical-center/internal/models/user"
+	"time"
+)
+
+type LoginAttemptRepository struct {
+	db *gorm.DB
+}
+
+func NewLoginAttemptRepository(db *gorm.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+func (r *LoginAttemptRepository) Get(ctx context.Context, key string) (*user.LoginAttempt, error) {
+	var attempt user.LoginAttempt
+	err := r.db.WithContext(ctx).Where("key = ?", key).First(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (r *LoginAttemptRepository) RecordFailure(ctx context.Context, key string, at, windowStart time.Time) (*user.LoginAttempt, error) {
+	var attempt user.LoginAttempt
+	err := r.db.WithContext(ctx).Raw(`
+		INSERT INTO login_attempts (key, failures, last_failed_at)
+		VALUES (@key, 1, @at)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_attempts.last_failed_at < @window_start
+					OR (login_attempts.locked_until IS NOT NULL AND login_attempts.locked_until <= @at)
+				THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			locked_until = CASE
+				WHEN login_attempts.locked_until <= @at THEN NULL
+				ELSE login_attempts.locked_until
+			END,
+			last_failed_at = @at
+		RETURNING key, failures, last_failed_at, locked_until
+	`, map[string]interface{}{
+		"key":          key,
+		"at":           at,
+		"window_start": windowStart,
+	}).Scan(&attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (r *LoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	return r.db.WithContext(ctx).Model(&user.LoginAttempt{}).
+		Where("key = ?", key).
+		Update("locked_until", until).Error
+}
+
+func (r *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).Where("key = ?", key).Delete(&user.LoginAttempt{}).Error
+}
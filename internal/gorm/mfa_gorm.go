@@ -0,0 +1,48 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"medical-center/internal/models/user"
+	"time"
+)
+
+type MFARecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewMFARecoveryCodeRepository(db *gorm.DB) *MFARecoveryCodeRepository {
+	return &MFARecoveryCodeRepository{db: db}
+}
+
+func (r *MFARecoveryCodeRepository) Replace(ctx context.Context, userID uint, codeHashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&user.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		codes := make([]user.MFARecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, user.MFARecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r *MFARecoveryCodeRepository) Consume(ctx context.Context, userID uint, codeHash string) error {
+	result := r.db.WithContext(ctx).Model(&user.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("recovery code not found")
+	}
+	return nil
+}
+
+func (r *MFARecoveryCodeRepository) DeleteForUser(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&user.MFARecoveryCode{}).Error
+}
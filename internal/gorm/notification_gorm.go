@@ -0,0 +1,34 @@
+package gorm
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"medical-center/internal/models/notification"
+	"strings"
+)
+
+type NotificationRepository struct {
+	db *gorm.DB
+}
+
+func NewNotificationRepository(db *gorm.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+func (r *NotificationRepository) Create(ctx context.Context, n *notification.Notification) error {
+	return r.db.WithContext(ctx).Create(n).Error
+}
+
+func (r *NotificationRepository) GetByRecipient(ctx context.Context, email string) ([]notification.Notification, error) {
+	var notifications []notification.Notification
+	err := r.db.WithContext(ctx).Where("LOWER(recipient) = ?", strings.ToLower(email)).
+		Order("created_at").
+		Find(&notifications).Error
+	return notifications, err
+}
+
+func (r *NotificationRepository) AnonymizeRecipient(ctx context.Context, email, replacement string) error {
+	return r.db.WithContext(ctx).Model(&notification.Notification{}).
+		Where("LOWER(recipient) = ?", strings.ToLower(email)).
+		Update("recipient", replacement).Error
+}
@@ -0,0 +1,38 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"medical-center/internal/models/user"
+	"time"
+)
+
+type OIDCAuthRequestRepository struct {
+	db *gorm.DB
+}
+
+func NewOIDCAuthRequestRepository(db *gorm.DB) *OIDCAuthRequestRepository {
+	return &OIDCAuthRequestRepository{db: db}
+}
+
+func (r *OIDCAuthRequestRepository) Create(ctx context.Context, req *user.OIDCAuthRequest) error {
+	return r.db.WithContext(ctx).Create(req).Error
+}
+
+func (r *OIDCAuthRequestRepository) Consume(ctx context.Context, state string) (*user.OIDCAuthRequest, error) {
+	var reqs []user.OIDCAuthRequest
+	result := r.db.WithContext(ctx).Clauses(clause.Returning{}).Where("state = ?", state).Delete(&reqs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(reqs) == 0 {
+		return nil, errors.New("sso login request not found")
+	}
+	return &reqs[0], nil
+}
+
+func (r *OIDCAuthRequestRepository) DeleteExpired(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&user.OIDCAuthRequest{}).Error
+}
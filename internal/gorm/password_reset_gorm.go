@@ -0,0 +1,49 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"medical-center/internal/models/user"
+	"time"
+)
+
+type PasswordResetRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetRepository(db *gorm.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+func (r *PasswordResetRepository) Create(ctx context.Context, token *user.PasswordResetToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *PasswordResetRepository) GetByHash(ctx context.Context, hash string) (*user.PasswordResetToken, error) {
+	var token user.PasswordResetToken
+	err := r.db.WithContext(ctx).Where("token_hash = ?", hash).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("reset token not found")
+	}
+	return &token, err
+}
+
+func (r *PasswordResetRepository) MarkUsed(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Model(&user.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("reset token already used")
+	}
+	return nil
+}
+
+func (r *PasswordResetRepository) InvalidateForUser(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Model(&user.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,316 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"medical-center/internal/models/allergy"
+	"medical-center/internal/models/appointment"
+	"medical-center/internal/models/attachment"
+	"medical-center/internal/models/encounter"
+	"medical-center/internal/models/hl7msg"
+	"medical-center/internal/models/lab"
+	"medical-center/internal/models/patient"
+	"medical-center/internal/models/prescription"
+	"medical-center/pkg/fieldcrypt"
+	"time"
+)
+
+// Blind index purposes of the patient columns
+const (
+	patientFullNameIndex = "patients.full_name"
+	patientEmailIndex    = "patients.email"
+	patientPhoneIndex    = "patients.phone"
+	patientIINIndex      = "patients.iin"
+)
+
+// PatientRepository stores the name, email, phone and IIN encrypted with
+// cipher, like AppoinmentRepository
+type PatientRepository struct {
+	db     *gorm.DB
+	cipher *fieldcrypt.Cipher
+}
+
+func NewPatientRepository(db *gorm.DB, cipher *fieldcrypt.Cipher) *PatientRepository {
+	return &PatientRepository{db: db, cipher: cipher}
+}
+
+func (r *PatientRepository) Create(ctx context.Context, p *patient.Patient) error {
+	var number int64
+	if err := r.db.WithContext(ctx).Raw("SELECT nextval('patient_mrn_seq')").Scan(&number).Error; err != nil {
+		return err
+	}
+	p.MRN = fmt.Sprintf("%08d", number)
+
+	row, err := r.seal(p, nil)
+	if err != nil {
+		return err
+	}
+	if err := r.db.WithContext(ctx).Create(row).Error; err != nil {
+		return err
+	}
+	p.Model = row.Model
+	return nil
+}
+
+func (r *PatientRepository) GetByID(ctx context.Context, id uint) (*patient.Patient, error) {
+	var p patient.Patient
+	err := r.db.WithContext(ctx).First(&p, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("patient not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, r.open(&p)
+}
+
+func (r *PatientRepository) List(ctx context.Context, filter patient.Filter) ([]patient.Patient, int64, error) {
+	query := r.db.WithContext(ctx).Model(&patient.Patient{})
+	if filter.MRN != "" {
+		query = query.Where("mrn = ?", filter.MRN)
+	}
+	if filter.Name != "" {
+		query = query.Where("full_name_bidx = ?", r.cipher.BlindIndex(patientFullNameIndex, patient.NormalizeName(filter.Name)))
+	}
+	if filter.Email != "" {
+		query = query.Where("email_bidx = ?", r.cipher.BlindIndex(patientEmailIndex, patient.NormalizeEmail(filter.Email)))
+	}
+	if filter.Phone != "" {
+		query = query.Where("phone_bidx = ?", r.cipher.BlindIndex(patientPhoneIndex, patient.NormalizePhone(filter.Phone)))
+	}
+	if filter.IIN != "" {
+		query = query.Where("iin_bidx = ?", r.cipher.BlindIndex(patientIINIndex, filter.IIN))
+	}
+	if filter.DoctorID != nil {
+		query = query.Where("id IN (?)", r.db.Model(&appointment.Appointment{}).Select("patient_id").Where("doctor_id = ?", *filter.DoctorID))
+	}
+	if filter.ConsentPurpose != "" {
+		query = query.Where("id IN (?)", consentingPatients(r.db, filter.ConsentPurpose))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var patients []patient.Patient
+	err := query.Order("id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&patients).Error
+	patients, err = r.openAll(patients, err)
+	return patients, total, err
+}
+
+func (r *PatientRepository) Update(ctx context.Context, p *patient.Patient) error {
+	return r.save(r.db.WithContext(ctx), p)
+}
+
+// save keeps the ciphertext of unchanged fields so that the audit log only
+// shows the fields that were actually edited
+func (r *PatientRepository) save(db *gorm.DB, p *patient.Patient) error {
+	var stored patient.Patient
+	if err := SkipAudit(db).Unscoped().First(&stored, p.ID).Error; err != nil {
+		return err
+	}
+
+	row, err := r.seal(p, &stored)
+	if err != nil {
+		return err
+	}
+	if err := db.Save(row).Error; err != nil {
+		return err
+	}
+	p.Model = row.Model
+	return nil
+}
+
+func (r *PatientRepository) GetByUser(ctx context.Context, userID uint) ([]patient.Patient, error) {
+	var patients []patient.Patient
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&patients).Error
+	return r.openAll(patients, err)
+}
+
+func (r *PatientRepository) FindMatch(ctx context.Context, name, email, phone string) (*patient.Patient, error) {
+	contact := r.db.Where("1 = 0")
+	if email = patient.NormalizeEmail(email); email != "" {
+		contact = contact.Or("email_bidx = ?", r.cipher.BlindIndex(patientEmailIndex, email))
+	}
+	if phone = patient.NormalizePhone(phone); phone != "" {
+		contact = contact.Or("phone_bidx = ?", r.cipher.BlindIndex(patientPhoneIndex, phone))
+	}
+
+	var patients []patient.Patient
+	err := r.db.WithContext(ctx).
+		Where("merged_into_id IS NULL").
+		Where("full_name_bidx = ?", r.cipher.BlindIndex(patientFullNameIndex, patient.NormalizeName(name))).
+		Where(contact).
+		Order("id").
+		Limit(1).
+		Find(&patients).Error
+	if err != nil || len(patients) == 0 {
+		return nil, err
+	}
+	return &patients[0], r.open(&patients[0])
+}
+
+func (r *PatientRepository) FindCandidates(ctx context.Context, p *patient.Patient) ([]patient.Patient, error) {
+	// Empty values all have the same blind index, they must not match
+	shared := r.db.Where("1 = 0")
+	if p.IIN != "" {
+		shared = shared.Or("iin_bidx = ?", r.cipher.BlindIndex(patientIINIndex, p.IIN))
+	}
+	if email := patient.NormalizeEmail(p.Email); email != "" {
+		shared = shared.Or("email_bidx = ?", r.cipher.BlindIndex(patientEmailIndex, email))
+	}
+	if phone := patient.NormalizePhone(p.Phone); phone != "" {
+		shared = shared.Or("phone_bidx = ?", r.cipher.BlindIndex(patientPhoneIndex, phone))
+	}
+	if name := patient.NormalizeName(p.FullName); name != "" {
+		shared = shared.Or("full_name_bidx = ?", r.cipher.BlindIndex(patientFullNameIndex, name))
+	}
+	// Names spelled differently are found through the date of birth
+	if p.BirthDate != nil {
+		shared = shared.Or("birth_date = ?", p.BirthDate.Format("2006-01-02"))
+	}
+
+	var patients []patient.Patient
+	err := r.db.WithContext(ctx).
+		Where("id <> ? AND merged_into_id IS NULL", p.ID).
+		Where(shared).
+		Order("id").
+		Find(&patients).Error
+	return r.openAll(patients, err)
+}
+
+func (r *PatientRepository) Merge(ctx context.Context, survivor, merged *patient.Patient, merge *patient.Merge) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		moved := tx.Model(&appointment.Appointment{}).Unscoped().
+			Where("patient_id = ?", merged.ID).
+			Update("patient_id", survivor.ID)
+		if moved.Error != nil {
+			return moved.Error
+		}
+		merge.Appointments = int(moved.RowsAffected)
+		// Unscoped so that deleted attachments and allergies move along with
+		// the rest
+		for _, model := range []interface{}{
+			&encounter.Note{}, &prescription.Prescription{}, &lab.Order{}, &attachment.Attachment{},
+			&allergy.Allergy{}, &allergy.Condition{}, &allergy.Acknowledgement{}, &hl7msg.Message{},
+		} {
+			err := tx.Unscoped().Model(model).
+				Where("patient_id = ?", merged.ID).
+				Update("patient_id", survivor.ID).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := r.save(tx, survivor); err != nil {
+			return err
+		}
+
+		// Patients merged into merged earlier now point at the survivor, so
+		// that following merged_into_id takes a single step
+		err := tx.Model(&patient.Patient{}).Unscoped().
+			Where("merged_into_id = ?", merged.ID).
+			Update("merged_into_id", survivor.ID).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		err = tx.Model(&patient.Patient{}).
+			Where("id = ? AND merged_into_id IS NULL", merged.ID).
+			Updates(map[string]interface{}{"merged_into_id": survivor.ID, "merged_at": now}).Error
+		if err != nil {
+			return err
+		}
+		merged.MergedIntoID, merged.MergedAt = &survivor.ID, &now
+
+		merge.CreatedAt = now
+		return tx.Create(merge).Error
+	})
+}
+
+func (r *PatientRepository) GetMerges(ctx context.Context, patientID uint) ([]patient.Merge, error) {
+	var merges []patient.Merge
+	err := r.db.WithContext(ctx).
+		Where("survivor_id = ? OR merged_id = ?", patientID, patientID).
+		Order("id DESC").
+		Find(&merges).Error
+	return merges, err
+}
+
+func (r *PatientRepository) Anonymize(ctx context.Context, id uint) error {
+	erased := patient.Patient{FullName: appointment.ErasedPatientName}
+	row, err := r.seal(&erased, nil)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&patient.Patient{}).Unscoped().
+			Where("id = ?", id).
+			Updates(map[string]interface{}{
+				"full_name":      row.FullName,
+				"email":          row.Email,
+				"phone":          row.Phone,
+				"iin":            row.IIN,
+				"birth_date":     nil,
+				"full_name_bidx": row.FullNameIndex,
+				"email_bidx":     row.EmailIndex,
+				"phone_bidx":     row.PhoneIndex,
+				"iin_bidx":       row.IINIndex,
+			}).Error
+		if err != nil {
+			return err
+		}
+		// Logged HL7 messages repeat the details, only their metadata stays
+		return tx.Model(&hl7msg.Message{}).Where("patient_id = ?", id).Update("payload", "").Error
+	})
+}
+
+// seal returns a copy of p ready to be stored. When stored is given, fields
+// whose plaintext did not change reuse its ciphertext.
+func (r *PatientRepository) seal(p, stored *patient.Patient) (*patient.Patient, error) {
+	row := *p
+	fields := []sealedField{{&row.FullName, ""}, {&row.Email, ""}, {&row.Phone, ""}, {&row.IIN, ""}}
+	if stored != nil {
+		fields[0].stored, fields[1].stored, fields[2].stored, fields[3].stored = stored.FullName, stored.Email, stored.Phone, stored.IIN
+	}
+	if err := sealFields(r.cipher, fields); err != nil {
+		return nil, err
+	}
+
+	row.FullNameIndex = r.cipher.BlindIndex(patientFullNameIndex, patient.NormalizeName(p.FullName))
+	row.EmailIndex = r.cipher.BlindIndex(patientEmailIndex, patient.NormalizeEmail(p.Email))
+	row.PhoneIndex = r.cipher.BlindIndex(patientPhoneIndex, patient.NormalizePhone(p.Phone))
+	row.IINIndex = r.cipher.BlindIndex(patientIINIndex, p.IIN)
+	return &row, nil
+}
+
+// open decrypts the personal details in place
+func (r *PatientRepository) open(p *patient.Patient) error {
+	for _, value := range []*string{&p.FullName, &p.Email, &p.Phone, &p.IIN} {
+		plain, err := r.cipher.Decrypt(*value)
+		if err != nil {
+			return err
+		}
+		*value = plain
+	}
+	return nil
+}
+
+func (r *PatientRepository) openAll(patients []patient.Patient, err error) ([]patient.Patient, error) {
+	if err != nil {
+		return patients, err
+	}
+	for i := range patients {
+		if err := r.open(&patients[i]); err != nil {
+			return nil, err
+		}
+	}
+	return patients, nil
+}
@@ -0,0 +1,76 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/models/user"
+)
+
+type PermissionRepository struct {
+	db *gorm.DB
+}
+
+func NewPermissionRepository(db *gorm.DB) *PermissionRepository {
+	return &PermissionRepository{db: db}
+}
+
+func (r *PermissionRepository) GetAll(ctx context.Context) ([]permission.Permission, error) {
+	var perms []permission.Permission
+	err := r.db.WithContext(ctx).Order("name").Find(&perms).Error
+	return perms, err
+}
+
+func (r *PermissionRepository) GetByNames(ctx context.Context, names []string) ([]permission.Permission, error) {
+	var perms []permission.Permission
+	err := r.db.WithContext(ctx).Where("name IN ?", names).Find(&perms).Error
+	return perms, err
+}
+
+func (r *PermissionRepository) GetRoles(ctx context.Context) ([]permission.Role, error) {
+	var roles []permission.Role
+	err := r.db.WithContext(ctx).Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func (r *PermissionRepository) GetRole(ctx context.Context, name user.Role) (*permission.Role, error) {
+	var role permission.Role
+	err := r.db.WithContext(ctx).Where("name = ?", name).First(&role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("role not found")
+	}
+	return &role, err
+}
+
+func (r *PermissionRepository) CreateRole(ctx context.Context, role *permission.Role) error {
+	return r.db.WithContext(ctx).Create(role).Error
+}
+
+func (r *PermissionRepository) GetRolePermissions(ctx context.Context, role user.Role) ([]string, error) {
+	var names []string
+	err := r.db.WithContext(ctx).Model(&permission.Permission{}).
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Where("role_permissions.role = ?", role).
+		Order("permissions.name").
+		Pluck("permissions.name", &names).
+		Error
+	return names, err
+}
+
+func (r *PermissionRepository) SetRolePermissions(ctx context.Context, role user.Role, permissionIDs []uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role = ?", role).Delete(&permission.RolePermission{}).Error; err != nil {
+			return err
+		}
+		if len(permissionIDs) == 0 {
+			return nil
+		}
+
+		links := make([]permission.RolePermission, 0, len(permissionIDs))
+		for _, id := range permissionIDs {
+			links = append(links, permission.RolePermission{Role: role, PermissionID: id})
+		}
+		return tx.Create(&links).Error
+	})
+}
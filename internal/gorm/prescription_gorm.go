@@ -0,0 +1,172 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"medical-center/internal/models/prescription"
+	"strings"
+)
+
+type FormularyRepository struct {
+	db *gorm.DB
+}
+
+func NewFormularyRepository(db *gorm.DB) *FormularyRepository {
+	return &FormularyRepository{db: db}
+}
+
+func (r *FormularyRepository) CreateDrug(ctx context.Context, drug *prescription.Drug) error {
+	return r.db.WithContext(ctx).Create(drug).Error
+}
+
+func (r *FormularyRepository) GetDrug(ctx context.Context, id uint) (*prescription.Drug, error) {
+	var drug prescription.Drug
+	err := r.db.WithContext(ctx).First(&drug, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("drug not found")
+	}
+	return &drug, err
+}
+
+func (r *FormularyRepository) GetDrugByCode(ctx context.Context, code string) (*prescription.Drug, error) {
+	var drugs []prescription.Drug
+	err := r.db.WithContext(ctx).Where("code = ?", code).Limit(1).Find(&drugs).Error
+	if err != nil || len(drugs) == 0 {
+		return nil, err
+	}
+	return &drugs[0], nil
+}
+
+func (r *FormularyRepository) ListDrugs(ctx context.Context, filter prescription.DrugFilter) ([]prescription.Drug, int64, error) {
+	query := r.db.WithContext(ctx).Model(&prescription.Drug{})
+	if !filter.IncludeInactive {
+		query = query.Where("active")
+	}
+	if q := strings.TrimSpace(filter.Query); q != "" {
+		// Escape LIKE wildcards typed by the user
+		pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q)
+		query = query.Where("code ILIKE ? OR name ILIKE ?", pattern+"%", "%"+pattern+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var drugs []prescription.Drug
+	err := query.Order("name, strength").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&drugs).Error
+	return drugs, total, err
+}
+
+func (r *FormularyRepository) UpdateDrug(ctx context.Context, drug *prescription.Drug) error {
+	return r.db.WithContext(ctx).Save(drug).Error
+}
+
+func (r *FormularyRepository) DeactivateExcept(ctx context.Context, codes []string) (int64, error) {
+	query := r.db.WithContext(ctx).Model(&prescription.Drug{}).Where("active")
+	if len(codes) > 0 {
+		query = query.Where("code NOT IN ?", codes)
+	}
+	result := query.Update("active", false)
+	return result.RowsAffected, result.Error
+}
+
+type PrescriptionRepository struct {
+	db *gorm.DB
+}
+
+func NewPrescriptionRepository(db *gorm.DB) *PrescriptionRepository {
+	return &PrescriptionRepository{db: db}
+}
+
+func (r *PrescriptionRepository) Create(ctx context.Context, p *prescription.Prescription) error {
+	return r.db.WithContext(ctx).Create(p).Error
+}
+
+func (r *PrescriptionRepository) GetByID(ctx context.Context, id uint) (*prescription.Prescription, error) {
+	var p prescription.Prescription
+	err := r.withLines(ctx).First(&p, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("prescription not found")
+	}
+	return &p, err
+}
+
+func (r *PrescriptionRepository) GetByVerificationCode(ctx context.Context, code string) (*prescription.Prescription, error) {
+	var p prescription.Prescription
+	err := r.withLines(ctx).Where("verification_code = ?", code).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("prescription not found")
+	}
+	return &p, err
+}
+
+func (r *PrescriptionRepository) GetByAppointment(ctx context.Context, appointmentID uint) ([]prescription.Prescription, error) {
+	var prescriptions []prescription.Prescription
+	err := r.withLines(ctx).Where("appointment_id = ?", appointmentID).Order("id").Find(&prescriptions).Error
+	return prescriptions, err
+}
+
+func (r *PrescriptionRepository) GetIssuedByPatient(ctx context.Context, patientID uint) ([]prescription.Prescription, error) {
+	var prescriptions []prescription.Prescription
+	err := r.withLines(ctx).
+		Where("patient_id = ? AND status = ?", patientID, prescription.StatusIssued).
+		Order("issued_at DESC").
+		Find(&prescriptions).Error
+	return prescriptions, err
+}
+
+func (r *PrescriptionRepository) Save(ctx context.Context, p *prescription.Prescription) error {
+	return r.db.WithContext(ctx).Omit("Lines", "Acknowledgements").Save(p).Error
+}
+
+func (r *PrescriptionRepository) ReplaceLines(ctx context.Context, p *prescription.Prescription) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("prescription_id = ?", p.ID).Delete(&prescription.Line{}).Error; err != nil {
+			return err
+		}
+		for i := range p.Lines {
+			p.Lines[i].ID = 0
+			p.Lines[i].PrescriptionID = p.ID
+		}
+		if len(p.Lines) > 0 {
+			if err := tx.Create(&p.Lines).Error; err != nil {
+				return err
+			}
+		}
+		for i := range p.Acknowledgements {
+			p.Acknowledgements[i].PrescriptionID = &p.ID
+		}
+		if len(p.Acknowledgements) > 0 {
+			if err := tx.Create(&p.Acknowledgements).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Omit("Lines", "Acknowledgements").Save(p).Error
+	})
+}
+
+func (r *PrescriptionRepository) Renew(ctx context.Context, original, renewal *prescription.Prescription) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Only one renewal per prescription, even when renewed concurrently
+		result := tx.Model(&prescription.Prescription{}).
+			Where("id = ? AND status = ?", original.ID, prescription.StatusIssued).
+			Update("status", prescription.StatusRenewed)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("prescription is no longer issued")
+		}
+		original.Status = prescription.StatusRenewed
+		return tx.Create(renewal).Error
+	})
+}
+
+func (r *PrescriptionRepository) withLines(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
+}
@@ -0,0 +1,173 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"medical-center/internal/models/appointment"
+	"medical-center/internal/models/department"
+	"medical-center/internal/models/doctor"
+	"medical-center/internal/models/patient"
+	"medical-center/internal/models/retention"
+	"medical-center/internal/models/schedule"
+	"medical-center/pkg/fieldcrypt"
+	"time"
+)
+
+// foreignKeyViolation is the Postgres error code for a row still referenced
+// by a foreign key
+const foreignKeyViolation = "23503"
+
+// retentionModels maps the entities of retention rules to their models
+var retentionModels = map[string]func() interface{}{
+	"departments":  func() interface{} { return &department.Department{} },
+	"doctors":      func() interface{} { return &doctor.Doctor{} },
+	"schedules":    func() interface{} { return &schedule.Schedule{} },
+	"appointments": func() interface{} { return &appointment.Appointment{} },
+}
+
+type RetentionRuleRepository struct {
+	db *gorm.DB
+}
+
+func NewRetentionRuleRepository(db *gorm.DB) *RetentionRuleRepository {
+	return &RetentionRuleRepository{db: db}
+}
+
+func (r *RetentionRuleRepository) Create(ctx context.Context, rule *retention.Rule) error {
+	return r.db.WithContext(ctx).Create(rule).Error
+}
+
+func (r *RetentionRuleRepository) GetByID(ctx context.Context, id uint) (*retention.Rule, error) {
+	var rule retention.Rule
+	err := r.db.WithContext(ctx).First(&rule, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("retention rule not found")
+	}
+	return &rule, err
+}
+
+func (r *RetentionRuleRepository) GetAll(ctx context.Context) ([]retention.Rule, error) {
+	var rules []retention.Rule
+	err := r.db.WithContext(ctx).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func (r *RetentionRuleRepository) Update(ctx context.Context, rule *retention.Rule) error {
+	return r.db.WithContext(ctx).Save(rule).Error
+}
+
+func (r *RetentionRuleRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&retention.Rule{}, id).Error
+}
+
+type LegalHoldRepository struct {
+	db *gorm.DB
+}
+
+func NewLegalHoldRepository(db *gorm.DB) *LegalHoldRepository {
+	return &LegalHoldRepository{db: db}
+}
+
+func (r *LegalHoldRepository) Create(ctx context.Context, hold *retention.LegalHold) error {
+	return r.db.WithContext(ctx).Create(hold).Error
+}
+
+func (r *LegalHoldRepository) GetByID(ctx context.Context, id uint) (*retention.LegalHold, error) {
+	var hold retention.LegalHold
+	err := r.db.WithContext(ctx).First(&hold, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("legal hold not found")
+	}
+	return &hold, err
+}
+
+func (r *LegalHoldRepository) GetAll(ctx context.Context, activeOnly bool) ([]retention.LegalHold, error) {
+	query := r.db.WithContext(ctx)
+	if activeOnly {
+		query = query.Where("released_at IS NULL")
+	}
+	var holds []retention.LegalHold
+	err := query.Order("id DESC").Find(&holds).Error
+	return holds, err
+}
+
+func (r *LegalHoldRepository) IsHeld(ctx context.Context, userID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&retention.LegalHold{}).
+		Where("user_id = ? AND released_at IS NULL", userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *LegalHoldRepository) Update(ctx context.Context, hold *retention.LegalHold) error {
+	return r.db.WithContext(ctx).Save(hold).Error
+}
+
+// RetentionRepository matches held patients to appointments through the
+// email blind index, so it needs the cipher of the appointments
+type RetentionRepository struct {
+	db           *gorm.DB
+	appointments *AppoinmentRepository
+}
+
+func NewRetentionRepository(db *gorm.DB, cipher *fieldcrypt.Cipher) *RetentionRepository {
+	return &RetentionRepository{db: db, appointments: NewAppoinmentRepository(db, cipher)}
+}
+
+func (r *RetentionRepository) FindExpired(ctx context.Context, rule retention.Rule, cutoff time.Time, heldEmails []string) ([]uint, int, error) {
+	newModel, ok := retentionModels[rule.Entity]
+	if !ok || !retention.Supports(rule.Entity, rule.Action) {
+		return nil, 0, fmt.Errorf("unsupported retention rule: %s %s", rule.Action, rule.Entity)
+	}
+
+	// Only IDs are read, this is not an access to patient data
+	query := SkipAudit(r.db.WithContext(ctx)).Unscoped().Model(newModel())
+	switch rule.Action {
+	case retention.ActionPurgeDeleted:
+		query = query.Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff)
+	case retention.ActionAnonymize:
+		erased := r.appointments.cipher.BlindIndex(patientNameIndex, patient.NormalizeName(appointment.ErasedPatientName))
+		query = query.Where("appointment_time < ? AND patient_name_bidx <> ?", cutoff, erased)
+	}
+
+	held := 0
+	if rule.Entity == "appointments" && len(heldEmails) > 0 {
+		indexes := make([]string, len(heldEmails))
+		for i, email := range heldEmails {
+			indexes[i] = r.appointments.cipher.BlindIndex(emailIndex, patient.NormalizeEmail(email))
+		}
+		var count int64
+		if err := query.Session(&gorm.Session{}).Where("email_bidx IN ?", indexes).Count(&count).Error; err != nil {
+			return nil, 0, err
+		}
+		held = int(count)
+		query = query.Where("email_bidx NOT IN ?", indexes)
+	}
+
+	var ids []uint
+	err := query.Order("id").Pluck("id", &ids).Error
+	return ids, held, err
+}
+
+func (r *RetentionRepository) Purge(ctx context.Context, entity string, id uint) error {
+	newModel, ok := retentionModels[entity]
+	if !ok {
+		return fmt.Errorf("unsupported retention entity: %s", entity)
+	}
+
+	err := r.db.WithContext(ctx).Unscoped().
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Delete(newModel()).Error
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+		return retention.ErrStillReferenced
+	}
+	return err
+}
+
+func (r *RetentionRepository) Anonymize(ctx context.Context, id uint) error {
+	return r.appointments.anonymize(ctx, id)
+}
@@ -1,6 +1,7 @@
 package gorm
 
 import (
+	"context"
 	"errors"
 	"gorm.io/gorm"
 	"medical-center/internal/models/schedule"
@@ -15,34 +16,34 @@ func NewScheduleRepository(db *gorm.DB) *ScheduleRepository {
 	return &ScheduleRepository{db: db}
 }
 
-func (r *ScheduleRepository) Create(slot *schedule.Schedule) error {
+func (r *ScheduleRepository) Create(ctx context.Context, slot *schedule.Schedule) error {
 	if err := slot.IsValid(); err != nil {
 		return err
 	}
-	return r.db.Create(slot).Error
+	return r.db.WithContext(ctx).Create(slot).Error
 }
 
-func (r *ScheduleRepository) GetByID(id uint) (*schedule.Schedule, error) {
+func (r *ScheduleRepository) GetByID(ctx context.Context, id uint) (*schedule.Schedule, error) {
 	var slot schedule.Schedule
-	err := r.db.First(&slot, id).Error
+	err := r.db.WithContext(ctx).First(&slot, id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, errors.New("schedule slot not found")
 	}
 	return &slot, err
 }
 
-func (r *ScheduleRepository) GetByDoctor(doctorID uint) ([]schedule.Schedule, error) {
+func (r *ScheduleRepository) GetByDoctor(ctx context.Context, doctorID uint) ([]schedule.Schedule, error) {
 	var slots []schedule.Schedule
-	err := r.db.Where("doctor_id = ?", doctorID).Find(&slots).Error
+	err := r.db.WithContext(ctx).Where("doctor_id = ?", doctorID).Find(&slots).Error
 	return slots, err
 }
 
-func (r *ScheduleRepository) GetAvailable(doctorID uint, date time.Time) ([]schedule.Schedule, error) {
+func (r *ScheduleRepository) GetAvailable(ctx context.Context, doctorID uint, date time.Time) ([]schedule.Schedule, error) {
 	start := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
 	end := start.Add(24 * time.Hour)
 
 	var slots []schedule.Schedule
-	err := r.db.Where(
+	err := r.db.WithContext(ctx).Where(
 		"doctor_id = ? AND booked = ? AND start_time BETWEEN ? AND ?",
 		doctorID,
 		false,
@@ -53,25 +54,63 @@ func (r *ScheduleRepository) GetAvailable(doctorID uint, date time.Time) ([]sche
 	return slots, err
 }
 
-func (r *ScheduleRepository) Update(slot *schedule.Schedule) error {
+func (r *ScheduleRepository) Update(ctx context.Context, slot *schedule.Schedule) error {
 	if err := slot.IsValid(); err != nil {
 		return err
 	}
-	return r.db.Save(slot).Error
+	return r.db.WithContext(ctx).Save(slot).Error
 }
 
-func (r *ScheduleRepository) Delete(id uint) error {
-	return r.db.Delete(&schedule.Schedule{}, id).Error
+func (r *ScheduleRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&schedule.Schedule{}, id).Error
 }
 
-func (r *ScheduleRepository) BookSlot(id uint) error {
-	return r.db.Model(&schedule.Schedule{}).
+func (r *ScheduleRepository) BookSlot(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Model(&schedule.Schedule{}).
 		Where("id = ? AND booked = ?", id, false).
-		Update("booked", true).Error
+		Update("booked", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := r.GetByID(ctx, id); err != nil {
+			return err
+		}
+		return schedule.ErrAlreadyBooked
+	}
+	return nil
 }
 
-func (r *ScheduleRepository) CancelBooking(id uint) error {
-	return r.db.Model(&schedule.Schedule{}).
+func (r *ScheduleRepository) CancelBooking(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&schedule.Schedule{}).
 		Where("id = ? AND booked = ?", id, true).
 		Update("booked", false).Error
 }
+
+func (r *ScheduleRepository) Search(ctx context.Context, filter schedule.SearchFilter) ([]schedule.Schedule, int64, error) {
+	query := r.db.WithContext(ctx).Model(&schedule.Schedule{})
+	if filter.DoctorID != nil {
+		query = query.Where("doctor_id = ?", *filter.DoctorID)
+	}
+	if filter.From != nil {
+		query = query.Where("start_time >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("start_time < ?", *filter.To)
+	}
+	if filter.Booked != nil {
+		query = query.Where("booked = ?", *filter.Booked)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var slots []schedule.Schedule
+	err := query.Order("start_time, id").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&slots).Error
+	return slots, total, err
+}
@@ -0,0 +1,35 @@
+package gorm
+
+import "medical-center/pkg/fieldcrypt"
+
+// sealedField is a column to encrypt in place. stored is its current
+// ciphertext, if any.
+type sealedField struct {
+	value  *string
+	stored string
+}
+
+// sealFields encrypts the plaintext of each field. Fields whose plaintext
+// did not change reuse their stored ciphertext, re-wrapped if it was written
+// under a retired key, so that updates only touch the edited columns.
+func sealFields(cipher *fieldcrypt.Cipher, fields []sealedField) error {
+	for _, field := range fields {
+		plain := *field.value
+		if field.stored != "" {
+			if current, err := cipher.Decrypt(field.stored); err == nil && current == plain {
+				sealed, err := cipher.Rewrap(field.stored)
+				if err != nil {
+					return err
+				}
+				*field.value = sealed
+				continue
+			}
+		}
+		sealed, err := cipher.Encrypt(plain)
+		if err != nil {
+			return err
+		}
+		*field.value = sealed
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"medical-center/internal/models/user"
+	"time"
+)
+
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+func (r *SessionRepository) Create(ctx context.Context, session *user.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *SessionRepository) GetByID(ctx context.Context, id string) (*user.Session, error) {
+	var session user.Session
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("session not found")
+	}
+	return &session, err
+}
+
+func (r *SessionRepository) GetActiveByUser(ctx context.Context, userID uint, now time.Time) ([]user.Session, error) {
+	var sessions []user.Session
+	err := r.db.WithContext(ctx).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *SessionRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&user.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at).Error
+}
+
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID uint, exceptID string, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&user.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptID).
+		Update("revoked_at", at).Error
+}
+
+func (r *SessionRepository) TouchLastSeen(ctx context.Context, id string, at time.Time) error {
+	return SkipAudit(r.db.WithContext(ctx)).Model(&user.Session{}).
+		Where("id = ?", id).
+		Update("last_seen_at", at).Error
+}
+
+func (r *SessionRepository) DeleteByUser(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&user.Session{}).Error
+}
@@ -1,8 +1,11 @@
 package gorm
 
 import (
+	"context"
 	"medical-center/internal/models/user"
 	"medical-center/internal/repository"
+	"strings"
+
 	"gorm.io/gorm"
 )
 
@@ -14,32 +17,69 @@ func NewUserRepository(db *gorm.DB) repository.UserRepository {
 	return &userRepository{db: db}
 }
 
-func (r *userRepository) Create(user *user.User) error {
-	return r.db.Create(user).Error
+func (r *userRepository) Create(ctx context.Context, user *user.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
 }
 
-func (r *userRepository) GetByID(id uint) (*user.User, error) {
+func (r *userRepository) GetByID(ctx context.Context, id uint) (*user.User, error) {
 	var user user.User
-	err := r.db.First(&user, id).Error
+	err := r.db.WithContext(ctx).First(&user, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *userRepository) GetByEmail(email string) (*user.User, error) {
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*user.User, error) {
 	var user user.User
-	err := r.db.Where("email = ?", email).First(&user).Error
+	err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *userRepository) Update(user *user.User) error {
-	return r.db.Save(user).Error
+func (r *userRepository) GetByOIDCSubject(ctx context.Context, subject string) (*user.User, error) {
+	var user user.User
+	err := r.db.WithContext(ctx).Where("oidc_subject = ?", subject).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *userRepository) Update(ctx context.Context, user *user.User) error {
+	return r.db.WithContext(ctx).Save(user).Error
+}
+
+func (r *userRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&user.User{}, id).Error
 }
 
-func (r *userRepository) Delete(id uint) error {
-	return r.db.Delete(&user.User{}, id).Error
-} 
\ No newline at end of file
+func (r *userRepository) List(ctx context.Context, filter user.ListFilter) ([]user.User, int64, error) {
+	query := r.db.WithContext(ctx).Model(&user.User{})
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Email != "" {
+		query = query.Where("LOWER(email) LIKE ?", "%"+strings.ToLower(filter.Email)+"%")
+	}
+	if filter.DoctorID != nil {
+		query = query.Where("doctor_id = ?", *filter.DoctorID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []user.User
+	err := query.Order("id").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&users).Error
+	return users, total, err
+}
@@ -0,0 +1,374 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/allergy"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/service"
+)
+
+type AllergyHandler struct {
+	service *service.AllergyService
+	access  *service.RecordAccessService
+}
+
+func NewAllergyHandler(s *service.AllergyService, access *service.RecordAccessService) *AllergyHandler {
+	return &AllergyHandler{service: s, access: access}
+}
+
+func (h *AllergyHandler) ListAllergies(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	if !canReadPatient(c, h.access, uint(patientID), permission.PatientsRead, permission.AllergiesRead) {
+		return
+	}
+
+	allergies, err := h.service.ListAllergies(c.Request.Context(), uint(patientID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, allergies)
+}
+
+func (h *AllergyHandler) AddAllergy(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	var input allergy.AllergyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if !canReadPatient(c, h.access, uint(patientID), permission.PatientsRead) {
+		return
+	}
+
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Allergies are only recorded by users"})
+		return
+	}
+	a, err := h.service.AddAllergy(c.Request.Context(), actor.ID, uint(patientID), input)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, a)
+}
+
+func (h *AllergyHandler) UpdateAllergy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid allergy ID"})
+		return
+	}
+	var input allergy.AllergyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	a, err := h.service.GetAllergy(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !canReadPatient(c, h.access, a.PatientID, permission.PatientsRead) {
+		return
+	}
+	a, err = h.service.UpdateAllergy(c.Request.Context(), uint(id), input)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
+
+func (h *AllergyHandler) RemoveAllergy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid allergy ID"})
+		return
+	}
+
+	a, err := h.service.GetAllergy(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !canReadPatient(c, h.access, a.PatientID, permission.PatientsRead) {
+		return
+	}
+	if err := h.service.RemoveAllergy(c.Request.Context(), uint(id)); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AllergyHandler) ListConditions(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	if !canReadPatient(c, h.access, uint(patientID), permission.PatientsRead, permission.AllergiesRead) {
+		return
+	}
+
+	conditions, err := h.service.ListConditions(c.Request.Context(), uint(patientID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, conditions)
+}
+
+func (h *AllergyHandler) AddCondition(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	var input allergy.ConditionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if !canReadPatient(c, h.access, uint(patientID), permission.PatientsRead) {
+		return
+	}
+
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Conditions are only recorded by users"})
+		return
+	}
+	condition, err := h.service.AddCondition(c.Request.Context(), actor.ID, uint(patientID), input)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, condition)
+}
+
+func (h *AllergyHandler) UpdateCondition(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid condition ID"})
+		return
+	}
+	var input allergy.ConditionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	condition, err := h.service.GetCondition(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !canReadPatient(c, h.access, condition.PatientID, permission.PatientsRead) {
+		return
+	}
+	condition, err = h.service.UpdateCondition(c.Request.Context(), uint(id), input)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, condition)
+}
+
+func (h *AllergyHandler) RemoveCondition(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid condition ID"})
+		return
+	}
+
+	condition, err := h.service.GetCondition(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !canReadPatient(c, h.access, condition.PatientID, permission.PatientsRead) {
+		return
+	}
+	if err := h.service.RemoveCondition(c.Request.Context(), uint(id)); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AllergyHandler) ListAcknowledgements(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	if !canReadPatient(c, h.access, uint(patientID), permission.PatientsRead, permission.AllergiesRead) {
+		return
+	}
+
+	acks, err := h.service.ListAcknowledgements(c.Request.Context(), uint(patientID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, acks)
+}
+
+func (h *AllergyHandler) ListProcedures(c *gin.Context) {
+	procedures, err := h.service.ListProcedures(c.Request.Context(), c.Query("include_inactive") == "true")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, procedures)
+}
+
+func (h *AllergyHandler) GetProcedure(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid procedure ID"})
+		return
+	}
+
+	p, err := h.service.GetProcedure(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *AllergyHandler) CreateProcedure(c *gin.Context) {
+	var input allergy.ProcedureInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	p, err := h.service.CreateProcedure(c.Request.Context(), input)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, p)
+}
+
+func (h *AllergyHandler) UpdateProcedure(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid procedure ID"})
+		return
+	}
+	var input allergy.ProcedureInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if _, err := h.service.GetProcedure(c.Request.Context(), uint(id)); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	p, err := h.service.UpdateProcedure(c.Request.Context(), uint(id), input)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+// SetProcedure sets the procedure of an appointment, a null procedure_id
+// clears it. Warnings are acknowledged by the doctor in acknowledgements.
+func (h *AllergyHandler) SetProcedure(c *gin.Context) {
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	var request struct {
+		ProcedureID      *uint              `json:"procedure_id"`
+		Acknowledgements []allergy.AckInput `json:"acknowledgements" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	doctorID, err := h.service.AppointmentDoctor(c.Request.Context(), uint(appointmentID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !middleware.HasPermission(c, permission.AppointmentsWriteAll) && !isDoctor(c, &doctorID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return
+	}
+	if len(request.Acknowledgements) > 0 && !isDoctor(c, nil) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Only doctors can acknowledge allergy warnings"})
+		return
+	}
+
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Procedures are only set by users"})
+		return
+	}
+	assignment, err := h.service.SetProcedure(c.Request.Context(), actor.ID, uint(appointmentID), request.ProcedureID, request.Acknowledgements)
+	if respondAllergyWarnings(c, err) {
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, assignment)
+}
+
+// isDoctor reports whether the caller has a doctor profile, the profile
+// doctorID when given
+func isDoctor(c *gin.Context, doctorID *uint) bool {
+	u, ok := middleware.CurrentUser(c)
+	return ok && u.DoctorID != nil && (doctorID == nil || *u.DoctorID == *doctorID)
+}
+
+// respondAllergyWarnings writes a 409 response listing the warnings left to
+// acknowledge if err is an allergy.UnacknowledgedError
+func respondAllergyWarnings(c *gin.Context, err error) bool {
+	var unacknowledged *allergy.UnacknowledgedError
+	if !errors.As(err, &unacknowledged) {
+		return false
+	}
+	c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": unacknowledged.Error(), "warnings": unacknowledged.Warnings})
+	return true
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/consent"
+	"medical-center/internal/service"
+)
+
+type APIKeyHandler struct {
+	service *service.APIKeyService
+}
+
+func NewAPIKeyHandler(s *service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{service: s}
+}
+
+func (h *APIKeyHandler) CreateServiceAccount(c *gin.Context) {
+	var request struct {
+		Name           string          `json:"name" binding:"required"`
+		Description    string          `json:"description"`
+		ConsentPurpose consent.Purpose `json:"consent_purpose"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	account, err := h.service.CreateServiceAccount(c.Request.Context(), request.Name, request.Description, request.ConsentPurpose, actor.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, account)
+}
+
+func (h *APIKeyHandler) GetServiceAccounts(c *gin.Context) {
+	accounts, err := h.service.GetServiceAccounts(c.Request.Context())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, accounts)
+}
+
+func (h *APIKeyHandler) GetKeys(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID"})
+		return
+	}
+
+	keys, err := h.service.GetKeys(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// IssueKey creates an API key. The key itself is only shown in this response.
+func (h *APIKeyHandler) IssueKey(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID"})
+		return
+	}
+
+	var request struct {
+		Name      string     `json:"name" binding:"required"`
+		Scopes    []string   `json:"scopes" binding:"required"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	rawKey, key, err := h.service.IssueKey(c.Request.Context(), uint(id), request.Name, request.Scopes, request.ExpiresAt)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"key": rawKey, "api_key": key})
+}
+
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	accountID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID"})
+		return
+	}
+	keyID, err := strconv.ParseUint(c.Param("key_id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	if err := h.service.RevokeKey(c.Request.Context(), uint(accountID), uint(keyID)); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -3,22 +3,28 @@ package handler
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/appointment"
+	"medical-center/internal/models/permission"
 	"medical-center/internal/service"
 )
 
 type AppointmentHandler struct {
-	service *service.AppointmentService
+	service  *service.AppointmentService
+	consents *service.ConsentService
 }
 
-func NewAppointmentHandler(s *service.AppointmentService) *AppointmentHandler {
-	return &AppointmentHandler{service: s}
+func NewAppointmentHandler(s *service.AppointmentService, consents *service.ConsentService) *AppointmentHandler {
+	return &AppointmentHandler{service: s, consents: consents}
 }
 
 func (h *AppointmentHandler) CreateAppointment(c *gin.Context) {
 	var request struct {
+		PatientID       *uint     `json:"patient_id"`
 		PatientName     string    `json:"patient_name"`
 		Email           string    `json:"email"`
 		Phone           string    `json:"phone"`
@@ -32,7 +38,14 @@ func (h *AppointmentHandler) CreateAppointment(c *gin.Context) {
 		return
 	}
 
+	if !h.canLinkPatient(c, request.PatientID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return
+	}
+
 	appt, err := h.service.CreateAppointment(
+		c.Request.Context(),
+		request.PatientID,
 		request.PatientName,
 		request.Email,
 		request.Phone,
@@ -56,12 +69,17 @@ func (h *AppointmentHandler) GetAppointment(c *gin.Context) {
 		return
 	}
 
-	appt, err := h.service.GetAppointmentByID(uint(id))
+	appt, err := h.service.GetAppointmentByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
+	if !h.canAccess(c, appt, permission.AppointmentsReadAll) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return
+	}
+
 	c.JSON(http.StatusOK, appt)
 }
 
@@ -74,6 +92,7 @@ func (h *AppointmentHandler) UpdateAppointment(c *gin.Context) {
 	}
 
 	var request struct {
+		PatientID       *uint     `json:"patient_id"`
 		PatientName     string    `json:"patient_name"`
 		Email           string    `json:"email"`
 		Phone           string    `json:"phone"`
@@ -87,8 +106,26 @@ func (h *AppointmentHandler) UpdateAppointment(c *gin.Context) {
 		return
 	}
 
+	existing, err := h.service.GetAppointmentByID(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.canAccess(c, existing, permission.AppointmentsWriteAll) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return
+	}
+
+	if !h.canLinkPatient(c, request.PatientID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return
+	}
+
 	appt, err := h.service.UpdateAppointment(
+		c.Request.Context(),
 		uint(id),
+		request.PatientID,
 		request.PatientName,
 		request.Email,
 		request.Phone,
@@ -105,13 +142,22 @@ func (h *AppointmentHandler) UpdateAppointment(c *gin.Context) {
 }
 
 func (h *AppointmentHandler) GetAllAppointments(c *gin.Context) {
-	appointments, err := h.service.GetAllAppointments()
+	var appointments []appointment.Appointment
+	var err error
+	if middleware.HasPermission(c, permission.AppointmentsReadAll) {
+		appointments, err = h.service.GetAllAppointments(c.Request.Context())
+	} else if u, ok := middleware.CurrentUser(c); ok {
+		appointments, err = h.service.GetOwnedBy(c.Request.Context(), u)
+	} else {
+		// Service accounts own no appointments
+		appointments = []appointment.Appointment{}
+	}
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, appointments)
+	c.JSON(http.StatusOK, h.shareable(c, appointments))
 }
 
 func (h *AppointmentHandler) GetAppointmentsByDepartment(c *gin.Context) {
@@ -122,11 +168,74 @@ func (h *AppointmentHandler) GetAppointmentsByDepartment(c *gin.Context) {
 		return
 	}
 
-	appointments, err := h.service.GetByDepartment(uint(deptID))
+	appointments, err := h.service.GetByDepartment(c.Request.Context(), uint(deptID))
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, appointments)
+	if !middleware.HasPermission(c, permission.AppointmentsReadAll) {
+		owned := make([]appointment.Appointment, 0, len(appointments))
+		for i := range appointments {
+			if h.canAccess(c, &appointments[i], permission.AppointmentsReadAll) {
+				owned = append(owned, appointments[i])
+			}
+		}
+		appointments = owned
+	}
+
+	c.JSON(http.StatusOK, h.shareable(c, appointments))
+}
+
+// canAccess reports whether the caller holds the ".all" permission or owns
+// the appointment. External partners also need the patient's consent.
+func (h *AppointmentHandler) canAccess(c *gin.Context, appt *appointment.Appointment, allPermission string) bool {
+	if middleware.HasPermission(c, allPermission) {
+		return len(h.shareable(c, []appointment.Appointment{*appt})) == 1
+	}
+	u, ok := middleware.CurrentUser(c)
+	return ok && h.service.IsOwnedBy(appt, u)
+}
+
+// canLinkPatient reports whether the caller may pick the patient of an
+// appointment. Booking for a patient fills in their details, so it takes
+// access to the patient index.
+func (h *AppointmentHandler) canLinkPatient(c *gin.Context, patientID *uint) bool {
+	return patientID == nil || middleware.HasPermission(c, permission.PatientsRead)
+}
+
+func (h *AppointmentHandler) shareable(c *gin.Context, appointments []appointment.Appointment) []appointment.Appointment {
+	return shareableAppointments(c, h.consents, appointments)
+}
+
+// isPartner reports whether the caller is an external partner, which only
+// sees the appointments of patients who consented to its purpose
+func isPartner(c *gin.Context) bool {
+	return partnerPurpose(c) != ""
+}
+
+// shareableAppointments leaves out the appointments of patients who have
+// not consented to sharing their data with the calling partner. Callers
+// other than external partners get every appointment.
+func shareableAppointments(c *gin.Context, consents *service.ConsentService, appointments []appointment.Appointment) []appointment.Appointment {
+	purpose := partnerPurpose(c)
+	if purpose == "" {
+		return appointments
+	}
+
+	allowedByEmail := map[string]bool{}
+	shared := make([]appointment.Appointment, 0, len(appointments))
+	for _, appt := range appointments {
+		email := strings.ToLower(appt.Email)
+		allowed, seen := allowedByEmail[email]
+		if !seen {
+			// Errors count as no consent
+			allowed, _ = consents.AllowedForEmail(c.Request.Context(), appt.Email, purpose)
+			allowedByEmail[email] = allowed
+		}
+		if allowed {
+			shared = append(shared, appt)
+		}
+	}
+	return shared
 }
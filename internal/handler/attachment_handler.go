@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/attachment"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/service"
+)
+
+// multipartOverhead is allowed on top of the file size for the other form
+// fields and the multipart framing
+const multipartOverhead = 1 << 20
+
+type AttachmentHandler struct {
+	service *service.AttachmentService
+	access  *service.RecordAccessService
+}
+
+func NewAttachmentHandler(s *service.AttachmentService, access *service.RecordAccessService) *AttachmentHandler {
+	return &AttachmentHandler{service: s, access: access}
+}
+
+func (h *AttachmentHandler) UploadPatientAttachment(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	id := uint(patientID)
+	if !canReadPatient(c, h.access, id, permission.PatientsRead) {
+		return
+	}
+	h.upload(c, &id, nil)
+}
+
+func (h *AttachmentHandler) GetPatientAttachments(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	if !canReadPatient(c, h.access, uint(patientID), permission.PatientsRead, permission.AttachmentsRead) {
+		return
+	}
+
+	attachments, err := h.service.GetByPatient(c.Request.Context(), uint(patientID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, attachments)
+}
+
+func (h *AttachmentHandler) UploadAppointmentAttachment(c *gin.Context) {
+	appointmentID, ok := h.appointment(c, permission.AppointmentsReadAll)
+	if !ok {
+		return
+	}
+	h.upload(c, nil, &appointmentID)
+}
+
+func (h *AttachmentHandler) GetAppointmentAttachments(c *gin.Context) {
+	appointmentID, ok := h.appointment(c, permission.AppointmentsReadAll, permission.AttachmentsRead)
+	if !ok {
+		return
+	}
+
+	attachments, err := h.service.GetByAppointment(c.Request.Context(), appointmentID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, attachments)
+}
+
+func (h *AttachmentHandler) GetAttachment(c *gin.Context) {
+	a, ok := h.authorize(c, permission.AttachmentsRead)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
+
+// GetDownloadURL issues a signed URL that downloads the attachment without
+// the Authorization header, e.g. from a browser tab
+func (h *AttachmentHandler) GetDownloadURL(c *gin.Context) {
+	a, ok := h.authorize(c, permission.AttachmentsRead)
+	if !ok {
+		return
+	}
+	u, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Download links are only issued to users"})
+		return
+	}
+
+	signed, err := h.service.SignURL(c.Request.Context(), a, u.ID)
+	if errors.Is(err, attachment.ErrNotScanned) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, signed)
+}
+
+// Download is public, the signed token in the URL stands for the user it
+// was issued to
+func (h *AttachmentHandler) Download(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	a, body, err := h.service.Open(c.Request.Context(), uint(id), c.Query("token"))
+	if errors.Is(err, attachment.ErrLinkInvalid) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, attachment.ErrNotScanned) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": a.FileName})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	c.DataFromReader(http.StatusOK, a.Size, a.ContentType, body, map[string]string{
+		"Content-Disposition":    disposition,
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, no-store",
+	})
+}
+
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	a, ok := h.authorize(c, permission.AttachmentsDelete)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), a.ID); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// upload reads the "file" field of a multipart form, with an optional
+// "description"
+func (h *AttachmentHandler) upload(c *gin.Context, patientID, appointmentID *uint) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.service.MaxSize()+multipartOverhead)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "A multipart form with a file field is required"})
+		return
+	}
+	defer file.Close()
+
+	a, err := h.service.Upload(c.Request.Context(), enteredBy(c), patientID, appointmentID, header.Filename, c.Request.FormValue("description"), file)
+	switch {
+	case errors.Is(err, attachment.ErrTooLarge):
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, attachment.ErrContentTypeRefused):
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, attachment.ErrInfected):
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusCreated, a)
+	}
+}
+
+// appointment parses the appointment ID and checks that the caller may see
+// the appointment. It aborts the request and returns false otherwise.
+func (h *AttachmentHandler) appointment(c *gin.Context, allPermissions ...string) (uint, bool) {
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return 0, false
+	}
+	if !canReadAppointment(c, h.access, uint(appointmentID), allPermissions...) {
+		return 0, false
+	}
+	return uint(appointmentID), true
+}
+
+// authorize loads the attachment and checks that the caller may see what it
+// belongs to. attachmentPermission together with patients.read or
+// appointments.read.all covers every attachment, otherwise only those of the
+// caller's patients. It aborts the request and returns false otherwise.
+func (h *AttachmentHandler) authorize(c *gin.Context, attachmentPermission string) (*attachment.Attachment, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return nil, false
+	}
+
+	a, err := h.service.Get(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	switch {
+	case a.PatientID != nil:
+		if !canReadPatient(c, h.access, *a.PatientID, permission.PatientsRead, attachmentPermission) {
+			return nil, false
+		}
+	case a.AppointmentID != nil:
+		if !canReadAppointment(c, h.access, *a.AppointmentID, permission.AppointmentsReadAll, attachmentPermission) {
+			return nil, false
+		}
+	default:
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return nil, false
+	}
+	return a, true
+}
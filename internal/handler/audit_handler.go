@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"medical-center/internal/models/audit"
+	"medical-center/internal/service"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	service *service.AuditService
+}
+
+func NewAuditHandler(s *service.AuditService) *AuditHandler {
+	return &AuditHandler{service: s}
+}
+
+// ListEntries returns audit log entries, newest first. Dates accept either
+// RFC 3339 timestamps or YYYY-MM-DD; a plain "to" date includes that day.
+func (h *AuditHandler) ListEntries(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	filter := audit.Filter{
+		ActorType: c.Query("actor_type"),
+		Entity:    c.Query("entity"),
+		EntityID:  c.Query("entity_id"),
+		Action:    c.Query("action"),
+		Page:      page,
+		PageSize:  pageSize,
+	}
+	if actorID := c.Query("actor_id"); actorID != "" {
+		id, err := strconv.ParseUint(actorID, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid actor_id"})
+			return
+		}
+		filter.ActorID = uint(id)
+	}
+
+	var err error
+	if filter.From, err = parseAuditDate(c.Query("from"), false); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+		return
+	}
+	if filter.To, err = parseAuditDate(c.Query("to"), true); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+		return
+	}
+
+	entries, total, err := h.service.ListEntries(c.Request.Context(), filter)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries":   entries,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// Verify checks the hash chain of the whole log against the stored
+// checkpoints and, when entry_id and hash are given, a checkpoint copied
+// from the application log
+func (h *AuditHandler) Verify(c *gin.Context) {
+	var anchors []audit.Checkpoint
+	if entryID := c.Query("entry_id"); entryID != "" {
+		id, err := strconv.ParseUint(entryID, 10, 64)
+		if err != nil || c.Query("hash") == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "entry_id and hash are required together"})
+			return
+		}
+		anchors = append(anchors, audit.Checkpoint{EntryID: uint(id), Hash: c.Query("hash")})
+	}
+
+	result, err := h.service.Verify(c.Request.Context(), anchors...)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *AuditHandler) ListCheckpoints(c *gin.Context) {
+	checkpoints, err := h.service.ListCheckpoints(c.Request.Context())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, checkpoints)
+}
+
+func (h *AuditHandler) CreateCheckpoint(c *gin.Context) {
+	checkpoint, err := h.service.Checkpoint(c.Request.Context())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if checkpoint == nil {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "The audit log is empty"})
+		return
+	}
+	c.JSON(http.StatusCreated, checkpoint)
+}
+
+func parseAuditDate(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
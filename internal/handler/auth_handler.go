@@ -1,9 +1,14 @@
 package handler
 
 import (
-	"net/http"
-	"medical-center/internal/models/user"
+	"errors"
+	"log"
+	"math"
+	"medical-center/internal/middleware"
 	"medical-center/internal/service"
+	"medical-center/pkg/passwords"
+	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,10 +23,32 @@ type LoginRequest struct {
 }
 
 type RegisterRequest struct {
-	Email    string    `json:"email" binding:"required,email"`
-	Password string    `json:"password" binding:"required,min=6"`
-	Name     string    `json:"name" binding:"required"`
-	Role     user.Role `json:"role"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type VerifyMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
 }
 
 func NewAuthHandler(authService service.AuthService) *AuthHandler {
@@ -36,18 +63,16 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	
-	// If role is not specified or invalid, default to patient
-	if req.Role == "" || (req.Role != user.RoleAdmin && req.Role != user.RoleDoctor && req.Role != user.RolePatient) {
-		req.Role = user.RolePatient
+
+	user, err := h.authService.Register(c.Request.Context(), req.Email, req.Password, req.Name)
+	if respondPasswordPolicy(c, err) {
+		return
 	}
-	
-	user, err := h.authService.Register(req.Email, req.Password, req.Name, req.Role)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	
+
 	c.JSON(http.StatusCreated, gin.H{"user": user})
 }
 
@@ -57,16 +82,155 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	
-	token, err := h.authService.Login(req.Email, req.Password)
+
+	result, err := h.authService.Login(c.Request.Context(), req.Email, req.Password, clientInfo(c))
+	if respondThrottled(c, err) {
+		return
+	}
+	// Only reported after the password has been verified
+	if errors.Is(err, service.ErrAccountDisabled) || errors.Is(err, service.ErrPasswordResetRequired) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
-	
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req VerifyMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.authService.VerifyMFA(c.Request.Context(), req.MFAToken, req.Code, clientInfo(c))
+	if respondThrottled(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"token": token})
 }
 
+func (h *AuthHandler) BeginMFAEnrollment(c *gin.Context) {
+	u, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	enrollment, err := h.authService.BeginMFAEnrollment(c.Request.Context(), u)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+func (h *AuthHandler) ConfirmMFAEnrollment(c *gin.Context) {
+	u, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	confirmation, err := h.authService.ConfirmMFAEnrollment(c.Request.Context(), u, req.Code, clientInfo(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, confirmation)
+}
+
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	u, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.DisableMFA(c.Request.Context(), u, req.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	p, ok := middleware.CurrentPrincipal(c)
+	if !ok || !p.IsUser() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.authService.ChangePassword(c.Request.Context(), p.User, p.SessionID, req.CurrentPassword, req.NewPassword, clientInfo(c))
+	if respondThrottled(c, err) || respondPasswordPolicy(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been changed"})
+}
+
+func clientInfo(c *gin.Context) service.ClientInfo {
+	return service.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// respondThrottled writes a 429 response if err is a login throttling error
+func respondThrottled(c *gin.Context, err error) bool {
+	var throttled *service.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": throttled.Error()})
+	return true
+}
+
+// respondPasswordPolicy reports every rule a rejected password breaks
+func respondPasswordPolicy(c *gin.Context, err error) bool {
+	var policyErr *passwords.PolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Error(), "reasons": policyErr.Reasons})
+	return true
+}
+
 func (h *AuthHandler) Me(c *gin.Context) {
 	// The user is already extracted in AuthMiddleware
 	user, exists := c.Get("user")
@@ -74,6 +238,71 @@ func (h *AuthHandler) Me(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	
+
 	c.JSON(http.StatusOK, gin.H{"user": user})
-} 
\ No newline at end of file
+}
+
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		log.Printf("password reset request failed: %v", err)
+	}
+
+	// Same response whether or not the account exists
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account with this email exists, a password reset link has been sent"})
+}
+
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.authService.ResetPassword(c.Request.Context(), req.Token, req.Password)
+	if respondPasswordPolicy(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token parameter is required"})
+		return
+	}
+
+	user, err := h.authService.VerifyEmail(c.Request.Context(), token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email address verified", "user": user})
+}
+
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	u, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.authService.SendVerificationEmail(c.Request.Context(), u); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/breakglass"
+	"medical-center/internal/service"
+)
+
+type BreakGlassHandler struct {
+	service *service.BreakGlassService
+}
+
+func NewBreakGlassHandler(s *service.BreakGlassService) *BreakGlassHandler {
+	return &BreakGlassHandler{service: s}
+}
+
+// Declare starts emergency access for the caller
+func (h *BreakGlassHandler) Declare(c *gin.Context) {
+	u, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	grant, err := h.service.Declare(c.Request.Context(), u, request.Reason)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, grant)
+}
+
+// Active returns the caller's active emergency access, or 404
+func (h *BreakGlassHandler) Active(c *gin.Context) {
+	u, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	grant, err := h.service.ActiveGrant(c.Request.Context(), u.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if grant == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "No emergency access is active"})
+		return
+	}
+
+	c.JSON(http.StatusOK, grant)
+}
+
+// End closes the caller's emergency access before it expires
+func (h *BreakGlassHandler) End(c *gin.Context) {
+	u, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.service.End(c.Request.Context(), u.ID); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *BreakGlassHandler) GetGrants(c *gin.Context) {
+	var userID uint
+	if value := c.Query("user_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		userID = uint(id)
+	}
+
+	grants, err := h.service.GetGrants(c.Request.Context(), userID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, grants)
+}
+
+// ListAccesses is the review queue; ?review_status=pending shows what is
+// left to review
+func (h *BreakGlassHandler) ListAccesses(c *gin.Context) {
+	filter, ok := accessFilter(c)
+	if !ok {
+		return
+	}
+
+	accesses, total, err := h.service.ListAccesses(c.Request.Context(), filter)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accesses":  accesses,
+		"total":     total,
+		"page":      filter.Page,
+		"page_size": filter.PageSize,
+	})
+}
+
+// ExportAccesses downloads the matching accesses as CSV, e.g.
+// ?review_status=misuse for a misuse report
+func (h *BreakGlassHandler) ExportAccesses(c *gin.Context) {
+	filter, ok := accessFilter(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.service.ExportCSV(c.Request.Context(), &buf, filter); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := "break-glass-" + time.Now().Format("20060102T150405") + ".csv"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+func (h *BreakGlassHandler) ReviewAccess(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid access ID"})
+		return
+	}
+	request, ok := reviewRequest(c)
+	if !ok {
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	access, err := h.service.ReviewAccess(c.Request.Context(), actor.ID, uint(id), request.Status, request.Note)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, access)
+}
+
+// ReviewGrant reviews every pending access made under a grant
+func (h *BreakGlassHandler) ReviewGrant(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid grant ID"})
+		return
+	}
+	request, ok := reviewRequest(c)
+	if !ok {
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	reviewed, err := h.service.ReviewGrant(c.Request.Context(), actor.ID, uint(id), request.Status, request.Note)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reviewed": reviewed})
+}
+
+type breakGlassReview struct {
+	Status breakglass.ReviewStatus `json:"status" binding:"required"`
+	Note   string                  `json:"note"`
+}
+
+func reviewRequest(c *gin.Context) (*breakGlassReview, bool) {
+	var request breakGlassReview
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return nil, false
+	}
+	return &request, true
+}
+
+// accessFilter reads the access filter from the query; dates take the same
+// formats as the audit log
+func accessFilter(c *gin.Context) (breakglass.AccessFilter, bool) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	filter := breakglass.AccessFilter{
+		ReviewStatus: breakglass.ReviewStatus(c.Query("review_status")),
+		Page:         page,
+		PageSize:     pageSize,
+	}
+	for param, target := range map[string]*uint{"user_id": &filter.UserID, "grant_id": &filter.GrantID} {
+		if value := c.Query(param); value != "" {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return filter, false
+			}
+			*target = uint(id)
+		}
+	}
+
+	var err error
+	if filter.From, err = parseAuditDate(c.Query("from"), false); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+		return filter, false
+	}
+	if filter.To, err = parseAuditDate(c.Query("to"), true); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+		return filter, false
+	}
+	return filter, true
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/consent"
+	"medical-center/internal/service"
+)
+
+type ConsentHandler struct {
+	service *service.ConsentService
+}
+
+func NewConsentHandler(s *service.ConsentService) *ConsentHandler {
+	return &ConsentHandler{service: s}
+}
+
+// MyConsents returns the caller's current choice for every purpose
+func (h *ConsentHandler) MyConsents(c *gin.Context) {
+	p, ok := middleware.CurrentPrincipal(c)
+	if !ok || !p.IsUser() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	h.consents(c, p.ID)
+}
+
+func (h *ConsentHandler) MyConsentHistory(c *gin.Context) {
+	p, ok := middleware.CurrentPrincipal(c)
+	if !ok || !p.IsUser() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	h.history(c, p.ID)
+}
+
+// RecordMyConsent grants or withdraws a consent of the caller through the web
+func (h *ConsentHandler) RecordMyConsent(c *gin.Context) {
+	p, ok := middleware.CurrentPrincipal(c)
+	if !ok || !p.IsUser() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Purpose consent.Purpose `json:"purpose" binding:"required"`
+		Granted *bool           `json:"granted" binding:"required"`
+		Version string          `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	record, err := h.service.Record(c.Request.Context(), p.ID, p.ID, request.Purpose, *request.Granted, request.Version, consent.ChannelWeb)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, record)
+}
+
+func (h *ConsentHandler) GetUserConsents(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	h.consents(c, uint(id))
+}
+
+func (h *ConsentHandler) GetUserConsentHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	h.history(c, uint(id))
+}
+
+// RecordUserConsent records a consent given on paper, by phone or in
+// person on behalf of the patient
+func (h *ConsentHandler) RecordUserConsent(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request struct {
+		Purpose consent.Purpose `json:"purpose" binding:"required"`
+		Granted *bool           `json:"granted" binding:"required"`
+		Version string          `json:"version"`
+		Channel consent.Channel `json:"channel" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	record, err := h.service.Record(c.Request.Context(), actor.ID, uint(id), request.Purpose, *request.Granted, request.Version, request.Channel)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, record)
+}
+
+func (h *ConsentHandler) consents(c *gin.Context, userID uint) {
+	statuses, err := h.service.GetConsents(c.Request.Context(), userID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, statuses)
+}
+
+func (h *ConsentHandler) history(c *gin.Context, userID uint) {
+	records, err := h.service.GetHistory(c.Request.Context(), userID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, records)
+}
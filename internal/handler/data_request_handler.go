@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/datarequest"
+	"medical-center/internal/service"
+)
+
+type DataRequestHandler struct {
+	service *service.DataRequestService
+}
+
+func NewDataRequestHandler(s *service.DataRequestService) *DataRequestHandler {
+	return &DataRequestHandler{service: s}
+}
+
+// ExportMyData returns the caller's data as a downloadable JSON file
+func (h *DataRequestHandler) ExportMyData(c *gin.Context) {
+	p, ok := middleware.CurrentPrincipal(c)
+	if !ok || !p.IsUser() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	h.export(c, p.ID, p.ID)
+}
+
+// MyRequests lists the caller's export and erasure requests
+func (h *DataRequestHandler) MyRequests(c *gin.Context) {
+	p, ok := middleware.CurrentPrincipal(c)
+	if !ok || !p.IsUser() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	h.list(c, datarequest.ListFilter{UserID: p.ID, Page: page, PageSize: pageSize})
+}
+
+// RequestMyErasure asks for the caller's data to be erased
+func (h *DataRequestHandler) RequestMyErasure(c *gin.Context) {
+	p, ok := middleware.CurrentPrincipal(c)
+	if !ok || !p.IsUser() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	req, err := h.service.RequestErasure(c.Request.Context(), p.ID, p.ID, request.Reason)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, req)
+}
+
+func (h *DataRequestHandler) ListRequests(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	filter := datarequest.ListFilter{
+		Type:     datarequest.Type(c.Query("type")),
+		Status:   datarequest.Status(c.Query("status")),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := strconv.ParseUint(userID, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		filter.UserID = uint(id)
+	}
+	h.list(c, filter)
+}
+
+// ExportUserData exports the data of a patient on their behalf, e.g. for a
+// request received by letter
+func (h *DataRequestHandler) ExportUserData(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	h.export(c, actor.ID, uint(id))
+}
+
+// RequestUserErasure files an erasure request on behalf of a patient
+func (h *DataRequestHandler) RequestUserErasure(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	req, err := h.service.RequestErasure(c.Request.Context(), actor.ID, uint(id), request.Reason)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, req)
+}
+
+// ApproveErasure erases the patient's data. It cannot be undone.
+func (h *DataRequestHandler) ApproveErasure(c *gin.Context) {
+	h.resolve(c, h.service.ApproveErasure)
+}
+
+func (h *DataRequestHandler) RejectErasure(c *gin.Context) {
+	h.resolve(c, h.service.RejectErasure)
+}
+
+func (h *DataRequestHandler) export(c *gin.Context, actorID, userID uint) {
+	export, err := h.service.Export(c.Request.Context(), actorID, userID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("data-export-%d-%s.json", userID, export.GeneratedAt.Format("20060102T150405"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.IndentedJSON(http.StatusOK, export)
+}
+
+func (h *DataRequestHandler) list(c *gin.Context, filter datarequest.ListFilter) {
+	requests, total, err := h.service.List(c.Request.Context(), filter)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requests":  requests,
+		"total":     total,
+		"page":      filter.Page,
+		"page_size": filter.PageSize,
+	})
+}
+
+type resolveFunc func(ctx context.Context, actorID, requestID uint, note string) (*datarequest.Request, error)
+
+func (h *DataRequestHandler) resolve(c *gin.Context, fn resolveFunc) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	var request struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	req, err := fn(c.Request.Context(), actor.ID, uint(id), request.Note)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
@@ -26,7 +26,7 @@ func (h *DepartmentHandler) CreateDepartment(c *gin.Context) {
 		return
 	}
 
-	dept, err := h.service.CreateDepartment(request.Name)
+	dept, err := h.service.CreateDepartment(c.Request.Context(), request.Name)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -43,7 +43,7 @@ func (h *DepartmentHandler) GetDepartment(c *gin.Context) {
 		return
 	}
 
-	dept, err := h.service.GetDepartmentByID(uint(id))
+	dept, err := h.service.GetDepartmentByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -69,7 +69,7 @@ func (h *DepartmentHandler) UpdateDepartment(c *gin.Context) {
 		return
 	}
 
-	dept, err := h.service.UpdateDepartment(uint(id), request.Name)
+	dept, err := h.service.UpdateDepartment(c.Request.Context(), uint(id), request.Name)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -79,7 +79,7 @@ func (h *DepartmentHandler) UpdateDepartment(c *gin.Context) {
 }
 
 func (h *DepartmentHandler) GetAllDepartments(c *gin.Context) {
-	depts, err := h.service.GetAllDepartments()
+	depts, err := h.service.GetAllDepartments(c.Request.Context())
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -102,7 +102,7 @@ func (h *DepartmentHandler) GetDepartmentSlots(c *gin.Context) {
 		return
 	}
 
-	slots, err := h.service.GetAvailableSlots(uint(id), date)
+	slots, err := h.service.GetAvailableSlots(c.Request.Context(), uint(id), date)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/diagnosis"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/service"
+)
+
+// maxICDCatalogueSize limits the size of an imported ICD-10 catalogue
+const maxICDCatalogueSize = 20 << 20
+
+type DiagnosisHandler struct {
+	service *service.DiagnosisService
+	access  *service.RecordAccessService
+}
+
+func NewDiagnosisHandler(s *service.DiagnosisService, access *service.RecordAccessService) *DiagnosisHandler {
+	return &DiagnosisHandler{service: s, access: access}
+}
+
+// ListCodes searches the catalogue by code prefix ("J45", "j450") or by
+// words of the titles ("бронх астм", "asthma")
+func (h *DiagnosisHandler) ListCodes(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	filter := diagnosis.CodeFilter{
+		Query:           c.Query("q"),
+		IncludeInactive: c.Query("include_inactive") == "true",
+		Page:            page,
+		PageSize:        pageSize,
+	}
+	codes, total, err := h.service.ListCodes(c.Request.Context(), filter)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"codes":     codes,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (h *DiagnosisHandler) GetCode(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid code ID"})
+		return
+	}
+
+	code, err := h.service.GetCode(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, code)
+}
+
+// ImportCodes reads the catalogue as CSV from the request body
+func (h *DiagnosisHandler) ImportCodes(c *gin.Context) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxICDCatalogueSize)
+	result, err := h.service.Import(c.Request.Context(), body, c.Query("deactivate_missing") == "true")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *DiagnosisHandler) GetAppointmentDiagnoses(c *gin.Context) {
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	if !canReadAppointment(c, h.access, uint(appointmentID), permission.DiagnosesRead) {
+		return
+	}
+
+	diagnoses, err := h.service.GetByAppointment(c.Request.Context(), uint(appointmentID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, diagnoses)
+}
+
+func (h *DiagnosisHandler) AddDiagnosis(c *gin.Context) {
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	var input diagnosis.Input
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	doctorID, err := h.service.AppointmentDoctor(c.Request.Context(), uint(appointmentID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !canWriteDiagnosis(c, doctorID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	d, err := h.service.Add(c.Request.Context(), actor.ID, uint(appointmentID), input)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, d)
+}
+
+func (h *DiagnosisHandler) UpdateDiagnosis(c *gin.Context) {
+	id, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		Kind    diagnosis.Kind `json:"kind"`
+		Comment string         `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	d, err := h.service.Update(c.Request.Context(), id, request.Kind, request.Comment)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, d)
+}
+
+func (h *DiagnosisHandler) RemoveDiagnosis(c *gin.Context) {
+	id, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Remove(c.Request.Context(), id); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// TopDiagnoses reports the most frequent primary diagnoses per department;
+// kind=all counts secondary diagnoses too and group=category counts by
+// three-character category
+func (h *DiagnosisHandler) TopDiagnoses(c *gin.Context) {
+	var filter diagnosis.ReportFilter
+	if value := c.Query("department_id"); value != "" {
+		departmentID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid department ID"})
+			return
+		}
+		id := uint(departmentID)
+		filter.DepartmentID = &id
+	}
+	var err error
+	if filter.From, err = parseAuditDate(c.Query("from"), false); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+		return
+	}
+	if filter.To, err = parseAuditDate(c.Query("to"), true); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+		return
+	}
+	if kind := c.DefaultQuery("kind", string(diagnosis.KindPrimary)); kind != "all" {
+		filter.Kind = diagnosis.Kind(kind)
+	}
+	filter.GroupBy = c.Query("group")
+	filter.Limit, _ = strconv.Atoi(c.Query("limit"))
+
+	rows, err := h.service.TopDiagnoses(c.Request.Context(), filter)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"diagnoses": rows})
+}
+
+// authorize parses the diagnosis ID and checks that the caller may write the
+// diagnoses of its appointment. It aborts the request and returns false
+// otherwise.
+func (h *DiagnosisHandler) authorize(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid diagnosis ID"})
+		return 0, false
+	}
+
+	d, err := h.service.Get(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	doctorID, err := h.service.AppointmentDoctor(c.Request.Context(), d.AppointmentID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	if !canWriteDiagnosis(c, doctorID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return 0, false
+	}
+	return d.ID, true
+}
+
+// canWriteDiagnosis reports whether the caller holds the ".all" permission
+// or is the doctor doctorID of the appointment
+func canWriteDiagnosis(c *gin.Context, doctorID uint) bool {
+	if middleware.HasPermission(c, permission.DiagnosesWriteAll) {
+		return true
+	}
+	u, ok := middleware.CurrentUser(c)
+	return ok && u.DoctorID != nil && *u.DoctorID == doctorID
+}
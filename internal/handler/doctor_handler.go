@@ -5,6 +5,8 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/permission"
 	"medical-center/internal/service"
 )
 
@@ -27,7 +29,7 @@ func (h *DoctorHandler) CreateDoctor(c *gin.Context) {
 		return
 	}
 
-	doctor, err := h.service.CreateDoctor(request.Name, request.DepartmentID)
+	doctor, err := h.service.CreateDoctor(c.Request.Context(), request.Name, request.DepartmentID)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -44,7 +46,7 @@ func (h *DoctorHandler) GetDoctor(c *gin.Context) {
 		return
 	}
 
-	doctor, err := h.service.GetDoctorByID(uint(id))
+	doctor, err := h.service.GetDoctorByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -71,7 +73,7 @@ func (h *DoctorHandler) UpdateDoctor(c *gin.Context) {
 		return
 	}
 
-	doctor, err := h.service.UpdateDoctor(uint(id), request.Name, request.DepartmentID)
+	doctor, err := h.service.UpdateDoctor(c.Request.Context(), uint(id), request.Name, request.DepartmentID)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -81,7 +83,7 @@ func (h *DoctorHandler) UpdateDoctor(c *gin.Context) {
 }
 
 func (h *DoctorHandler) GetAllDoctors(c *gin.Context) {
-	doctors, err := h.service.GetAllDoctors()
+	doctors, err := h.service.GetAllDoctors(c.Request.Context())
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -98,6 +100,11 @@ func (h *DoctorHandler) SetAvailability(c *gin.Context) {
 		return
 	}
 
+	if !canManageDoctor(c, uint(id), permission.DoctorsAvailabilityWriteAll) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return
+	}
+
 	var request struct {
 		Available bool `json:"available"`
 	}
@@ -107,10 +114,20 @@ func (h *DoctorHandler) SetAvailability(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.SetAvailability(uint(id), request.Available); err != nil {
+	if err := h.service.SetAvailability(c.Request.Context(), uint(id), request.Available); err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
+
+// canManageDoctor reports whether the caller may act on the doctor either
+// through the ".all" permission or because the doctor profile is their own
+func canManageDoctor(c *gin.Context, doctorID uint, allPermission string) bool {
+	if middleware.HasPermission(c, allPermission) {
+		return true
+	}
+	u, ok := middleware.CurrentUser(c)
+	return ok && u.DoctorID != nil && *u.DoctorID == doctorID
+}
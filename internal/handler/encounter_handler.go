@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/encounter"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/service"
+)
+
+type EncounterHandler struct {
+	service *service.EncounterService
+}
+
+func NewEncounterHandler(s *service.EncounterService) *EncounterHandler {
+	return &EncounterHandler{service: s}
+}
+
+func (h *EncounterHandler) GetNote(c *gin.Context) {
+	id, ok := h.authorize(c, permission.EncountersReadAll)
+	if !ok {
+		return
+	}
+
+	note, err := h.service.GetNote(c.Request.Context(), id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, note)
+}
+
+// SaveDraft is called by the editor whenever the draft changes
+func (h *EncounterHandler) SaveDraft(c *gin.Context) {
+	id, ok := h.authorize(c, permission.EncountersWriteAll)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		encounter.Content
+		// Version is the version the draft was based on, 0 for a new note
+		Version int `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	note, err := h.service.SaveDraft(c.Request.Context(), actor.ID, id, request.Content, request.Version)
+	if err != nil {
+		abortWithNoteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, note)
+}
+
+func (h *EncounterHandler) Sign(c *gin.Context) {
+	id, ok := h.authorize(c, permission.EncountersWriteAll)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Version int `json:"version" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	note, err := h.service.Sign(c.Request.Context(), actor.ID, id, request.Version)
+	if err != nil {
+		abortWithNoteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, note)
+}
+
+func (h *EncounterHandler) AddAddendum(c *gin.Context) {
+	id, ok := h.authorize(c, permission.EncountersWriteAll)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Text string `json:"text" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	addendum, err := h.service.AddAddendum(c.Request.Context(), actor.ID, id, request.Text)
+	if err != nil {
+		abortWithNoteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, addendum)
+}
+
+func (h *EncounterHandler) GetVersions(c *gin.Context) {
+	id, ok := h.authorize(c, permission.EncountersReadAll)
+	if !ok {
+		return
+	}
+
+	versions, err := h.service.GetVersions(c.Request.Context(), id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// authorize parses the appointment ID and checks that the caller holds the
+// ".all" permission or is the treating doctor. It aborts the request and
+// returns false otherwise.
+func (h *EncounterHandler) authorize(c *gin.Context, allPermission string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return 0, false
+	}
+
+	doctorID, err := h.service.DoctorOf(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	if !middleware.HasPermission(c, allPermission) {
+		u, ok := middleware.CurrentUser(c)
+		if !ok || u.DoctorID == nil || *u.DoctorID != doctorID {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+			return 0, false
+		}
+	}
+	return uint(id), true
+}
+
+func abortWithNoteError(c *gin.Context, err error) {
+	if errors.Is(err, encounter.ErrVersionConflict) || errors.Is(err, encounter.ErrSigned) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,303 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/appointment"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/models/schedule"
+	"medical-center/internal/service"
+	"medical-center/pkg/fhir"
+)
+
+// FHIRHandler serves the FHIR R4 facade. Responses and errors are FHIR
+// resources, errors being an OperationOutcome.
+type FHIRHandler struct {
+	service  *service.FHIRService
+	consents *service.ConsentService
+	// baseURL is the public URL of the application, links in bundles are
+	// absolute
+	baseURL string
+	started time.Time
+}
+
+func NewFHIRHandler(s *service.FHIRService, consents *service.ConsentService, baseURL string) *FHIRHandler {
+	return &FHIRHandler{service: s, consents: consents, baseURL: strings.TrimSuffix(baseURL, "/"), started: time.Now()}
+}
+
+// Metadata returns the CapabilityStatement of the facade
+func (h *FHIRHandler) Metadata(c *gin.Context) {
+	read := []fhir.CapabilityInteraction{{Code: "read"}, {Code: "search-type"}}
+	param := func(name, kind string) fhir.CapabilitySearchParam {
+		return fhir.CapabilitySearchParam{Name: name, Type: kind}
+	}
+
+	writeFHIR(c, http.StatusOK, &fhir.CapabilityStatement{
+		Base:        fhir.Base{ResourceType: "CapabilityStatement"},
+		Status:      "active",
+		Date:        h.started,
+		Kind:        "instance",
+		FHIRVersion: fhir.Version,
+		Format:      []string{fhir.ContentType, "json"},
+		Rest: []fhir.CapabilityRest{{
+			Mode: "server",
+			Resource: []fhir.CapabilityResource{
+				{Type: "Organization", Interaction: read, SearchParam: []fhir.CapabilitySearchParam{param("_id", "token"), param("name", "string")}},
+				{Type: "HealthcareService", Interaction: read, SearchParam: []fhir.CapabilitySearchParam{param("_id", "token"), param("name", "string"), param("organization", "reference")}},
+				{Type: "Practitioner", Interaction: read, SearchParam: []fhir.CapabilitySearchParam{param("_id", "token"), param("name", "string")}},
+				{Type: "PractitionerRole", Interaction: read, SearchParam: []fhir.CapabilitySearchParam{param("_id", "token"), param("practitioner", "reference"), param("organization", "reference"), param("active", "token")}},
+				{Type: "Schedule", Interaction: read, SearchParam: []fhir.CapabilitySearchParam{param("_id", "token"), param("actor", "reference"), param("active", "token")}},
+				{Type: "Slot", Interaction: read, SearchParam: []fhir.CapabilitySearchParam{param("schedule", "reference"), param("start", "date"), param("status", "token")}},
+				{
+					Type:        "Appointment",
+					Interaction: append([]fhir.CapabilityInteraction{{Code: "create"}}, read...),
+					SearchParam: []fhir.CapabilitySearchParam{param("date", "date"), param("practitioner", "reference"), param("status", "token")},
+				},
+			},
+		}},
+	})
+}
+
+func (h *FHIRHandler) SearchOrganizations(c *gin.Context) {
+	h.search(c, h.service.SearchOrganizations)
+}
+
+func (h *FHIRHandler) GetOrganization(c *gin.Context) {
+	h.read(c, func(ctx context.Context, id uint) (fhir.Resource, error) {
+		return h.service.GetOrganization(ctx, id)
+	})
+}
+
+func (h *FHIRHandler) SearchHealthcareServices(c *gin.Context) {
+	h.search(c, h.service.SearchHealthcareServices)
+}
+
+func (h *FHIRHandler) GetHealthcareService(c *gin.Context) {
+	h.read(c, func(ctx context.Context, id uint) (fhir.Resource, error) {
+		return h.service.GetHealthcareService(ctx, id)
+	})
+}
+
+func (h *FHIRHandler) SearchPractitioners(c *gin.Context) {
+	h.search(c, h.service.SearchPractitioners)
+}
+
+func (h *FHIRHandler) GetPractitioner(c *gin.Context) {
+	h.read(c, func(ctx context.Context, id uint) (fhir.Resource, error) {
+		return h.service.GetPractitioner(ctx, id)
+	})
+}
+
+func (h *FHIRHandler) SearchPractitionerRoles(c *gin.Context) {
+	h.search(c, h.service.SearchPractitionerRoles)
+}
+
+func (h *FHIRHandler) GetPractitionerRole(c *gin.Context) {
+	h.read(c, func(ctx context.Context, id uint) (fhir.Resource, error) {
+		return h.service.GetPractitionerRole(ctx, id)
+	})
+}
+
+func (h *FHIRHandler) SearchSchedules(c *gin.Context) {
+	h.search(c, h.service.SearchSchedules)
+}
+
+func (h *FHIRHandler) GetSchedule(c *gin.Context) {
+	h.read(c, func(ctx context.Context, id uint) (fhir.Resource, error) {
+		return h.service.GetSchedule(ctx, id)
+	})
+}
+
+func (h *FHIRHandler) SearchSlots(c *gin.Context) {
+	h.search(c, h.service.SearchSlots)
+}
+
+func (h *FHIRHandler) GetSlot(c *gin.Context) {
+	h.read(c, func(ctx context.Context, id uint) (fhir.Resource, error) {
+		return h.service.GetSlot(ctx, id)
+	})
+}
+
+// SearchAppointments applies the rules of the appointment list: the ".all"
+// permission, narrowed to consenting patients for partners, or the
+// caller's own appointments
+func (h *FHIRHandler) SearchAppointments(c *gin.Context) {
+	access := service.FHIRAccess{}
+	if middleware.HasPermission(c, permission.AppointmentsReadAll) {
+		if isPartner(c) {
+			access.Keep = func(appointments []appointment.Appointment) []appointment.Appointment {
+				return shareableAppointments(c, h.consents, appointments)
+			}
+		}
+	} else if u, ok := middleware.CurrentUser(c); ok {
+		access.Owner = u
+	} else {
+		// Service accounts own no appointments
+		access.Keep = func([]appointment.Appointment) []appointment.Appointment { return nil }
+	}
+
+	h.search(c, func(ctx context.Context, q fhir.Query) (*service.FHIRSearchResult, error) {
+		return h.service.SearchAppointments(ctx, q, access)
+	})
+}
+
+func (h *FHIRHandler) GetAppointment(c *gin.Context) {
+	h.read(c, func(ctx context.Context, id uint) (fhir.Resource, error) {
+		appt, err := h.service.GetAppointment(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !h.canSee(c, appt) {
+			return nil, errFHIRForbidden
+		}
+		return h.service.AppointmentResource(appt), nil
+	})
+}
+
+// CreateAppointment books the posted Appointment like the booking endpoint
+// does. Referring to a patient of the index takes patients.read and booking
+// a slot takes schedules.book.
+func (h *FHIRHandler) CreateAppointment(c *gin.Context) {
+	var in fhir.Appointment
+	if err := json.NewDecoder(c.Request.Body).Decode(&in); err != nil || in.ResourceType != "Appointment" {
+		fhirError(c, http.StatusBadRequest, fhir.IssueInvalid, "An Appointment resource is required")
+		return
+	}
+
+	if ref := in.Actor("Patient"); ref != nil && !strings.HasPrefix(ref.Reference, "#") && !middleware.HasPermission(c, permission.PatientsRead) {
+		fhirError(c, http.StatusForbidden, fhir.IssueForbidden, "Insufficient privileges")
+		return
+	}
+	if len(in.Slot) > 0 && !middleware.HasPermission(c, permission.SchedulesBook) {
+		fhirError(c, http.StatusForbidden, fhir.IssueForbidden, "Insufficient privileges")
+		return
+	}
+
+	created, err := h.service.CreateAppointment(c.Request.Context(), &in)
+	if errors.Is(err, schedule.ErrAlreadyBooked) {
+		fhirError(c, http.StatusConflict, fhir.IssueConflict, err.Error())
+		return
+	}
+	if err != nil {
+		fhirError(c, http.StatusBadRequest, fhir.IssueInvalid, err.Error())
+		return
+	}
+
+	c.Header("Location", h.fullURL(created))
+	writeFHIR(c, http.StatusCreated, created)
+}
+
+// canSee reports whether the caller holds appointments.read.all, and for
+// partners the patient's consent, or owns the appointment
+func (h *FHIRHandler) canSee(c *gin.Context, appt *appointment.Appointment) bool {
+	if middleware.HasPermission(c, permission.AppointmentsReadAll) {
+		return len(shareableAppointments(c, h.consents, []appointment.Appointment{*appt})) == 1
+	}
+	u, ok := middleware.CurrentUser(c)
+	return ok && h.service.IsOwnedBy(appt, u)
+}
+
+// errFHIRForbidden is returned by read callbacks that refuse the caller
+var errFHIRForbidden = errors.New("insufficient privileges")
+
+// read serves the resource with the ID in the path
+func (h *FHIRHandler) read(c *gin.Context, get func(context.Context, uint) (fhir.Resource, error)) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		fhirError(c, http.StatusNotFound, fhir.IssueNotFound, "Resource not found")
+		return
+	}
+
+	resource, err := get(c.Request.Context(), uint(id))
+	if errors.Is(err, errFHIRForbidden) {
+		fhirError(c, http.StatusForbidden, fhir.IssueForbidden, "Insufficient privileges")
+		return
+	}
+	if err != nil {
+		fhirError(c, http.StatusNotFound, fhir.IssueNotFound, err.Error())
+		return
+	}
+
+	writeFHIR(c, http.StatusOK, resource)
+}
+
+// search serves a searchset Bundle with links to the other pages
+func (h *FHIRHandler) search(c *gin.Context, find func(context.Context, fhir.Query) (*service.FHIRSearchResult, error)) {
+	result, err := find(c.Request.Context(), fhir.Query(c.Request.URL.Query()))
+	if errors.Is(err, fhir.ErrInvalidParam) {
+		fhirError(c, http.StatusBadRequest, fhir.IssueInvalid, err.Error())
+		return
+	}
+	if err != nil {
+		fhirError(c, http.StatusInternalServerError, fhir.IssueException, err.Error())
+		return
+	}
+
+	total := result.Total
+	bundle := &fhir.Bundle{
+		Base:  fhir.Base{ResourceType: "Bundle"},
+		Type:  "searchset",
+		Total: &total,
+		Entry: make([]fhir.BundleEntry, 0, len(result.Resources)),
+	}
+	for _, r := range result.Resources {
+		bundle.Entry = append(bundle.Entry, fhir.BundleEntry{
+			FullURL:  h.fullURL(r),
+			Resource: r,
+			Search:   &fhir.BundleEntrySearch{Mode: "match"},
+		})
+	}
+
+	lastPage := int((total + int64(result.Count) - 1) / int64(result.Count))
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	link := func(relation string, page int) {
+		query := c.Request.URL.Query()
+		query.Set("_page", strconv.Itoa(page))
+		query.Set("_count", strconv.Itoa(result.Count))
+		bundle.Link = append(bundle.Link, fhir.BundleLink{
+			Relation: relation,
+			URL:      h.baseURL + c.Request.URL.Path + "?" + query.Encode(),
+		})
+	}
+	link("self", result.Page)
+	link("first", 1)
+	if result.Page > 1 {
+		link("previous", min(result.Page-1, lastPage))
+	}
+	if result.Page < lastPage {
+		link("next", result.Page+1)
+	}
+	link("last", lastPage)
+
+	writeFHIR(c, http.StatusOK, bundle)
+}
+
+// fullURL is the absolute URL of a resource
+func (h *FHIRHandler) fullURL(r fhir.Resource) string {
+	return h.baseURL + "/api/v1/fhir/" + r.Reference()
+}
+
+func writeFHIR(c *gin.Context, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(status, fhir.ContentType+"; charset=utf-8", body)
+}
+
+// fhirError aborts the request with an OperationOutcome
+func fhirError(c *gin.Context, status int, code, diagnostics string) {
+	c.Abort()
+	writeFHIR(c, status, fhir.NewOperationOutcome(code, diagnostics))
+}
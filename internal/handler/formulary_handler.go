@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/models/prescription"
+	"medical-center/internal/service"
+)
+
+// maxFormularySize limits the size of an imported catalogue
+const maxFormularySize = 20 << 20
+
+type FormularyHandler struct {
+	service *service.FormularyService
+}
+
+func NewFormularyHandler(s *service.FormularyService) *FormularyHandler {
+	return &FormularyHandler{service: s}
+}
+
+func (h *FormularyHandler) ListDrugs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	filter := prescription.DrugFilter{
+		Query:           c.Query("q"),
+		IncludeInactive: c.Query("include_inactive") == "true",
+		Page:            page,
+		PageSize:        pageSize,
+	}
+	drugs, total, err := h.service.ListDrugs(c.Request.Context(), filter)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"drugs":     drugs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (h *FormularyHandler) GetDrug(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid drug ID"})
+		return
+	}
+
+	drug, err := h.service.GetDrug(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, drug)
+}
+
+// Import reads the catalogue as CSV from the request body
+func (h *FormularyHandler) Import(c *gin.Context) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxFormularySize)
+	result, err := h.service.Import(c.Request.Context(), body, c.Query("deactivate_missing") == "true")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
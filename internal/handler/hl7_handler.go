@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/models/hl7msg"
+	"medical-center/internal/service"
+)
+
+// HL7Handler exposes the log of HL7 messages exchanged with the hospital
+// information system
+type HL7Handler struct {
+	service *service.HL7Service
+}
+
+func NewHL7Handler(s *service.HL7Service) *HL7Handler {
+	return &HL7Handler{service: s}
+}
+
+func (h *HL7Handler) ListMessages(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	messages, total, err := h.service.ListMessages(c.Request.Context(), hl7msg.Filter{
+		Direction:   hl7msg.Direction(c.Query("direction")),
+		Status:      hl7msg.Status(c.Query("status")),
+		MessageType: c.Query("type"),
+		ControlID:   c.Query("control_id"),
+		Page:        page,
+		PageSize:    pageSize,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages":  messages,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (h *HL7Handler) GetMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	msg, err := h.service.GetMessage(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, msg)
+}
+
+// ReplayMessage sends an outbound message again, or applies an inbound one
+// again, and returns the new log entry
+func (h *HL7Handler) ReplayMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	replay, err := h.service.Replay(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, replay)
+}
@@ -0,0 +1,407 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/lab"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/service"
+)
+
+// maxLabResultsSize limits the size of an ingested batch of results
+const maxLabResultsSize = 20 << 20
+
+type LabHandler struct {
+	service *service.LabService
+	access  *service.RecordAccessService
+}
+
+func NewLabHandler(s *service.LabService, access *service.RecordAccessService) *LabHandler {
+	return &LabHandler{service: s, access: access}
+}
+
+// testRequest is the body of catalogue create and update requests
+type testRequest struct {
+	Code     string   `json:"code" binding:"required"`
+	Name     string   `json:"name" binding:"required"`
+	Specimen string   `json:"specimen"`
+	Unit     string   `json:"unit"`
+	RefLow   *float64 `json:"ref_low"`
+	RefHigh  *float64 `json:"ref_high"`
+	RefText  string   `json:"ref_text"`
+	Active   *bool    `json:"active"`
+}
+
+func (r *testRequest) test() *lab.Test {
+	test := &lab.Test{
+		Code:     r.Code,
+		Name:     r.Name,
+		Specimen: r.Specimen,
+		Unit:     r.Unit,
+		RefLow:   r.RefLow,
+		RefHigh:  r.RefHigh,
+		RefText:  r.RefText,
+		Active:   true,
+	}
+	if r.Active != nil {
+		test.Active = *r.Active
+	}
+	return test
+}
+
+func (h *LabHandler) ListTests(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	filter := lab.TestFilter{
+		Query:           c.Query("q"),
+		IncludeInactive: c.Query("include_inactive") == "true",
+		Page:            page,
+		PageSize:        pageSize,
+	}
+	tests, total, err := h.service.ListTests(c.Request.Context(), filter)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tests":     tests,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (h *LabHandler) GetTest(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid test ID"})
+		return
+	}
+
+	test, err := h.service.GetTest(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, test)
+}
+
+func (h *LabHandler) CreateTest(c *gin.Context) {
+	var request testRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	test := request.test()
+	if err := h.service.CreateTest(c.Request.Context(), test); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, test)
+}
+
+func (h *LabHandler) UpdateTest(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid test ID"})
+		return
+	}
+	var request testRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	test, err := h.service.UpdateTest(c.Request.Context(), uint(id), request.test())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, test)
+}
+
+func (h *LabHandler) CreateOrder(c *gin.Context) {
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	var request struct {
+		TestIDs []uint `json:"test_ids" binding:"required"`
+		Notes   string `json:"notes"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	doctorID, err := h.service.AppointmentDoctor(c.Request.Context(), uint(appointmentID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !canOrderLabs(c, doctorID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return
+	}
+	u, _ := middleware.CurrentUser(c)
+	if u == nil || u.DoctorID == nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Only doctors can order lab tests"})
+		return
+	}
+
+	order, err := h.service.CreateOrder(c.Request.Context(), u.ID, *u.DoctorID, uint(appointmentID), request.TestIDs, request.Notes)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+func (h *LabHandler) GetAppointmentOrders(c *gin.Context) {
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	if !canReadAppointment(c, h.access, uint(appointmentID), permission.LabsRead) {
+		return
+	}
+
+	orders, err := h.service.GetByAppointment(c.Request.Context(), uint(appointmentID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// ListOrders is the worklist of the laboratory, filtered by status and
+// ordering doctor
+func (h *LabHandler) ListOrders(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	filter := lab.OrderFilter{
+		Status:   lab.Status(c.Query("status")),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	if value := c.Query("doctor_id"); value != "" {
+		doctorID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid doctor ID"})
+			return
+		}
+		id := uint(doctorID)
+		filter.DoctorID = &id
+	}
+	if !canReadAllOrders(c) {
+		// Callers without a doctor profile have no patients of their own
+		u, ok := middleware.CurrentUser(c)
+		if !ok || u.DoctorID == nil {
+			c.JSON(http.StatusOK, gin.H{
+				"orders":    []lab.Order{},
+				"total":     0,
+				"page":      page,
+				"page_size": pageSize,
+			})
+			return
+		}
+		filter.TreatingDoctorID = u.DoctorID
+	}
+	filter.ConsentPurpose = partnerPurpose(c)
+	orders, total, err := h.service.ListOrders(c.Request.Context(), filter)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders":    orders,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (h *LabHandler) GetOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid lab order ID"})
+		return
+	}
+
+	order, err := h.service.GetOrder(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	r := recordReader(c)
+	r.All = canReadAllOrders(c)
+	allowed, err := h.access.CanReadAppointment(c.Request.Context(), r, order.AppointmentID)
+	if !canRead(c, allowed, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *LabHandler) CollectOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid lab order ID"})
+		return
+	}
+
+	order, err := h.service.Collect(c.Request.Context(), enteredBy(c), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *LabHandler) CancelOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid lab order ID"})
+		return
+	}
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	order, err := h.service.GetOrder(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !canOrderLabs(c, order.DoctorID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	order, err = h.service.Cancel(c.Request.Context(), actor.ID, order.ID, request.Reason)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// EnterResults records results of the order typed in by hand. Results that
+// are accepted are kept even when others are rejected.
+func (h *LabHandler) EnterResults(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid lab order ID"})
+		return
+	}
+	var request struct {
+		Results []lab.ResultInput `json:"results" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	report := h.service.EnterResults(c.Request.Context(), enteredBy(c), uint(id), request.Results)
+	c.JSON(http.StatusOK, report)
+}
+
+// Ingest records a batch of results sent by a laboratory system, as CSV or
+// JSON depending on the Content-Type
+func (h *LabHandler) Ingest(c *gin.Context) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxLabResultsSize)
+	var (
+		report *lab.IngestReport
+		err    error
+	)
+	switch c.ContentType() {
+	case "text/csv":
+		report, err = h.service.IngestCSV(c.Request.Context(), enteredBy(c), lab.SourceAPI, body)
+	case "application/json":
+		report, err = h.service.IngestJSON(c.Request.Context(), enteredBy(c), lab.SourceAPI, body)
+	default:
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "Send results as text/csv or application/json"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// History returns the results of a patient, newest first, optionally of the
+// test given by test_code
+func (h *LabHandler) History(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	if !canReadPatient(c, h.access, uint(patientID), permission.PatientsRead, permission.LabsRead) {
+		return
+	}
+
+	history, err := h.service.History(c.Request.Context(), uint(patientID), c.Query("test_code"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// canOrderLabs reports whether the caller holds the ".all" permission or is
+// the doctor doctorID
+func canOrderLabs(c *gin.Context, doctorID uint) bool {
+	if middleware.HasPermission(c, permission.LabsOrderAll) {
+		return true
+	}
+	u, ok := middleware.CurrentUser(c)
+	return ok && u.DoctorID != nil && *u.DoctorID == doctorID
+}
+
+// enteredBy returns the ID of the calling user, nil when a service account
+// calls
+func enteredBy(c *gin.Context) *uint {
+	if u, ok := middleware.CurrentUser(c); ok {
+		return &u.ID
+	}
+	return nil
+}
+
+// canReadAllOrders reports whether the caller sees every lab order. The
+// laboratory works through all of them, but doctors who also collect
+// specimens stay limited to their own patients by "labs.read.own".
+func canReadAllOrders(c *gin.Context) bool {
+	if middleware.HasPermission(c, permission.LabsRead) {
+		return true
+	}
+	if middleware.HasPermission(c, permission.LabsReadOwn) {
+		return false
+	}
+	return middleware.HasPermission(c, permission.LabsCollect) || middleware.HasPermission(c, permission.LabsResults)
+}
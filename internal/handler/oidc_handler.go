@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/service"
+)
+
+type OIDCHandler struct {
+	service *service.OIDCService
+}
+
+func NewOIDCHandler(s *service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{service: s}
+}
+
+// Login redirects the browser to the identity provider
+func (h *OIDCHandler) Login(c *gin.Context) {
+	url, err := h.service.BeginLogin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusFound, url)
+}
+
+// Callback is the redirect URI registered at the identity provider
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errCode, "error_description": c.Query("error_description")})
+		return
+	}
+
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state and code are required"})
+		return
+	}
+
+	result, err := h.service.CompleteLogin(c.Request.Context(), state, code, clientInfo(c))
+	if errors.Is(err, service.ErrSSONotAllowed) || errors.Is(err, service.ErrSSORoleMismatch) || errors.Is(err, service.ErrAccountDisabled) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
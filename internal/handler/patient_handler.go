@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/patient"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/service"
+)
+
+type PatientHandler struct {
+	service *service.PatientService
+	access  *service.RecordAccessService
+}
+
+func NewPatientHandler(s *service.PatientService, access *service.RecordAccessService) *PatientHandler {
+	return &PatientHandler{service: s, access: access}
+}
+
+// patientRequest is the body of patient create and update requests
+type patientRequest struct {
+	FullName string `json:"full_name" binding:"required"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	IIN      string `json:"iin"`
+	// BirthDate is formatted as YYYY-MM-DD
+	BirthDate string `json:"birth_date"`
+	UserID    *uint  `json:"user_id"`
+}
+
+// bindPatient reads the request body, aborting with 400 when it is invalid
+func bindPatient(c *gin.Context) (patient.PatientDTO, bool) {
+	var request patientRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return patient.PatientDTO{}, false
+	}
+
+	dto := patient.PatientDTO{
+		FullName: request.FullName,
+		Email:    request.Email,
+		Phone:    request.Phone,
+		IIN:      request.IIN,
+		UserID:   request.UserID,
+	}
+	if request.BirthDate != "" {
+		birthDate, err := time.Parse("2006-01-02", request.BirthDate)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid birth_date, expected YYYY-MM-DD"})
+			return patient.PatientDTO{}, false
+		}
+		dto.BirthDate = &birthDate
+	}
+	return dto, true
+}
+
+func (h *PatientHandler) ListPatients(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	filter := patient.Filter{
+		MRN:      c.Query("mrn"),
+		Name:     c.Query("name"),
+		Email:    c.Query("email"),
+		Phone:    c.Query("phone"),
+		IIN:      c.Query("iin"),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	if !middleware.HasPermission(c, permission.PatientsRead) {
+		// Callers without a doctor profile have no patients of their own
+		u, ok := middleware.CurrentUser(c)
+		if !ok || u.DoctorID == nil {
+			c.JSON(http.StatusOK, gin.H{
+				"patients":  []patient.Patient{},
+				"total":     0,
+				"page":      page,
+				"page_size": pageSize,
+			})
+			return
+		}
+		filter.DoctorID = u.DoctorID
+	}
+	filter.ConsentPurpose = partnerPurpose(c)
+	patients, total, err := h.service.ListPatients(c.Request.Context(), filter)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"patients":  patients,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (h *PatientHandler) CreatePatient(c *gin.Context) {
+	dto, ok := bindPatient(c)
+	if !ok {
+		return
+	}
+
+	p, err := h.service.CreatePatient(c.Request.Context(), dto)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, p)
+}
+
+func (h *PatientHandler) GetPatient(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	if !canReadPatient(c, h.access, uint(id), permission.PatientsRead) {
+		return
+	}
+
+	p, err := h.service.GetPatient(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *PatientHandler) UpdatePatient(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	dto, ok := bindPatient(c)
+	if !ok {
+		return
+	}
+
+	p, err := h.service.UpdatePatient(c.Request.Context(), uint(id), dto)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *PatientHandler) GetAppointments(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	if !canReadPatient(c, h.access, uint(id), permission.PatientsRead) {
+		return
+	}
+
+	appointments, err := h.service.GetAppointments(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, appointments)
+}
+
+func (h *PatientHandler) FindDuplicates(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	if !canReadPatient(c, h.access, uint(id), permission.PatientsRead) {
+		return
+	}
+
+	duplicates, err := h.service.FindDuplicates(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, duplicates)
+}
+
+// Merge folds the patient given in the body into the patient in the path
+func (h *PatientHandler) Merge(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+
+	var request struct {
+		MergedID uint `json:"merged_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	merge, err := h.service.Merge(c.Request.Context(), actor.ID, uint(id), request.MergedID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, merge)
+}
+
+func (h *PatientHandler) GetMerges(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	if !canReadPatient(c, h.access, uint(id), permission.PatientsRead) {
+		return
+	}
+
+	merges, err := h.service.GetMerges(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, merges)
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/user"
+	"medical-center/internal/service"
+)
+
+type PermissionHandler struct {
+	service *service.PermissionService
+}
+
+func NewPermissionHandler(s *service.PermissionService) *PermissionHandler {
+	return &PermissionHandler{service: s}
+}
+
+func (h *PermissionHandler) GetAllPermissions(c *gin.Context) {
+	perms, err := h.service.GetAllPermissions(c.Request.Context())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, perms)
+}
+
+func (h *PermissionHandler) GetRoles(c *gin.Context) {
+	roles, err := h.service.GetRoles(c.Request.Context())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+func (h *PermissionHandler) CreateRole(c *gin.Context) {
+	var request struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	role, err := h.service.CreateRole(c.Request.Context(), user.Role(request.Name), request.Description)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+func (h *PermissionHandler) GetRolePermissions(c *gin.Context) {
+	perms, err := h.service.GetRolePermissions(c.Request.Context(), user.Role(c.Param("role")))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"role": c.Param("role"), "permissions": perms})
+}
+
+func (h *PermissionHandler) SetRolePermissions(c *gin.Context) {
+	var request struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	perms, err := h.service.SetRolePermissions(c.Request.Context(), user.Role(c.Param("role")), request.Permissions)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"role": c.Param("role"), "permissions": perms})
+}
+
+// MyPermissions returns the effective permissions of the caller
+func (h *PermissionHandler) MyPermissions(c *gin.Context) {
+	p, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	set, err := h.service.GetPrincipalPermissions(c.Request.Context(), p)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	perms := make([]string, 0, len(set))
+	for name := range set {
+		perms = append(perms, name)
+	}
+	sort.Strings(perms)
+
+	c.JSON(http.StatusOK, gin.H{"principal": p, "role": p.Role, "permissions": perms})
+}
@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/allergy"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/models/prescription"
+	"medical-center/internal/service"
+)
+
+type PrescriptionHandler struct {
+	service *service.PrescriptionService
+	access  *service.RecordAccessService
+}
+
+func NewPrescriptionHandler(s *service.PrescriptionService, access *service.RecordAccessService) *PrescriptionHandler {
+	return &PrescriptionHandler{service: s, access: access}
+}
+
+// prescriptionRequest is the body of prescription create and update
+// requests
+type prescriptionRequest struct {
+	Notes string `json:"notes"`
+	Lines []struct {
+		DrugID       uint               `json:"drug_id" binding:"required"`
+		Dose         string             `json:"dose"`
+		Route        prescription.Route `json:"route"`
+		Frequency    string             `json:"frequency"`
+		DurationDays int                `json:"duration_days"`
+		Quantity     int                `json:"quantity"`
+		Instructions string             `json:"instructions"`
+	} `json:"lines" binding:"dive"`
+	// Acknowledgements acknowledge the allergy warnings raised by the drugs
+	Acknowledgements []allergy.AckInput `json:"acknowledgements" binding:"dive"`
+}
+
+func (r *prescriptionRequest) lines() []prescription.Line {
+	lines := make([]prescription.Line, 0, len(r.Lines))
+	for _, line := range r.Lines {
+		lines = append(lines, prescription.Line{
+			DrugID:       line.DrugID,
+			Dose:         line.Dose,
+			Route:        line.Route,
+			Frequency:    line.Frequency,
+			DurationDays: line.DurationDays,
+			Quantity:     line.Quantity,
+			Instructions: line.Instructions,
+		})
+	}
+	return lines
+}
+
+func (h *PrescriptionHandler) CreatePrescription(c *gin.Context) {
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	var request prescriptionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	doctorID, err := h.service.AppointmentDoctor(c.Request.Context(), uint(appointmentID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !canWritePrescription(c, doctorID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return
+	}
+	prescriber, ok := prescriberOf(c)
+	if !ok {
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	p, err := h.service.Create(c.Request.Context(), actor.ID, prescriber, uint(appointmentID), request.Notes, request.lines(), request.Acknowledgements)
+	if respondAllergyWarnings(c, err) {
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, p)
+}
+
+func (h *PrescriptionHandler) GetAppointmentPrescriptions(c *gin.Context) {
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	if !canReadAppointment(c, h.access, uint(appointmentID), permission.PrescriptionsRead) {
+		return
+	}
+
+	prescriptions, err := h.service.GetByAppointment(c.Request.Context(), uint(appointmentID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, prescriptions)
+}
+
+func (h *PrescriptionHandler) GetPrescription(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid prescription ID"})
+		return
+	}
+
+	p, err := h.service.Get(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !canReadAppointment(c, h.access, p.AppointmentID, permission.PrescriptionsRead) {
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *PrescriptionHandler) UpdatePrescription(c *gin.Context) {
+	id, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+	var request prescriptionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	p, err := h.service.Update(c.Request.Context(), actor.ID, id, request.Notes, request.lines(), request.Acknowledgements)
+	if respondAllergyWarnings(c, err) {
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *PrescriptionHandler) IssuePrescription(c *gin.Context) {
+	id, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+
+	p, err := h.service.Issue(c.Request.Context(), id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *PrescriptionHandler) CancelPrescription(c *gin.Context) {
+	id, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	p, err := h.service.Cancel(c.Request.Context(), actor.ID, id, request.Reason)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+// RenewPrescription issues a copy of the prescription signed by the caller
+func (h *PrescriptionHandler) RenewPrescription(c *gin.Context) {
+	id, ok := h.authorize(c)
+	if !ok {
+		return
+	}
+	prescriber, ok := prescriberOf(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		Acknowledgements []allergy.AckInput `json:"acknowledgements" binding:"dive"`
+	}
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	p, err := h.service.Renew(c.Request.Context(), actor.ID, prescriber, id, request.Acknowledgements)
+	if respondAllergyWarnings(c, err) {
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, p)
+}
+
+// Verify is public, pharmacies check the code printed on a prescription
+func (h *PrescriptionHandler) Verify(c *gin.Context) {
+	verification, err := h.service.Verify(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, verification)
+}
+
+func (h *PrescriptionHandler) ActiveMedications(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	if !canReadPatient(c, h.access, uint(patientID), permission.PatientsRead, permission.PrescriptionsRead) {
+		return
+	}
+
+	medications, err := h.service.ActiveMedications(c.Request.Context(), uint(patientID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, medications)
+}
+
+// authorize parses the prescription ID and checks that the caller may
+// write it. It aborts the request and returns false otherwise.
+func (h *PrescriptionHandler) authorize(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid prescription ID"})
+		return 0, false
+	}
+
+	p, err := h.service.Get(c.Request.Context(), uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	if !canWritePrescription(c, p.DoctorID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return 0, false
+	}
+	return p.ID, true
+}
+
+// canWritePrescription reports whether the caller holds the ".all"
+// permission or is the doctor doctorID
+func canWritePrescription(c *gin.Context, doctorID uint) bool {
+	if middleware.HasPermission(c, permission.PrescriptionsWriteAll) {
+		return true
+	}
+	u, ok := middleware.CurrentUser(c)
+	return ok && u.DoctorID != nil && *u.DoctorID == doctorID
+}
+
+// prescriberOf returns the doctor profile of the caller, who signs the
+// prescription. It aborts the request when the caller is not a doctor.
+func prescriberOf(c *gin.Context) (uint, bool) {
+	u, ok := middleware.CurrentUser(c)
+	if !ok || u.DoctorID == nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Only doctors can prescribe"})
+		return 0, false
+	}
+	return *u.DoctorID, true
+}
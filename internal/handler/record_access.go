@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/consent"
+	"medical-center/internal/service"
+)
+
+// recordReader describes the caller of a read of medical records. Holding
+// every one of allPermissions covers every patient, otherwise the ".own"
+// variants the routes accept narrow the read to the caller's patients.
+// External partners are further limited to patients who consented.
+func recordReader(c *gin.Context, allPermissions ...string) service.Reader {
+	r := service.Reader{All: true}
+	for _, name := range allPermissions {
+		if !middleware.HasPermission(c, name) {
+			r.All = false
+		}
+	}
+	if u, ok := middleware.CurrentUser(c); ok {
+		r.DoctorID = u.DoctorID
+	}
+	r.Purpose = partnerPurpose(c)
+	return r
+}
+
+// partnerPurpose is the consent patients must have given to share their
+// records with the caller, empty unless the caller is an external partner
+func partnerPurpose(c *gin.Context) consent.Purpose {
+	p, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return ""
+	}
+	return consent.Purpose(p.ConsentPurpose)
+}
+
+// canReadPatient checks that the caller may read the records of the
+// patient. It aborts the request and returns false otherwise.
+func canReadPatient(c *gin.Context, access *service.RecordAccessService, patientID uint, allPermissions ...string) bool {
+	allowed, err := access.CanReadPatient(c.Request.Context(), recordReader(c, allPermissions...), patientID)
+	return canRead(c, allowed, err)
+}
+
+// canReadAppointment checks that the caller may read the records of the
+// appointment. It aborts the request and returns false otherwise.
+func canReadAppointment(c *gin.Context, access *service.RecordAccessService, appointmentID uint, allPermissions ...string) bool {
+	allowed, err := access.CanReadAppointment(c.Request.Context(), recordReader(c, allPermissions...), appointmentID)
+	return canRead(c, allowed, err)
+}
+
+// canRead aborts the request unless the access check allowed the read
+func canRead(c *gin.Context, allowed bool, err error) bool {
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return false
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/models/retention"
+	"medical-center/internal/service"
+)
+
+type RetentionHandler struct {
+	service *service.RetentionService
+}
+
+func NewRetentionHandler(s *service.RetentionService) *RetentionHandler {
+	return &RetentionHandler{service: s}
+}
+
+func (h *RetentionHandler) GetRules(c *gin.Context) {
+	rules, err := h.service.GetRules(c.Request.Context())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *RetentionHandler) CreateRule(c *gin.Context) {
+	var request struct {
+		Entity    string           `json:"entity" binding:"required"`
+		Action    retention.Action `json:"action" binding:"required"`
+		AfterDays int              `json:"after_days" binding:"required"`
+		Enabled   *bool            `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	rule := &retention.Rule{
+		Entity:    request.Entity,
+		Action:    request.Action,
+		AfterDays: request.AfterDays,
+		Enabled:   request.Enabled == nil || *request.Enabled,
+	}
+	if err := h.service.CreateRule(c.Request.Context(), rule); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *RetentionHandler) UpdateRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	var request struct {
+		AfterDays int  `json:"after_days" binding:"required"`
+		Enabled   bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	rule, err := h.service.UpdateRule(c.Request.Context(), uint(id), request.AfterDays, request.Enabled)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *RetentionHandler) DeleteRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	if err := h.service.DeleteRule(c.Request.Context(), uint(id)); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetHolds lists legal holds, only active ones with ?active=true
+func (h *RetentionHandler) GetHolds(c *gin.Context) {
+	activeOnly, _ := strconv.ParseBool(c.Query("active"))
+	holds, err := h.service.GetHolds(c.Request.Context(), activeOnly)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, holds)
+}
+
+func (h *RetentionHandler) PlaceHold(c *gin.Context) {
+	var request struct {
+		UserID uint   `json:"user_id" binding:"required"`
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	hold, err := h.service.PlaceHold(c.Request.Context(), actor.ID, request.UserID, request.Reason)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, hold)
+}
+
+func (h *RetentionHandler) ReleaseHold(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid hold ID"})
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	hold, err := h.service.ReleaseHold(c.Request.Context(), actor.ID, uint(id))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, hold)
+}
+
+// DryRun reports what the rules would change right now without changing it
+func (h *RetentionHandler) DryRun(c *gin.Context) {
+	h.run(c, true)
+}
+
+// Run enforces the rules immediately instead of waiting for the job
+func (h *RetentionHandler) Run(c *gin.Context) {
+	h.run(c, false)
+}
+
+func (h *RetentionHandler) run(c *gin.Context, dryRun bool) {
+	report, err := h.service.Run(c.Request.Context(), dryRun)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
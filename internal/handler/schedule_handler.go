@@ -1,11 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/models/schedule"
 	"medical-center/internal/service"
 )
 
@@ -29,7 +32,12 @@ func (h *ScheduleHandler) CreateSlot(c *gin.Context) {
 		return
 	}
 
-	slot, err := h.service.CreateSlot(request.DoctorID, request.StartTime, request.EndTime)
+	if !canManageDoctor(c, request.DoctorID, permission.SchedulesWriteAll) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return
+	}
+
+	slot, err := h.service.CreateSlot(c.Request.Context(), request.DoctorID, request.StartTime, request.EndTime)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -46,7 +54,7 @@ func (h *ScheduleHandler) GetSlot(c *gin.Context) {
 		return
 	}
 
-	slot, err := h.service.GetSlotByID(uint(id))
+	slot, err := h.service.GetSlotByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -63,7 +71,7 @@ func (h *ScheduleHandler) GetDoctorSlots(c *gin.Context) {
 		return
 	}
 
-	slots, err := h.service.GetDoctorSlots(uint(doctorID))
+	slots, err := h.service.GetDoctorSlots(c.Request.Context(), uint(doctorID))
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -80,7 +88,12 @@ func (h *ScheduleHandler) BookSlot(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.BookSlot(uint(id)); err != nil {
+	err = h.service.BookSlot(c.Request.Context(), uint(id))
+	if errors.Is(err, schedule.ErrAlreadyBooked) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -103,7 +116,7 @@ func (h *ScheduleHandler) GetAvailableSlots(c *gin.Context) {
 		return
 	}
 
-	slots, err := h.service.GetAvailableSlots(uint(doctorID), date)
+	slots, err := h.service.GetAvailableSlots(c.Request.Context(), uint(doctorID), date)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"medical-center/internal/middleware"
+	"medical-center/internal/service"
+)
+
+type SessionHandler struct {
+	service *service.SessionService
+}
+
+func NewSessionHandler(s *service.SessionService) *SessionHandler {
+	return &SessionHandler{service: s}
+}
+
+// MySessions lists where the caller is logged in
+func (h *SessionHandler) MySessions(c *gin.Context) {
+	p, ok := middleware.CurrentPrincipal(c)
+	if !ok || !p.IsUser() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sessions, err := h.service.GetSessions(c.Request.Context(), p.ID, p.SessionID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeMySession logs out one of the caller's sessions, including the current one
+func (h *SessionHandler) RevokeMySession(c *gin.Context) {
+	p, ok := middleware.CurrentPrincipal(c)
+	if !ok || !p.IsUser() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.service.Revoke(c.Request.Context(), p.ID, c.Param("id")); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeOtherSessions logs out everywhere except the current session
+func (h *SessionHandler) RevokeOtherSessions(c *gin.Context) {
+	p, ok := middleware.CurrentPrincipal(c)
+	if !ok || !p.IsUser() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.service.RevokeOthers(c.Request.Context(), p.ID, p.SessionID); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *SessionHandler) GetUserSessions(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	current := ""
+	if p, ok := middleware.CurrentPrincipal(c); ok {
+		current = p.SessionID
+	}
+	sessions, err := h.service.GetSessions(c.Request.Context(), uint(id), current)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (h *SessionHandler) RevokeUserSession(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.service.Revoke(c.Request.Context(), uint(id), c.Param("session_id")); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeUserSessions logs the user out of every session
+func (h *SessionHandler) RevokeUserSessions(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.service.RevokeOthers(c.Request.Context(), uint(id), ""); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
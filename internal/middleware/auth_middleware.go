@@ -1,15 +1,51 @@
 package middleware
 
 import (
-	"net/http"
-	"strings"
+	"context"
+	"medical-center/internal/models/principal"
 	"medical-center/internal/models/user"
 	"medical-center/internal/service"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(authService service.AuthService) gin.HandlerFunc {
+const (
+	apiKeyHeader = "X-API-Key"
+	principalKey = "principal"
+)
+
+// AuthMiddleware authenticates the request with either a bearer token or an
+// API key sent in the X-API-Key header and stores the resulting principal in
+// the context. For users the *user.User is available under "user" as well.
+func AuthMiddleware(authService service.AuthService, apiKeyService *service.APIKeyService) gin.HandlerFunc {
+	validateToken := tokenMiddleware(authService.ValidateToken)
+	return func(c *gin.Context) {
+		rawKey := c.GetHeader(apiKeyHeader)
+		if rawKey == "" {
+			validateToken(c)
+			return
+		}
+
+		p, err := apiKeyService.Authenticate(c.Request.Context(), rawKey)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+			return
+		}
+
+		setPrincipal(c, p)
+		c.Next()
+	}
+}
+
+// MFAEnrollmentMiddleware also lets through users holding an enrollment
+// token, so that they can set up MFA before their first full login
+func MFAEnrollmentMiddleware(authService service.AuthService) gin.HandlerFunc {
+	return tokenMiddleware(authService.ValidateEnrollmentToken)
+}
+
+func tokenMiddleware(validate func(ctx context.Context, tokenString string) (*principal.Principal, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -26,46 +62,35 @@ func AuthMiddleware(authService service.AuthService) gin.HandlerFunc {
 		}
 
 		tokenString := tokenParts[1]
-		user, err := authService.ValidateToken(tokenString)
+		p, err := validate(c.Request.Context(), tokenString)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			return
 		}
 
 		// Set the user in the context for handlers to access
-		c.Set("user", user)
+		setPrincipal(c, p)
 		c.Next()
 	}
 }
 
-func RoleMiddleware(roles ...user.Role) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userInterface, exists := c.Get("user")
-		if !exists {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
-			return
-		}
-
-		user, ok := userInterface.(*user.User)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user from context"})
-			return
-		}
-
-		// Check if the user's role is allowed
-		authorized := false
-		for _, role := range roles {
-			if user.Role == role {
-				authorized = true
-				break
-			}
-		}
-
-		if !authorized {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
-			return
-		}
+// CurrentPrincipal returns the caller set by AuthMiddleware
+func CurrentPrincipal(c *gin.Context) (*principal.Principal, bool) {
+	p, exists := c.Get(principalKey)
+	if !exists {
+		return nil, false
+	}
+	pr, ok := p.(*principal.Principal)
+	return pr, ok
+}
 
-		c.Next()
+// CurrentUser returns the user set by AuthMiddleware. It is not set when the
+// request was authenticated with an API key.
+func CurrentUser(c *gin.Context) (*user.User, bool) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		return nil, false
 	}
-} 
\ No newline at end of file
+	u, ok := userInterface.(*user.User)
+	return u, ok
+}
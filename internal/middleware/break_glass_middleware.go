@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"medical-center/internal/models/breakglass"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const patientDataKey = "patient_data"
+
+// PatientData marks the routes serving records of entity, a table such as
+// "patients", so that requests made to them under break-glass access are
+// recorded with the record's ID taken from the :id route parameter
+func PatientData(entity string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(patientDataKey, entity)
+		c.Next()
+	}
+}
+
+// BreakGlass widens the permissions of users with an active emergency grant
+// and records every successful request for patient data they make under it
+// for review
+func BreakGlass(permissionService *service.PermissionService, breakGlassService *service.BreakGlassService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := CurrentPrincipal(c)
+		if !ok || !p.IsUser() {
+			c.Next()
+			return
+		}
+		perms, err := loadPermissions(c, permissionService)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+			return
+		}
+		if !perms.Has(permission.BreakGlassUse) {
+			c.Next()
+			return
+		}
+
+		grant, err := breakGlassService.ActiveGrant(c.Request.Context(), p.ID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve emergency access"})
+			return
+		}
+		if grant == nil {
+			c.Next()
+			return
+		}
+
+		elevated := make(permission.Set, len(perms)+len(breakglass.ElevatedPermissions))
+		for name := range perms {
+			elevated[name] = true
+		}
+		for _, name := range breakglass.ElevatedPermissions {
+			elevated[name] = true
+		}
+		c.Set(permissionsKey, elevated)
+		c.Header("X-Break-Glass", "active")
+
+		c.Next()
+
+		// Refused and failed requests disclosed nothing, and other routes,
+		// such as the caller's own profile, are not what the grant is for
+		entity := c.GetString(patientDataKey)
+		status := c.Writer.Status()
+		if entity == "" || status < http.StatusOK || status >= http.StatusMultipleChoices {
+			return
+		}
+		if err := breakGlassService.RecordAccess(c.Request.Context(), grant, c.Request.Method, c.Request.URL.RequestURI(), entity, c.Param("id"), status); err != nil {
+			log.Printf("failed to record break-glass access of grant %d: %v", grant.ID, err)
+		}
+	}
+}
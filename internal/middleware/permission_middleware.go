@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"medical-center/internal/models/permission"
+	"medical-center/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const permissionsKey = "permissions"
+
+var errUserNotInContext = errors.New("user not found in context")
+
+// RequirePermission allows the request through when the authenticated user
+// holds at least one of the given permissions
+func RequirePermission(permissionService *service.PermissionService, names ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		perms, err := loadPermissions(c, permissionService)
+		if errors.Is(err, errUserNotInContext) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+			return
+		}
+
+		if !perms.HasAny(names...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail blocks users who have not confirmed their email
+// address. Service accounts have no email and are not affected.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := CurrentPrincipal(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+			return
+		}
+
+		if p.IsUser() && !p.User.EmailVerified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Email address is not verified"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// HasPermission reports whether the permissions resolved for this request
+// include the given one
+func HasPermission(c *gin.Context, name string) bool {
+	perms, exists := c.Get(permissionsKey)
+	if !exists {
+		return false
+	}
+	set, ok := perms.(permission.Set)
+	return ok && set.Has(name)
+}
+
+func loadPermissions(c *gin.Context, permissionService *service.PermissionService) (permission.Set, error) {
+	if perms, exists := c.Get(permissionsKey); exists {
+		if set, ok := perms.(permission.Set); ok {
+			return set, nil
+		}
+	}
+
+	p, ok := CurrentPrincipal(c)
+	if !ok {
+		return nil, errUserNotInContext
+	}
+
+	set, err := permissionService.GetPrincipalPermissions(c.Request.Context(), p)
+	if err != nil {
+		return nil, err
+	}
+	c.Set(permissionsKey, set)
+	return set, nil
+}
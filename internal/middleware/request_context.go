@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"medical-center/internal/models/audit"
+	"medical-center/internal/models/principal"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// RequestContext assigns every request an ID, reusing a well-formed
+// X-Request-ID sent by a proxy, and records it with the client IP for the
+// audit log
+func RequestContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header(requestIDHeader, requestID)
+
+		ctx := audit.WithRequest(c.Request.Context(), audit.Request{
+			IP:        c.ClientIP(),
+			RequestID: requestID,
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// setPrincipal stores the authenticated caller in the context and makes it
+// the actor of the changes made by the request
+func setPrincipal(c *gin.Context, p *principal.Principal) {
+	if p.User != nil {
+		c.Set("user", p.User)
+	}
+	c.Set(principalKey, p)
+
+	ctx := audit.WithActor(c.Request.Context(), audit.Actor{
+		Type: string(p.Kind),
+		ID:   p.ID,
+	})
+	c.Request = c.Request.WithContext(ctx)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -24,4 +24,4 @@ func (m *CreateDepartmentsTable) Migrate(db *gorm.DB) error {
 
 func (m *CreateDepartmentsTable) Rollback(db *gorm.DB) error {
 	return db.Exec("DROP TABLE IF EXISTS departments").Error
-} 
\ No newline at end of file
+}
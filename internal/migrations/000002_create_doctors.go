@@ -28,4 +28,4 @@ func (m *CreateDoctorsTable) Migrate(db *gorm.DB) error {
 
 func (m *CreateDoctorsTable) Rollback(db *gorm.DB) error {
 	return db.Exec("DROP TABLE IF EXISTS doctors").Error
-} 
\ No newline at end of file
+}
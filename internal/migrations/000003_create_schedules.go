@@ -29,4 +29,4 @@ func (m *CreateSchedulesTable) Migrate(db *gorm.DB) error {
 
 func (m *CreateSchedulesTable) Rollback(db *gorm.DB) error {
 	return db.Exec("DROP TABLE IF EXISTS schedules").Error
-} 
\ No newline at end of file
+}
@@ -33,4 +33,4 @@ func (m *CreateAppointmentsTable) Migrate(db *gorm.DB) error {
 
 func (m *CreateAppointmentsTable) Rollback(db *gorm.DB) error {
 	return db.Exec("DROP TABLE IF EXISTS appointments").Error
-} 
\ No newline at end of file
+}
@@ -27,4 +27,4 @@ func (m *CreateUsersTable) Migrate(db *gorm.DB) error {
 
 func (m *CreateUsersTable) Rollback(db *gorm.DB) error {
 	return db.Exec("DROP TABLE IF EXISTS users").Error
-} 
\ No newline at end of file
+}
@@ -0,0 +1,112 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreatePermissionsTables struct{}
+
+func (m *CreatePermissionsTables) ID() string {
+	return "000006_create_permissions"
+}
+
+func (m *CreatePermissionsTables) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS roles (
+			name VARCHAR(20) PRIMARY KEY,
+			description VARCHAR(255) NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS permissions (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL UNIQUE,
+			description VARCHAR(255) NOT NULL DEFAULT ''
+		);
+
+		CREATE TABLE IF NOT EXISTS role_permissions (
+			role VARCHAR(20) NOT NULL,
+			permission_id INTEGER NOT NULL,
+			PRIMARY KEY (role, permission_id),
+			CONSTRAINT fk_role_permissions_role FOREIGN KEY (role) REFERENCES roles(name) ON DELETE CASCADE,
+			CONSTRAINT fk_role_permissions_permission FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+		);
+
+		INSERT INTO roles (name, description) VALUES
+			('admin', 'Full access to the system'),
+			('doctor', 'Doctors managing their own schedule and appointments'),
+			('patient', 'Patients booking appointments'),
+			('receptionist', 'Front desk staff booking on behalf of patients'),
+			('nurse', 'Nursing staff with read access to appointments'),
+			('billing', 'Billing staff with read access to appointments')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO permissions (name, description) VALUES
+			('departments.read', 'View departments'),
+			('departments.write', 'Create and update departments'),
+			('doctors.read', 'View doctors'),
+			('doctors.write', 'Create and update doctors'),
+			('doctors.availability.write.all', 'Set availability of any doctor'),
+			('doctors.availability.write.own', 'Set availability of the linked doctor profile'),
+			('schedules.read', 'View schedule slots'),
+			('schedules.write.all', 'Create slots for any doctor'),
+			('schedules.write.own', 'Create slots for the linked doctor profile'),
+			('schedules.book', 'Book schedule slots'),
+			('appointments.create', 'Book appointments'),
+			('appointments.read.all', 'View all appointments'),
+			('appointments.read.own', 'View own appointments'),
+			('appointments.write.all', 'Update any appointment'),
+			('appointments.write.own', 'Update own appointments'),
+			('users.manage', 'Manage user accounts'),
+			('roles.manage', 'Manage roles and their permissions')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT 'admin', id FROM permissions
+		ON CONFLICT DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT r.role, p.id FROM (VALUES
+			('doctor', 'departments.read'),
+			('doctor', 'doctors.read'),
+			('doctor', 'doctors.availability.write.own'),
+			('doctor', 'schedules.read'),
+			('doctor', 'schedules.write.own'),
+			('doctor', 'schedules.book'),
+			('doctor', 'appointments.create'),
+			('doctor', 'appointments.read.own'),
+			('doctor', 'appointments.write.own'),
+			('patient', 'departments.read'),
+			('patient', 'doctors.read'),
+			('patient', 'schedules.read'),
+			('patient', 'schedules.book'),
+			('patient', 'appointments.create'),
+			('patient', 'appointments.read.own'),
+			('receptionist', 'departments.read'),
+			('receptionist', 'doctors.read'),
+			('receptionist', 'schedules.read'),
+			('receptionist', 'schedules.book'),
+			('receptionist', 'appointments.create'),
+			('receptionist', 'appointments.read.all'),
+			('receptionist', 'appointments.write.all'),
+			('nurse', 'departments.read'),
+			('nurse', 'doctors.read'),
+			('nurse', 'schedules.read'),
+			('nurse', 'appointments.read.all'),
+			('billing', 'departments.read'),
+			('billing', 'doctors.read'),
+			('billing', 'appointments.read.all')
+		) AS r(role, permission)
+		JOIN permissions p ON p.name = r.permission
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreatePermissionsTables) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DROP TABLE IF EXISTS role_permissions;
+		DROP TABLE IF EXISTS permissions;
+		DROP TABLE IF EXISTS roles;
+	`).Error
+}
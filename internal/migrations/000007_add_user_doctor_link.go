@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type AddUserDoctorLink struct{}
+
+func (m *AddUserDoctorLink) ID() string {
+	return "000007_add_user_doctor_link"
+}
+
+func (m *AddUserDoctorLink) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS doctor_id INTEGER REFERENCES doctors(id);
+		CREATE INDEX IF NOT EXISTS idx_users_doctor_id ON users(doctor_id);
+	`).Error
+}
+
+func (m *AddUserDoctorLink) Rollback(db *gorm.DB) error {
+	return db.Exec("ALTER TABLE users DROP COLUMN IF EXISTS doctor_id").Error
+}
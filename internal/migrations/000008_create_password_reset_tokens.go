@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreatePasswordResetTokensTable struct{}
+
+func (m *CreatePasswordResetTokensTable) ID() string {
+	return "000008_create_password_reset_tokens"
+}
+
+func (m *CreatePasswordResetTokensTable) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INTEGER NOT NULL DEFAULT 0;
+
+		CREATE TABLE IF NOT EXISTS password_reset_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			token_hash VARCHAR(64) NOT NULL UNIQUE,
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			used_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_password_reset_tokens_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+	`).Error
+}
+
+func (m *CreatePasswordResetTokensTable) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DROP TABLE IF EXISTS password_reset_tokens;
+		ALTER TABLE users DROP COLUMN IF EXISTS token_version;
+	`).Error
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type AddEmailVerification struct{}
+
+func (m *AddEmailVerification) ID() string {
+	return "000009_add_email_verification"
+}
+
+func (m *AddEmailVerification) Migrate(db *gorm.DB) error {
+	// Accounts created before verification existed are treated as verified
+	return db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP WITH TIME ZONE;
+		UPDATE users SET email_verified = TRUE, email_verified_at = NOW() WHERE email_verified = FALSE;
+	`).Error
+}
+
+func (m *AddEmailVerification) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
+		ALTER TABLE users DROP COLUMN IF EXISTS email_verified;
+	`).Error
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateLoginAttemptsTable struct{}
+
+func (m *CreateLoginAttemptsTable) ID() string {
+	return "000010_create_login_attempts"
+}
+
+func (m *CreateLoginAttemptsTable) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS login_attempts (
+			key VARCHAR(320) PRIMARY KEY,
+			failures INTEGER NOT NULL DEFAULT 0,
+			last_failed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			locked_until TIMESTAMP WITH TIME ZONE
+		)
+	`).Error
+}
+
+func (m *CreateLoginAttemptsTable) Rollback(db *gorm.DB) error {
+	return db.Exec("DROP TABLE IF EXISTS login_attempts").Error
+}
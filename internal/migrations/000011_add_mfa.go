@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type AddMFA struct{}
+
+func (m *AddMFA) ID() string {
+	return "000011_add_mfa"
+}
+
+func (m *AddMFA) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_secret VARCHAR(64);
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_last_step BIGINT NOT NULL DEFAULT 0;
+
+		CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			code_hash VARCHAR(64) NOT NULL,
+			used_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_mfa_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+	`).Error
+}
+
+func (m *AddMFA) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DROP TABLE IF EXISTS mfa_recovery_codes;
+		ALTER TABLE users DROP COLUMN IF EXISTS mfa_last_step;
+		ALTER TABLE users DROP COLUMN IF EXISTS mfa_secret;
+		ALTER TABLE users DROP COLUMN IF EXISTS mfa_enabled;
+	`).Error
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type AddUserStatus struct{}
+
+func (m *AddUserStatus) ID() string {
+	return "000012_add_user_status"
+}
+
+func (m *AddUserStatus) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active';
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+		CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);
+		CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at);
+	`).Error
+}
+
+func (m *AddUserStatus) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+		ALTER TABLE users DROP COLUMN IF EXISTS password_reset_required;
+		ALTER TABLE users DROP COLUMN IF EXISTS status;
+	`).Error
+}
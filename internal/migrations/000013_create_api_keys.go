@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateAPIKeysTables struct{}
+
+func (m *CreateAPIKeysTables) ID() string {
+	return "000013_create_api_keys"
+}
+
+func (m *CreateAPIKeysTables) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS service_accounts (
+			id SERIAL PRIMARY KEY,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			deleted_at TIMESTAMP WITH TIME ZONE,
+			name VARCHAR(100) NOT NULL UNIQUE,
+			description VARCHAR(255) NOT NULL DEFAULT '',
+			disabled BOOLEAN NOT NULL DEFAULT FALSE,
+			created_by_id INTEGER
+		);
+
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id SERIAL PRIMARY KEY,
+			service_account_id INTEGER NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			prefix VARCHAR(16) NOT NULL,
+			key_hash VARCHAR(64) NOT NULL UNIQUE,
+			scopes TEXT NOT NULL DEFAULT '',
+			expires_at TIMESTAMP WITH TIME ZONE,
+			last_used_at TIMESTAMP WITH TIME ZONE,
+			revoked_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_api_keys_service_account FOREIGN KEY (service_account_id) REFERENCES service_accounts(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_api_keys_service_account_id ON api_keys(service_account_id);
+
+		INSERT INTO permissions (name, description) VALUES
+			('service_accounts.manage', 'Manage service accounts and their API keys')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT 'admin', id FROM permissions WHERE name = 'service_accounts.manage'
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreateAPIKeysTables) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name = 'service_accounts.manage';
+		DROP TABLE IF EXISTS api_keys;
+		DROP TABLE IF EXISTS service_accounts;
+	`).Error
+}
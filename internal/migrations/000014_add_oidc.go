@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type AddOIDC struct{}
+
+func (m *AddOIDC) ID() string {
+	return "000014_add_oidc"
+}
+
+func (m *AddOIDC) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_subject VARCHAR(255);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_subject ON users(oidc_subject);
+
+		CREATE TABLE IF NOT EXISTS oidc_auth_requests (
+			state VARCHAR(64) PRIMARY KEY,
+			code_verifier VARCHAR(64) NOT NULL,
+			nonce VARCHAR(64) NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_oidc_auth_requests_expires_at ON oidc_auth_requests(expires_at);
+	`).Error
+}
+
+func (m *AddOIDC) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DROP TABLE IF EXISTS oidc_auth_requests;
+		DROP INDEX IF EXISTS idx_users_oidc_subject;
+		ALTER TABLE users DROP COLUMN IF EXISTS oidc_subject;
+	`).Error
+}
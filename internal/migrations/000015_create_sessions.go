@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateSessionsTable struct{}
+
+func (m *CreateSessionsTable) ID() string {
+	return "000015_create_sessions"
+}
+
+func (m *CreateSessionsTable) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS sessions (
+			id VARCHAR(32) PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			device VARCHAR(100) NOT NULL DEFAULT '',
+			user_agent VARCHAR(512) NOT NULL DEFAULT '',
+			ip VARCHAR(45) NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			revoked_at TIMESTAMP WITH TIME ZONE,
+			CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+	`).Error
+}
+
+func (m *CreateSessionsTable) Rollback(db *gorm.DB) error {
+	return db.Exec(`DROP TABLE IF EXISTS sessions;`).Error
+}
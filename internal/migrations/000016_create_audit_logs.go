@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateAuditLogsTable struct{}
+
+func (m *CreateAuditLogsTable) ID() string {
+	return "000016_create_audit_logs"
+}
+
+// Migrate creates the audit log. A trigger rejects updates, deletes and
+// truncation so that entries can only be appended; the hash chain detects
+// tampering by anyone able to bypass the trigger.
+func (m *CreateAuditLogsTable) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_logs (
+			id BIGSERIAL PRIMARY KEY,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			actor_type VARCHAR(20) NOT NULL,
+			actor_id INTEGER NOT NULL DEFAULT 0,
+			action VARCHAR(10) NOT NULL,
+			entity VARCHAR(100) NOT NULL,
+			entity_id VARCHAR(64) NOT NULL DEFAULT '',
+			changes TEXT NOT NULL DEFAULT '',
+			ip VARCHAR(45) NOT NULL DEFAULT '',
+			request_id VARCHAR(64) NOT NULL DEFAULT '',
+			prev_hash VARCHAR(64) NOT NULL DEFAULT '',
+			hash VARCHAR(64) NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_logs_entity ON audit_logs(entity, entity_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_logs_actor ON audit_logs(actor_type, actor_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at);
+
+		CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_logs is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS audit_logs_no_modify ON audit_logs;
+		CREATE TRIGGER audit_logs_no_modify BEFORE UPDATE OR DELETE ON audit_logs
+			FOR EACH ROW EXECUTE PROCEDURE audit_logs_append_only();
+		DROP TRIGGER IF EXISTS audit_logs_no_truncate ON audit_logs;
+		CREATE TRIGGER audit_logs_no_truncate BEFORE TRUNCATE ON audit_logs
+			FOR EACH STATEMENT EXECUTE PROCEDURE audit_logs_append_only();
+
+		INSERT INTO permissions (name, description) VALUES
+			('audit.read', 'View the audit log')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT 'admin', id FROM permissions WHERE name = 'audit.read'
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreateAuditLogsTable) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name = 'audit.read';
+		DROP TABLE IF EXISTS audit_logs;
+		DROP FUNCTION IF EXISTS audit_logs_append_only();
+	`).Error
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type EncryptAppointmentPII struct{}
+
+func (m *EncryptAppointmentPII) ID() string {
+	return "000017_encrypt_appointment_pii"
+}
+
+// Migrate makes room for the encrypted patient details and adds their blind
+// indexes. Existing rows stay readable and are encrypted afterwards with
+// "migrate -encrypt-pii".
+func (m *EncryptAppointmentPII) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		ALTER TABLE appointments
+			ALTER COLUMN patient_name TYPE TEXT,
+			ALTER COLUMN email TYPE TEXT,
+			ALTER COLUMN phone TYPE TEXT,
+			ADD COLUMN IF NOT EXISTS patient_name_bidx VARCHAR(64) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS email_bidx VARCHAR(64) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS phone_bidx VARCHAR(64) NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS idx_appointments_patient_name_bidx ON appointments(patient_name_bidx);
+		CREATE INDEX IF NOT EXISTS idx_appointments_email_bidx ON appointments(email_bidx);
+		CREATE INDEX IF NOT EXISTS idx_appointments_phone_bidx ON appointments(phone_bidx);
+	`).Error
+}
+
+// Rollback only works once the rows have been decrypted again, encrypted
+// values do not fit the original column sizes
+func (m *EncryptAppointmentPII) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		ALTER TABLE appointments
+			DROP COLUMN IF EXISTS patient_name_bidx,
+			DROP COLUMN IF EXISTS email_bidx,
+			DROP COLUMN IF EXISTS phone_bidx,
+			ALTER COLUMN patient_name TYPE VARCHAR(100),
+			ALTER COLUMN email TYPE VARCHAR(255),
+			ALTER COLUMN phone TYPE VARCHAR(20);
+	`).Error
+}
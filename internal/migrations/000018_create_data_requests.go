@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateDataRequestsTables struct{}
+
+func (m *CreateDataRequestsTables) ID() string {
+	return "000018_create_data_requests"
+}
+
+func (m *CreateDataRequestsTables) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS notifications (
+			id SERIAL PRIMARY KEY,
+			recipient VARCHAR(255) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			status VARCHAR(10) NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_notifications_recipient ON notifications(LOWER(recipient));
+
+		CREATE TABLE IF NOT EXISTS data_requests (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			resolution TEXT NOT NULL DEFAULT '',
+			requested_by_id INTEGER NOT NULL DEFAULT 0,
+			completed_by_id INTEGER,
+			completed_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_data_requests_user FOREIGN KEY (user_id) REFERENCES users(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_data_requests_user_id ON data_requests(user_id);
+
+		INSERT INTO permissions (name, description) VALUES
+			('data_requests.manage', 'Handle patient data export and erasure requests')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT 'admin', id FROM permissions WHERE name = 'data_requests.manage'
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreateDataRequestsTables) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name = 'data_requests.manage';
+		DROP TABLE IF EXISTS data_requests;
+		DROP TABLE IF EXISTS notifications;
+	`).Error
+}
@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateRetentionTables struct{}
+
+func (m *CreateRetentionTables) ID() string {
+	return "000019_create_retention"
+}
+
+func (m *CreateRetentionTables) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS retention_rules (
+			id SERIAL PRIMARY KEY,
+			entity VARCHAR(50) NOT NULL,
+			action VARCHAR(20) NOT NULL,
+			after_days INTEGER NOT NULL CHECK (after_days > 0),
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT uq_retention_rules_entity_action UNIQUE (entity, action)
+		);
+
+		CREATE TABLE IF NOT EXISTS legal_holds (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			reason TEXT NOT NULL,
+			placed_by_id INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			released_at TIMESTAMP WITH TIME ZONE,
+			released_by_id INTEGER,
+			CONSTRAINT fk_legal_holds_user FOREIGN KEY (user_id) REFERENCES users(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_legal_holds_user_id ON legal_holds(user_id);
+
+		CREATE INDEX IF NOT EXISTS idx_appointments_appointment_time ON appointments(appointment_time);
+
+		INSERT INTO permissions (name, description) VALUES
+			('retention.manage', 'Manage data retention rules and legal holds')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT 'admin', id FROM permissions WHERE name = 'retention.manage'
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreateRetentionTables) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name = 'retention.manage';
+		DROP INDEX IF EXISTS idx_appointments_appointment_time;
+		DROP TABLE IF EXISTS legal_holds;
+		DROP TABLE IF EXISTS retention_rules;
+	`).Error
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateConsentRecordsTable struct{}
+
+func (m *CreateConsentRecordsTable) ID() string {
+	return "000020_create_consent_records"
+}
+
+func (m *CreateConsentRecordsTable) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS consent_records (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			purpose VARCHAR(50) NOT NULL,
+			granted BOOLEAN NOT NULL,
+			version VARCHAR(50) NOT NULL DEFAULT '',
+			channel VARCHAR(20) NOT NULL,
+			recorded_by_id INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_consent_records_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_consent_records_user_purpose ON consent_records(user_id, purpose, id);
+
+		ALTER TABLE service_accounts ADD COLUMN IF NOT EXISTS consent_purpose VARCHAR(50) NOT NULL DEFAULT '';
+
+		INSERT INTO permissions (name, description) VALUES
+			('consents.manage', 'View patient consents and record consents given on paper, by phone or in person')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT r.role, p.id FROM (VALUES
+			('admin', 'consents.manage'),
+			('receptionist', 'consents.manage')
+		) AS r(role, permission)
+		JOIN permissions p ON p.name = r.permission
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreateConsentRecordsTable) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name = 'consents.manage';
+		ALTER TABLE service_accounts DROP COLUMN IF EXISTS consent_purpose;
+		DROP TABLE IF EXISTS consent_records;
+	`).Error
+}
@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateBreakGlassTables struct{}
+
+func (m *CreateBreakGlassTables) ID() string {
+	return "000021_create_break_glass"
+}
+
+func (m *CreateBreakGlassTables) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS break_glass_grants (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			user_name VARCHAR(255) NOT NULL DEFAULT '',
+			reason TEXT NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			ended_at TIMESTAMP WITH TIME ZONE,
+			CONSTRAINT fk_break_glass_grants_user FOREIGN KEY (user_id) REFERENCES users(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_break_glass_grants_user_id ON break_glass_grants(user_id);
+
+		CREATE TABLE IF NOT EXISTS break_glass_accesses (
+			id SERIAL PRIMARY KEY,
+			grant_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			method VARCHAR(10) NOT NULL,
+			path TEXT NOT NULL,
+			entity VARCHAR(50) NOT NULL DEFAULT '',
+			entity_id VARCHAR(64) NOT NULL DEFAULT '',
+			status INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			review_status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			reviewed_by_id INTEGER,
+			reviewed_at TIMESTAMP WITH TIME ZONE,
+			review_note TEXT NOT NULL DEFAULT '',
+			CONSTRAINT fk_break_glass_accesses_grant FOREIGN KEY (grant_id) REFERENCES break_glass_grants(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_break_glass_accesses_grant_id ON break_glass_accesses(grant_id);
+		CREATE INDEX IF NOT EXISTS idx_break_glass_accesses_user_id ON break_glass_accesses(user_id);
+		CREATE INDEX IF NOT EXISTS idx_break_glass_accesses_review_status ON break_glass_accesses(review_status);
+
+		INSERT INTO permissions (name, description) VALUES
+			('break_glass.use', 'Declare an emergency to read every appointment for a limited time'),
+			('break_glass.review', 'Review emergency accesses and export misuse reports')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT r.role, p.id FROM (VALUES
+			('doctor', 'break_glass.use'),
+			('admin', 'break_glass.review')
+		) AS r(role, permission)
+		JOIN permissions p ON p.name = r.permission
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreateBreakGlassTables) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name IN ('break_glass.use', 'break_glass.review');
+		DROP TABLE IF EXISTS break_glass_accesses;
+		DROP TABLE IF EXISTS break_glass_grants;
+	`).Error
+}
@@ -0,0 +1,98 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreatePatientsTables struct{}
+
+func (m *CreatePatientsTables) ID() string {
+	return "000022_create_patients"
+}
+
+// Migrate creates the master patient index and links appointments to it.
+// Existing appointments are linked afterwards with "migrate -link-patients".
+func (m *CreatePatientsTables) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE SEQUENCE IF NOT EXISTS patient_mrn_seq START 1;
+
+		CREATE TABLE IF NOT EXISTS patients (
+			id SERIAL PRIMARY KEY,
+			created_at TIMESTAMP WITH TIME ZONE,
+			updated_at TIMESTAMP WITH TIME ZONE,
+			deleted_at TIMESTAMP WITH TIME ZONE,
+			mrn VARCHAR(20) NOT NULL,
+			full_name TEXT NOT NULL,
+			email TEXT NOT NULL DEFAULT '',
+			phone TEXT NOT NULL DEFAULT '',
+			iin TEXT NOT NULL DEFAULT '',
+			birth_date DATE,
+			user_id INTEGER,
+			full_name_bidx VARCHAR(64) NOT NULL DEFAULT '',
+			email_bidx VARCHAR(64) NOT NULL DEFAULT '',
+			phone_bidx VARCHAR(64) NOT NULL DEFAULT '',
+			iin_bidx VARCHAR(64) NOT NULL DEFAULT '',
+			merged_into_id INTEGER,
+			merged_at TIMESTAMP WITH TIME ZONE,
+			CONSTRAINT fk_patients_user FOREIGN KEY (user_id) REFERENCES users(id),
+			CONSTRAINT fk_patients_merged_into FOREIGN KEY (merged_into_id) REFERENCES patients(id)
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_patients_mrn ON patients(mrn);
+		CREATE INDEX IF NOT EXISTS idx_patients_deleted_at ON patients(deleted_at);
+		CREATE INDEX IF NOT EXISTS idx_patients_user_id ON patients(user_id);
+		CREATE INDEX IF NOT EXISTS idx_patients_full_name_bidx ON patients(full_name_bidx);
+		CREATE INDEX IF NOT EXISTS idx_patients_email_bidx ON patients(email_bidx);
+		CREATE INDEX IF NOT EXISTS idx_patients_phone_bidx ON patients(phone_bidx);
+		CREATE INDEX IF NOT EXISTS idx_patients_iin_bidx ON patients(iin_bidx);
+		CREATE INDEX IF NOT EXISTS idx_patients_birth_date ON patients(birth_date);
+		CREATE INDEX IF NOT EXISTS idx_patients_merged_into_id ON patients(merged_into_id);
+
+		CREATE TABLE IF NOT EXISTS patient_merges (
+			id SERIAL PRIMARY KEY,
+			survivor_id INTEGER NOT NULL,
+			merged_id INTEGER NOT NULL,
+			merged_mrn VARCHAR(20) NOT NULL,
+			appointments INTEGER NOT NULL DEFAULT 0,
+			fields VARCHAR(255) NOT NULL DEFAULT '',
+			merged_by_id INTEGER NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_patient_merges_survivor FOREIGN KEY (survivor_id) REFERENCES patients(id),
+			CONSTRAINT fk_patient_merges_merged FOREIGN KEY (merged_id) REFERENCES patients(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_patient_merges_survivor_id ON patient_merges(survivor_id);
+		CREATE INDEX IF NOT EXISTS idx_patient_merges_merged_id ON patient_merges(merged_id);
+
+		ALTER TABLE appointments ADD COLUMN IF NOT EXISTS patient_id INTEGER REFERENCES patients(id);
+		CREATE INDEX IF NOT EXISTS idx_appointments_patient_id ON appointments(patient_id);
+
+		INSERT INTO permissions (name, description) VALUES
+			('patients.read', 'Search the patient index and view patient records'),
+			('patients.read.own', 'View the patients who have an appointment with the linked doctor profile'),
+			('patients.write', 'Register patients and edit their details'),
+			('patients.merge', 'Merge duplicate patient records')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT r.role, p.id FROM (VALUES
+			('admin', 'patients.read'),
+			('admin', 'patients.write'),
+			('admin', 'patients.merge'),
+			('receptionist', 'patients.read'),
+			('receptionist', 'patients.write'),
+			('doctor', 'patients.read.own'),
+			('nurse', 'patients.read')
+		) AS r(role, permission)
+		JOIN permissions p ON p.name = r.permission
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreatePatientsTables) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name IN ('patients.read', 'patients.read.own', 'patients.write', 'patients.merge');
+		ALTER TABLE appointments DROP COLUMN IF EXISTS patient_id;
+		DROP TABLE IF EXISTS patient_merges;
+		DROP TABLE IF EXISTS patients;
+		DROP SEQUENCE IF EXISTS patient_mrn_seq;
+	`).Error
+}
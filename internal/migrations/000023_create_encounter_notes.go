@@ -0,0 +1,90 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateEncounterNotesTables struct{}
+
+func (m *CreateEncounterNotesTables) ID() string {
+	return "000023_create_encounter_notes"
+}
+
+func (m *CreateEncounterNotesTables) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS encounter_notes (
+			id SERIAL PRIMARY KEY,
+			appointment_id INTEGER NOT NULL,
+			doctor_id INTEGER NOT NULL,
+			patient_id INTEGER,
+			subjective TEXT NOT NULL DEFAULT '',
+			objective TEXT NOT NULL DEFAULT '',
+			assessment TEXT NOT NULL DEFAULT '',
+			plan TEXT NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL DEFAULT 'draft',
+			version INTEGER NOT NULL DEFAULT 1,
+			created_by_id INTEGER NOT NULL,
+			updated_by_id INTEGER NOT NULL,
+			signed_by_id INTEGER,
+			signed_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_encounter_notes_appointment FOREIGN KEY (appointment_id) REFERENCES appointments(id),
+			CONSTRAINT fk_encounter_notes_doctor FOREIGN KEY (doctor_id) REFERENCES doctors(id),
+			CONSTRAINT fk_encounter_notes_patient FOREIGN KEY (patient_id) REFERENCES patients(id)
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_encounter_notes_appointment_id ON encounter_notes(appointment_id);
+		CREATE INDEX IF NOT EXISTS idx_encounter_notes_doctor_id ON encounter_notes(doctor_id);
+		CREATE INDEX IF NOT EXISTS idx_encounter_notes_patient_id ON encounter_notes(patient_id);
+
+		CREATE TABLE IF NOT EXISTS encounter_note_versions (
+			id SERIAL PRIMARY KEY,
+			note_id INTEGER NOT NULL,
+			version INTEGER NOT NULL,
+			subjective TEXT NOT NULL DEFAULT '',
+			objective TEXT NOT NULL DEFAULT '',
+			assessment TEXT NOT NULL DEFAULT '',
+			plan TEXT NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL,
+			saved_by_id INTEGER NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_encounter_note_versions_note FOREIGN KEY (note_id) REFERENCES encounter_notes(id),
+			CONSTRAINT uq_encounter_note_versions UNIQUE (note_id, version)
+		);
+
+		CREATE TABLE IF NOT EXISTS encounter_addenda (
+			id SERIAL PRIMARY KEY,
+			note_id INTEGER NOT NULL,
+			text TEXT NOT NULL,
+			author_id INTEGER NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_encounter_addenda_note FOREIGN KEY (note_id) REFERENCES encounter_notes(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_encounter_addenda_note_id ON encounter_addenda(note_id);
+
+		INSERT INTO permissions (name, description) VALUES
+			('encounters.read.all', 'Read the encounter notes of every appointment'),
+			('encounters.read.own', 'Read the encounter notes of appointments of the linked doctor profile'),
+			('encounters.write.all', 'Write and sign the encounter notes of every appointment'),
+			('encounters.write.own', 'Write and sign the encounter notes of appointments of the linked doctor profile')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT r.role, p.id FROM (VALUES
+			('doctor', 'encounters.read.own'),
+			('doctor', 'encounters.write.own'),
+			('nurse', 'encounters.read.all')
+		) AS r(role, permission)
+		JOIN permissions p ON p.name = r.permission
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreateEncounterNotesTables) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name IN ('encounters.read.all', 'encounters.read.own', 'encounters.write.all', 'encounters.write.own');
+		DROP TABLE IF EXISTS encounter_addenda;
+		DROP TABLE IF EXISTS encounter_note_versions;
+		DROP TABLE IF EXISTS encounter_notes;
+	`).Error
+}
@@ -0,0 +1,102 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreatePrescriptionsTables struct{}
+
+func (m *CreatePrescriptionsTables) ID() string {
+	return "000024_create_prescriptions"
+}
+
+func (m *CreatePrescriptionsTables) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS formulary_drugs (
+			id SERIAL PRIMARY KEY,
+			code VARCHAR(50) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			form VARCHAR(100) NOT NULL DEFAULT '',
+			strength VARCHAR(100) NOT NULL DEFAULT '',
+			atc_code VARCHAR(20) NOT NULL DEFAULT '',
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_formulary_drugs_code ON formulary_drugs(code);
+		CREATE INDEX IF NOT EXISTS idx_formulary_drugs_atc_code ON formulary_drugs(atc_code);
+		CREATE INDEX IF NOT EXISTS idx_formulary_drugs_name ON formulary_drugs(LOWER(name));
+
+		CREATE TABLE IF NOT EXISTS prescriptions (
+			id SERIAL PRIMARY KEY,
+			appointment_id INTEGER NOT NULL,
+			encounter_note_id INTEGER,
+			patient_id INTEGER,
+			doctor_id INTEGER NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'draft',
+			verification_code VARCHAR(20),
+			notes TEXT NOT NULL DEFAULT '',
+			created_by_id INTEGER NOT NULL,
+			issued_at TIMESTAMP WITH TIME ZONE,
+			cancelled_at TIMESTAMP WITH TIME ZONE,
+			cancelled_by_id INTEGER,
+			cancel_reason TEXT NOT NULL DEFAULT '',
+			renewed_from_id INTEGER,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_prescriptions_appointment FOREIGN KEY (appointment_id) REFERENCES appointments(id),
+			CONSTRAINT fk_prescriptions_encounter_note FOREIGN KEY (encounter_note_id) REFERENCES encounter_notes(id),
+			CONSTRAINT fk_prescriptions_patient FOREIGN KEY (patient_id) REFERENCES patients(id),
+			CONSTRAINT fk_prescriptions_doctor FOREIGN KEY (doctor_id) REFERENCES doctors(id),
+			CONSTRAINT fk_prescriptions_renewed_from FOREIGN KEY (renewed_from_id) REFERENCES prescriptions(id)
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_prescriptions_verification_code ON prescriptions(verification_code);
+		CREATE INDEX IF NOT EXISTS idx_prescriptions_appointment_id ON prescriptions(appointment_id);
+		CREATE INDEX IF NOT EXISTS idx_prescriptions_patient_id ON prescriptions(patient_id);
+		CREATE INDEX IF NOT EXISTS idx_prescriptions_doctor_id ON prescriptions(doctor_id);
+		CREATE INDEX IF NOT EXISTS idx_prescriptions_renewed_from_id ON prescriptions(renewed_from_id);
+
+		CREATE TABLE IF NOT EXISTS prescription_lines (
+			id SERIAL PRIMARY KEY,
+			prescription_id INTEGER NOT NULL,
+			drug_id INTEGER NOT NULL,
+			drug_name VARCHAR(255) NOT NULL,
+			dose VARCHAR(100) NOT NULL,
+			route VARCHAR(20) NOT NULL,
+			frequency VARCHAR(100) NOT NULL,
+			duration_days INTEGER NOT NULL,
+			quantity INTEGER NOT NULL,
+			instructions TEXT NOT NULL DEFAULT '',
+			CONSTRAINT fk_prescription_lines_prescription FOREIGN KEY (prescription_id) REFERENCES prescriptions(id) ON DELETE CASCADE,
+			CONSTRAINT fk_prescription_lines_drug FOREIGN KEY (drug_id) REFERENCES formulary_drugs(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_prescription_lines_prescription_id ON prescription_lines(prescription_id);
+
+		INSERT INTO permissions (name, description) VALUES
+			('prescriptions.read', 'View prescriptions and the active medications of patients'),
+			('prescriptions.read.own', 'View the prescriptions of patients of the linked doctor profile'),
+			('prescriptions.write.all', 'Write, issue, cancel and renew every prescription'),
+			('prescriptions.write.own', 'Write, issue, cancel and renew prescriptions of the linked doctor profile'),
+			('formulary.manage', 'Import the drug catalogue')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT r.role, p.id FROM (VALUES
+			('doctor', 'prescriptions.read.own'),
+			('doctor', 'prescriptions.write.own'),
+			('nurse', 'prescriptions.read'),
+			('admin', 'formulary.manage')
+		) AS r(role, permission)
+		JOIN permissions p ON p.name = r.permission
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreatePrescriptionsTables) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name IN ('prescriptions.read', 'prescriptions.read.own', 'prescriptions.write.all', 'prescriptions.write.own', 'formulary.manage');
+		DROP TABLE IF EXISTS prescription_lines;
+		DROP TABLE IF EXISTS prescriptions;
+		DROP TABLE IF EXISTS formulary_drugs;
+	`).Error
+}
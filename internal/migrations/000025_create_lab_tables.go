@@ -0,0 +1,112 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateLabTables struct{}
+
+func (m *CreateLabTables) ID() string {
+	return "000025_create_lab_tables"
+}
+
+func (m *CreateLabTables) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS lab_tests (
+			id SERIAL PRIMARY KEY,
+			code VARCHAR(50) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			specimen VARCHAR(100) NOT NULL DEFAULT '',
+			unit VARCHAR(50) NOT NULL DEFAULT '',
+			ref_low DOUBLE PRECISION,
+			ref_high DOUBLE PRECISION,
+			ref_text VARCHAR(100) NOT NULL DEFAULT '',
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_lab_tests_code ON lab_tests(code);
+		CREATE INDEX IF NOT EXISTS idx_lab_tests_name ON lab_tests(LOWER(name));
+
+		CREATE TABLE IF NOT EXISTS lab_orders (
+			id SERIAL PRIMARY KEY,
+			appointment_id INTEGER NOT NULL,
+			patient_id INTEGER,
+			doctor_id INTEGER NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'ordered',
+			notes TEXT NOT NULL DEFAULT '',
+			ordered_by_id INTEGER NOT NULL,
+			collected_at TIMESTAMP WITH TIME ZONE,
+			collected_by_id INTEGER,
+			resulted_at TIMESTAMP WITH TIME ZONE,
+			cancelled_at TIMESTAMP WITH TIME ZONE,
+			cancelled_by_id INTEGER,
+			cancel_reason TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_lab_orders_appointment FOREIGN KEY (appointment_id) REFERENCES appointments(id),
+			CONSTRAINT fk_lab_orders_patient FOREIGN KEY (patient_id) REFERENCES patients(id),
+			CONSTRAINT fk_lab_orders_doctor FOREIGN KEY (doctor_id) REFERENCES doctors(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_lab_orders_appointment_id ON lab_orders(appointment_id);
+		CREATE INDEX IF NOT EXISTS idx_lab_orders_patient_id ON lab_orders(patient_id);
+		CREATE INDEX IF NOT EXISTS idx_lab_orders_doctor_id ON lab_orders(doctor_id);
+		CREATE INDEX IF NOT EXISTS idx_lab_orders_status ON lab_orders(status);
+
+		CREATE TABLE IF NOT EXISTS lab_results (
+			id SERIAL PRIMARY KEY,
+			order_id INTEGER NOT NULL,
+			test_id INTEGER NOT NULL,
+			test_code VARCHAR(50) NOT NULL,
+			test_name VARCHAR(255) NOT NULL,
+			value TEXT NOT NULL DEFAULT '',
+			numeric_value DOUBLE PRECISION,
+			unit VARCHAR(50) NOT NULL DEFAULT '',
+			ref_low DOUBLE PRECISION,
+			ref_high DOUBLE PRECISION,
+			ref_text VARCHAR(100) NOT NULL DEFAULT '',
+			flag VARCHAR(10) NOT NULL DEFAULT '',
+			comment TEXT NOT NULL DEFAULT '',
+			source VARCHAR(10) NOT NULL DEFAULT '',
+			entered_by_id INTEGER,
+			resulted_at TIMESTAMP WITH TIME ZONE,
+			CONSTRAINT fk_lab_results_order FOREIGN KEY (order_id) REFERENCES lab_orders(id) ON DELETE CASCADE,
+			CONSTRAINT fk_lab_results_test FOREIGN KEY (test_id) REFERENCES lab_tests(id),
+			CONSTRAINT uq_lab_results_order_test UNIQUE (order_id, test_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_lab_results_order_id ON lab_results(order_id);
+		CREATE INDEX IF NOT EXISTS idx_lab_results_test_id ON lab_results(test_id);
+
+		INSERT INTO permissions (name, description) VALUES
+			('labs.read', 'View lab orders, results and the lab history of patients'),
+			('labs.read.own', 'View the lab orders and results of patients of the linked doctor profile'),
+			('labs.order.all', 'Order and cancel lab tests for every appointment'),
+			('labs.order.own', 'Order and cancel lab tests for appointments of the linked doctor profile'),
+			('labs.collect', 'Record the collection of specimens'),
+			('labs.results', 'Enter and ingest lab results'),
+			('labs.manage', 'Manage the lab test catalogue')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT r.role, p.id FROM (VALUES
+			('doctor', 'labs.read.own'),
+			('doctor', 'labs.order.own'),
+			('doctor', 'labs.collect'),
+			('nurse', 'labs.read'),
+			('nurse', 'labs.collect'),
+			('nurse', 'labs.results'),
+			('admin', 'labs.manage')
+		) AS r(role, permission)
+		JOIN permissions p ON p.name = r.permission
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreateLabTables) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name IN ('labs.read', 'labs.read.own', 'labs.order.all', 'labs.order.own', 'labs.collect', 'labs.results', 'labs.manage');
+		DROP TABLE IF EXISTS lab_results;
+		DROP TABLE IF EXISTS lab_orders;
+		DROP TABLE IF EXISTS lab_tests;
+	`).Error
+}
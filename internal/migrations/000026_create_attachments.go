@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateAttachmentsTable struct{}
+
+func (m *CreateAttachmentsTable) ID() string {
+	return "000026_create_attachments"
+}
+
+func (m *CreateAttachmentsTable) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS attachments (
+			id SERIAL PRIMARY KEY,
+			patient_id INTEGER,
+			appointment_id INTEGER,
+			file_name VARCHAR(255) NOT NULL,
+			content_type VARCHAR(100) NOT NULL,
+			size BIGINT NOT NULL,
+			sha256 VARCHAR(64) NOT NULL,
+			storage_key VARCHAR(255) NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			scan_status VARCHAR(10) NOT NULL,
+			uploaded_by_id INTEGER,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			deleted_at TIMESTAMP WITH TIME ZONE,
+			CONSTRAINT fk_attachments_patient FOREIGN KEY (patient_id) REFERENCES patients(id),
+			CONSTRAINT fk_attachments_appointment FOREIGN KEY (appointment_id) REFERENCES appointments(id),
+			CONSTRAINT chk_attachments_owner CHECK ((patient_id IS NULL) <> (appointment_id IS NULL))
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_attachments_storage_key ON attachments(storage_key);
+		CREATE INDEX IF NOT EXISTS idx_attachments_patient_id ON attachments(patient_id);
+		CREATE INDEX IF NOT EXISTS idx_attachments_appointment_id ON attachments(appointment_id);
+		CREATE INDEX IF NOT EXISTS idx_attachments_deleted_at ON attachments(deleted_at);
+
+		INSERT INTO permissions (name, description) VALUES
+			('attachments.read', 'View and download attachments of patients and appointments'),
+			('attachments.read.own', 'View and download the attachments of patients of the linked doctor profile'),
+			('attachments.write', 'Upload attachments to patients and appointments'),
+			('attachments.delete', 'Delete attachments')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT r.role, p.id FROM (VALUES
+			('doctor', 'attachments.read.own'),
+			('doctor', 'attachments.write'),
+			('nurse', 'attachments.read'),
+			('nurse', 'attachments.write'),
+			('receptionist', 'attachments.read'),
+			('receptionist', 'attachments.write'),
+			('admin', 'attachments.delete')
+		) AS r(role, permission)
+		JOIN permissions p ON p.name = r.permission
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreateAttachmentsTable) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name IN ('attachments.read', 'attachments.read.own', 'attachments.write', 'attachments.delete');
+		DROP TABLE IF EXISTS attachments;
+	`).Error
+}
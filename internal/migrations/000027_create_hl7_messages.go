@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateHL7MessagesTable struct{}
+
+func (m *CreateHL7MessagesTable) ID() string {
+	return "000027_create_hl7_messages"
+}
+
+func (m *CreateHL7MessagesTable) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS hl7_messages (
+			id SERIAL PRIMARY KEY,
+			direction VARCHAR(3) NOT NULL,
+			message_type VARCHAR(20) NOT NULL,
+			control_id VARCHAR(50) NOT NULL,
+			status VARCHAR(10) NOT NULL,
+			payload TEXT NOT NULL,
+			ack TEXT NOT NULL DEFAULT '',
+			ack_code VARCHAR(2) NOT NULL DEFAULT '',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TIMESTAMP WITH TIME ZONE,
+			appointment_id INTEGER,
+			patient_id INTEGER,
+			replay_of_id INTEGER,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			completed_at TIMESTAMP WITH TIME ZONE,
+			CONSTRAINT fk_hl7_messages_replay_of FOREIGN KEY (replay_of_id) REFERENCES hl7_messages(id),
+			CONSTRAINT chk_hl7_messages_direction CHECK (direction IN ('in', 'out'))
+		);
+		CREATE INDEX IF NOT EXISTS idx_hl7_messages_outbox ON hl7_messages(id) WHERE direction = 'out' AND status = 'pending';
+		CREATE INDEX IF NOT EXISTS idx_hl7_messages_control_id ON hl7_messages(control_id);
+
+		INSERT INTO permissions (name, description) VALUES
+			('hl7.manage', 'View and replay HL7 messages exchanged with the hospital information system')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT 'admin', id FROM permissions WHERE name = 'hl7.manage'
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreateHL7MessagesTable) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name = 'hl7.manage';
+		DROP TABLE IF EXISTS hl7_messages;
+	`).Error
+}
@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateDiagnosesTables struct{}
+
+func (m *CreateDiagnosesTables) ID() string {
+	return "000028_create_diagnoses"
+}
+
+func (m *CreateDiagnosesTables) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS icd10_codes (
+			id SERIAL PRIMARY KEY,
+			code VARCHAR(10) NOT NULL,
+			category VARCHAR(3) NOT NULL,
+			title_ru TEXT NOT NULL DEFAULT '',
+			title_en TEXT NOT NULL DEFAULT '',
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', title_ru || ' ' || title_en)) STORED,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_icd10_codes_code ON icd10_codes(code);
+		CREATE INDEX IF NOT EXISTS idx_icd10_codes_category ON icd10_codes(category);
+		CREATE INDEX IF NOT EXISTS idx_icd10_codes_code_prefix ON icd10_codes(REPLACE(code, '.', '') text_pattern_ops);
+		CREATE INDEX IF NOT EXISTS idx_icd10_codes_search ON icd10_codes USING GIN (search_vector);
+
+		CREATE TABLE IF NOT EXISTS diagnoses (
+			id SERIAL PRIMARY KEY,
+			appointment_id INTEGER NOT NULL,
+			encounter_note_id INTEGER,
+			code_id INTEGER NOT NULL,
+			code VARCHAR(10) NOT NULL,
+			kind VARCHAR(10) NOT NULL,
+			comment TEXT NOT NULL DEFAULT '',
+			created_by_id INTEGER NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			deleted_at TIMESTAMP WITH TIME ZONE,
+			CONSTRAINT fk_diagnoses_appointment FOREIGN KEY (appointment_id) REFERENCES appointments(id),
+			CONSTRAINT fk_diagnoses_encounter_note FOREIGN KEY (encounter_note_id) REFERENCES encounter_notes(id),
+			CONSTRAINT fk_diagnoses_code FOREIGN KEY (code_id) REFERENCES icd10_codes(id),
+			CONSTRAINT fk_diagnoses_created_by FOREIGN KEY (created_by_id) REFERENCES users(id),
+			CONSTRAINT chk_diagnoses_kind CHECK (kind IN ('primary', 'secondary'))
+		);
+		CREATE INDEX IF NOT EXISTS idx_diagnoses_appointment_id ON diagnoses(appointment_id);
+		CREATE INDEX IF NOT EXISTS idx_diagnoses_code ON diagnoses(code);
+		CREATE INDEX IF NOT EXISTS idx_diagnoses_deleted_at ON diagnoses(deleted_at);
+		-- One primary diagnosis per appointment
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_diagnoses_primary ON diagnoses(appointment_id)
+			WHERE kind = 'primary' AND deleted_at IS NULL;
+
+		INSERT INTO permissions (name, description) VALUES
+			('diagnoses.read', 'View the diagnoses of appointments'),
+			('diagnoses.read.own', 'View the diagnoses of patients of the linked doctor profile'),
+			('diagnoses.write.all', 'Give and remove diagnoses at every appointment'),
+			('diagnoses.write.own', 'Give and remove diagnoses at appointments of the linked doctor profile'),
+			('icd.manage', 'Import the ICD-10 catalogue'),
+			('reports.read', 'View reports such as the top diagnoses per department')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT r.role, p.id FROM (VALUES
+			('doctor', 'diagnoses.read.own'),
+			('doctor', 'diagnoses.write.own'),
+			('nurse', 'diagnoses.read'),
+			('admin', 'icd.manage'),
+			('admin', 'reports.read')
+		) AS r(role, permission)
+		JOIN permissions p ON p.name = r.permission
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreateDiagnosesTables) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name IN ('diagnoses.read', 'diagnoses.read.own', 'diagnoses.write.all', 'diagnoses.write.own', 'icd.manage', 'reports.read');
+		DROP TABLE IF EXISTS diagnoses;
+		DROP TABLE IF EXISTS icd10_codes;
+	`).Error
+}
@@ -0,0 +1,121 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateAllergiesTables struct{}
+
+func (m *CreateAllergiesTables) ID() string {
+	return "000029_create_allergies"
+}
+
+func (m *CreateAllergiesTables) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS patient_allergies (
+			id SERIAL PRIMARY KEY,
+			patient_id INTEGER NOT NULL,
+			substance VARCHAR(255) NOT NULL,
+			atc_code VARCHAR(20) NOT NULL DEFAULT '',
+			reaction TEXT NOT NULL DEFAULT '',
+			severity VARCHAR(20) NOT NULL,
+			notes TEXT NOT NULL DEFAULT '',
+			recorded_by_id INTEGER NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			deleted_at TIMESTAMP WITH TIME ZONE,
+			CONSTRAINT fk_patient_allergies_patient FOREIGN KEY (patient_id) REFERENCES patients(id),
+			CONSTRAINT fk_patient_allergies_recorded_by FOREIGN KEY (recorded_by_id) REFERENCES users(id),
+			CONSTRAINT chk_patient_allergies_severity CHECK (severity IN ('mild', 'moderate', 'severe', 'life_threatening'))
+		);
+		CREATE INDEX IF NOT EXISTS idx_patient_allergies_patient_id ON patient_allergies(patient_id);
+		CREATE INDEX IF NOT EXISTS idx_patient_allergies_deleted_at ON patient_allergies(deleted_at);
+
+		CREATE TABLE IF NOT EXISTS patient_conditions (
+			id SERIAL PRIMARY KEY,
+			patient_id INTEGER NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			code VARCHAR(10) NOT NULL DEFAULT '',
+			since DATE,
+			resolved_at DATE,
+			notes TEXT NOT NULL DEFAULT '',
+			recorded_by_id INTEGER NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			deleted_at TIMESTAMP WITH TIME ZONE,
+			CONSTRAINT fk_patient_conditions_patient FOREIGN KEY (patient_id) REFERENCES patients(id),
+			CONSTRAINT fk_patient_conditions_recorded_by FOREIGN KEY (recorded_by_id) REFERENCES users(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_patient_conditions_patient_id ON patient_conditions(patient_id);
+		CREATE INDEX IF NOT EXISTS idx_patient_conditions_deleted_at ON patient_conditions(deleted_at);
+
+		CREATE TABLE IF NOT EXISTS procedures (
+			id SERIAL PRIMARY KEY,
+			code VARCHAR(50) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			agent VARCHAR(255) NOT NULL DEFAULT '',
+			agent_atc_code VARCHAR(20) NOT NULL DEFAULT '',
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_procedures_code ON procedures(code);
+
+		ALTER TABLE appointments ADD COLUMN IF NOT EXISTS procedure_id INTEGER REFERENCES procedures(id);
+		CREATE INDEX IF NOT EXISTS idx_appointments_procedure_id ON appointments(procedure_id);
+
+		-- Acknowledged warnings are kept for audit, rows are never updated
+		CREATE TABLE IF NOT EXISTS allergy_acknowledgements (
+			id SERIAL PRIMARY KEY,
+			patient_id INTEGER NOT NULL,
+			allergy_id INTEGER NOT NULL,
+			prescription_id INTEGER,
+			appointment_id INTEGER,
+			agent VARCHAR(255) NOT NULL,
+			severity VARCHAR(20) NOT NULL,
+			warning TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			acknowledged_by_id INTEGER NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_allergy_acknowledgements_patient FOREIGN KEY (patient_id) REFERENCES patients(id),
+			CONSTRAINT fk_allergy_acknowledgements_allergy FOREIGN KEY (allergy_id) REFERENCES patient_allergies(id),
+			CONSTRAINT fk_allergy_acknowledgements_prescription FOREIGN KEY (prescription_id) REFERENCES prescriptions(id),
+			CONSTRAINT fk_allergy_acknowledgements_appointment FOREIGN KEY (appointment_id) REFERENCES appointments(id),
+			CONSTRAINT fk_allergy_acknowledgements_acknowledged_by FOREIGN KEY (acknowledged_by_id) REFERENCES users(id),
+			CONSTRAINT chk_allergy_acknowledgements_subject CHECK ((prescription_id IS NULL) <> (appointment_id IS NULL))
+		);
+		CREATE INDEX IF NOT EXISTS idx_allergy_acknowledgements_patient_id ON allergy_acknowledgements(patient_id);
+		CREATE INDEX IF NOT EXISTS idx_allergy_acknowledgements_allergy_id ON allergy_acknowledgements(allergy_id);
+		CREATE INDEX IF NOT EXISTS idx_allergy_acknowledgements_prescription_id ON allergy_acknowledgements(prescription_id);
+		CREATE INDEX IF NOT EXISTS idx_allergy_acknowledgements_appointment_id ON allergy_acknowledgements(appointment_id);
+
+		INSERT INTO permissions (name, description) VALUES
+			('allergies.read', 'View the allergies, chronic conditions and acknowledged allergy warnings of patients'),
+			('allergies.read.own', 'View the allergies, chronic conditions and acknowledged allergy warnings of patients of the linked doctor profile'),
+			('allergies.write', 'Record the allergies and chronic conditions of patients'),
+			('procedures.manage', 'Manage the catalogue of procedures and their contrast agents')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission_id)
+		SELECT r.role, p.id FROM (VALUES
+			('doctor', 'allergies.read.own'),
+			('doctor', 'allergies.write'),
+			('nurse', 'allergies.read'),
+			('nurse', 'allergies.write'),
+			('admin', 'procedures.manage')
+		) AS r(role, permission)
+		JOIN permissions p ON p.name = r.permission
+		ON CONFLICT DO NOTHING;
+	`).Error
+}
+
+func (m *CreateAllergiesTables) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DELETE FROM permissions WHERE name IN ('allergies.read', 'allergies.read.own', 'allergies.write', 'procedures.manage');
+		DROP TABLE IF EXISTS allergy_acknowledgements;
+		ALTER TABLE appointments DROP COLUMN IF EXISTS procedure_id;
+		DROP TABLE IF EXISTS procedures;
+		DROP TABLE IF EXISTS patient_conditions;
+		DROP TABLE IF EXISTS patient_allergies;
+	`).Error
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type CreateAuditCheckpointsTable struct{}
+
+func (m *CreateAuditCheckpointsTable) ID() string {
+	return "000030_create_audit_checkpoints"
+}
+
+// Migrate creates the checkpoints of the audit log, append-only like the
+// log itself
+func (m *CreateAuditCheckpointsTable) Migrate(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_checkpoints (
+			id BIGSERIAL PRIMARY KEY,
+			entry_id BIGINT NOT NULL,
+			hash VARCHAR(64) NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_checkpoints_entry_id ON audit_checkpoints(entry_id);
+
+		DROP TRIGGER IF EXISTS audit_checkpoints_no_modify ON audit_checkpoints;
+		CREATE TRIGGER audit_checkpoints_no_modify BEFORE UPDATE OR DELETE ON audit_checkpoints
+			FOR EACH ROW EXECUTE PROCEDURE audit_logs_append_only();
+		DROP TRIGGER IF EXISTS audit_checkpoints_no_truncate ON audit_checkpoints;
+		CREATE TRIGGER audit_checkpoints_no_truncate BEFORE TRUNCATE ON audit_checkpoints
+			FOR EACH STATEMENT EXECUTE PROCEDURE audit_logs_append_only();
+	`).Error
+}
+
+func (m *CreateAuditCheckpointsTable) Rollback(db *gorm.DB) error {
+	return db.Exec(`
+		DROP TABLE IF EXISTS audit_checkpoints;
+	`).Error
+}
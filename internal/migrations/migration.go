@@ -70,29 +70,29 @@ func (m *Migrator) Migrate() error {
 	for _, migration := range m.migrations {
 		if !appliedMap[migration.ID()] {
 			log.Printf("Running migration: %s", migration.ID())
-			
+
 			err := m.db.Transaction(func(tx *gorm.DB) error {
 				if err := migration.Migrate(tx); err != nil {
 					return err
 				}
-				
+
 				// Record migration as applied
 				record := MigrationRecord{
 					ID:        migration.ID(),
 					AppliedAt: time.Now(),
 				}
-				
+
 				return tx.Create(&record).Error
 			})
-			
+
 			if err != nil {
 				return fmt.Errorf("migration %s failed: %w", migration.ID(), err)
 			}
-			
+
 			log.Printf("Migration %s completed successfully", migration.ID())
 		}
 	}
-	
+
 	return nil
 }
 
@@ -107,7 +107,7 @@ func (m *Migrator) RollbackLast() error {
 		}
 		return fmt.Errorf("failed to get last migration: %w", result.Error)
 	}
-	
+
 	// Find the migration to rollback
 	var migrationToRollback Migration
 	for _, migration := range m.migrations {
@@ -116,27 +116,27 @@ func (m *Migrator) RollbackLast() error {
 			break
 		}
 	}
-	
+
 	if migrationToRollback == nil {
 		return fmt.Errorf("migration %s not found in registered migrations", lastMigration.ID)
 	}
-	
+
 	// Rollback the migration
 	log.Printf("Rolling back migration: %s", lastMigration.ID)
-	
+
 	err := m.db.Transaction(func(tx *gorm.DB) error {
 		if err := migrationToRollback.Rollback(tx); err != nil {
 			return err
 		}
-		
+
 		// Remove the migration record
 		return tx.Delete(&lastMigration).Error
 	})
-	
+
 	if err != nil {
 		return fmt.Errorf("rollback of migration %s failed: %w", lastMigration.ID, err)
 	}
-	
+
 	log.Printf("Rollback of migration %s completed successfully", lastMigration.ID)
 	return nil
-} 
\ No newline at end of file
+}
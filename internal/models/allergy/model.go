@@ -0,0 +1,250 @@
+package allergy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Severity string
+
+const (
+	SeverityMild            Severity = "mild"
+	SeverityModerate        Severity = "moderate"
+	SeveritySevere          Severity = "severe"
+	SeverityLifeThreatening Severity = "life_threatening"
+)
+
+func (s Severity) IsValid() bool {
+	switch s {
+	case SeverityMild, SeverityModerate, SeveritySevere, SeverityLifeThreatening:
+		return true
+	}
+	return false
+}
+
+// Allergy is a substance the patient reacts to. Substance is matched against
+// the names of drugs and contrast agents; ATCCode, e.g. "J01C" for
+// penicillins or "V08A" for iodinated contrast media, also matches every
+// drug of that ATC group whatever its name.
+type Allergy struct {
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	PatientID    uint           `json:"patient_id" gorm:"index;not null"`
+	Substance    string         `json:"substance" gorm:"size:255;not null"`
+	ATCCode      string         `json:"atc_code,omitempty" gorm:"column:atc_code;size:20"`
+	Reaction     string         `json:"reaction"`
+	Severity     Severity       `json:"severity" gorm:"size:20;not null"`
+	Notes        string         `json:"notes"`
+	RecordedByID uint           `json:"recorded_by_id" gorm:"not null"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func (Allergy) TableName() string {
+	return "patient_allergies"
+}
+
+// AllergyInput is an allergy as entered by staff
+type AllergyInput struct {
+	Substance string   `json:"substance" binding:"required"`
+	ATCCode   string   `json:"atc_code"`
+	Reaction  string   `json:"reaction"`
+	Severity  Severity `json:"severity" binding:"required"`
+	Notes     string   `json:"notes"`
+}
+
+// Condition is a chronic condition of the patient, coded with ICD-10 when
+// Code is set
+type Condition struct {
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	PatientID    uint           `json:"patient_id" gorm:"index;not null"`
+	Name         string         `json:"name" gorm:"size:255;not null"`
+	Code         string         `json:"code,omitempty" gorm:"size:10"`
+	Since        *time.Time     `json:"since,omitempty" gorm:"type:date"`
+	ResolvedAt   *time.Time     `json:"resolved_at,omitempty" gorm:"type:date"`
+	Notes        string         `json:"notes"`
+	RecordedByID uint           `json:"recorded_by_id" gorm:"not null"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func (Condition) TableName() string {
+	return "patient_conditions"
+}
+
+// ConditionInput is a condition as entered by staff. The name defaults to
+// the ICD-10 title of the code.
+type ConditionInput struct {
+	Name       string     `json:"name"`
+	Code       string     `json:"code"`
+	Since      *time.Time `json:"since"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	Notes      string     `json:"notes"`
+}
+
+// Agent is something given to the patient that is checked against their
+// allergies: a prescribed drug or the contrast agent of a procedure
+type Agent struct {
+	Name    string
+	ATCCode string
+}
+
+// Warning tells that Agent may trigger the allergy AllergyID
+type Warning struct {
+	AllergyID uint     `json:"allergy_id"`
+	Substance string   `json:"substance"`
+	Reaction  string   `json:"reaction,omitempty"`
+	Severity  Severity `json:"severity"`
+	Agent     string   `json:"agent"`
+	// Match is what matched, the substance or the ATC group
+	Match string `json:"match"`
+}
+
+// String describes the warning, e.g. "Amoxicillin: allergy to penicillin
+// (severe, anaphylaxis), matched by ATC group J01C"
+func (w Warning) String() string {
+	s := fmt.Sprintf("%s: allergy to %s (%s", w.Agent, w.Substance, w.Severity)
+	if w.Reaction != "" {
+		s += ", " + w.Reaction
+	}
+	return s + "), matched by " + w.Match
+}
+
+// Check returns a warning for every allergy triggered by one of the agents,
+// once per allergy and agent
+func Check(allergies []Allergy, agents []Agent) []Warning {
+	var warnings []Warning
+	for _, a := range allergies {
+		substance := strings.ToLower(strings.TrimSpace(a.Substance))
+		group := strings.ToUpper(strings.TrimSpace(a.ATCCode))
+		for _, agent := range agents {
+			var match string
+			switch {
+			case group != "" && strings.HasPrefix(strings.ToUpper(agent.ATCCode), group):
+				match = "ATC group " + group
+			case substance != "" && strings.Contains(strings.ToLower(agent.Name), substance):
+				match = "substance " + a.Substance
+			default:
+				continue
+			}
+			warnings = append(warnings, Warning{
+				AllergyID: a.ID,
+				Substance: a.Substance,
+				Reaction:  a.Reaction,
+				Severity:  a.Severity,
+				Agent:     agent.Name,
+				Match:     match,
+			})
+		}
+	}
+	return warnings
+}
+
+// Acknowledgement records that a doctor went ahead despite a warning, with
+// the prescription or the appointment procedure it was given for.
+// Acknowledgements are never changed or deleted.
+type Acknowledgement struct {
+	ID             uint     `json:"id" gorm:"primaryKey"`
+	PatientID      uint     `json:"patient_id" gorm:"index;not null"`
+	AllergyID      uint     `json:"allergy_id" gorm:"index;not null"`
+	PrescriptionID *uint    `json:"prescription_id,omitempty" gorm:"index"`
+	AppointmentID  *uint    `json:"appointment_id,omitempty" gorm:"index"`
+	Agent          string   `json:"agent" gorm:"size:255;not null"`
+	Severity       Severity `json:"severity" gorm:"size:20;not null"`
+	// Warning is the text of the warning as shown to the doctor
+	Warning          string    `json:"warning" gorm:"not null"`
+	Reason           string    `json:"reason"`
+	AcknowledgedByID uint      `json:"acknowledged_by_id" gorm:"not null"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+func (Acknowledgement) TableName() string {
+	return "allergy_acknowledgements"
+}
+
+// AckInput acknowledges the warnings of an allergy, with an optional reason
+type AckInput struct {
+	AllergyID uint   `json:"allergy_id" binding:"required"`
+	Reason    string `json:"reason"`
+}
+
+// UnacknowledgedError is returned when warnings were raised that the request
+// did not acknowledge; nothing was saved
+type UnacknowledgedError struct {
+	Warnings []Warning
+}
+
+func (e *UnacknowledgedError) Error() string {
+	return fmt.Sprintf("%d allergy warning(s) must be acknowledged", len(e.Warnings))
+}
+
+// Acknowledge turns the warnings into acknowledgements by actorID. It returns
+// an UnacknowledgedError listing the warnings whose allergy is not in acks.
+func Acknowledge(patientID, actorID uint, warnings []Warning, acks []AckInput) ([]Acknowledgement, error) {
+	reasons := make(map[uint]string, len(acks))
+	for _, ack := range acks {
+		reasons[ack.AllergyID] = strings.TrimSpace(ack.Reason)
+	}
+
+	var missing []Warning
+	acknowledgements := make([]Acknowledgement, 0, len(warnings))
+	for _, w := range warnings {
+		reason, ok := reasons[w.AllergyID]
+		if !ok {
+			missing = append(missing, w)
+			continue
+		}
+		acknowledgements = append(acknowledgements, Acknowledgement{
+			PatientID:        patientID,
+			AllergyID:        w.AllergyID,
+			Agent:            w.Agent,
+			Severity:         w.Severity,
+			Warning:          w.String(),
+			Reason:           reason,
+			AcknowledgedByID: actorID,
+		})
+	}
+	if len(missing) > 0 {
+		return nil, &UnacknowledgedError{Warnings: missing}
+	}
+	return acknowledgements, nil
+}
+
+// Procedure is a kind of appointment, such as a contrast-enhanced CT scan.
+// A procedure with an agent is checked against the patient's allergies when
+// it is set on an appointment.
+type Procedure struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Code         string    `json:"code" gorm:"size:50;uniqueIndex;not null"`
+	Name         string    `json:"name" gorm:"size:255;not null"`
+	Agent        string    `json:"agent,omitempty" gorm:"size:255"`
+	AgentATCCode string    `json:"agent_atc_code,omitempty" gorm:"column:agent_atc_code;size:20"`
+	Active       bool      `json:"active" gorm:"not null;default:true"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (Procedure) TableName() string {
+	return "procedures"
+}
+
+// ProcedureInput creates or updates a procedure; Active defaults to true
+type ProcedureInput struct {
+	Code         string `json:"code" binding:"required"`
+	Name         string `json:"name" binding:"required"`
+	Agent        string `json:"agent"`
+	AgentATCCode string `json:"agent_atc_code"`
+	Active       *bool  `json:"active"`
+}
+
+// ProcedureAssignment is the outcome of setting the procedure of an
+// appointment; Procedure is nil when it was cleared
+type ProcedureAssignment struct {
+	AppointmentID    uint              `json:"appointment_id"`
+	Procedure        *Procedure        `json:"procedure"`
+	Acknowledgements []Acknowledgement `json:"acknowledgements,omitempty"`
+}
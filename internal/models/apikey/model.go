@@ -0,0 +1,79 @@
+package apikey
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ServiceAccount is a non-human identity used by integrations such as the
+// lab system or call-centre software
+type ServiceAccount struct {
+	gorm.Model
+	Name        string `gorm:"size:100;unique;not null"`
+	Description string `gorm:"size:255"`
+	Disabled    bool   `gorm:"not null;default:false"`
+	CreatedByID uint
+	// ConsentPurpose marks an external partner, such as a partner lab. It
+	// only sees the records of patients who gave this consent.
+	ConsentPurpose string `gorm:"size:50"`
+}
+
+// APIKey authenticates a service account. Only the SHA-256 hash of the key
+// is stored; Prefix is kept to recognise keys in listings.
+type APIKey struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	ServiceAccountID uint       `json:"service_account_id" gorm:"index;not null"`
+	Name             string     `json:"name" gorm:"size:100;not null"`
+	Prefix           string     `json:"prefix" gorm:"size:16;not null"`
+	KeyHash          string     `json:"-" gorm:"size:64;unique;not null"`
+	Scopes           Scopes     `json:"scopes" gorm:"type:text;not null"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+func (k *APIKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// Scopes are the permission names granted to a key, stored comma separated
+type Scopes []string
+
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+func (s *Scopes) Scan(value interface{}) error {
+	var str string
+	switch v := value.(type) {
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	case nil:
+		*s = Scopes{}
+		return nil
+	default:
+		return errors.New("invalid scopes value")
+	}
+
+	*s = Scopes{}
+	for _, scope := range strings.Split(str, ",") {
+		if scope != "" {
+			*s = append(*s, scope)
+		}
+	}
+	return nil
+}
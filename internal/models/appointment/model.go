@@ -5,12 +5,68 @@ import (
 	"time"
 )
 
+// ErasedPatientName replaces the patient name of appointments whose patient
+// had their data erased
+const ErasedPatientName = "[erased]"
+
+// Appointment holds the patient details in plaintext; the repository
+// encrypts PatientName, Email and Phone when storing them and fills the
+// blind indexes used to look them up
 type Appointment struct {
 	gorm.Model
-	PatientName     string    `gorm:"not null"`
-	Email           string    `gorm:"size:255;not null"`
-	Phone           string    `gorm:"size:20;not null"`
-	DepartmentID    uint      `gorm:"index;not null"`
-	DoctorID        uint      `gorm:"index;not null"`
-	AppointmentTime time.Time `gorm:"not null"`
+	// PatientID links the appointment to the master patient index. The
+	// patient details below are what was given at booking time.
+	PatientID        *uint     `gorm:"index"`
+	PatientName      string    `gorm:"not null"`
+	Email            string    `gorm:"not null"`
+	Phone            string    `gorm:"not null"`
+	PatientNameIndex string    `json:"-" gorm:"column:patient_name_bidx"`
+	EmailIndex       string    `json:"-" gorm:"column:email_bidx"`
+	PhoneIndex       string    `json:"-" gorm:"column:phone_bidx"`
+	DepartmentID     uint      `gorm:"index;not null"`
+	DoctorID         uint      `gorm:"index;not null"`
+	AppointmentTime  time.Time `gorm:"not null"`
+	// ProcedureID is the kind of procedure, such as a contrast-enhanced
+	// scan, set by the doctor once allergy warnings were acknowledged
+	ProcedureID *uint `gorm:"index"`
+}
+
+// State is derived from the appointment time and deletion, appointments
+// have no status of their own
+type State string
+
+const (
+	StateUpcoming  State = "upcoming"
+	StatePast      State = "past"
+	StateCancelled State = "cancelled"
+)
+
+// State of the appointment at now
+func (a *Appointment) State(now time.Time) State {
+	if a.DeletedAt.Valid {
+		return StateCancelled
+	}
+	if a.AppointmentTime.Before(now) {
+		return StatePast
+	}
+	return StateUpcoming
+}
+
+// SearchFilter narrows a search of appointments, empty fields match every
+// appointment
+type SearchFilter struct {
+	DoctorID *uint
+	// From is inclusive and To exclusive
+	From *time.Time
+	To   *time.Time
+	// States defaults to upcoming and past, cancelled appointments are only
+	// found when asked for
+	States []State
+	// OwnerDoctorID and OwnerEmail limit the search to the appointments of
+	// the doctor together with the ones booked under the email
+	OwnerDoctorID *uint
+	OwnerEmail    string
+	// PageSize 0 returns every match
+	Page     int
+	PageSize int
 }
@@ -0,0 +1,50 @@
+package attachment
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTooLarge           = errors.New("file is too large")
+	ErrContentTypeRefused = errors.New("content type is not allowed")
+	ErrInfected           = errors.New("file failed the malware scan")
+	ErrLinkInvalid        = errors.New("invalid or expired download link")
+	ErrNotScanned         = errors.New("file was not scanned for malware")
+)
+
+type ScanStatus string
+
+const (
+	ScanClean ScanStatus = "clean"
+	// ScanSkipped files were stored while no scanner was configured
+	ScanSkipped ScanStatus = "skipped"
+)
+
+// Attachment is a document or image of a patient or of an appointment,
+// exactly one of PatientID and AppointmentID is set. The contents live in
+// the blob store under StorageKey; ContentType is sniffed from the contents
+// rather than taken from the client.
+type Attachment struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	PatientID     *uint          `json:"patient_id,omitempty" gorm:"index"`
+	AppointmentID *uint          `json:"appointment_id,omitempty" gorm:"index"`
+	FileName      string         `json:"file_name" gorm:"size:255;not null"`
+	ContentType   string         `json:"content_type" gorm:"size:100;not null"`
+	Size          int64          `json:"size" gorm:"not null"`
+	SHA256        string         `json:"sha256" gorm:"column:sha256;size:64;not null"`
+	StorageKey    string         `json:"-" gorm:"size:255;not null;uniqueIndex"`
+	Description   string         `json:"description"`
+	ScanStatus    ScanStatus     `json:"scan_status" gorm:"size:10;not null"`
+	UploadedByID  *uint          `json:"uploaded_by_id,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// SignedURL is a time-limited download link issued to a user
+type SignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,56 @@
+package audit
+
+import "context"
+
+const (
+	ActorUser           = "user"
+	ActorServiceAccount = "service_account"
+	// ActorAnonymous is used for requests made before authentication, such
+	// as registration or login
+	ActorAnonymous = "anonymous"
+	// ActorSystem is used for changes made outside of an HTTP request, such
+	// as migrations and background jobs
+	ActorSystem = "system"
+)
+
+// Actor is who a change is attributed to. Names are not part of it: the
+// log cannot be erased, so it only identifies the actor by type and ID.
+type Actor struct {
+	Type string
+	ID   uint
+}
+
+// Request describes the HTTP request a change was made in
+type Request struct {
+	IP        string
+	RequestID string
+}
+
+type actorKey struct{}
+type requestKey struct{}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func WithRequest(ctx context.Context, req Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, req)
+}
+
+// ActorFromContext returns the actor stored in ctx. Without one the change
+// is attributed to an anonymous caller inside requests and to the system
+// otherwise.
+func ActorFromContext(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return actor
+	}
+	if _, ok := ctx.Value(requestKey{}).(Request); ok {
+		return Actor{Type: ActorAnonymous}
+	}
+	return Actor{Type: ActorSystem}
+}
+
+func RequestFromContext(ctx context.Context) Request {
+	req, _ := ctx.Value(requestKey{}).(Request)
+	return req
+}
@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionRead   = "read"
+)
+
+// Entry is one record of the audit log. Entries are append-only and chained:
+// Hash covers the entry fields and the hash of the previous entry, so that
+// changing or removing an entry breaks every hash after it.
+type Entry struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	ActorType string    `json:"actor_type"`
+	ActorID   uint      `json:"actor_id"`
+	Action    string    `json:"action"`
+	Entity    string    `json:"entity"`
+	EntityID  string    `json:"entity_id"`
+	// Changes is a JSON object with the "before" and "after" values of the
+	// columns that changed. Empty for reads.
+	Changes   string `json:"changes,omitempty"`
+	IP        string `json:"ip"`
+	RequestID string `json:"request_id"`
+	PrevHash  string `json:"prev_hash"`
+	Hash      string `json:"hash"`
+}
+
+func (Entry) TableName() string {
+	return "audit_logs"
+}
+
+// ComputeHash returns the chain hash of the entry given the hash of the
+// entry before it
+func (e *Entry) ComputeHash(prevHash string) string {
+	fields, _ := json.Marshal([]interface{}{
+		prevHash,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		e.ActorType,
+		e.ActorID,
+		e.Action,
+		e.Entity,
+		e.EntityID,
+		e.Changes,
+		e.IP,
+		e.RequestID,
+	})
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
+
+// Filter narrows down audit log queries. Empty fields are ignored.
+type Filter struct {
+	ActorType string
+	ActorID   uint
+	Entity    string
+	EntityID  string
+	Action    string
+	From      *time.Time
+	To        *time.Time
+	Page      int
+	PageSize  int
+}
+
+// Checkpoint records the last entry of the log at a point in time. Removing
+// entries from the end of the chain leaves the chain itself intact, but not
+// the checkpoints taken before; checkpoints are also written to the
+// application log, so they can be checked against a copy kept elsewhere.
+type Checkpoint struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	EntryID   uint      `json:"entry_id"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Checkpoint) TableName() string {
+	return "audit_checkpoints"
+}
+
+// VerifyResult reports the outcome of checking the hash chain
+type VerifyResult struct {
+	Valid   bool `json:"valid"`
+	Checked int  `json:"checked"`
+	// Checkpoints is how many checkpoints were matched against the chain
+	Checkpoints int `json:"checkpoints"`
+	// BrokenAt is the first entry whose hash does not match, when invalid
+	BrokenAt uint   `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
@@ -0,0 +1,86 @@
+package breakglass
+
+import (
+	"medical-center/internal/models/permission"
+	"time"
+)
+
+// ElevatedPermissions are added to the caller's permissions while a grant is
+// active. Break-glass only ever widens read access, from the patients of the
+// caller's doctor profile to every patient.
+var ElevatedPermissions = []string{
+	permission.AppointmentsReadAll,
+	permission.EncountersReadAll,
+	permission.PatientsRead,
+	permission.PrescriptionsRead,
+	permission.LabsRead,
+	permission.AttachmentsRead,
+	permission.DiagnosesRead,
+	permission.AllergiesRead,
+}
+
+// Grant is an emergency declared by a user, giving them elevated read
+// access until ExpiresAt or until they end it
+type Grant struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	UserName  string     `json:"user_name" gorm:"size:255"`
+	Reason    string     `json:"reason" gorm:"not null"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+func (Grant) TableName() string {
+	return "break_glass_grants"
+}
+
+func (g *Grant) IsActive(now time.Time) bool {
+	return g.EndedAt == nil && now.Before(g.ExpiresAt)
+}
+
+type ReviewStatus string
+
+const (
+	ReviewPending   ReviewStatus = "pending"
+	ReviewJustified ReviewStatus = "justified"
+	ReviewMisuse    ReviewStatus = "misuse"
+)
+
+// Access is a successful request for patient data made under a grant.
+// Every access waits in the review queue until an administrator marks it
+// justified or misuse.
+type Access struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	GrantID uint   `json:"grant_id" gorm:"index;not null"`
+	UserID  uint   `json:"user_id" gorm:"index;not null"`
+	Method  string `json:"method" gorm:"size:10;not null"`
+	Path    string `json:"path" gorm:"not null"`
+	// Entity is the table of the record the route serves, and EntityID the
+	// ID in the route, e.g. the patient of /patients/:id/allergies. Empty
+	// for listings.
+	Entity       string       `json:"entity" gorm:"size:50;not null"`
+	EntityID     string       `json:"entity_id" gorm:"size:64;not null"`
+	Status       int          `json:"status"`
+	CreatedAt    time.Time    `json:"created_at"`
+	ReviewStatus ReviewStatus `json:"review_status" gorm:"size:20;not null;default:'pending'"`
+	ReviewedByID *uint        `json:"reviewed_by_id,omitempty"`
+	ReviewedAt   *time.Time   `json:"reviewed_at,omitempty"`
+	ReviewNote   string       `json:"review_note,omitempty"`
+}
+
+func (Access) TableName() string {
+	return "break_glass_accesses"
+}
+
+// AccessFilter narrows down access listings. Empty fields are ignored and a
+// PageSize of 0 returns every match.
+type AccessFilter struct {
+	ReviewStatus ReviewStatus
+	UserID       uint
+	GrantID      uint
+	From         *time.Time
+	To           *time.Time
+	Page         int
+	PageSize     int
+}
@@ -0,0 +1,69 @@
+package consent
+
+import "time"
+
+type Purpose string
+
+const (
+	PurposeDataProcessing    Purpose = "data_processing"
+	PurposeSMSReminders      Purpose = "sms_reminders"
+	PurposeMarketing         Purpose = "marketing"
+	PurposePartnerLabSharing Purpose = "partner_lab_sharing"
+)
+
+// Purposes lists everything a patient can consent to
+var Purposes = []Purpose{PurposeDataProcessing, PurposeSMSReminders, PurposeMarketing, PurposePartnerLabSharing}
+
+func (p Purpose) IsValid() bool {
+	for _, purpose := range Purposes {
+		if p == purpose {
+			return true
+		}
+	}
+	return false
+}
+
+// Channel is how the consent was given or withdrawn
+type Channel string
+
+const (
+	ChannelWeb      Channel = "web"
+	ChannelPaper    Channel = "paper"
+	ChannelPhone    Channel = "phone"
+	ChannelInPerson Channel = "in_person"
+	ChannelEmail    Channel = "email"
+)
+
+func (c Channel) IsValid() bool {
+	switch c {
+	case ChannelWeb, ChannelPaper, ChannelPhone, ChannelInPerson, ChannelEmail:
+		return true
+	}
+	return false
+}
+
+// Record is one grant or withdrawal of consent. Records are never changed;
+// the latest record for a purpose is the patient's current choice.
+type Record struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"index;not null"`
+	Purpose      Purpose   `json:"purpose" gorm:"size:50;not null"`
+	Granted      bool      `json:"granted" gorm:"not null"`
+	Version      string    `json:"version" gorm:"size:50;not null"` // Version of the consent text shown to the patient
+	Channel      Channel   `json:"channel" gorm:"size:20;not null"`
+	RecordedByID uint      `json:"recorded_by_id"` // The patient, or staff recording a paper or phone consent
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (Record) TableName() string {
+	return "consent_records"
+}
+
+// Status is the current choice of a patient for one purpose
+type Status struct {
+	Purpose   Purpose    `json:"purpose"`
+	Granted   bool       `json:"granted"`
+	Version   string     `json:"version,omitempty"`
+	Channel   Channel    `json:"channel,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"` // Unset when the patient never answered
+}
@@ -0,0 +1,65 @@
+package datarequest
+
+import (
+	"medical-center/internal/models/appointment"
+	"medical-center/internal/models/consent"
+	"medical-center/internal/models/notification"
+	"medical-center/internal/models/patient"
+	"medical-center/internal/models/user"
+	"time"
+)
+
+type Type string
+
+const (
+	TypeExport  Type = "export"
+	TypeErasure Type = "erasure"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusCompleted Status = "completed"
+	StatusRejected  Status = "rejected"
+)
+
+// Request is a data subject request of a patient: a copy of their data or
+// its erasure. Exports complete immediately, erasures wait for an admin.
+type Request struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UserID        uint       `json:"user_id" gorm:"index;not null"`
+	Type          Type       `json:"type" gorm:"size:20;not null"`
+	Status        Status     `json:"status" gorm:"size:20;not null"`
+	Reason        string     `json:"reason,omitempty"`
+	Resolution    string     `json:"resolution,omitempty"` // Note of the administrator who closed the request
+	RequestedByID uint       `json:"requested_by_id"`
+	CompletedByID *uint      `json:"completed_by_id,omitempty"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func (Request) TableName() string {
+	return "data_requests"
+}
+
+// ListFilter narrows down request listings. Empty fields are ignored.
+type ListFilter struct {
+	UserID   uint
+	Type     Type
+	Status   Status
+	Page     int
+	PageSize int
+}
+
+// Export is the archive handed to a patient asking for a copy of their data
+type Export struct {
+	GeneratedAt   time.Time                   `json:"generated_at"`
+	Account       *user.User                  `json:"account"`
+	Sessions      []user.Session              `json:"sessions"`
+	Appointments  []appointment.Appointment   `json:"appointments"`
+	Notifications []notification.Notification `json:"notifications"`
+	Consents      []consent.Record            `json:"consents"`
+	Patients      []patient.Patient           `json:"patient_records"`
+	Requests      []Request                   `json:"data_requests"`
+}
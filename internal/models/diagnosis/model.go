@@ -0,0 +1,154 @@
+package diagnosis
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Kind string
+
+const (
+	KindPrimary   Kind = "primary"
+	KindSecondary Kind = "secondary"
+)
+
+// Code is an entry of the ICD-10 catalogue, either a three-character
+// category such as "J45" or a subcategory such as "J45.0". Codes are never
+// deleted; the ones dropped from the catalogue are deactivated and cannot
+// be given any more.
+type Code struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Code string `json:"code" gorm:"size:10;uniqueIndex;not null"`
+	// Category is the first three characters of the code
+	Category  string    `json:"category" gorm:"size:3;index;not null"`
+	TitleRU   string    `json:"title_ru" gorm:"column:title_ru;not null"`
+	TitleEN   string    `json:"title_en" gorm:"column:title_en;not null"`
+	Active    bool      `json:"active" gorm:"not null;default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Code) TableName() string {
+	return "icd10_codes"
+}
+
+// NormalizeCode writes a code the way the catalogue does, in upper case
+// with a dot after the category: "j450" becomes "J45.0"
+func NormalizeCode(code string) string {
+	code = strings.ToUpper(strings.Join(strings.Fields(code), ""))
+	code = strings.ReplaceAll(code, ".", "")
+	if len(code) > 3 {
+		code = code[:3] + "." + code[3:]
+	}
+	return code
+}
+
+// ValidCode reports whether a normalized code has the ICD-10 shape: a
+// letter, two characters of which the first is a digit, and up to four more
+// after the dot
+func ValidCode(code string) bool {
+	if len(code) != 3 && (len(code) < 5 || len(code) > 8 || code[3] != '.') {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case i == 0:
+			if c < 'A' || c > 'Z' {
+				return false
+			}
+		case i == 1:
+			if c < '0' || c > '9' {
+				return false
+			}
+		case i == 3:
+		default:
+			if (c < '0' || c > '9') && (c < 'A' || c > 'Z') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// CodeFilter narrows down catalogue searches. A query that starts like a
+// code, a letter followed by a digit, matches the start of the codes;
+// otherwise every word of it must start a word of the Russian or English
+// title.
+type CodeFilter struct {
+	Query           string
+	IncludeInactive bool
+	Page            int
+	PageSize        int
+}
+
+// ImportResult reports the outcome of a catalogue import
+type ImportResult struct {
+	Created     int      `json:"created"`
+	Updated     int      `json:"updated"`
+	Unchanged   int      `json:"unchanged"`
+	Deactivated int64    `json:"deactivated"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// Diagnosis is a code given at an appointment, linked to the encounter
+// note of the appointment when there is one. An appointment has at most one
+// primary diagnosis. Code is the code when the diagnosis was given.
+type Diagnosis struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	AppointmentID   uint           `json:"appointment_id" gorm:"index;not null"`
+	EncounterNoteID *uint          `json:"encounter_note_id,omitempty"`
+	CodeID          uint           `json:"code_id" gorm:"not null"`
+	Code            string         `json:"code" gorm:"size:10;index;not null"`
+	Kind            Kind           `json:"kind" gorm:"size:10;not null"`
+	Comment         string         `json:"comment"`
+	CreatedByID     uint           `json:"created_by_id" gorm:"not null"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+	// Entry is the catalogue entry, for its titles
+	Entry *Code `json:"entry,omitempty" gorm:"foreignKey:CodeID"`
+}
+
+// Input is a diagnosis given by code, e.g. "J45.0". Without a kind it is
+// primary when the appointment has no primary diagnosis yet.
+type Input struct {
+	Code    string `json:"code" binding:"required"`
+	Kind    Kind   `json:"kind"`
+	Comment string `json:"comment"`
+}
+
+// Grouping of the diagnoses report
+const (
+	GroupCode     = "code"
+	GroupCategory = "category"
+)
+
+// ReportFilter selects the diagnoses counted in a report, given at
+// appointments in [From, To). Empty fields are ignored, so both kinds are
+// counted without Kind.
+type ReportFilter struct {
+	DepartmentID *uint
+	From         *time.Time
+	To           *time.Time
+	Kind         Kind
+	// GroupBy is GroupCode or GroupCategory
+	GroupBy string
+	// Limit is the number of diagnoses reported per department
+	Limit int
+}
+
+// TopDiagnosis is a line of the top diagnoses report
+type TopDiagnosis struct {
+	DepartmentID   uint   `json:"department_id"`
+	DepartmentName string `json:"department_name"`
+	Rank           int    `json:"rank"`
+	Code           string `json:"code"`
+	TitleRU        string `json:"title_ru"`
+	TitleEN        string `json:"title_en"`
+	Count          int64  `json:"count"`
+	// Patients is the number of distinct patients with the diagnosis
+	Patients int64 `json:"patients"`
+}
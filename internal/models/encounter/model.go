@@ -0,0 +1,89 @@
+package encounter
+
+import (
+	"errors"
+	"time"
+)
+
+type Status string
+
+const (
+	// StatusDraft notes can be edited freely, every save is kept as a version
+	StatusDraft Status = "draft"
+	// StatusSigned notes are locked, changes are made through addenda
+	StatusSigned Status = "signed"
+)
+
+var (
+	// ErrVersionConflict is returned when a note was saved by someone else,
+	// for example from another browser tab, since the caller loaded it
+	ErrVersionConflict = errors.New("note was changed since it was loaded, reload it")
+	ErrSigned          = errors.New("note is signed, add an addendum instead")
+)
+
+// Content is the SOAP structure of a note
+type Content struct {
+	Subjective string `json:"subjective"`
+	Objective  string `json:"objective"`
+	Assessment string `json:"assessment"`
+	Plan       string `json:"plan"`
+}
+
+// Note documents the visit of an appointment. There is one note per
+// appointment, written by the treating doctor.
+type Note struct {
+	ID            uint `json:"id" gorm:"primaryKey"`
+	AppointmentID uint `json:"appointment_id" gorm:"uniqueIndex;not null"`
+	// DoctorID is the treating doctor when the note was started
+	DoctorID  uint  `json:"doctor_id" gorm:"index;not null"`
+	PatientID *uint `json:"patient_id,omitempty" gorm:"index"`
+	Content   `gorm:"embedded"`
+	Status    Status `json:"status" gorm:"size:20;not null"`
+	// Version starts at 1 and grows with every save
+	Version     int        `json:"version" gorm:"not null"`
+	CreatedByID uint       `json:"created_by_id"`
+	UpdatedByID uint       `json:"updated_by_id"`
+	SignedByID  *uint      `json:"signed_by_id,omitempty"`
+	SignedAt    *time.Time `json:"signed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Addenda     []Addendum `json:"addenda" gorm:"foreignKey:NoteID"`
+}
+
+func (Note) TableName() string {
+	return "encounter_notes"
+}
+
+func (n *Note) IsSigned() bool {
+	return n.Status == StatusSigned
+}
+
+// Version is a snapshot of a note as it was saved
+type Version struct {
+	ID      uint `json:"id" gorm:"primaryKey"`
+	NoteID  uint `json:"note_id" gorm:"index;not null"`
+	Version int  `json:"version" gorm:"not null"`
+	Content `gorm:"embedded"`
+	Status  Status `json:"status" gorm:"size:20;not null"`
+	// SavedByID is who saved or signed this version
+	SavedByID uint      `json:"saved_by_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Version) TableName() string {
+	return "encounter_note_versions"
+}
+
+// Addendum adds to a signed note without changing it. Addenda cannot be
+// edited either.
+type Addendum struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	NoteID    uint      `json:"note_id" gorm:"index;not null"`
+	Text      string    `json:"text" gorm:"not null"`
+	AuthorID  uint      `json:"author_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Addendum) TableName() string {
+	return "encounter_addenda"
+}
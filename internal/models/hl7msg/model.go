@@ -0,0 +1,64 @@
+package hl7msg
+
+import (
+	"time"
+)
+
+type Direction string
+
+const (
+	Inbound  Direction = "in"
+	Outbound Direction = "out"
+)
+
+type Status string
+
+const (
+	// StatusPending outbound messages wait in the outbox for delivery
+	StatusPending Status = "pending"
+	// StatusSent outbound messages were accepted by the receiver
+	StatusSent Status = "sent"
+	// StatusFailed outbound messages were rejected or ran out of attempts
+	StatusFailed Status = "failed"
+	// StatusProcessed inbound messages were applied and acknowledged AA
+	StatusProcessed Status = "processed"
+	// StatusRejected inbound messages were acknowledged AE or AR
+	StatusRejected Status = "rejected"
+)
+
+// Message is an HL7 v2 message sent or received, kept as it went over the
+// wire together with the acknowledgement so that it can be replayed.
+// Outbound messages are queued as pending and delivered in ID order.
+type Message struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Direction     Direction  `json:"direction" gorm:"size:3;not null"`
+	MessageType   string     `json:"message_type" gorm:"size:20;not null"`
+	ControlID     string     `json:"control_id" gorm:"size:50;not null"`
+	Status        Status     `json:"status" gorm:"size:10;not null"`
+	Payload       string     `json:"payload" gorm:"not null"`
+	Ack           string     `json:"ack,omitempty"`
+	AckCode       string     `json:"ack_code,omitempty" gorm:"size:2"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	AppointmentID *uint      `json:"appointment_id,omitempty"`
+	PatientID     *uint      `json:"patient_id,omitempty"`
+	// ReplayOfID is the message this one replays
+	ReplayOfID  *uint      `json:"replay_of_id,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+func (Message) TableName() string {
+	return "hl7_messages"
+}
+
+// Filter narrows down message listings. Empty fields are ignored.
+type Filter struct {
+	Direction   Direction
+	Status      Status
+	MessageType string
+	ControlID   string
+	Page        int
+	PageSize    int
+}
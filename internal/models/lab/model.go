@@ -0,0 +1,201 @@
+package lab
+
+import (
+	"medical-center/internal/models/consent"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Status string
+
+const (
+	// StatusOrdered orders wait for the specimen to be collected
+	StatusOrdered   Status = "ordered"
+	StatusCollected Status = "collected"
+	// StatusResulted orders have a result for every test
+	StatusResulted  Status = "resulted"
+	StatusCancelled Status = "cancelled"
+)
+
+// Flag compares a result with its reference range
+type Flag string
+
+const (
+	FlagNormal Flag = "normal"
+	FlagLow    Flag = "low"
+	FlagHigh   Flag = "high"
+	// FlagAbnormal is a qualitative result that differs from the expected
+	// value, e.g. "positive" when "negative" is expected
+	FlagAbnormal Flag = "abnormal"
+)
+
+// Source tells how a result was entered
+type Source string
+
+const (
+	SourceManual Source = "manual"
+	SourceAPI    Source = "api"
+	SourceFile   Source = "file"
+)
+
+// Test is an entry of the test catalogue. The reference range is either
+// numeric, RefLow and RefHigh in Unit, or the expected value of a
+// qualitative test in RefText.
+type Test struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Code      string    `json:"code" gorm:"size:50;uniqueIndex;not null"`
+	Name      string    `json:"name" gorm:"size:255;not null"`
+	Specimen  string    `json:"specimen" gorm:"size:100"`
+	Unit      string    `json:"unit" gorm:"size:50"`
+	RefLow    *float64  `json:"ref_low,omitempty"`
+	RefHigh   *float64  `json:"ref_high,omitempty"`
+	RefText   string    `json:"ref_text,omitempty" gorm:"size:100"`
+	Active    bool      `json:"active" gorm:"not null;default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Test) TableName() string {
+	return "lab_tests"
+}
+
+// TestFilter narrows down catalogue searches. Query matches the start of the
+// code or any part of the name.
+type TestFilter struct {
+	Query           string
+	IncludeInactive bool
+	Page            int
+	PageSize        int
+}
+
+// Result is the result of one test of an order. It is created with the
+// order and filled in when the result arrives; the reference range is the
+// one the value was compared with.
+type Result struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	OrderID  uint   `json:"order_id" gorm:"index;not null"`
+	TestID   uint   `json:"test_id" gorm:"index;not null"`
+	TestCode string `json:"test_code" gorm:"size:50;not null"`
+	TestName string `json:"test_name" gorm:"size:255;not null"`
+	// Value as reported, NumericValue is set when it is a number
+	Value        string     `json:"value"`
+	NumericValue *float64   `json:"numeric_value,omitempty"`
+	Unit         string     `json:"unit" gorm:"size:50"`
+	RefLow       *float64   `json:"ref_low,omitempty"`
+	RefHigh      *float64   `json:"ref_high,omitempty"`
+	RefText      string     `json:"ref_text,omitempty" gorm:"size:100"`
+	Flag         Flag       `json:"flag,omitempty" gorm:"size:10"`
+	Comment      string     `json:"comment,omitempty"`
+	Source       Source     `json:"source,omitempty" gorm:"size:10"`
+	EnteredByID  *uint      `json:"entered_by_id,omitempty"`
+	ResultedAt   *time.Time `json:"resulted_at,omitempty"`
+}
+
+func (Result) TableName() string {
+	return "lab_results"
+}
+
+// Evaluate parses the value and flags it against the reference range. A
+// number outside RefLow and RefHigh is low or high, a text differing from
+// RefText is abnormal. Values without a matching range are not flagged.
+func (r *Result) Evaluate() {
+	r.NumericValue, r.Flag = nil, ""
+	value := strings.TrimSpace(r.Value)
+	if n, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64); err == nil {
+		r.NumericValue = &n
+		switch {
+		case r.RefLow != nil && n < *r.RefLow:
+			r.Flag = FlagLow
+		case r.RefHigh != nil && n > *r.RefHigh:
+			r.Flag = FlagHigh
+		case r.RefLow != nil || r.RefHigh != nil:
+			r.Flag = FlagNormal
+		}
+		return
+	}
+	if r.RefText != "" {
+		r.Flag = FlagNormal
+		if !strings.EqualFold(value, r.RefText) {
+			r.Flag = FlagAbnormal
+		}
+	}
+}
+
+// IsAbnormal reports whether the result is outside its reference range
+func (r *Result) IsAbnormal() bool {
+	return r.Flag == FlagLow || r.Flag == FlagHigh || r.Flag == FlagAbnormal
+}
+
+// Order is a set of tests ordered by a doctor for an appointment. It has
+// one result per test.
+type Order struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	AppointmentID uint       `json:"appointment_id" gorm:"index;not null"`
+	PatientID     *uint      `json:"patient_id,omitempty" gorm:"index"`
+	DoctorID      uint       `json:"doctor_id" gorm:"index;not null"`
+	Status        Status     `json:"status" gorm:"size:20;not null"`
+	Notes         string     `json:"notes"`
+	OrderedByID   uint       `json:"ordered_by_id"`
+	CollectedAt   *time.Time `json:"collected_at,omitempty"`
+	CollectedByID *uint      `json:"collected_by_id,omitempty"`
+	ResultedAt    *time.Time `json:"resulted_at,omitempty"`
+	CancelledAt   *time.Time `json:"cancelled_at,omitempty"`
+	CancelledByID *uint      `json:"cancelled_by_id,omitempty"`
+	CancelReason  string     `json:"cancel_reason,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Results       []Result   `json:"results" gorm:"foreignKey:OrderID"`
+}
+
+func (Order) TableName() string {
+	return "lab_orders"
+}
+
+// OrderFilter narrows down order listings, e.g. the collected orders
+// waiting for results. Empty fields are ignored.
+type OrderFilter struct {
+	Status   Status
+	DoctorID *uint
+	// TreatingDoctorID limits the orders to the ones of the doctor and of
+	// the patients with an appointment with the doctor
+	TreatingDoctorID *uint
+	// ConsentPurpose limits the orders to the ones of patients who
+	// consented to it
+	ConsentPurpose consent.Purpose
+	Page           int
+	PageSize       int
+}
+
+// ResultInput is a result entered by hand or ingested from a laboratory.
+// Without a reference range the one of the catalogue is used, provided the
+// unit is the unit of the catalogue.
+type ResultInput struct {
+	OrderID    uint       `json:"order_id"`
+	TestCode   string     `json:"test_code"`
+	Value      string     `json:"value"`
+	Unit       string     `json:"unit"`
+	RefLow     *float64   `json:"ref_low"`
+	RefHigh    *float64   `json:"ref_high"`
+	RefText    string     `json:"ref_text"`
+	Comment    string     `json:"comment"`
+	ResultedAt *time.Time `json:"resulted_at"`
+}
+
+// IngestReport reports the outcome of a batch of results
+type IngestReport struct {
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`
+	Errors   []string `json:"errors,omitempty"`
+	// Orders that received all their results with this batch
+	Completed []uint `json:"completed,omitempty"`
+}
+
+// HistoryEntry is a result of a patient with its order, for following a
+// test over time
+type HistoryEntry struct {
+	Result
+	AppointmentID uint       `json:"appointment_id"`
+	DoctorID      uint       `json:"doctor_id"`
+	CollectedAt   *time.Time `json:"collected_at,omitempty"`
+}
@@ -0,0 +1,63 @@
+package lab
+
+import "testing"
+
+func TestResultEvaluate(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name        string
+		value       string
+		low, high   *float64
+		refText     string
+		wantFlag    Flag
+		wantNumeric *float64
+	}{
+		{"within range", "5.2", f(3.5), f(5.5), "", FlagNormal, f(5.2)},
+		{"on the low bound", "3.5", f(3.5), f(5.5), "", FlagNormal, f(3.5)},
+		{"on the high bound", "5.5", f(3.5), f(5.5), "", FlagNormal, f(5.5)},
+		{"below range", "3.4", f(3.5), f(5.5), "", FlagLow, f(3.4)},
+		{"above range", "5.51", f(3.5), f(5.5), "", FlagHigh, f(5.51)},
+		{"decimal comma", "6,1", f(3.5), f(5.5), "", FlagHigh, f(6.1)},
+		{"surrounding spaces", " 4 ", f(3.5), f(5.5), "", FlagNormal, f(4)},
+		{"negative", "-1", f(0), nil, "", FlagLow, f(-1)},
+		{"only a low bound", "100", f(10), nil, "", FlagNormal, f(100)},
+		{"only a high bound", "201", nil, f(200), "", FlagHigh, f(201)},
+		{"number without a range", "42", nil, nil, "", "", f(42)},
+		{"expected text", "Negative", nil, nil, "negative", FlagNormal, nil},
+		{"unexpected text", "Positive", nil, nil, "negative", FlagAbnormal, nil},
+		{"text without a reference", "turbid", nil, nil, "", "", nil},
+		{"text against a numeric range", "see comment", f(1), f(2), "", "", nil},
+		{"empty value", "", f(1), f(2), "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Result{Value: tt.value, RefLow: tt.low, RefHigh: tt.high, RefText: tt.refText}
+			r.Evaluate()
+			if r.Flag != tt.wantFlag {
+				t.Errorf("Flag = %q, want %q", r.Flag, tt.wantFlag)
+			}
+			switch {
+			case tt.wantNumeric == nil && r.NumericValue != nil:
+				t.Errorf("NumericValue = %v, want nil", *r.NumericValue)
+			case tt.wantNumeric != nil && (r.NumericValue == nil || *r.NumericValue != *tt.wantNumeric):
+				t.Errorf("NumericValue = %v, want %v", r.NumericValue, *tt.wantNumeric)
+			}
+			wantAbnormal := tt.wantFlag == FlagLow || tt.wantFlag == FlagHigh || tt.wantFlag == FlagAbnormal
+			if r.IsAbnormal() != wantAbnormal {
+				t.Errorf("IsAbnormal() = %v, want %v", r.IsAbnormal(), wantAbnormal)
+			}
+		})
+	}
+}
+
+func TestResultEvaluateClearsPreviousFlag(t *testing.T) {
+	low, high := 3.5, 5.5
+	r := Result{Value: "9", RefLow: &low, RefHigh: &high}
+	r.Evaluate()
+	r.Value = "corrected, see comment"
+	r.Evaluate()
+	if r.Flag != "" || r.NumericValue != nil {
+		t.Errorf("re-evaluated result kept Flag %q and NumericValue %v", r.Flag, r.NumericValue)
+	}
+}
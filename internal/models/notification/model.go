@@ -0,0 +1,21 @@
+package notification
+
+import "time"
+
+const (
+	StatusSent   = "sent"
+	StatusFailed = "failed"
+	// StatusSuppressed is a message not sent because the recipient has not
+	// consented to it
+	StatusSuppressed = "suppressed"
+)
+
+// Notification records an email sent to someone. The body is not kept
+// because it may contain one-time links.
+type Notification struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Recipient string    `json:"recipient" gorm:"size:255;index;not null"`
+	Subject   string    `json:"subject" gorm:"size:255;not null"`
+	Status    string    `json:"status" gorm:"size:10;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
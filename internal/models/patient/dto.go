@@ -0,0 +1,12 @@
+package patient
+
+import "time"
+
+type PatientDTO struct {
+	FullName  string
+	Email     string
+	Phone     string
+	IIN       string
+	BirthDate *time.Time
+	UserID    *uint
+}
@@ -0,0 +1,83 @@
+package patient
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidIIN = errors.New("invalid IIN")
+
+var (
+	iinWeights      = [11]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	iinRetryWeights = [11]int{3, 4, 5, 6, 7, 8, 9, 10, 11, 1, 2}
+)
+
+// ValidateIIN checks the format and the check digit of a Kazakhstan
+// individual identification number: 12 digits, the last one computed from
+// the first 11.
+func ValidateIIN(iin string) error {
+	if len(iin) != 12 {
+		return ErrInvalidIIN
+	}
+	var digits [12]int
+	for i, r := range iin {
+		if r < '0' || r > '9' {
+			return ErrInvalidIIN
+		}
+		digits[i] = int(r - '0')
+	}
+
+	check := iinChecksum(digits, iinWeights)
+	if check == 10 {
+		check = iinChecksum(digits, iinRetryWeights)
+	}
+	if check == 10 || check != digits[11] {
+		return ErrInvalidIIN
+	}
+	if _, ok := IINBirthDate(iin); !ok && digits[6] >= 1 && digits[6] <= 6 {
+		return ErrInvalidIIN
+	}
+	return nil
+}
+
+func iinChecksum(digits [12]int, weights [11]int) int {
+	sum := 0
+	for i, weight := range weights {
+		sum += digits[i] * weight
+	}
+	return sum % 11
+}
+
+// IINBirthDate returns the date of birth encoded in the first seven digits
+// of an IIN: YYMMDD followed by a digit giving the century (1-2: 1800s, 3-4:
+// 1900s, 5-6: 2000s). It returns false when the century digit is unknown or
+// the date does not exist.
+func IINBirthDate(iin string) (time.Time, bool) {
+	if len(iin) < 7 {
+		return time.Time{}, false
+	}
+	for _, r := range iin[:7] {
+		if r < '0' || r > '9' {
+			return time.Time{}, false
+		}
+	}
+	var century int
+	switch iin[6] {
+	case '1', '2':
+		century = 1800
+	case '3', '4':
+		century = 1900
+	case '5', '6':
+		century = 2000
+	default:
+		return time.Time{}, false
+	}
+
+	number := func(s string) int { return int(s[0]-'0')*10 + int(s[1]-'0') }
+	year, month, day := century+number(iin[0:2]), number(iin[2:4]), number(iin[4:6])
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Year() != year || int(date.Month()) != month || date.Day() != day {
+		return time.Time{}, false
+	}
+	return date, true
+}
@@ -0,0 +1,68 @@
+package patient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateIIN(t *testing.T) {
+	tests := []struct {
+		name  string
+		iin   string
+		valid bool
+	}{
+		{"born in the 1900s", "900101300126", true},
+		{"born in the 2000s", "040101500128", true},
+		{"last day of the year", "851231400567", true},
+		{"leap day", "000229500018", true},
+		{"check digit from the second weights", "900101300811", true},
+		{"unknown century is not dated", "900101700121", true},
+		{"wrong check digit", "900101300127", false},
+		{"first and second weights give 10", "900101300800", false},
+		{"no such day", "000230500013", false},
+		{"no leap day that year", "010229500016", false},
+		{"day 32", "900132300125", false},
+		{"too short", "90010130012", false},
+		{"too long", "9001013001260", false},
+		{"letters", "90010130012a", false},
+		{"spaces", "900101 00126", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateIIN(tt.iin)
+			if (err == nil) != tt.valid {
+				t.Errorf("ValidateIIN(%q) = %v, want valid %v", tt.iin, err, tt.valid)
+			}
+			if err != nil && err != ErrInvalidIIN {
+				t.Errorf("ValidateIIN(%q) = %v, want ErrInvalidIIN", tt.iin, err)
+			}
+		})
+	}
+}
+
+func TestIINBirthDate(t *testing.T) {
+	tests := []struct {
+		iin    string
+		want   time.Time
+		wantOK bool
+	}{
+		{"870415100000", time.Date(1887, 4, 15, 0, 0, 0, 0, time.UTC), true},
+		{"900101300126", time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"851231400567", time.Date(1985, 12, 31, 0, 0, 0, 0, time.UTC), true},
+		{"040101500128", time.Date(2004, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"000229600000", time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC), true},
+		{"900101700121", time.Time{}, false},
+		{"900101000000", time.Time{}, false},
+		{"901301300000", time.Time{}, false},
+		{"000230500013", time.Time{}, false},
+		{"90010", time.Time{}, false},
+		{"9a0101300126", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := IINBirthDate(tt.iin)
+		if ok != tt.wantOK || !got.Equal(tt.want) {
+			t.Errorf("IINBirthDate(%q) = %v, %v, want %v, %v", tt.iin, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
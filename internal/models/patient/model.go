@@ -0,0 +1,81 @@
+package patient
+
+import (
+	"gorm.io/gorm"
+	"medical-center/internal/models/consent"
+	"time"
+)
+
+// Patient is an entry of the master patient index. The repository encrypts
+// FullName, Email, Phone and IIN when storing them and fills the blind
+// indexes used to look them up and to find duplicates.
+//
+// A patient merged into another one is kept with MergedIntoID set so that
+// its details and history stay available.
+type Patient struct {
+	gorm.Model
+	// MRN is the medical record number, assigned when the patient is created
+	MRN           string     `json:"mrn" gorm:"column:mrn;uniqueIndex;not null"`
+	FullName      string     `json:"full_name" gorm:"not null"`
+	Email         string     `json:"email"`
+	Phone         string     `json:"phone"`
+	IIN           string     `json:"iin" gorm:"column:iin"`
+	BirthDate     *time.Time `json:"birth_date,omitempty" gorm:"type:date"`
+	UserID        *uint      `json:"user_id,omitempty" gorm:"index"`
+	FullNameIndex string     `json:"-" gorm:"column:full_name_bidx"`
+	EmailIndex    string     `json:"-" gorm:"column:email_bidx"`
+	PhoneIndex    string     `json:"-" gorm:"column:phone_bidx"`
+	IINIndex      string     `json:"-" gorm:"column:iin_bidx"`
+	MergedIntoID  *uint      `json:"merged_into_id,omitempty" gorm:"index"`
+	MergedAt      *time.Time `json:"merged_at,omitempty"`
+}
+
+func (p *Patient) IsMerged() bool {
+	return p.MergedIntoID != nil
+}
+
+// Merge records that the patient MergedID was merged into SurvivorID
+type Merge struct {
+	ID         uint `json:"id" gorm:"primaryKey"`
+	SurvivorID uint `json:"survivor_id" gorm:"index;not null"`
+	MergedID   uint `json:"merged_id" gorm:"index;not null"`
+	// MergedMRN is kept so the old record number can still be looked up
+	MergedMRN string `json:"merged_mrn"`
+	// Appointments is how many appointments were moved to the survivor
+	Appointments int `json:"appointments"`
+	// Fields lists the survivor fields that were filled in from the merged
+	// patient
+	Fields     string    `json:"fields"`
+	MergedByID uint      `json:"merged_by_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (Merge) TableName() string {
+	return "patient_merges"
+}
+
+// Filter narrows down patient queries. Empty fields are ignored; name,
+// email, phone and IIN match exactly after normalisation.
+type Filter struct {
+	MRN   string
+	Name  string
+	Email string
+	Phone string
+	IIN   string
+	// DoctorID limits the patients to the ones with an appointment with
+	// the doctor
+	DoctorID *uint
+	// ConsentPurpose limits the patients to the ones who consented to it
+	ConsentPurpose consent.Purpose
+	Page           int
+	PageSize       int
+}
+
+// Duplicate is a patient that may be the same person as another one
+type Duplicate struct {
+	Patient Patient `json:"patient"`
+	// Score is between 0 and 1, higher means more likely the same person
+	Score float64 `json:"score"`
+	// Reasons lists what matched: "iin", "email", "phone", "name", "birth_date"
+	Reasons []string `json:"reasons"`
+}
@@ -0,0 +1,26 @@
+package patient
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeName ignores case and extra spaces
+func NormalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone keeps the digits only, so "+7 (701) 123-45-67" and
+// "77011234567" match
+func NormalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+}
@@ -0,0 +1,26 @@
+package permission
+
+import (
+	"medical-center/internal/models/user"
+	"time"
+)
+
+type Permission struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	Name        string `json:"name" gorm:"unique;not null"`
+	Description string `json:"description"`
+}
+
+type Role struct {
+	Name        user.Role `json:"name" gorm:"primaryKey;type:varchar(20)"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions" gorm:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// RolePermission is the join table between roles and permissions
+type RolePermission struct {
+	Role         user.Role `gorm:"primaryKey;type:varchar(20)"`
+	PermissionID uint      `gorm:"primaryKey"`
+}
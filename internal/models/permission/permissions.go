@@ -0,0 +1,105 @@
+package permission
+
+// Permission names follow "<resource>.<action>[.<scope>]". The ".own" scope
+// limits the action to records linked to the caller (their doctor profile or
+// their email), ".all" grants it for every record. Reads of patient data
+// without a scope cover every patient; their ".own" variants cover the
+// patients who have an appointment with the caller's doctor profile.
+const (
+	DepartmentsRead  = "departments.read"
+	DepartmentsWrite = "departments.write"
+
+	DoctorsRead                 = "doctors.read"
+	DoctorsWrite                = "doctors.write"
+	DoctorsAvailabilityWriteAll = "doctors.availability.write.all"
+	DoctorsAvailabilityWriteOwn = "doctors.availability.write.own"
+
+	SchedulesRead     = "schedules.read"
+	SchedulesWriteAll = "schedules.write.all"
+	SchedulesWriteOwn = "schedules.write.own"
+	SchedulesBook     = "schedules.book"
+
+	AppointmentsCreate   = "appointments.create"
+	AppointmentsReadAll  = "appointments.read.all"
+	AppointmentsReadOwn  = "appointments.read.own"
+	AppointmentsWriteAll = "appointments.write.all"
+	AppointmentsWriteOwn = "appointments.write.own"
+
+	PatientsRead    = "patients.read"
+	PatientsReadOwn = "patients.read.own"
+	PatientsWrite   = "patients.write"
+	PatientsMerge   = "patients.merge"
+
+	EncountersReadAll  = "encounters.read.all"
+	EncountersReadOwn  = "encounters.read.own"
+	EncountersWriteAll = "encounters.write.all"
+	EncountersWriteOwn = "encounters.write.own"
+
+	PrescriptionsRead     = "prescriptions.read"
+	PrescriptionsReadOwn  = "prescriptions.read.own"
+	PrescriptionsWriteAll = "prescriptions.write.all"
+	PrescriptionsWriteOwn = "prescriptions.write.own"
+	FormularyManage       = "formulary.manage"
+
+	LabsRead     = "labs.read"
+	LabsReadOwn  = "labs.read.own"
+	LabsOrderAll = "labs.order.all"
+	LabsOrderOwn = "labs.order.own"
+	LabsCollect  = "labs.collect"
+	LabsResults  = "labs.results"
+	LabsManage   = "labs.manage"
+
+	AttachmentsRead    = "attachments.read"
+	AttachmentsReadOwn = "attachments.read.own"
+	AttachmentsWrite   = "attachments.write"
+	AttachmentsDelete  = "attachments.delete"
+
+	HL7Manage = "hl7.manage"
+
+	DiagnosesRead     = "diagnoses.read"
+	DiagnosesReadOwn  = "diagnoses.read.own"
+	DiagnosesWriteAll = "diagnoses.write.all"
+	DiagnosesWriteOwn = "diagnoses.write.own"
+	ICDManage         = "icd.manage"
+	ReportsRead       = "reports.read"
+
+	AllergiesRead    = "allergies.read"
+	AllergiesReadOwn = "allergies.read.own"
+	AllergiesWrite   = "allergies.write"
+	ProceduresManage = "procedures.manage"
+
+	UsersManage           = "users.manage"
+	RolesManage           = "roles.manage"
+	ServiceAccountsManage = "service_accounts.manage"
+	AuditRead             = "audit.read"
+	DataRequestsManage    = "data_requests.manage"
+	RetentionManage       = "retention.manage"
+	ConsentsManage        = "consents.manage"
+	BreakGlassUse         = "break_glass.use"
+	BreakGlassReview      = "break_glass.review"
+)
+
+// Set is a lookup of permission names granted to a caller
+type Set map[string]bool
+
+func NewSet(names []string) Set {
+	set := make(Set, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+func (s Set) Has(name string) bool {
+	return s[name]
+}
+
+// HasAny reports whether at least one of the given permissions is granted
+func (s Set) HasAny(names ...string) bool {
+	for _, name := range names {
+		if s[name] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package prescription
+
+import (
+	"medical-center/internal/models/allergy"
+	"time"
+)
+
+type Status string
+
+const (
+	// StatusDraft prescriptions can still be edited and are not valid yet
+	StatusDraft  Status = "draft"
+	StatusIssued Status = "issued"
+	// StatusCancelled prescriptions must not be dispensed any more
+	StatusCancelled Status = "cancelled"
+	// StatusRenewed prescriptions were replaced by a renewal
+	StatusRenewed Status = "renewed"
+)
+
+// Route is how a medication is administered
+type Route string
+
+const (
+	RouteOral          Route = "oral"
+	RouteSublingual    Route = "sublingual"
+	RouteTopical       Route = "topical"
+	RouteInhaled       Route = "inhaled"
+	RouteNasal         Route = "nasal"
+	RouteOphthalmic    Route = "ophthalmic"
+	RouteOtic          Route = "otic"
+	RouteRectal        Route = "rectal"
+	RouteIntravenous   Route = "intravenous"
+	RouteIntramuscular Route = "intramuscular"
+	RouteSubcutaneous  Route = "subcutaneous"
+)
+
+var Routes = []Route{
+	RouteOral, RouteSublingual, RouteTopical, RouteInhaled, RouteNasal, RouteOphthalmic,
+	RouteOtic, RouteRectal, RouteIntravenous, RouteIntramuscular, RouteSubcutaneous,
+}
+
+func (r Route) IsValid() bool {
+	for _, route := range Routes {
+		if r == route {
+			return true
+		}
+	}
+	return false
+}
+
+// Drug is an entry of the formulary catalogue. Drugs are never deleted;
+// the ones dropped from the catalogue are deactivated and cannot be
+// prescribed any more.
+type Drug struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Code      string    `json:"code" gorm:"size:50;uniqueIndex;not null"`
+	Name      string    `json:"name" gorm:"size:255;not null"`
+	Form      string    `json:"form" gorm:"size:100"`
+	Strength  string    `json:"strength" gorm:"size:100"`
+	ATCCode   string    `json:"atc_code" gorm:"column:atc_code;size:20;index"`
+	Active    bool      `json:"active" gorm:"not null;default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Drug) TableName() string {
+	return "formulary_drugs"
+}
+
+// Label is how the drug is printed on a prescription,
+// e.g. "Amoxicillin 500 mg capsule"
+func (d *Drug) Label() string {
+	label := d.Name
+	for _, part := range []string{d.Strength, d.Form} {
+		if part != "" {
+			label += " " + part
+		}
+	}
+	return label
+}
+
+// DrugFilter narrows down formulary searches. Query matches the start of the
+// code or any part of the name.
+type DrugFilter struct {
+	Query           string
+	IncludeInactive bool
+	Page            int
+	PageSize        int
+}
+
+// ImportResult reports the outcome of a formulary import
+type ImportResult struct {
+	Created     int      `json:"created"`
+	Updated     int      `json:"updated"`
+	Unchanged   int      `json:"unchanged"`
+	Deactivated int64    `json:"deactivated"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// Line is one medication of a prescription
+type Line struct {
+	ID             uint `json:"id" gorm:"primaryKey"`
+	PrescriptionID uint `json:"prescription_id" gorm:"index;not null"`
+	DrugID         uint `json:"drug_id" gorm:"not null"`
+	// DrugName is the drug label when the line was written
+	DrugName string `json:"drug_name" gorm:"size:255;not null"`
+	// Dose per administration, e.g. "500 mg" or "2 puffs"
+	Dose  string `json:"dose" gorm:"size:100;not null"`
+	Route Route  `json:"route" gorm:"size:20;not null"`
+	// Frequency, e.g. "3 times a day" or "every 8 hours"
+	Frequency    string `json:"frequency" gorm:"size:100;not null"`
+	DurationDays int    `json:"duration_days" gorm:"not null"`
+	// Quantity is the number of units to dispense
+	Quantity     int    `json:"quantity" gorm:"not null"`
+	Instructions string `json:"instructions"`
+}
+
+func (Line) TableName() string {
+	return "prescription_lines"
+}
+
+// Prescription is written by a doctor for an appointment, and linked to the
+// encounter note of the appointment when there is one. The verification
+// code is assigned when it is issued.
+type Prescription struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	AppointmentID    uint       `json:"appointment_id" gorm:"index;not null"`
+	EncounterNoteID  *uint      `json:"encounter_note_id,omitempty"`
+	PatientID        *uint      `json:"patient_id,omitempty" gorm:"index"`
+	DoctorID         uint       `json:"doctor_id" gorm:"index;not null"`
+	Status           Status     `json:"status" gorm:"size:20;not null"`
+	VerificationCode *string    `json:"verification_code,omitempty" gorm:"size:20;uniqueIndex"`
+	Notes            string     `json:"notes"`
+	CreatedByID      uint       `json:"created_by_id"`
+	IssuedAt         *time.Time `json:"issued_at,omitempty"`
+	CancelledAt      *time.Time `json:"cancelled_at,omitempty"`
+	CancelledByID    *uint      `json:"cancelled_by_id,omitempty"`
+	CancelReason     string     `json:"cancel_reason,omitempty"`
+	// RenewedFromID is the prescription this one renews
+	RenewedFromID *uint     `json:"renewed_from_id,omitempty" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Lines         []Line    `json:"lines" gorm:"foreignKey:PrescriptionID"`
+	// Acknowledgements are the allergy warnings acknowledged when the
+	// prescription was written; only set on the prescription just saved
+	Acknowledgements []allergy.Acknowledgement `json:"acknowledgements,omitempty" gorm:"foreignKey:PrescriptionID"`
+}
+
+// ActiveMedication is a line of an issued prescription whose duration has
+// not run out yet
+type ActiveMedication struct {
+	Line
+	VerificationCode string    `json:"verification_code"`
+	DoctorID         uint      `json:"doctor_id"`
+	IssuedAt         time.Time `json:"issued_at"`
+	EndsAt           time.Time `json:"ends_at"`
+}
+
+// Verification is what the public verification endpoint tells a pharmacy
+// about a prescription: enough to dispense it, nothing about the patient
+type Verification struct {
+	VerificationCode string     `json:"verification_code"`
+	Status           Status     `json:"status"`
+	Valid            bool       `json:"valid"`
+	DoctorID         uint       `json:"doctor_id"`
+	IssuedAt         *time.Time `json:"issued_at"`
+	CancelledAt      *time.Time `json:"cancelled_at,omitempty"`
+	Lines            []Line     `json:"lines"`
+}
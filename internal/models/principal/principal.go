@@ -0,0 +1,42 @@
+package principal
+
+import "medical-center/internal/models/user"
+
+type Kind string
+
+const (
+	KindUser           Kind = "user"
+	KindServiceAccount Kind = "service_account"
+)
+
+// Principal is the authenticated caller of a request, either a user logged
+// in with a token or a service account using an API key
+type Principal struct {
+	Kind Kind   `json:"kind"`
+	ID   uint   `json:"id"` // User ID or service account ID depending on Kind
+	Name string `json:"name"`
+
+	// Set for users
+	User      *user.User `json:"-"`
+	Role      user.Role  `json:"role,omitempty"`
+	SessionID string     `json:"session_id,omitempty"`
+
+	// Set for service accounts
+	APIKeyID       uint     `json:"api_key_id,omitempty"`
+	Scopes         []string `json:"scopes,omitempty"`
+	ConsentPurpose string   `json:"consent_purpose,omitempty"` // Consent patients must have given to share data with this caller
+}
+
+func ForUser(u *user.User) *Principal {
+	return &Principal{
+		Kind: KindUser,
+		ID:   u.ID,
+		Name: u.Name,
+		User: u,
+		Role: u.Role,
+	}
+}
+
+func (p *Principal) IsUser() bool {
+	return p.Kind == KindUser && p.User != nil
+}
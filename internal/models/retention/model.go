@@ -0,0 +1,97 @@
+package retention
+
+import (
+	"errors"
+	"time"
+)
+
+type Action string
+
+const (
+	// ActionPurgeDeleted removes soft-deleted rows for good once they have
+	// been deleted for longer than the rule allows
+	ActionPurgeDeleted Action = "purge_deleted"
+	// ActionAnonymize removes the patient details of appointments older
+	// than the rule allows, keeping the rest for statistics
+	ActionAnonymize Action = "anonymize"
+)
+
+// Entities lists the tables rules can be set for and the actions each
+// supports
+var Entities = map[string][]Action{
+	"departments":  {ActionPurgeDeleted},
+	"doctors":      {ActionPurgeDeleted},
+	"schedules":    {ActionPurgeDeleted},
+	"appointments": {ActionPurgeDeleted, ActionAnonymize},
+}
+
+// Supports reports whether action can be applied to entity
+func Supports(entity string, action Action) bool {
+	for _, a := range Entities[entity] {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrStillReferenced is returned when a row cannot be purged because other
+// rows still point to it
+var ErrStillReferenced = errors.New("row is still referenced")
+
+// Rule applies Action to rows of Entity that are older than AfterDays. Age
+// is counted from the deletion for purges and from the appointment time for
+// anonymisation.
+type Rule struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Entity    string    `json:"entity" gorm:"size:50;not null"`
+	Action    Action    `json:"action" gorm:"size:20;not null"`
+	AfterDays int       `json:"after_days" gorm:"not null"`
+	Enabled   bool      `json:"enabled" gorm:"not null;default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Rule) TableName() string {
+	return "retention_rules"
+}
+
+// LegalHold keeps the records of a patient out of every retention rule and
+// blocks erasure of their data until it is released
+type LegalHold struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"index;not null"`
+	Reason       string     `json:"reason" gorm:"not null"`
+	PlacedByID   uint       `json:"placed_by_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ReleasedAt   *time.Time `json:"released_at,omitempty"`
+	ReleasedByID *uint      `json:"released_by_id,omitempty"`
+}
+
+func (h *LegalHold) IsActive() bool {
+	return h.ReleasedAt == nil
+}
+
+// Report describes one run of the retention rules
+type Report struct {
+	DryRun     bool         `json:"dry_run"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	Rules      []RuleReport `json:"rules"`
+}
+
+// RuleReport is the outcome of one rule. In a dry run Matched is what
+// would have been processed.
+type RuleReport struct {
+	RuleID    uint      `json:"rule_id"`
+	Entity    string    `json:"entity"`
+	Action    Action    `json:"action"`
+	Cutoff    time.Time `json:"cutoff"`
+	Matched   int       `json:"matched"`
+	Held      int       `json:"held"` // Skipped because of a legal hold
+	Processed int       `json:"processed"`
+	// Referenced rows cannot be purged yet because other rows point to them
+	Referenced int      `json:"referenced"`
+	Failed     int      `json:"failed"`
+	Errors     []string `json:"errors,omitempty"`
+}
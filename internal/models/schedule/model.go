@@ -20,3 +20,17 @@ func (s *Schedule) IsValid() error {
 	}
 	return nil
 }
+
+// ErrAlreadyBooked is returned when booking a slot that is taken
+var ErrAlreadyBooked = errors.New("schedule slot is already booked")
+
+// SearchFilter narrows a search of slots, empty fields match every slot
+type SearchFilter struct {
+	DoctorID *uint
+	// From and To bound the start time, From is inclusive and To exclusive
+	From     *time.Time
+	To       *time.Time
+	Booked   *bool
+	Page     int
+	PageSize int
+}
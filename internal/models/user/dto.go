@@ -0,0 +1,11 @@
+package user
+
+// ListFilter narrows down admin user listings. Empty fields are ignored.
+type ListFilter struct {
+	Role     Role
+	Status   Status
+	Email    string // Case-insensitive substring match
+	DoctorID *uint  // Accounts linked to the doctor profile
+	Page     int
+	PageSize int
+}
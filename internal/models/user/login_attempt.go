@@ -0,0 +1,16 @@
+package user
+
+import "time"
+
+// LoginAttempt counts recent failed logins for a throttling key such as
+// "account:<email>" or "ip:<address>"
+type LoginAttempt struct {
+	Key          string    `gorm:"primaryKey;size:320"`
+	Failures     int       `gorm:"not null;default:0"`
+	LastFailedAt time.Time `gorm:"not null"`
+	LockedUntil  *time.Time
+}
+
+func (a *LoginAttempt) IsLocked(now time.Time) bool {
+	return a.LockedUntil != nil && now.Before(*a.LockedUntil)
+}
@@ -0,0 +1,17 @@
+package user
+
+import "time"
+
+// MFARecoveryCode is a one-time code that replaces a TOTP code when the
+// authenticator device is lost. Only the hash is stored.
+type MFARecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	CodeHash  string `gorm:"size:64;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
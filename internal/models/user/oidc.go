@@ -0,0 +1,13 @@
+package user
+
+import "time"
+
+// OIDCAuthRequest keeps the PKCE verifier and nonce of a single-sign-on
+// login between the redirect to the identity provider and its callback
+type OIDCAuthRequest struct {
+	State        string    `gorm:"primaryKey;size:64"`
+	CodeVerifier string    `gorm:"size:64;not null"`
+	Nonce        string    `gorm:"size:64;not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	CreatedAt    time.Time
+}
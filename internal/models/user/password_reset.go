@@ -0,0 +1,14 @@
+package user
+
+import "time"
+
+// PasswordResetToken is a single-use password reset token. Only the SHA-256
+// hash of the token is stored; the plain token is emailed to the user.
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index;not null"`
+	TokenHash string    `gorm:"size:64;unique;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,22 @@
+package user
+
+import "time"
+
+// Session is a single login of a user on a device. Access tokens carry the
+// session ID, so revoking the session revokes the token.
+type Session struct {
+	ID         string     `json:"id" gorm:"primaryKey;size:32"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	Device     string     `json:"device" gorm:"size:100"`
+	UserAgent  string     `json:"user_agent" gorm:"size:512"`
+	IP         string     `json:"ip" gorm:"size:45"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at" gorm:"not null"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Current    bool       `json:"current" gorm:"-"` // Set when listing the sessions of the caller
+}
+
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
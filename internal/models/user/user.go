@@ -2,22 +2,49 @@ package user
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Role string
 
 const (
-	RoleAdmin  Role = "admin"
-	RoleDoctor Role = "doctor"
-	RolePatient Role = "patient"
+	RoleAdmin        Role = "admin"
+	RoleDoctor       Role = "doctor"
+	RolePatient      Role = "patient"
+	RoleReceptionist Role = "receptionist"
+	RoleNurse        Role = "nurse"
+	RoleBilling      Role = "billing"
+)
+
+type Status string
+
+const (
+	StatusActive   Status = "active"
+	StatusDisabled Status = "disabled"
 )
 
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Email     string    `json:"email" gorm:"unique;not null"`
-	Password  string    `json:"-" gorm:"not null"` // Password is not exposed in JSON
-	Name      string    `json:"name"`
-	Role      Role      `json:"role" gorm:"type:varchar(20);default:'patient'"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-} 
\ No newline at end of file
+	ID                    uint           `json:"id" gorm:"primaryKey"`
+	Email                 string         `json:"email" gorm:"unique;not null"`
+	Password              string         `json:"-" gorm:"not null"` // Password is not exposed in JSON
+	Name                  string         `json:"name"`
+	Role                  Role           `json:"role" gorm:"type:varchar(20);default:'patient'"`
+	Status                Status         `json:"status" gorm:"type:varchar(20);not null;default:'active'"`
+	DoctorID              *uint          `json:"doctor_id,omitempty" gorm:"index"` // Doctor profile owned by this account, if any
+	TokenVersion          int            `json:"-" gorm:"not null;default:0"`      // Bumping it revokes every issued token
+	EmailVerified         bool           `json:"email_verified" gorm:"not null;default:false"`
+	EmailVerifiedAt       *time.Time     `json:"email_verified_at,omitempty"`
+	MFAEnabled            bool           `json:"mfa_enabled" gorm:"column:mfa_enabled;not null;default:false"`
+	MFASecret             string         `json:"-" gorm:"column:mfa_secret"`
+	MFALastStep           int64          `json:"-" gorm:"column:mfa_last_step;not null;default:0"`      // Last accepted TOTP step, rejects replays
+	PasswordResetRequired bool           `json:"password_reset_required" gorm:"not null;default:false"` // Blocks login until the password is reset
+	OIDCSubject           *string        `json:"-" gorm:"column:oidc_subject;unique"`                   // Subject at the identity provider for SSO accounts
+	CreatedAt             time.Time      `json:"created_at"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+	DeletedAt             gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func (u *User) IsDisabled() bool {
+	return u.Status == StatusDisabled
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/allergy"
+)
+
+type AllergyRepository interface {
+	// ListAllergies returns the allergies of the patient, most severe first
+	ListAllergies(ctx context.Context, patientID uint) ([]allergy.Allergy, error)
+	GetAllergy(ctx context.Context, id uint) (*allergy.Allergy, error)
+	CreateAllergy(ctx context.Context, a *allergy.Allergy) error
+	SaveAllergy(ctx context.Context, a *allergy.Allergy) error
+	DeleteAllergy(ctx context.Context, id uint) error
+
+	// ListConditions returns the conditions of the patient, current ones
+	// first
+	ListConditions(ctx context.Context, patientID uint) ([]allergy.Condition, error)
+	GetCondition(ctx context.Context, id uint) (*allergy.Condition, error)
+	CreateCondition(ctx context.Context, c *allergy.Condition) error
+	SaveCondition(ctx context.Context, c *allergy.Condition) error
+	DeleteCondition(ctx context.Context, id uint) error
+
+	// ListAcknowledgements returns the acknowledged warnings of the patient,
+	// newest first
+	ListAcknowledgements(ctx context.Context, patientID uint) ([]allergy.Acknowledgement, error)
+}
+
+type ProcedureRepository interface {
+	ListProcedures(ctx context.Context, includeInactive bool) ([]allergy.Procedure, error)
+	GetProcedure(ctx context.Context, id uint) (*allergy.Procedure, error)
+	// GetProcedureByCode returns the procedure with the code, or nil
+	GetProcedureByCode(ctx context.Context, code string) (*allergy.Procedure, error)
+	CreateProcedure(ctx context.Context, p *allergy.Procedure) error
+	SaveProcedure(ctx context.Context, p *allergy.Procedure) error
+	// SetAppointmentProcedure sets the procedure of the appointment, nil to
+	// clear it, and stores the acknowledgements in the same transaction
+	SetAppointmentProcedure(ctx context.Context, appointmentID uint, procedureID *uint, acks []allergy.Acknowledgement) error
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/apikey"
+	"time"
+)
+
+type APIKeyRepository interface {
+	CreateServiceAccount(ctx context.Context, account *apikey.ServiceAccount) error
+	GetServiceAccount(ctx context.Context, id uint) (*apikey.ServiceAccount, error)
+	GetServiceAccounts(ctx context.Context) ([]apikey.ServiceAccount, error)
+	Create(ctx context.Context, key *apikey.APIKey) error
+	GetByID(ctx context.Context, id uint) (*apikey.APIKey, error)
+	GetByHash(ctx context.Context, hash string) (*apikey.APIKey, error)
+	GetByServiceAccount(ctx context.Context, accountID uint) ([]apikey.APIKey, error)
+	Revoke(ctx context.Context, id uint, at time.Time) error
+	TouchLastUsed(ctx context.Context, id uint, at time.Time) error
+}
@@ -1,16 +1,29 @@
 package repository
 
 import (
+	"context"
 	"medical-center/internal/models/appointment"
 )
 
 type AppRepository interface {
-	Create(app *appointment.Appointment) error
-	GetByID(id uint) (*appointment.Appointment, error)
-	GetAll() ([]appointment.Appointment, error)
-	GetByDepartment(departmentID uint) ([]appointment.Appointment, error)
-	GetByPatient(name string) ([]appointment.Appointment, error)
-	Update(appointment *appointment.Appointment) error
-	Delete(id uint) error
-	GetByDoctor(doctorID uint) ([]appointment.Appointment, error)
+	Create(ctx context.Context, app *appointment.Appointment) error
+	GetByID(ctx context.Context, id uint) (*appointment.Appointment, error)
+	GetAll(ctx context.Context) ([]appointment.Appointment, error)
+	GetByDepartment(ctx context.Context, departmentID uint) ([]appointment.Appointment, error)
+	GetByPatient(ctx context.Context, name string) ([]appointment.Appointment, error)
+	Update(ctx context.Context, appointment *appointment.Appointment) error
+	Delete(ctx context.Context, id uint) error
+	GetByDoctor(ctx context.Context, doctorID uint) ([]appointment.Appointment, error)
+	GetByEmail(ctx context.Context, email string) ([]appointment.Appointment, error)
+	GetByPatientID(ctx context.Context, patientID uint) ([]appointment.Appointment, error)
+	// IsPatientOf reports whether the patient has an appointment with the
+	// doctor that was not cancelled
+	IsPatientOf(ctx context.Context, patientID, doctorID uint) (bool, error)
+	// Search returns a page of the matching appointments ordered by time,
+	// with the number of matches
+	Search(ctx context.Context, filter appointment.SearchFilter) ([]appointment.Appointment, int64, error)
+	// AnonymizeByEmail removes the patient details from every appointment
+	// booked with email, keeping the rest of the record. Returns how many
+	// appointments were changed.
+	AnonymizeByEmail(ctx context.Context, email string) (int, error)
 }
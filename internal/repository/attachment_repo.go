@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/attachment"
+)
+
+type AttachmentRepository interface {
+	Create(ctx context.Context, a *attachment.Attachment) error
+	GetByID(ctx context.Context, id uint) (*attachment.Attachment, error)
+	GetByPatient(ctx context.Context, patientID uint) ([]attachment.Attachment, error)
+	GetByAppointment(ctx context.Context, appointmentID uint) ([]attachment.Attachment, error)
+	// Delete hides the attachment; the row stays for the audit trail
+	Delete(ctx context.Context, id uint) error
+}
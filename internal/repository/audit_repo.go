@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/audit"
+)
+
+type AuditRepository interface {
+	List(ctx context.Context, filter audit.Filter) ([]audit.Entry, int64, error)
+	// GetAfter returns up to limit entries with an ID above afterID, in chain order
+	GetAfter(ctx context.Context, afterID uint, limit int) ([]audit.Entry, error)
+	// CreateCheckpoint records the last entry of the log, nil while the log
+	// is empty
+	CreateCheckpoint(ctx context.Context) (*audit.Checkpoint, error)
+	// ListCheckpoints returns every checkpoint in chain order
+	ListCheckpoints(ctx context.Context) ([]audit.Checkpoint, error)
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/breakglass"
+	"time"
+)
+
+type BreakGlassRepository interface {
+	CreateGrant(ctx context.Context, grant *breakglass.Grant) error
+	GetGrant(ctx context.Context, id uint) (*breakglass.Grant, error)
+	// GetActiveGrant returns the grant of the user that is neither ended nor
+	// expired, or nil
+	GetActiveGrant(ctx context.Context, userID uint, now time.Time) (*breakglass.Grant, error)
+	GetGrants(ctx context.Context, userID uint) ([]breakglass.Grant, error)
+	EndGrant(ctx context.Context, id uint, at time.Time) error
+
+	CreateAccess(ctx context.Context, access *breakglass.Access) error
+	GetAccess(ctx context.Context, id uint) (*breakglass.Access, error)
+	ListAccesses(ctx context.Context, filter breakglass.AccessFilter) ([]breakglass.Access, int64, error)
+	UpdateAccess(ctx context.Context, access *breakglass.Access) error
+	// ReviewPendingByGrant sets the review of every pending access of the grant
+	ReviewPendingByGrant(ctx context.Context, grantID uint, status breakglass.ReviewStatus, reviewerID uint, note string, at time.Time) (int64, error)
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/consent"
+)
+
+type ConsentRepository interface {
+	Create(ctx context.Context, record *consent.Record) error
+	// GetHistory returns every record of the user, newest first
+	GetHistory(ctx context.Context, userID uint) ([]consent.Record, error)
+	// GetLatest returns the newest record of the user for each purpose
+	GetLatest(ctx context.Context, userID uint) ([]consent.Record, error)
+}
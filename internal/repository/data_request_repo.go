@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/datarequest"
+)
+
+type DataRequestRepository interface {
+	Create(ctx context.Context, req *datarequest.Request) error
+	GetByID(ctx context.Context, id uint) (*datarequest.Request, error)
+	List(ctx context.Context, filter datarequest.ListFilter) ([]datarequest.Request, int64, error)
+	Update(ctx context.Context, req *datarequest.Request) error
+}
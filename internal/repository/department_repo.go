@@ -1,16 +1,17 @@
 package repository
 
 import (
+	"context"
 	"medical-center/internal/models/department"
 	"time"
 )
 
 type DepartmentRepository interface {
-	Create(depart *department.Department) error
-	GetByID(id uint) (*department.Department, error)
-	GetAll() ([]department.Department, error)
-	Update(depart *department.Department) error
-	Delete(id uint) error
-	GetWithDoctors(id uint) (*department.Department, error)
-	GetAvailableSlots(id uint, date time.Time) ([]time.Time, error)
+	Create(ctx context.Context, depart *department.Department) error
+	GetByID(ctx context.Context, id uint) (*department.Department, error)
+	GetAll(ctx context.Context) ([]department.Department, error)
+	Update(ctx context.Context, depart *department.Department) error
+	Delete(ctx context.Context, id uint) error
+	GetWithDoctors(ctx context.Context, id uint) (*department.Department, error)
+	GetAvailableSlots(ctx context.Context, id uint, date time.Time) ([]time.Time, error)
 }
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/diagnosis"
+)
+
+type ICDCodeRepository interface {
+	// CreateCodes stores new codes in batches
+	CreateCodes(ctx context.Context, codes []diagnosis.Code) error
+	GetCode(ctx context.Context, id uint) (*diagnosis.Code, error)
+	// GetCodeByCode returns the entry with the code, or nil
+	GetCodeByCode(ctx context.Context, code string) (*diagnosis.Code, error)
+	// AllCodes returns every entry, active or not, for imports
+	AllCodes(ctx context.Context) ([]diagnosis.Code, error)
+	ListCodes(ctx context.Context, filter diagnosis.CodeFilter) ([]diagnosis.Code, int64, error)
+	UpdateCode(ctx context.Context, code *diagnosis.Code) error
+	// DeactivateExcept deactivates the active codes that are not listed
+	DeactivateExcept(ctx context.Context, codes []string) (int64, error)
+}
+
+type DiagnosisRepository interface {
+	// Create stores the diagnosis; a primary diagnosis demotes the primary
+	// diagnosis the appointment had to secondary in the same transaction
+	Create(ctx context.Context, d *diagnosis.Diagnosis) error
+	GetByID(ctx context.Context, id uint) (*diagnosis.Diagnosis, error)
+	// GetByAppointment returns the diagnoses of the appointment with their
+	// catalogue entries, the primary one first
+	GetByAppointment(ctx context.Context, appointmentID uint) ([]diagnosis.Diagnosis, error)
+	// Save stores the diagnosis, demoting the other primary one like Create
+	Save(ctx context.Context, d *diagnosis.Diagnosis) error
+	Delete(ctx context.Context, id uint) error
+	// TopByDepartment ranks the codes, or categories, given in each
+	// department
+	TopByDepartment(ctx context.Context, filter diagnosis.ReportFilter) ([]diagnosis.TopDiagnosis, error)
+}
@@ -1,16 +1,17 @@
 package repository
 
 import (
+	"context"
 	"medical-center/internal/models/doctor"
 )
 
 type DoctorRepository interface {
-	Create(doctor *doctor.Doctor) error
-	GetByID(id uint) (*doctor.Doctor, error)
-	GetAll() ([]doctor.Doctor, error)
-	GetByDepartment(departmentID uint) ([]doctor.Doctor, error)
-	Update(doctor *doctor.Doctor) error
-	Delete(id uint) error
-	SetAvailability(id uint, available bool) error
-	GetAvailable() ([]doctor.Doctor, error)
+	Create(ctx context.Context, doctor *doctor.Doctor) error
+	GetByID(ctx context.Context, id uint) (*doctor.Doctor, error)
+	GetAll(ctx context.Context) ([]doctor.Doctor, error)
+	GetByDepartment(ctx context.Context, departmentID uint) ([]doctor.Doctor, error)
+	Update(ctx context.Context, doctor *doctor.Doctor) error
+	Delete(ctx context.Context, id uint) error
+	SetAvailability(ctx context.Context, id uint, available bool) error
+	GetAvailable(ctx context.Context) ([]doctor.Doctor, error)
 }
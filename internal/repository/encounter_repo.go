@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/encounter"
+)
+
+type EncounterRepository interface {
+	// GetByAppointment returns the note of the appointment with its addenda,
+	// or nil
+	GetByAppointment(ctx context.Context, appointmentID uint) (*encounter.Note, error)
+	// Create stores a new note and its first version
+	Create(ctx context.Context, note *encounter.Note) error
+	// Save stores the note with the next version number and keeps the
+	// version. It returns encounter.ErrVersionConflict when the stored note
+	// is no longer at expectedVersion and encounter.ErrSigned when it is
+	// signed.
+	Save(ctx context.Context, note *encounter.Note, expectedVersion int) error
+	GetVersions(ctx context.Context, noteID uint) ([]encounter.Version, error)
+	CreateAddendum(ctx context.Context, addendum *encounter.Addendum) error
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/hl7msg"
+)
+
+type HL7MessageRepository interface {
+	Create(ctx context.Context, m *hl7msg.Message) error
+	GetByID(ctx context.Context, id uint) (*hl7msg.Message, error)
+	List(ctx context.Context, filter hl7msg.Filter) ([]hl7msg.Message, int64, error)
+	// NextPending returns the oldest pending outbound message, or nil when
+	// the outbox is empty
+	NextPending(ctx context.Context) (*hl7msg.Message, error)
+	Save(ctx context.Context, m *hl7msg.Message) error
+}
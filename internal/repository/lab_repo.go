@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/lab"
+)
+
+type LabTestRepository interface {
+	Create(ctx context.Context, test *lab.Test) error
+	GetByID(ctx context.Context, id uint) (*lab.Test, error)
+	// GetByCode returns the test with the code, or nil
+	GetByCode(ctx context.Context, code string) (*lab.Test, error)
+	List(ctx context.Context, filter lab.TestFilter) ([]lab.Test, int64, error)
+	Update(ctx context.Context, test *lab.Test) error
+}
+
+type LabOrderRepository interface {
+	// Create stores the order with its empty results
+	Create(ctx context.Context, order *lab.Order) error
+	GetByID(ctx context.Context, id uint) (*lab.Order, error)
+	GetByAppointment(ctx context.Context, appointmentID uint) ([]lab.Order, error)
+	List(ctx context.Context, filter lab.OrderFilter) ([]lab.Order, int64, error)
+	// Save stores the order without touching its results
+	Save(ctx context.Context, order *lab.Order) error
+	// RecordResult fills in a result that has none yet and marks the order
+	// as resulted when it was the last one, in one transaction. It reports
+	// whether the order is now resulted.
+	RecordResult(ctx context.Context, result *lab.Result) (bool, error)
+	// GetHistory returns the results of the patient, newest first,
+	// optionally of a single test
+	GetHistory(ctx context.Context, patientID uint, testCode string) ([]lab.HistoryEntry, error)
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/user"
+	"time"
+)
+
+// LoginAttemptRepository stores failed login counters. It is shared by all
+// application instances, so implementations must update counters atomically.
+type LoginAttemptRepository interface {
+	// Get returns nil without an error when the key has no recorded failures
+	Get(ctx context.Context, key string) (*user.LoginAttempt, error)
+	// RecordFailure increments the counter, starting over when the previous
+	// failure is older than windowStart or an earlier lockout has expired
+	RecordFailure(ctx context.Context, key string, at, windowStart time.Time) (*user.LoginAttempt, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
@@ -0,0 +1,11 @@
+package repository
+
+import "context"
+
+type MFARecoveryCodeRepository interface {
+	// Replace discards the user's previous codes and stores the new hashes
+	Replace(ctx context.Context, userID uint, codeHashes []string) error
+	// Consume marks the code as used; it fails if no unused code matches
+	Consume(ctx context.Context, userID uint, codeHash string) error
+	DeleteForUser(ctx context.Context, userID uint) error
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/notification"
+)
+
+type NotificationRepository interface {
+	Create(ctx context.Context, n *notification.Notification) error
+	GetByRecipient(ctx context.Context, email string) ([]notification.Notification, error)
+	// AnonymizeRecipient replaces the address on every notification sent to email
+	AnonymizeRecipient(ctx context.Context, email, replacement string) error
+}
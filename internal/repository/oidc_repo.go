@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/user"
+	"time"
+)
+
+type OIDCAuthRequestRepository interface {
+	Create(ctx context.Context, req *user.OIDCAuthRequest) error
+	// Consume deletes and returns the request so that a state is only used once
+	Consume(ctx context.Context, state string) (*user.OIDCAuthRequest, error)
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
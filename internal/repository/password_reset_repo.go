@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/user"
+)
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, token *user.PasswordResetToken) error
+	GetByHash(ctx context.Context, hash string) (*user.PasswordResetToken, error)
+	// MarkUsed consumes the token; it fails if the token was already used
+	MarkUsed(ctx context.Context, id uint) error
+	InvalidateForUser(ctx context.Context, userID uint) error
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/patient"
+)
+
+type PatientRepository interface {
+	// Create assigns the next medical record number
+	Create(ctx context.Context, p *patient.Patient) error
+	GetByID(ctx context.Context, id uint) (*patient.Patient, error)
+	List(ctx context.Context, filter patient.Filter) ([]patient.Patient, int64, error)
+	Update(ctx context.Context, p *patient.Patient) error
+	// GetByUser returns the patients linked to a user account, merged ones
+	// included
+	GetByUser(ctx context.Context, userID uint) ([]patient.Patient, error)
+	// FindMatch returns the patient that is not merged with exactly this
+	// name and either this email or this phone, or nil
+	FindMatch(ctx context.Context, name, email, phone string) (*patient.Patient, error)
+	// FindCandidates returns the patients that are not merged and share the
+	// IIN, email, phone, name or date of birth with p
+	FindCandidates(ctx context.Context, p *patient.Patient) ([]patient.Patient, error)
+	// Merge moves the appointments, encounter notes, prescriptions, lab
+	// orders, attachments, allergies and HL7 messages of merged to survivor,
+	// saves survivor and marks merged as merged into it, all in one
+	// transaction
+	Merge(ctx context.Context, survivor, merged *patient.Patient, merge *patient.Merge) error
+	GetMerges(ctx context.Context, patientID uint) ([]patient.Merge, error)
+	// Anonymize removes the personal details of a patient, keeping the MRN,
+	// and the payloads of the HL7 messages about the patient
+	Anonymize(ctx context.Context, id uint) error
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/models/user"
+)
+
+type PermissionRepository interface {
+	GetAll(ctx context.Context) ([]permission.Permission, error)
+	GetByNames(ctx context.Context, names []string) ([]permission.Permission, error)
+	GetRoles(ctx context.Context) ([]permission.Role, error)
+	GetRole(ctx context.Context, name user.Role) (*permission.Role, error)
+	CreateRole(ctx context.Context, role *permission.Role) error
+	GetRolePermissions(ctx context.Context, role user.Role) ([]string, error)
+	SetRolePermissions(ctx context.Context, role user.Role, permissionIDs []uint) error
+}
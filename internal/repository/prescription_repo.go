@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/prescription"
+)
+
+type FormularyRepository interface {
+	CreateDrug(ctx context.Context, drug *prescription.Drug) error
+	GetDrug(ctx context.Context, id uint) (*prescription.Drug, error)
+	// GetDrugByCode returns the drug with the code, or nil
+	GetDrugByCode(ctx context.Context, code string) (*prescription.Drug, error)
+	ListDrugs(ctx context.Context, filter prescription.DrugFilter) ([]prescription.Drug, int64, error)
+	UpdateDrug(ctx context.Context, drug *prescription.Drug) error
+	// DeactivateExcept deactivates the active drugs whose code is not listed
+	DeactivateExcept(ctx context.Context, codes []string) (int64, error)
+}
+
+type PrescriptionRepository interface {
+	// Create stores the prescription with its lines and acknowledgements
+	Create(ctx context.Context, p *prescription.Prescription) error
+	GetByID(ctx context.Context, id uint) (*prescription.Prescription, error)
+	GetByVerificationCode(ctx context.Context, code string) (*prescription.Prescription, error)
+	GetByAppointment(ctx context.Context, appointmentID uint) ([]prescription.Prescription, error)
+	// GetIssuedByPatient returns the issued prescriptions of the patient,
+	// newest first
+	GetIssuedByPatient(ctx context.Context, patientID uint) ([]prescription.Prescription, error)
+	// Save stores the prescription without its lines and acknowledgements
+	Save(ctx context.Context, p *prescription.Prescription) error
+	// ReplaceLines stores the prescription, replaces its lines and adds its
+	// new acknowledgements
+	ReplaceLines(ctx context.Context, p *prescription.Prescription) error
+	// Renew creates renewal with its acknowledgements and marks original as
+	// renewed in one transaction
+	Renew(ctx context.Context, original, renewal *prescription.Prescription) error
+}
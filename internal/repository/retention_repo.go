@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/retention"
+	"time"
+)
+
+type RetentionRuleRepository interface {
+	Create(ctx context.Context, rule *retention.Rule) error
+	GetByID(ctx context.Context, id uint) (*retention.Rule, error)
+	GetAll(ctx context.Context) ([]retention.Rule, error)
+	Update(ctx context.Context, rule *retention.Rule) error
+	Delete(ctx context.Context, id uint) error
+}
+
+type LegalHoldRepository interface {
+	Create(ctx context.Context, hold *retention.LegalHold) error
+	GetByID(ctx context.Context, id uint) (*retention.LegalHold, error)
+	// GetAll lists holds, only those not yet released when activeOnly is set
+	GetAll(ctx context.Context, activeOnly bool) ([]retention.LegalHold, error)
+	IsHeld(ctx context.Context, userID uint) (bool, error)
+	Update(ctx context.Context, hold *retention.LegalHold) error
+}
+
+// RetentionRepository finds and processes the rows a retention rule applies to
+type RetentionRepository interface {
+	// FindExpired returns the IDs of the rows of rule.Entity the rule applies
+	// to at cutoff, leaving out appointments booked with one of heldEmails.
+	// held is how many rows were left out.
+	FindExpired(ctx context.Context, rule retention.Rule, cutoff time.Time, heldEmails []string) (ids []uint, held int, err error)
+	// Purge deletes a soft-deleted row for good. Returns
+	// retention.ErrStillReferenced when other rows point to it.
+	Purge(ctx context.Context, entity string, id uint) error
+	// Anonymize removes the patient details of an appointment
+	Anonymize(ctx context.Context, id uint) error
+}
@@ -1,17 +1,22 @@
 package repository
 
 import (
+	"context"
 	"medical-center/internal/models/schedule"
 	"time"
 )
 
 type ScheduleRepository interface {
-	Create(slot *schedule.Schedule) error
-	GetByID(id uint) (*schedule.Schedule, error)
-	GetByDoctor(doctorID uint) ([]schedule.Schedule, error)
-	GetAvailable(doctorID uint, date time.Time) ([]schedule.Schedule, error)
-	Update(slot *schedule.Schedule) error
-	Delete(id uint) error
-	BookSlot(id uint) error
-	CancelBooking(id uint) error
+	Create(ctx context.Context, slot *schedule.Schedule) error
+	GetByID(ctx context.Context, id uint) (*schedule.Schedule, error)
+	GetByDoctor(ctx context.Context, doctorID uint) ([]schedule.Schedule, error)
+	GetAvailable(ctx context.Context, doctorID uint, date time.Time) ([]schedule.Schedule, error)
+	Update(ctx context.Context, slot *schedule.Schedule) error
+	Delete(ctx context.Context, id uint) error
+	// BookSlot returns schedule.ErrAlreadyBooked when the slot is taken
+	BookSlot(ctx context.Context, id uint) error
+	CancelBooking(ctx context.Context, id uint) error
+	// Search returns a page of the matching slots ordered by start time,
+	// with the number of matches
+	Search(ctx context.Context, filter schedule.SearchFilter) ([]schedule.Schedule, int64, error)
 }
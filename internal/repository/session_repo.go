@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"medical-center/internal/models/user"
+	"time"
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *user.Session) error
+	GetByID(ctx context.Context, id string) (*user.Session, error)
+	// GetActiveByUser returns sessions that are neither revoked nor expired
+	GetActiveByUser(ctx context.Context, userID uint, now time.Time) ([]user.Session, error)
+	Revoke(ctx context.Context, id string, at time.Time) error
+	// RevokeAllForUser revokes every session of the user except the given one
+	RevokeAllForUser(ctx context.Context, userID uint, exceptID string, at time.Time) error
+	TouchLastSeen(ctx context.Context, id string, at time.Time) error
+	DeleteByUser(ctx context.Context, userID uint) error
+}
@@ -1,13 +1,16 @@
 package repository
 
 import (
+	"context"
 	"medical-center/internal/models/user"
 )
 
 type UserRepository interface {
-	Create(user *user.User) error
-	GetByID(id uint) (*user.User, error)
-	GetByEmail(email string) (*user.User, error)
-	Update(user *user.User) error
-	Delete(id uint) error
-} 
\ No newline at end of file
+	Create(ctx context.Context, user *user.User) error
+	GetByID(ctx context.Context, id uint) (*user.User, error)
+	GetByEmail(ctx context.Context, email string) (*user.User, error)
+	GetByOIDCSubject(ctx context.Context, subject string) (*user.User, error)
+	Update(ctx context.Context, user *user.User) error
+	Delete(ctx context.Context, id uint) error
+	List(ctx context.Context, filter user.ListFilter) ([]user.User, int64, error)
+}
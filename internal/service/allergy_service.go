@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"medical-center/internal/models/allergy"
+	"medical-center/internal/models/diagnosis"
+	"medical-center/internal/repository"
+	"strings"
+	"time"
+)
+
+// AllergyService keeps the allergies and chronic conditions of patients and
+// checks the procedures set on appointments against the allergies.
+// Prescriptions are checked by PrescriptionService.
+type AllergyService struct {
+	repo       repository.AllergyRepository
+	procedures repository.ProcedureRepository
+	codes      repository.ICDCodeRepository
+	appRepo    repository.AppRepository
+	patients   *PatientService
+}
+
+func NewAllergyService(
+	repo repository.AllergyRepository,
+	procedures repository.ProcedureRepository,
+	codes repository.ICDCodeRepository,
+	appRepo repository.AppRepository,
+	patients *PatientService,
+) *AllergyService {
+	return &AllergyService{repo: repo, procedures: procedures, codes: codes, appRepo: appRepo, patients: patients}
+}
+
+func (s *AllergyService) ListAllergies(ctx context.Context, patientID uint) ([]allergy.Allergy, error) {
+	return s.repo.ListAllergies(ctx, patientID)
+}
+
+func (s *AllergyService) GetAllergy(ctx context.Context, id uint) (*allergy.Allergy, error) {
+	return s.repo.GetAllergy(ctx, id)
+}
+
+// AddAllergy records an allergy of the patient, or of the patient they were
+// merged into
+func (s *AllergyService) AddAllergy(ctx context.Context, actorID, patientID uint, input allergy.AllergyInput) (*allergy.Allergy, error) {
+	p, err := s.patients.Resolve(ctx, patientID)
+	if err != nil {
+		return nil, err
+	}
+	a := &allergy.Allergy{PatientID: p.ID, RecordedByID: actorID}
+	if err := applyAllergy(a, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateAllergy(ctx, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *AllergyService) UpdateAllergy(ctx context.Context, id uint, input allergy.AllergyInput) (*allergy.Allergy, error) {
+	a, err := s.repo.GetAllergy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyAllergy(a, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveAllergy(ctx, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *AllergyService) RemoveAllergy(ctx context.Context, id uint) error {
+	if _, err := s.repo.GetAllergy(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteAllergy(ctx, id)
+}
+
+func applyAllergy(a *allergy.Allergy, input allergy.AllergyInput) error {
+	substance := strings.TrimSpace(input.Substance)
+	if substance == "" {
+		return errors.New("substance is required")
+	}
+	if !input.Severity.IsValid() {
+		return fmt.Errorf("invalid severity: %s", input.Severity)
+	}
+	a.Substance = substance
+	a.ATCCode = strings.ToUpper(strings.TrimSpace(input.ATCCode))
+	a.Reaction = strings.TrimSpace(input.Reaction)
+	a.Severity = input.Severity
+	a.Notes = strings.TrimSpace(input.Notes)
+	return nil
+}
+
+func (s *AllergyService) ListConditions(ctx context.Context, patientID uint) ([]allergy.Condition, error) {
+	return s.repo.ListConditions(ctx, patientID)
+}
+
+func (s *AllergyService) GetCondition(ctx context.Context, id uint) (*allergy.Condition, error) {
+	return s.repo.GetCondition(ctx, id)
+}
+
+// AddCondition records a chronic condition of the patient, or of the
+// patient they were merged into
+func (s *AllergyService) AddCondition(ctx context.Context, actorID, patientID uint, input allergy.ConditionInput) (*allergy.Condition, error) {
+	p, err := s.patients.Resolve(ctx, patientID)
+	if err != nil {
+		return nil, err
+	}
+	c := &allergy.Condition{PatientID: p.ID, RecordedByID: actorID}
+	if err := s.applyCondition(ctx, c, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateCondition(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *AllergyService) UpdateCondition(ctx context.Context, id uint, input allergy.ConditionInput) (*allergy.Condition, error) {
+	c, err := s.repo.GetCondition(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyCondition(ctx, c, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveCondition(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *AllergyService) RemoveCondition(ctx context.Context, id uint) error {
+	if _, err := s.repo.GetCondition(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteCondition(ctx, id)
+}
+
+// applyCondition validates the input against the ICD-10 catalogue and
+// copies it onto c
+func (s *AllergyService) applyCondition(ctx context.Context, c *allergy.Condition, input allergy.ConditionInput) error {
+	name := strings.TrimSpace(input.Name)
+	code := ""
+	if strings.TrimSpace(input.Code) != "" {
+		entry, err := s.codes.GetCodeByCode(ctx, diagnosis.NormalizeCode(input.Code))
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			return fmt.Errorf("unknown ICD-10 code: %s", input.Code)
+		}
+		code = entry.Code
+		if name == "" {
+			name = entry.TitleRU
+		}
+		if name == "" {
+			name = entry.TitleEN
+		}
+	}
+	if name == "" {
+		return errors.New("name or code is required")
+	}
+	now := time.Now()
+	if input.Since != nil && input.Since.After(now) {
+		return errors.New("since cannot be in the future")
+	}
+	if input.ResolvedAt != nil {
+		if input.ResolvedAt.After(now) {
+			return errors.New("resolved_at cannot be in the future")
+		}
+		if input.Since != nil && input.ResolvedAt.Before(*input.Since) {
+			return errors.New("resolved_at cannot be before since")
+		}
+	}
+
+	c.Name = name
+	c.Code = code
+	c.Since = input.Since
+	c.ResolvedAt = input.ResolvedAt
+	c.Notes = strings.TrimSpace(input.Notes)
+	return nil
+}
+
+func (s *AllergyService) ListAcknowledgements(ctx context.Context, patientID uint) ([]allergy.Acknowledgement, error) {
+	return s.repo.ListAcknowledgements(ctx, patientID)
+}
+
+func (s *AllergyService) ListProcedures(ctx context.Context, includeInactive bool) ([]allergy.Procedure, error) {
+	return s.procedures.ListProcedures(ctx, includeInactive)
+}
+
+func (s *AllergyService) GetProcedure(ctx context.Context, id uint) (*allergy.Procedure, error) {
+	return s.procedures.GetProcedure(ctx, id)
+}
+
+func (s *AllergyService) CreateProcedure(ctx context.Context, input allergy.ProcedureInput) (*allergy.Procedure, error) {
+	p := &allergy.Procedure{Active: true}
+	if err := s.applyProcedure(ctx, p, input); err != nil {
+		return nil, err
+	}
+	if err := s.procedures.CreateProcedure(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *AllergyService) UpdateProcedure(ctx context.Context, id uint, input allergy.ProcedureInput) (*allergy.Procedure, error) {
+	p, err := s.procedures.GetProcedure(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyProcedure(ctx, p, input); err != nil {
+		return nil, err
+	}
+	if err := s.procedures.SaveProcedure(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *AllergyService) applyProcedure(ctx context.Context, p *allergy.Procedure, input allergy.ProcedureInput) error {
+	code := strings.TrimSpace(input.Code)
+	name := strings.TrimSpace(input.Name)
+	if code == "" || name == "" {
+		return errors.New("code and name are required")
+	}
+	existing, err := s.procedures.GetProcedureByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != p.ID {
+		return fmt.Errorf("procedure code %s is already in use", code)
+	}
+	agent := strings.TrimSpace(input.Agent)
+	atcCode := strings.ToUpper(strings.TrimSpace(input.AgentATCCode))
+	// The agent is named in the warnings
+	if atcCode != "" && agent == "" {
+		return errors.New("agent is required with agent_atc_code")
+	}
+
+	p.Code, p.Name, p.Agent, p.AgentATCCode = code, name, agent, atcCode
+	if input.Active != nil {
+		p.Active = *input.Active
+	}
+	return nil
+}
+
+// AppointmentDoctor returns the doctor of the appointment, who may set its
+// procedure with the ".own" permission
+func (s *AllergyService) AppointmentDoctor(ctx context.Context, appointmentID uint) (uint, error) {
+	appt, err := s.appRepo.GetByID(ctx, appointmentID)
+	if err != nil {
+		return 0, err
+	}
+	return appt.DoctorID, nil
+}
+
+// SetProcedure sets the procedure of the appointment, or clears it when
+// procedureID is nil. The agent of the procedure is checked against the
+// patient's allergies and every warning must be acknowledged in acks; the
+// acknowledgements by actorID are stored with the change.
+func (s *AllergyService) SetProcedure(ctx context.Context, actorID, appointmentID uint, procedureID *uint, acks []allergy.AckInput) (*allergy.ProcedureAssignment, error) {
+	appt, err := s.appRepo.GetByID(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	assignment := &allergy.ProcedureAssignment{AppointmentID: appt.ID}
+	if procedureID != nil {
+		p, err := s.procedures.GetProcedure(ctx, *procedureID)
+		if err != nil {
+			return nil, err
+		}
+		if !p.Active && (appt.ProcedureID == nil || *appt.ProcedureID != p.ID) {
+			return nil, fmt.Errorf("procedure %s is no longer in use", p.Name)
+		}
+		assignment.Procedure = p
+		if assignment.Acknowledgements, err = s.checkProcedure(ctx, appt.PatientID, actorID, p, acks); err != nil {
+			return nil, err
+		}
+		for i := range assignment.Acknowledgements {
+			assignment.Acknowledgements[i].AppointmentID = &appt.ID
+		}
+	}
+
+	if err := s.procedures.SetAppointmentProcedure(ctx, appt.ID, procedureID, assignment.Acknowledgements); err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+// checkProcedure checks the agent of the procedure against the allergies of
+// the patient
+func (s *AllergyService) checkProcedure(ctx context.Context, patientID *uint, actorID uint, p *allergy.Procedure, acks []allergy.AckInput) ([]allergy.Acknowledgement, error) {
+	if patientID == nil || p.Agent == "" {
+		return nil, nil
+	}
+	allergies, err := s.repo.ListAllergies(ctx, *patientID)
+	if err != nil || len(allergies) == 0 {
+		return nil, err
+	}
+	agents := []allergy.Agent{{Name: p.Agent, ATCCode: p.AgentATCCode}}
+	return allergy.Acknowledge(*patientID, actorID, allergy.Check(allergies, agents), acks)
+}
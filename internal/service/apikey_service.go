@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"medical-center/internal/models/apikey"
+	"medical-center/internal/models/consent"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/models/principal"
+	"medical-center/internal/repository"
+	"strings"
+	"time"
+)
+
+const apiKeyPrefix = "mck_"
+
+// nonDelegableScopes are never granted to API keys. A key acts without a
+// person behind it, so it cannot administer accounts, roles, service
+// accounts, data requests, retention, consents or break-glass access, merge
+// patients or manage the HL7 interface, and cannot write encounter notes,
+// prescriptions, lab orders or diagnoses, which are signed by a doctor.
+// Attachments cannot be read either: files are only downloaded through URLs
+// signed for a user's session, so they are never shared with integrations
+// or external partners.
+var nonDelegableScopes = map[string]bool{
+	permission.UsersManage:           true,
+	permission.RolesManage:           true,
+	permission.ServiceAccountsManage: true,
+	permission.DataRequestsManage:    true,
+	permission.RetentionManage:       true,
+	permission.ConsentsManage:        true,
+	permission.BreakGlassUse:         true,
+	permission.BreakGlassReview:      true,
+	permission.PatientsMerge:         true,
+	permission.EncountersWriteAll:    true,
+	permission.EncountersWriteOwn:    true,
+	permission.PrescriptionsWriteAll: true,
+	permission.PrescriptionsWriteOwn: true,
+	permission.LabsOrderAll:          true,
+	permission.LabsOrderOwn:          true,
+	permission.AttachmentsRead:       true,
+	permission.AttachmentsReadOwn:    true,
+	permission.HL7Manage:             true,
+	permission.DiagnosesWriteAll:     true,
+	permission.DiagnosesWriteOwn:     true,
+}
+
+// lastUsedResolution limits how often last_used_at is written for busy keys
+const lastUsedResolution = time.Minute
+
+type APIKeyService struct {
+	repo           repository.APIKeyRepository
+	permissionRepo repository.PermissionRepository
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository, permissionRepo repository.PermissionRepository) *APIKeyService {
+	return &APIKeyService{repo: repo, permissionRepo: permissionRepo}
+}
+
+// CreateServiceAccount creates an integration identity. A non-empty
+// consentPurpose makes it an external partner that only sees patients who
+// gave that consent.
+func (s *APIKeyService) CreateServiceAccount(ctx context.Context, name, description string, consentPurpose consent.Purpose, createdByID uint) (*apikey.ServiceAccount, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("service account name cannot be empty")
+	}
+	if consentPurpose != "" && !consentPurpose.IsValid() {
+		return nil, errors.New("unknown consent purpose: " + string(consentPurpose))
+	}
+
+	account := &apikey.ServiceAccount{
+		Name:           name,
+		Description:    description,
+		CreatedByID:    createdByID,
+		ConsentPurpose: string(consentPurpose),
+	}
+	if err := s.repo.CreateServiceAccount(ctx, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *APIKeyService) GetServiceAccounts(ctx context.Context) ([]apikey.ServiceAccount, error) {
+	return s.repo.GetServiceAccounts(ctx)
+}
+
+func (s *APIKeyService) GetKeys(ctx context.Context, accountID uint) ([]apikey.APIKey, error) {
+	if _, err := s.repo.GetServiceAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByServiceAccount(ctx, accountID)
+}
+
+// IssueKey creates a key for the service account. The plain key is only
+// returned here and cannot be recovered later.
+func (s *APIKeyService) IssueKey(ctx context.Context, accountID uint, name string, scopes []string, expiresAt *time.Time) (string, *apikey.APIKey, error) {
+	account, err := s.repo.GetServiceAccount(ctx, accountID)
+	if err != nil {
+		return "", nil, err
+	}
+	if account.Disabled {
+		return "", nil, errors.New("service account is disabled")
+	}
+	if name == "" {
+		return "", nil, errors.New("key name cannot be empty")
+	}
+	if len(scopes) == 0 {
+		return "", nil, errors.New("at least one scope is required")
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return "", nil, errors.New("expiry cannot be in the past")
+	}
+	if err := s.validateScopes(ctx, scopes); err != nil {
+		return "", nil, err
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	prefix := hex.EncodeToString(secret[:4])
+	rawKey := apiKeyPrefix + prefix + "_" + hex.EncodeToString(secret[4:])
+
+	key := &apikey.APIKey{
+		ServiceAccountID: accountID,
+		Name:             name,
+		Prefix:           apiKeyPrefix + prefix,
+		KeyHash:          hashToken(rawKey),
+		Scopes:           scopes,
+		ExpiresAt:        expiresAt,
+	}
+	if err := s.repo.Create(ctx, key); err != nil {
+		return "", nil, err
+	}
+	return rawKey, key, nil
+}
+
+func (s *APIKeyService) RevokeKey(ctx context.Context, accountID, keyID uint) error {
+	key, err := s.repo.GetByID(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	if key.ServiceAccountID != accountID {
+		return errors.New("api key not found")
+	}
+	return s.repo.Revoke(ctx, keyID, time.Now())
+}
+
+// Authenticate resolves the principal for a raw API key
+func (s *APIKeyService) Authenticate(ctx context.Context, rawKey string) (*principal.Principal, error) {
+	invalid := errors.New("invalid api key")
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return nil, invalid
+	}
+
+	key, err := s.repo.GetByHash(ctx, hashToken(rawKey))
+	if err != nil {
+		return nil, invalid
+	}
+
+	now := time.Now()
+	if !key.IsActive(now) {
+		return nil, invalid
+	}
+
+	account, err := s.repo.GetServiceAccount(ctx, key.ServiceAccountID)
+	if err != nil || account.Disabled {
+		return nil, invalid
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedResolution {
+		if err := s.repo.TouchLastUsed(ctx, key.ID, now); err != nil {
+			log.Printf("failed to update last use of api key %d: %v", key.ID, err)
+		}
+	}
+
+	return &principal.Principal{
+		Kind:           principal.KindServiceAccount,
+		ID:             account.ID,
+		Name:           account.Name,
+		APIKeyID:       key.ID,
+		Scopes:         key.Scopes,
+		ConsentPurpose: account.ConsentPurpose,
+	}, nil
+}
+
+func (s *APIKeyService) validateScopes(ctx context.Context, scopes []string) error {
+	known, err := s.permissionRepo.GetByNames(ctx, scopes)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(known))
+	for _, p := range known {
+		names[p.Name] = true
+	}
+	for _, scope := range scopes {
+		if !names[scope] {
+			return fmt.Errorf("unknown scope: %s", scope)
+		}
+		if nonDelegableScopes[scope] {
+			return fmt.Errorf("scope cannot be granted to an api key: %s", scope)
+		}
+	}
+	return nil
+}
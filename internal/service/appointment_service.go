@@ -1,26 +1,64 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"log"
 	"medical-center/internal/models/appointment"
+	"medical-center/internal/models/patient"
+	"medical-center/internal/models/user"
 	"medical-center/internal/repository"
+	"strings"
 	"time"
 )
 
+// AppointmentListener is told about appointments booked, modified and
+// cancelled, after the change is saved
+type AppointmentListener interface {
+	AppointmentBooked(ctx context.Context, a *appointment.Appointment) error
+	AppointmentModified(ctx context.Context, a *appointment.Appointment) error
+	AppointmentCancelled(ctx context.Context, a *appointment.Appointment) error
+}
+
 type AppointmentService struct {
-	repo repository.AppRepository
+	repo     repository.AppRepository
+	patients *PatientService
+	// listener may be nil; its errors are logged and do not undo the change
+	listener AppointmentListener
 }
 
-func NewAppointmentService(repo repository.AppRepository) *AppointmentService {
-	return &AppointmentService{repo: repo}
+func NewAppointmentService(repo repository.AppRepository, patients *PatientService, listener AppointmentListener) *AppointmentService {
+	return &AppointmentService{repo: repo, patients: patients, listener: listener}
 }
 
+// CreateAppointment links the appointment to the patient patientID when
+// given, filling in the details left empty from it. Otherwise the patient
+// is looked up by the details and created when there is no exact match.
 func (s *AppointmentService) CreateAppointment(
+	ctx context.Context,
+	patientID *uint,
 	patientName, email, phone string,
 	departmentID, doctorID uint,
 	appointmentTime time.Time,
 ) (*appointment.Appointment, error) {
 
+	var p *patient.Patient
+	if patientID != nil {
+		var err error
+		if p, err = s.patients.Resolve(ctx, *patientID); err != nil {
+			return nil, err
+		}
+		if patientName == "" {
+			patientName = p.FullName
+		}
+		if email == "" {
+			email = p.Email
+		}
+		if phone == "" {
+			phone = p.Phone
+		}
+	}
+
 	// Валидация данных
 	if patientName == "" {
 		return nil, errors.New("patient name is required")
@@ -29,7 +67,15 @@ func (s *AppointmentService) CreateAppointment(
 		return nil, errors.New("appointment time cannot be in the past")
 	}
 
+	if p == nil {
+		var err error
+		if p, err = s.patients.FindOrCreate(ctx, patientName, email, phone); err != nil {
+			return nil, err
+		}
+	}
+
 	newAppointment := &appointment.Appointment{
+		PatientID:       &p.ID,
 		PatientName:     patientName,
 		Email:           email,
 		Phone:           phone,
@@ -38,32 +84,45 @@ func (s *AppointmentService) CreateAppointment(
 		AppointmentTime: appointmentTime,
 	}
 
-	if err := s.repo.Create(newAppointment); err != nil {
+	if err := s.repo.Create(ctx, newAppointment); err != nil {
 		return nil, err
 	}
+	s.notify(ctx, newAppointment, AppointmentListener.AppointmentBooked)
 	return newAppointment, nil
 }
 
-func (s *AppointmentService) GetAppointmentByID(id uint) (*appointment.Appointment, error) {
-	return s.repo.GetByID(id)
+func (s *AppointmentService) GetAppointmentByID(ctx context.Context, id uint) (*appointment.Appointment, error) {
+	return s.repo.GetByID(ctx, id)
 }
 
-func (s *AppointmentService) GetAllAppointments() ([]appointment.Appointment, error) {
-	return s.repo.GetAll()
+func (s *AppointmentService) GetAllAppointments(ctx context.Context) ([]appointment.Appointment, error) {
+	return s.repo.GetAll(ctx)
 }
 
+// UpdateAppointment moves the appointment to the patient patientID when
+// given and keeps its patient otherwise
 func (s *AppointmentService) UpdateAppointment(
+	ctx context.Context,
 	id uint,
+	patientID *uint,
 	patientName, email, phone string,
 	departmentID, doctorID uint,
 	appointmentTime time.Time,
 ) (*appointment.Appointment, error) {
 
-	appt, err := s.repo.GetByID(id)
+	appt, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
+	if patientID != nil {
+		p, err := s.patients.Resolve(ctx, *patientID)
+		if err != nil {
+			return nil, err
+		}
+		appt.PatientID = &p.ID
+	}
+
 	// Обновление полей
 	appt.PatientName = patientName
 	appt.Email = email
@@ -72,20 +131,83 @@ func (s *AppointmentService) UpdateAppointment(
 	appt.DoctorID = doctorID
 	appt.AppointmentTime = appointmentTime
 
-	if err := s.repo.Update(appt); err != nil {
+	if err := s.repo.Update(ctx, appt); err != nil {
 		return nil, err
 	}
+	s.notify(ctx, appt, AppointmentListener.AppointmentModified)
 	return appt, nil
 }
 
-func (s *AppointmentService) DeleteAppointment(id uint) error {
-	return s.repo.Delete(id)
+func (s *AppointmentService) DeleteAppointment(ctx context.Context, id uint) error {
+	appt, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.notify(ctx, appt, AppointmentListener.AppointmentCancelled)
+	return nil
+}
+
+func (s *AppointmentService) notify(
+	ctx context.Context,
+	appt *appointment.Appointment,
+	event func(AppointmentListener, context.Context, *appointment.Appointment) error,
+) {
+	if s.listener == nil {
+		return
+	}
+	if err := event(s.listener, ctx, appt); err != nil {
+		log.Printf("appointment %d listener failed: %v", appt.ID, err)
+	}
+}
+
+func (s *AppointmentService) GetByDepartment(ctx context.Context, departmentID uint) ([]appointment.Appointment, error) {
+	return s.repo.GetByDepartment(ctx, departmentID)
 }
 
-func (s *AppointmentService) GetByDepartment(departmentID uint) ([]appointment.Appointment, error) {
-	return s.repo.GetByDepartment(departmentID)
+func (s *AppointmentService) GetByPatient(ctx context.Context, patientName string) ([]appointment.Appointment, error) {
+	return s.repo.GetByPatient(ctx, patientName)
 }
 
-func (s *AppointmentService) GetByPatient(patientName string) ([]appointment.Appointment, error) {
-	return s.repo.GetByPatient(patientName)
+func (s *AppointmentService) GetByDoctor(ctx context.Context, doctorID uint) ([]appointment.Appointment, error) {
+	return s.repo.GetByDoctor(ctx, doctorID)
+}
+
+// GetOwnedBy returns the appointments of the user's linked doctor profile
+// together with the ones booked under the user's email
+func (s *AppointmentService) GetOwnedBy(ctx context.Context, u *user.User) ([]appointment.Appointment, error) {
+	result, err := s.repo.GetByEmail(ctx, u.Email)
+	if err != nil {
+		return nil, err
+	}
+	if u.DoctorID == nil {
+		return result, nil
+	}
+
+	byDoctor, err := s.repo.GetByDoctor(ctx, *u.DoctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool, len(result))
+	for _, appt := range result {
+		seen[appt.ID] = true
+	}
+	for _, appt := range byDoctor {
+		if !seen[appt.ID] {
+			result = append(result, appt)
+		}
+	}
+	return result, nil
+}
+
+// IsOwnedBy reports whether the appointment belongs to the user either as
+// the treating doctor or as the patient
+func (s *AppointmentService) IsOwnedBy(appt *appointment.Appointment, u *user.User) bool {
+	if u.DoctorID != nil && *u.DoctorID == appt.DoctorID {
+		return true
+	}
+	return appt.Email != "" && strings.EqualFold(appt.Email, u.Email)
 }
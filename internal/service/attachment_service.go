@@ -0,0 +1,394 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"medical-center/internal/models/attachment"
+	"medical-center/internal/models/breakglass"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/models/user"
+	"medical-center/internal/repository"
+	"medical-center/pkg/blobstore"
+	"medical-center/pkg/malware"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AttachmentConfig struct {
+	// MaxSize is the largest accepted file in bytes
+	MaxSize int64
+	// ContentTypes lists the accepted types, as sniffed from the contents
+	ContentTypes []string
+	// URLTTL is how long a signed download URL stays valid
+	URLTTL     time.Duration
+	SigningKey []byte
+	// BaseURL is the public URL of the application, download URLs start
+	// with it
+	BaseURL string
+	// RequireScan refuses to serve files that were stored while no
+	// scanner was configured
+	RequireScan bool
+}
+
+// AttachmentService stores documents and images of patients and
+// appointments in a blob store
+type AttachmentService struct {
+	repo           repository.AttachmentRepository
+	store          blobstore.BlobStore
+	scanner        malware.Scanner
+	appRepo        repository.AppRepository
+	patientRepo    repository.PatientRepository
+	userRepo       repository.UserRepository
+	permissionRepo repository.PermissionRepository
+	access         *RecordAccessService
+	breakGlass     *BreakGlassService
+	cfg            AttachmentConfig
+}
+
+// NewAttachmentService creates the service. scanner may be nil, files are
+// then stored unscanned and marked as such.
+func NewAttachmentService(
+	repo repository.AttachmentRepository,
+	store blobstore.BlobStore,
+	scanner malware.Scanner,
+	appRepo repository.AppRepository,
+	patientRepo repository.PatientRepository,
+	userRepo repository.UserRepository,
+	permissionRepo repository.PermissionRepository,
+	access *RecordAccessService,
+	breakGlass *BreakGlassService,
+	cfg AttachmentConfig,
+) *AttachmentService {
+	return &AttachmentService{
+		repo:           repo,
+		store:          store,
+		scanner:        scanner,
+		appRepo:        appRepo,
+		patientRepo:    patientRepo,
+		userRepo:       userRepo,
+		permissionRepo: permissionRepo,
+		access:         access,
+		breakGlass:     breakGlass,
+		cfg:            cfg,
+	}
+}
+
+// MaxSize is the largest accepted file in bytes
+func (s *AttachmentService) MaxSize() int64 {
+	return s.cfg.MaxSize
+}
+
+// Upload stores the file for the patient or the appointment, whichever ID
+// is set. The file is checked against the size limit and the accepted
+// content types, and scanned, before anything is stored.
+func (s *AttachmentService) Upload(ctx context.Context, actorID, patientID, appointmentID *uint, fileName, description string, r io.Reader) (*attachment.Attachment, error) {
+	switch {
+	case patientID != nil && appointmentID == nil:
+		p, err := s.patientRepo.GetByID(ctx, *patientID)
+		if err != nil {
+			return nil, err
+		}
+		if p.IsMerged() {
+			return nil, fmt.Errorf("patient was merged into patient %d", *p.MergedIntoID)
+		}
+	case appointmentID != nil && patientID == nil:
+		if _, err := s.appRepo.GetByID(ctx, *appointmentID); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("an attachment belongs to either a patient or an appointment")
+	}
+
+	// Spool to a temporary file, the contents are read three times
+	tmp, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, s.cfg.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if size > s.cfg.MaxSize {
+		return nil, fmt.Errorf("%w: the limit is %d bytes", attachment.ErrTooLarge, s.cfg.MaxSize)
+	}
+	if size == 0 {
+		return nil, errors.New("file is empty")
+	}
+
+	contentType, err := s.sniff(tmp)
+	if err != nil {
+		return nil, err
+	}
+	status, err := s.scan(ctx, tmp, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := newStorageKey()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := s.store.Put(ctx, key, tmp, size, contentType); err != nil {
+		return nil, err
+	}
+
+	a := &attachment.Attachment{
+		PatientID:     patientID,
+		AppointmentID: appointmentID,
+		FileName:      cleanFileName(fileName),
+		ContentType:   contentType,
+		Size:          size,
+		SHA256:        hex.EncodeToString(hash.Sum(nil)),
+		StorageKey:    key,
+		Description:   strings.TrimSpace(description),
+		ScanStatus:    status,
+		UploadedByID:  actorID,
+	}
+	if err := s.repo.Create(ctx, a); err != nil {
+		if deleteErr := s.store.Delete(ctx, key); deleteErr != nil {
+			log.Printf("failed to delete orphaned blob %s: %v", key, deleteErr)
+		}
+		return nil, err
+	}
+	return a, nil
+}
+
+// sniff detects the content type from the first bytes of the file and
+// checks that it is accepted
+func (s *AttachmentService) sniff(f *os.File) (string, error) {
+	head := make([]byte, 512)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	for _, accepted := range s.cfg.ContentTypes {
+		if contentType == accepted {
+			return contentType, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", attachment.ErrContentTypeRefused, contentType)
+}
+
+// scan runs the malware scanner, if any. A file that cannot be scanned is
+// refused rather than stored unchecked.
+func (s *AttachmentService) scan(ctx context.Context, f *os.File, fileName string) (attachment.ScanStatus, error) {
+	if s.scanner == nil {
+		return attachment.ScanSkipped, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	threat, err := s.scanner.Scan(ctx, f)
+	if err != nil {
+		return "", fmt.Errorf("malware scan failed: %w", err)
+	}
+	if threat != "" {
+		log.Printf("refused upload %q: %s detected", fileName, threat)
+		return "", fmt.Errorf("%w: %s detected", attachment.ErrInfected, threat)
+	}
+	return attachment.ScanClean, nil
+}
+
+func (s *AttachmentService) Get(ctx context.Context, id uint) (*attachment.Attachment, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *AttachmentService) GetByPatient(ctx context.Context, patientID uint) ([]attachment.Attachment, error) {
+	return s.repo.GetByPatient(ctx, patientID)
+}
+
+func (s *AttachmentService) GetByAppointment(ctx context.Context, appointmentID uint) ([]attachment.Attachment, error) {
+	return s.repo.GetByAppointment(ctx, appointmentID)
+}
+
+// Delete hides the attachment and removes its contents from the blob store
+func (s *AttachmentService) Delete(ctx context.Context, id uint) error {
+	a, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, a.ID); err != nil {
+		return err
+	}
+	if err := s.store.Delete(ctx, a.StorageKey); err != nil {
+		log.Printf("failed to delete blob %s of attachment %d: %v", a.StorageKey, a.ID, err)
+	}
+	return nil
+}
+
+// SignURL issues a download URL of the attachment for the user, valid for
+// URLTTL. The caller has checked that the user may see the attachment.
+func (s *AttachmentService) SignURL(ctx context.Context, a *attachment.Attachment, userID uint) (*attachment.SignedURL, error) {
+	if err := s.servable(a); err != nil {
+		return nil, err
+	}
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(s.cfg.URLTTL).Truncate(time.Second)
+	token := s.signDownload(a.ID, u.ID, u.TokenVersion, expiresAt)
+	return &attachment.SignedURL{
+		URL:       fmt.Sprintf("%s/api/v1/attachments/%d/download?token=%s", strings.TrimSuffix(s.cfg.BaseURL, "/"), a.ID, token),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Open checks a signed download URL and returns the attachment with its
+// contents, which the caller closes. The URL dies when it expires, when the
+// user is disabled or signed out everywhere, and when they may no longer
+// see the attachment's patient or appointment. Downloads under break-glass
+// access are recorded for review like the other requests made under it.
+func (s *AttachmentService) Open(ctx context.Context, id uint, token string) (*attachment.Attachment, io.ReadCloser, error) {
+	invalid := attachment.ErrLinkInvalid
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, invalid
+	}
+	userID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, nil, invalid
+	}
+	expiresUnix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().After(time.Unix(expiresUnix, 0)) {
+		return nil, nil, invalid
+	}
+	u, err := s.userRepo.GetByID(ctx, uint(userID))
+	if err != nil || u.IsDisabled() {
+		return nil, nil, invalid
+	}
+	expected := s.signDownload(id, u.ID, u.TokenVersion, time.Unix(expiresUnix, 0))
+	if !hmac.Equal([]byte(expected), []byte(token)) {
+		return nil, nil, invalid
+	}
+	granted, err := s.permissionRepo.GetRolePermissions(ctx, u.Role)
+	if err != nil {
+		return nil, nil, err
+	}
+	perms := permission.NewSet(granted)
+	if !perms.HasAny(permission.AttachmentsRead, permission.AttachmentsReadOwn) {
+		return nil, nil, invalid
+	}
+	var grant *breakglass.Grant
+	if perms.Has(permission.BreakGlassUse) {
+		if grant, err = s.breakGlass.ActiveGrant(ctx, u.ID); err != nil {
+			return nil, nil, err
+		}
+		if grant != nil {
+			for _, name := range breakglass.ElevatedPermissions {
+				perms[name] = true
+			}
+		}
+	}
+
+	a, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.servable(a); err != nil {
+		return nil, nil, err
+	}
+	allowed, err := s.canRead(ctx, u, perms, a)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allowed {
+		return nil, nil, invalid
+	}
+	body, err := s.store.Get(ctx, a.StorageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if grant != nil {
+		path := fmt.Sprintf("/api/v1/attachments/%d/download", a.ID)
+		if err := s.breakGlass.RecordAccess(ctx, grant, http.MethodGet, path, "attachments", strconv.FormatUint(uint64(a.ID), 10), http.StatusOK); err != nil {
+			log.Printf("failed to record break-glass access of grant %d: %v", grant.ID, err)
+		}
+	}
+	return a, body, nil
+}
+
+// canRead applies the checks of the API to the user of a download URL:
+// patient attachments take patients.read and appointment attachments
+// appointments.read.all, narrowed to the user's patients by the ".own"
+// variants
+func (s *AttachmentService) canRead(ctx context.Context, u *user.User, perms permission.Set, a *attachment.Attachment) (bool, error) {
+	r := Reader{DoctorID: u.DoctorID}
+	switch {
+	case a.PatientID != nil:
+		r.All = perms.Has(permission.PatientsRead) && perms.Has(permission.AttachmentsRead)
+		return s.access.CanReadPatient(ctx, r, *a.PatientID)
+	case a.AppointmentID != nil:
+		r.All = perms.Has(permission.AppointmentsReadAll) && perms.Has(permission.AttachmentsRead)
+		return s.access.CanReadAppointment(ctx, r, *a.AppointmentID)
+	}
+	return false, nil
+}
+
+// servable refuses files stored without a scan when scans are required
+func (s *AttachmentService) servable(a *attachment.Attachment) error {
+	if s.cfg.RequireScan && a.ScanStatus != attachment.ScanClean {
+		return attachment.ErrNotScanned
+	}
+	return nil
+}
+
+// signDownload builds a "<user id>.<expiry>.<signature>" token. The
+// signature covers the token version so that revoking the user's sessions
+// also revokes their links.
+func (s *AttachmentService) signDownload(attachmentID, userID uint, tokenVersion int, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%d.%d", userID, expiresAt.Unix())
+	mac := hmac.New(sha256.New, s.cfg.SigningKey)
+	mac.Write([]byte(fmt.Sprintf("attachment:%d:%s:%d", attachmentID, payload, tokenVersion)))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newStorageKey returns a random key grouped by month. Keys never contain
+// the file name, which may hold patient details.
+func newStorageKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "attachments/" + time.Now().UTC().Format("2006/01") + "/" + hex.EncodeToString(b), nil
+}
+
+// cleanFileName keeps the base name of an uploaded file without control
+// characters
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		name = "attachment"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	return name
+}
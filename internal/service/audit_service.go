@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"medical-center/internal/models/audit"
+	"medical-center/internal/repository"
+	"sort"
+	"time"
+)
+
+// auditVerifyBatch is how many entries are loaded at a time when verifying
+// the hash chain
+const auditVerifyBatch = 1000
+
+type AuditService struct {
+	repo repository.AuditRepository
+}
+
+func NewAuditService(repo repository.AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+func (s *AuditService) ListEntries(ctx context.Context, filter audit.Filter) ([]audit.Entry, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 100 {
+		filter.PageSize = 50
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, 0, errors.New("from must be before to")
+	}
+	return s.repo.List(ctx, filter)
+}
+
+// Verify walks the whole log and checks that every entry links to the one
+// before it and that its hash matches its contents. The entries recorded by
+// the stored checkpoints and by anchors, checkpoints kept outside the
+// database, must still be in the chain with the same hash, which detects
+// entries removed from its end.
+func (s *AuditService) Verify(ctx context.Context, anchors ...audit.Checkpoint) (*audit.VerifyResult, error) {
+	checkpoints, err := s.repo.ListCheckpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	checkpoints = append(checkpoints, anchors...)
+	sort.SliceStable(checkpoints, func(i, j int) bool { return checkpoints[i].EntryID < checkpoints[j].EntryID })
+
+	result := &audit.VerifyResult{Valid: true}
+	var lastID uint
+	prevHash := ""
+	for {
+		entries, err := s.repo.GetAfter(ctx, lastID, auditVerifyBatch)
+		if err != nil {
+			return nil, err
+		}
+		for i := range entries {
+			e := &entries[i]
+			switch {
+			case e.PrevHash != prevHash:
+				result.Valid, result.BrokenAt, result.Reason = false, e.ID, "previous hash does not match, entries were removed or reordered"
+			case e.Hash != e.ComputeHash(prevHash):
+				result.Valid, result.BrokenAt, result.Reason = false, e.ID, "hash does not match the entry, it was modified"
+			}
+			for result.Valid && len(checkpoints) > 0 && checkpoints[0].EntryID <= e.ID {
+				if checkpoints[0].EntryID < e.ID || checkpoints[0].Hash != e.Hash {
+					result.Valid, result.BrokenAt, result.Reason = false, checkpoints[0].EntryID, "entry of a checkpoint is missing or changed, entries were removed or rewritten"
+					break
+				}
+				result.Checkpoints++
+				checkpoints = checkpoints[1:]
+			}
+			if !result.Valid {
+				return result, nil
+			}
+			result.Checked++
+			prevHash = e.Hash
+			lastID = e.ID
+		}
+		if len(entries) < auditVerifyBatch {
+			break
+		}
+	}
+
+	if len(checkpoints) > 0 {
+		result.Valid, result.BrokenAt, result.Reason = false, checkpoints[0].EntryID, "the log ends before a checkpoint, entries were removed from its end"
+	}
+	return result, nil
+}
+
+func (s *AuditService) ListCheckpoints(ctx context.Context) ([]audit.Checkpoint, error) {
+	return s.repo.ListCheckpoints(ctx)
+}
+
+// Checkpoint records the last entry of the log. The checkpoint is written
+// to the application log as well, so that a copy survives outside the
+// database.
+func (s *AuditService) Checkpoint(ctx context.Context) (*audit.Checkpoint, error) {
+	checkpoint, err := s.repo.CreateCheckpoint(ctx)
+	if err != nil || checkpoint == nil {
+		return checkpoint, err
+	}
+	log.Printf("audit checkpoint %d: entry %d hash %s", checkpoint.ID, checkpoint.EntryID, checkpoint.Hash)
+	return checkpoint, nil
+}
+
+// ScheduleCheckpoints takes a checkpoint every interval until ctx is done
+func (s *AuditService) ScheduleCheckpoints(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Checkpoint(ctx); err != nil {
+				log.Printf("audit checkpoint failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"medical-center/internal/models/audit"
+	"medical-center/internal/repository"
+	"testing"
+	"time"
+)
+
+// fakeAuditRepo serves a fixed log and its checkpoints
+type fakeAuditRepo struct {
+	repository.AuditRepository
+	entries     []audit.Entry
+	checkpoints []audit.Checkpoint
+}
+
+func (r *fakeAuditRepo) GetAfter(ctx context.Context, afterID uint, limit int) ([]audit.Entry, error) {
+	var entries []audit.Entry
+	for _, e := range r.entries {
+		if e.ID > afterID && len(entries) < limit {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (r *fakeAuditRepo) ListCheckpoints(ctx context.Context) ([]audit.Checkpoint, error) {
+	return r.checkpoints, nil
+}
+
+// auditChain returns n correctly chained entries with IDs 1 to n
+func auditChain(n int) []audit.Entry {
+	entries := make([]audit.Entry, n)
+	prevHash := ""
+	start := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	for i := range entries {
+		e := &entries[i]
+		e.ID = uint(i + 1)
+		e.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		e.ActorType, e.ActorID = "user", 3
+		e.Action, e.Entity, e.EntityID = audit.ActionUpdate, "patients", fmt.Sprint(i%7+1)
+		e.Changes = fmt.Sprintf(`{"before":{"phone":"%d"},"after":{"phone":"%d"}}`, i, i+1)
+		e.PrevHash = prevHash
+		e.Hash = e.ComputeHash(prevHash)
+		prevHash = e.Hash
+	}
+	return entries
+}
+
+func checkpointAt(entries []audit.Entry, id uint) audit.Checkpoint {
+	return audit.Checkpoint{EntryID: id, Hash: entries[id-1].Hash}
+}
+
+func TestEntryComputeHash(t *testing.T) {
+	e := auditChain(1)[0]
+	base := e.ComputeHash("")
+
+	tests := []struct {
+		name   string
+		change func(e *audit.Entry)
+		prev   string
+	}{
+		{"previous hash", func(e *audit.Entry) {}, "abc"},
+		{"time", func(e *audit.Entry) { e.CreatedAt = e.CreatedAt.Add(time.Nanosecond) }, ""},
+		{"actor", func(e *audit.Entry) { e.ActorID++ }, ""},
+		{"action", func(e *audit.Entry) { e.Action = audit.ActionDelete }, ""},
+		{"entity ID", func(e *audit.Entry) { e.EntityID = "99" }, ""},
+		{"changes", func(e *audit.Entry) { e.Changes = "{}" }, ""},
+		{"IP", func(e *audit.Entry) { e.IP = "10.0.0.1" }, ""},
+		{"request ID", func(e *audit.Entry) { e.RequestID = "req-1" }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := e
+			tt.change(&changed)
+			if changed.ComputeHash(tt.prev) == base {
+				t.Error("hash does not cover the change")
+			}
+		})
+	}
+
+	// The hash does not depend on the time zone the time was read in
+	local := e
+	local.CreatedAt = e.CreatedAt.In(time.FixedZone("", 5*3600))
+	if local.ComputeHash("") != base {
+		t.Error("hash depends on the time zone")
+	}
+}
+
+func TestAuditServiceVerify(t *testing.T) {
+	const n = auditVerifyBatch + 5 // spans two batches
+
+	tests := []struct {
+		name            string
+		tamper          func(entries []audit.Entry) []audit.Entry
+		checkpoints     func(entries []audit.Entry) []audit.Checkpoint
+		anchors         func(entries []audit.Entry) []audit.Checkpoint
+		wantValid       bool
+		wantBrokenAt    uint
+		wantChecked     int
+		wantCheckpoints int
+	}{
+		{
+			name:        "intact",
+			wantValid:   true,
+			wantChecked: n,
+		},
+		{
+			name: "intact with checkpoints and an anchor",
+			checkpoints: func(e []audit.Entry) []audit.Checkpoint {
+				return []audit.Checkpoint{checkpointAt(e, 10), checkpointAt(e, n)}
+			},
+			anchors: func(e []audit.Entry) []audit.Checkpoint {
+				return []audit.Checkpoint{checkpointAt(e, auditVerifyBatch+1)}
+			},
+			wantValid:       true,
+			wantChecked:     n,
+			wantCheckpoints: 3,
+		},
+		{
+			name: "modified entry",
+			tamper: func(e []audit.Entry) []audit.Entry {
+				e[41].Changes = `{"before":{"phone":"x"},"after":{"phone":"y"}}`
+				return e
+			},
+			wantBrokenAt: 42,
+			wantChecked:  41,
+		},
+		{
+			name: "modified entry with its hash recomputed",
+			tamper: func(e []audit.Entry) []audit.Entry {
+				e[41].EntityID = "99"
+				e[41].Hash = e[41].ComputeHash(e[41].PrevHash)
+				return e
+			},
+			wantBrokenAt: 43,
+			wantChecked:  42,
+		},
+		{
+			name: "removed entry",
+			tamper: func(e []audit.Entry) []audit.Entry {
+				return append(e[:99:99], e[100:]...)
+			},
+			wantBrokenAt: 101,
+			wantChecked:  99,
+		},
+		{
+			name: "rewritten tail",
+			tamper: func(e []audit.Entry) []audit.Entry {
+				e[n-2].IP = "10.0.0.1"
+				e[n-2].Hash = e[n-2].ComputeHash(e[n-2].PrevHash)
+				e[n-1].PrevHash = e[n-2].Hash
+				e[n-1].Hash = e[n-1].ComputeHash(e[n-1].PrevHash)
+				return e
+			},
+			checkpoints: func(e []audit.Entry) []audit.Checkpoint {
+				return []audit.Checkpoint{checkpointAt(e, n-1)}
+			},
+			wantBrokenAt: n - 1,
+			wantChecked:  n - 2,
+		},
+		{
+			name: "entries removed from the end, caught by a checkpoint",
+			tamper: func(e []audit.Entry) []audit.Entry {
+				return e[:n-3]
+			},
+			checkpoints: func(e []audit.Entry) []audit.Checkpoint {
+				return []audit.Checkpoint{checkpointAt(e, 5), checkpointAt(e, n-1)}
+			},
+			wantBrokenAt:    n - 1,
+			wantChecked:     n - 3,
+			wantCheckpoints: 1,
+		},
+		{
+			name: "entries and checkpoints removed from the end, caught by an anchor",
+			tamper: func(e []audit.Entry) []audit.Entry {
+				return e[:n-3]
+			},
+			anchors: func(e []audit.Entry) []audit.Checkpoint {
+				return []audit.Checkpoint{checkpointAt(e, n)}
+			},
+			wantBrokenAt: n,
+			wantChecked:  n - 3,
+		},
+		{
+			name: "anchor with another hash",
+			anchors: func(e []audit.Entry) []audit.Checkpoint {
+				return []audit.Checkpoint{{EntryID: 7, Hash: e[6].PrevHash}}
+			},
+			wantBrokenAt: 7,
+			wantChecked:  6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := auditChain(n)
+			entries := auditChain(n)
+			if tt.tamper != nil {
+				entries = tt.tamper(entries)
+			}
+			repo := &fakeAuditRepo{entries: entries}
+			if tt.checkpoints != nil {
+				repo.checkpoints = tt.checkpoints(original)
+			}
+			var anchors []audit.Checkpoint
+			if tt.anchors != nil {
+				anchors = tt.anchors(original)
+			}
+
+			result, err := NewAuditService(repo).Verify(context.Background(), anchors...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Valid != tt.wantValid || result.BrokenAt != tt.wantBrokenAt {
+				t.Errorf("Verify() = valid %v broken at %d (%s), want valid %v broken at %d",
+					result.Valid, result.BrokenAt, result.Reason, tt.wantValid, tt.wantBrokenAt)
+			}
+			if result.Checked != tt.wantChecked || result.Checkpoints != tt.wantCheckpoints {
+				t.Errorf("Verify() checked %d entries and %d checkpoints, want %d and %d",
+					result.Checked, result.Checkpoints, tt.wantChecked, tt.wantCheckpoints)
+			}
+		})
+	}
+}
+
+func TestAuditServiceVerifyEmptyLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		anchors   []audit.Checkpoint
+		wantValid bool
+	}{
+		{"no checkpoints", nil, true},
+		{"log emptied after a checkpoint", []audit.Checkpoint{{EntryID: 3, Hash: "abc"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewAuditService(&fakeAuditRepo{}).Verify(context.Background(), tt.anchors...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Valid != tt.wantValid {
+				t.Errorf("Verify() valid = %v (%s), want %v", result.Valid, result.Reason, tt.wantValid)
+			}
+		})
+	}
+}
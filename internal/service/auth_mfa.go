@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log"
+	"medical-center/internal/models/principal"
+	"medical-center/internal/models/user"
+	"medical-center/pkg/totp"
+	"strings"
+	"time"
+)
+
+const (
+	tokenPurposeMFAChallenge  = "mfa_challenge"
+	tokenPurposeMFAEnrollment = "mfa_enrollment"
+
+	mfaTokenTTL       = 5 * time.Minute
+	recoveryCodeCount = 10
+	// Wrong codes accepted per MFA challenge token before the user has to
+	// log in again
+	mfaChallengeMaxFailures = 3
+)
+
+// LoginResult carries either an access token or an MFA token that has to be
+// exchanged (challenge) or used to set up MFA (enrollment)
+type LoginResult struct {
+	Token                 string `json:"token,omitempty"`
+	MFARequired           bool   `json:"mfa_required,omitempty"`
+	MFAEnrollmentRequired bool   `json:"mfa_enrollment_required,omitempty"`
+	MFAToken              string `json:"mfa_token,omitempty"`
+}
+
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFAConfirmation struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	Token         string   `json:"token"`
+}
+
+func (s *authService) mfaRequired(u *user.User) bool {
+	for _, role := range s.cfg.MFARequiredRoles {
+		if u.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *authService) generateRestrictedToken(ctx context.Context, u *user.User, purpose string) (string, error) {
+	return s.signToken(u, purpose, "", mfaTokenTTL)
+}
+
+func (s *authService) VerifyMFA(ctx context.Context, mfaToken, code string, client ClientInfo) (string, error) {
+	claims, u, err := s.parseToken(ctx, mfaToken)
+	if err != nil || claims.Purpose != tokenPurposeMFAChallenge {
+		return "", errors.New("invalid or expired MFA token")
+	}
+
+	// Codes are short, so guesses count towards the same lockout as passwords
+	if err := s.throttle.check(ctx, throttleKeys(u.Email, client)...); err != nil {
+		return "", err
+	}
+
+	challengeKey := mfaChallengeKey(mfaToken)
+	exhausted, err := s.throttle.exhausted(ctx, challengeKey, mfaChallengeMaxFailures)
+	if err != nil {
+		return "", err
+	}
+	if exhausted {
+		return "", errors.New("too many invalid MFA codes, log in again")
+	}
+
+	if !s.verifyMFACode(ctx, u, code) {
+		s.loginFailed(ctx, u.Email, u, client)
+		if err := s.throttle.countFailure(ctx, challengeKey, mfaTokenTTL); err != nil {
+			log.Printf("failed to record MFA failure: %v", err)
+		}
+		return "", errors.New("invalid MFA code")
+	}
+
+	for _, key := range []string{accountThrottleKey(u.Email), challengeKey} {
+		if err := s.throttle.reset(ctx, key); err != nil {
+			log.Printf("failed to reset login attempts for user %d: %v", u.ID, err)
+		}
+	}
+
+	return s.generateToken(ctx, u, client)
+}
+
+// mfaChallengeKey is the throttling key counting wrong codes for one MFA
+// challenge token
+func mfaChallengeKey(mfaToken string) string {
+	return "mfa:" + hashToken(mfaToken)
+}
+
+func (s *authService) ValidateEnrollmentToken(ctx context.Context, tokenString string) (*principal.Principal, error) {
+	claims, u, err := s.parseToken(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	switch claims.Purpose {
+	case "":
+		return s.checkSession(ctx, claims, u)
+	case tokenPurposeMFAEnrollment:
+		// Enrollment tokens are issued before a session exists
+		return principal.ForUser(u), nil
+	default:
+		return nil, errors.New("invalid token")
+	}
+}
+
+func (s *authService) BeginMFAEnrollment(ctx context.Context, u *user.User) (*MFAEnrollment, error) {
+	if u.MFAEnabled {
+		return nil, errors.New("MFA is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	// The secret only becomes active once confirmed with a valid code
+	u.MFASecret = secret
+	u.MFALastStep = 0
+	if err := s.userRepo.Update(ctx, u); err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.cfg.MFAIssuer, u.Email, secret),
+	}, nil
+}
+
+func (s *authService) ConfirmMFAEnrollment(ctx context.Context, u *user.User, code string, client ClientInfo) (*MFAConfirmation, error) {
+	if u.MFAEnabled {
+		return nil, errors.New("MFA is already enabled")
+	}
+	if u.MFASecret == "" {
+		return nil, errors.New("MFA enrollment has not been started")
+	}
+
+	step, ok := totp.Validate(u.MFASecret, code, time.Now(), 1)
+	if !ok {
+		return nil, errors.New("invalid MFA code")
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.Replace(ctx, u.ID, hashes); err != nil {
+		return nil, err
+	}
+
+	u.MFAEnabled = true
+	u.MFALastStep = step
+	if err := s.userRepo.Update(ctx, u); err != nil {
+		return nil, err
+	}
+
+	token, err := s.generateToken(ctx, u, client)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAConfirmation{RecoveryCodes: codes, Token: token}, nil
+}
+
+func (s *authService) DisableMFA(ctx context.Context, u *user.User, code string) error {
+	if !u.MFAEnabled {
+		return errors.New("MFA is not enabled")
+	}
+	if s.mfaRequired(u) {
+		return errors.New("MFA is required for your role")
+	}
+	if !s.verifyMFACode(ctx, u, code) {
+		return errors.New("invalid MFA code")
+	}
+
+	if err := s.mfaRepo.DeleteForUser(ctx, u.ID); err != nil {
+		return err
+	}
+
+	u.MFAEnabled = false
+	u.MFASecret = ""
+	u.MFALastStep = 0
+	return s.userRepo.Update(ctx, u)
+}
+
+// verifyMFACode accepts a current TOTP code that has not been used yet or an
+// unused recovery code
+func (s *authService) verifyMFACode(ctx context.Context, u *user.User, code string) bool {
+	if step, ok := totp.Validate(u.MFASecret, code, time.Now(), 1); ok {
+		if step <= u.MFALastStep {
+			return false
+		}
+		u.MFALastStep = step
+		if err := s.userRepo.Update(ctx, u); err != nil {
+			log.Printf("failed to store MFA step for user %d: %v", u.ID, err)
+			return false
+		}
+		return true
+	}
+
+	return s.mfaRepo.Consume(ctx, u.ID, hashToken(normalizeRecoveryCode(code))) == nil
+}
+
+const recoveryCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// generateRecoveryCodes returns codes formatted as XXXXX-XXXXX with their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		for j := range b {
+			b[j] = recoveryCodeAlphabet[int(b[j])%len(recoveryCodeAlphabet)]
+		}
+
+		code := string(b[:5]) + "-" + string(b[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"medical-center/internal/models/user"
+	"medical-center/internal/repository"
+	"medical-center/pkg/mailer"
+	"medical-center/pkg/totp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeUserRepo serves users from memory; the methods the tests do not need
+// are left to the embedded nil interface
+type fakeUserRepo struct {
+	repository.UserRepository
+	users map[uint]*user.User
+}
+
+func (r *fakeUserRepo) GetByID(ctx context.Context, id uint) (*user.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	found := *u
+	return &found, nil
+}
+
+func (r *fakeUserRepo) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			found := *u
+			return &found, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *fakeUserRepo) GetByOIDCSubject(ctx context.Context, subject string) (*user.User, error) {
+	for _, u := range r.users {
+		if u.OIDCSubject != nil && *u.OIDCSubject == subject {
+			found := *u
+			return &found, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *fakeUserRepo) Create(ctx context.Context, u *user.User) error {
+	u.ID = uint(len(r.users) + 1)
+	for r.users[u.ID] != nil {
+		u.ID++
+	}
+	stored := *u
+	r.users[u.ID] = &stored
+	return nil
+}
+
+func (r *fakeUserRepo) Update(ctx context.Context, u *user.User) error {
+	stored := *u
+	r.users[u.ID] = &stored
+	return nil
+}
+
+func (r *fakeUserRepo) Delete(ctx context.Context, id uint) error {
+	if _, ok := r.users[id]; !ok {
+		return errors.New("user not found")
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// fakeRecoveryCodes keeps the unused recovery code hashes of each user
+type fakeRecoveryCodes struct {
+	repository.MFARecoveryCodeRepository
+	unused map[uint]map[string]bool
+}
+
+func (r *fakeRecoveryCodes) Consume(ctx context.Context, userID uint, codeHash string) error {
+	if !r.unused[userID][codeHash] {
+		return errors.New("recovery code not found")
+	}
+	delete(r.unused[userID], codeHash)
+	return nil
+}
+
+type fakeSessionRepo struct {
+	repository.SessionRepository
+	created      []*user.Session
+	revokedUsers []uint
+}
+
+func (r *fakeSessionRepo) Create(ctx context.Context, session *user.Session) error {
+	r.created = append(r.created, session)
+	return nil
+}
+
+func (r *fakeSessionRepo) RevokeAllForUser(ctx context.Context, userID uint, exceptID string, at time.Time) error {
+	r.revokedUsers = append(r.revokedUsers, userID)
+	return nil
+}
+
+type fakeMailer struct {
+	sent []mailer.Message
+}
+
+func (m *fakeMailer) Send(msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+const testMFASecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// newMFATestService returns an auth service with one doctor using MFA and
+// the recovery code "ABCDE-FGHJK"
+func newMFATestService(t *testing.T) (*authService, *fakeUserRepo, *fakeAttemptRepo) {
+	t.Helper()
+	users := &fakeUserRepo{users: map[uint]*user.User{
+		7: {ID: 7, Email: "doctor@example.com", Role: user.RoleDoctor, MFAEnabled: true, MFASecret: testMFASecret},
+	}}
+	codes := &fakeRecoveryCodes{unused: map[uint]map[string]bool{
+		7: {hashToken(normalizeRecoveryCode("ABCDE-FGHJK")): true},
+	}}
+	attempts := newFakeAttemptRepo()
+	s := NewAuthService(users, nil, attempts, codes, &fakeSessionRepo{}, &fakeMailer{}, AuthConfig{
+		JWTSecret: "test-secret",
+		// Keep password throttling out of the way of the challenge limit
+		Throttle: LoginThrottleConfig{FreeAttempts: 100, MaxAccountFailures: 100, MaxIPFailures: 100},
+	}).(*authService)
+	return s, users, attempts
+}
+
+func totpCode(t *testing.T, step int64) string {
+	t.Helper()
+	code, err := totp.CodeAt(testMFASecret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestVerifyMFACode(t *testing.T) {
+	current := totp.Step(time.Now())
+
+	tests := []struct {
+		name         string
+		lastStep     int64
+		code         func(t *testing.T) string
+		want         bool
+		wantLastStep int64
+	}{
+		{"current code", 0, func(t *testing.T) string { return totpCode(t, current) }, true, current},
+		{"previous step within skew", current - 2, func(t *testing.T) string { return totpCode(t, current-1) }, true, current - 1},
+		{"replayed code", current, func(t *testing.T) string { return totpCode(t, current) }, false, current},
+		{"code older than the last one used", current, func(t *testing.T) string { return totpCode(t, current-1) }, false, current},
+		{"code outside the skew", 0, func(t *testing.T) string { return totpCode(t, current-3) }, false, 0},
+		{"recovery code", current, func(t *testing.T) string { return "ABCDE-FGHJK" }, true, current},
+		{"recovery code without dash, lower case", current, func(t *testing.T) string { return "abcde fghjk" }, true, current},
+		{"unknown recovery code", current, func(t *testing.T) string { return "ZZZZZ-ZZZZZ" }, false, current},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, users, _ := newMFATestService(t)
+			users.users[7].MFALastStep = tt.lastStep
+			u, _ := users.GetByID(context.Background(), 7)
+
+			if got := s.verifyMFACode(context.Background(), u, tt.code(t)); got != tt.want {
+				t.Errorf("verifyMFACode() = %v, want %v", got, tt.want)
+			}
+			if stored := users.users[7].MFALastStep; stored != tt.wantLastStep {
+				t.Errorf("stored MFALastStep = %d, want %d", stored, tt.wantLastStep)
+			}
+		})
+	}
+}
+
+func TestVerifyMFARecoveryCodeSingleUse(t *testing.T) {
+	s, users, _ := newMFATestService(t)
+	u, _ := users.GetByID(context.Background(), 7)
+
+	if !s.verifyMFACode(context.Background(), u, "ABCDE-FGHJK") {
+		t.Fatal("recovery code rejected")
+	}
+	if s.verifyMFACode(context.Background(), u, "ABCDE-FGHJK") {
+		t.Error("recovery code accepted twice")
+	}
+}
+
+func TestVerifyMFAChallengeLimit(t *testing.T) {
+	ctx := context.Background()
+	s, users, attempts := newMFATestService(t)
+	client := ClientInfo{IP: "10.0.0.1"}
+	// Tokens signed within the same second are identical, so each challenge
+	// gets a different lifetime to be a challenge of its own
+	issued := 0
+	challenge := func() string {
+		issued++
+		token, err := s.signToken(users.users[7], tokenPurposeMFAChallenge, "", mfaTokenTTL-time.Duration(issued)*time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	code := totpCode(t, totp.Step(time.Now()))
+
+	token := challenge()
+	for i := 0; i < mfaChallengeMaxFailures; i++ {
+		if _, err := s.VerifyMFA(ctx, token, "000000", client); err == nil || err.Error() != "invalid MFA code" {
+			t.Fatalf("wrong code %d: VerifyMFA() = %v, want invalid MFA code", i+1, err)
+		}
+	}
+	if _, err := s.VerifyMFA(ctx, token, code, client); err == nil || !strings.Contains(err.Error(), "log in again") {
+		t.Fatalf("correct code on an exhausted challenge: VerifyMFA() = %v", err)
+	}
+	if a, _ := attempts.Get(ctx, accountThrottleKey("doctor@example.com")); a == nil || a.Failures != mfaChallengeMaxFailures {
+		t.Errorf("account failures = %+v, want %d", a, mfaChallengeMaxFailures)
+	}
+
+	// A new challenge starts over, and success clears the failures
+	fresh := challenge()
+	if _, err := s.VerifyMFA(ctx, fresh, code, client); err != nil {
+		t.Fatalf("new challenge: VerifyMFA() = %v", err)
+	}
+	for _, key := range []string{accountThrottleKey("doctor@example.com"), mfaChallengeKey(fresh)} {
+		if a, _ := attempts.Get(ctx, key); a != nil {
+			t.Errorf("%s not reset after a successful login: %+v", key, a)
+		}
+	}
+
+	// The code cannot be used again with another challenge
+	if _, err := s.VerifyMFA(ctx, challenge(), code, client); err == nil {
+		t.Error("replayed code accepted")
+	}
+}
+
+func TestVerifyMFARejectsOtherTokens(t *testing.T) {
+	ctx := context.Background()
+	s, users, _ := newMFATestService(t)
+	code := totpCode(t, totp.Step(time.Now()))
+
+	enrollment, err := s.generateRestrictedToken(ctx, users.users[7], tokenPurposeMFAEnrollment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := s.signToken(users.users[7], "", "session", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"enrollment token", enrollment},
+		{"access token", access},
+		{"garbage", "not-a-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.VerifyMFA(ctx, tt.token, code, ClientInfo{}); err == nil {
+				t.Error("VerifyMFA() accepted the token")
+			}
+		})
+	}
+}
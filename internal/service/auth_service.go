@@ -1,116 +1,649 @@
 package service
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"log"
+	"medical-center/internal/models/audit"
+	"medical-center/internal/models/principal"
 	"medical-center/internal/models/user"
 	"medical-center/internal/repository"
+	"medical-center/pkg/mailer"
+	"medical-center/pkg/passwords"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrAccountDisabled       = errors.New("account is disabled")
+	ErrPasswordResetRequired = errors.New("password reset required")
+)
+
 type AuthService interface {
-	Register(email, password, name string, role user.Role) (*user.User, error)
-	Login(email, password string) (string, error) // returns JWT token
-	ValidateToken(tokenString string) (*user.User, error)
+	Register(ctx context.Context, email, password, name string) (*user.User, error)
+	// Login returns a token, or an MFA challenge for accounts using two-factor authentication
+	Login(ctx context.Context, email, password string, client ClientInfo) (*LoginResult, error)
+	// LoginExternal issues a token for a user authenticated by an external
+	// identity provider, which is responsible for the second factor
+	LoginExternal(ctx context.Context, u *user.User, client ClientInfo) (*LoginResult, error)
+	// ValidateToken checks an access token and the session it belongs to
+	ValidateToken(ctx context.Context, tokenString string) (*principal.Principal, error)
+	// RequestPasswordReset emails a reset link in the background if the
+	// account exists. It never reveals whether the email is registered, in
+	// its result or in how long it takes.
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	// ChangePassword requires the current password and logs out every other
+	// session of the user
+	ChangePassword(ctx context.Context, u *user.User, sessionID, currentPassword, newPassword string, client ClientInfo) error
+	SendVerificationEmail(ctx context.Context, u *user.User) error
+	VerifyEmail(ctx context.Context, token string) (*user.User, error)
+	VerifyMFA(ctx context.Context, mfaToken, code string, client ClientInfo) (string, error)
+	// ValidateEnrollmentToken accepts regular tokens as well as the
+	// enrollment tokens issued to users who must set up MFA before logging in
+	ValidateEnrollmentToken(ctx context.Context, tokenString string) (*principal.Principal, error)
+	BeginMFAEnrollment(ctx context.Context, u *user.User) (*MFAEnrollment, error)
+	ConfirmMFAEnrollment(ctx context.Context, u *user.User, code string, client ClientInfo) (*MFAConfirmation, error)
+	DisableMFA(ctx context.Context, u *user.User, code string) error
+}
+
+type AuthConfig struct {
+	JWTSecret        string
+	TokenTTL         time.Duration
+	PasswordResetTTL time.Duration
+	// EmailVerificationTTL is how long a signed verification link stays valid
+	EmailVerificationTTL time.Duration
+	AppBaseURL           string
+	Throttle             LoginThrottleConfig
+	// MFARequiredRoles cannot log in without two-factor authentication
+	MFARequiredRoles []user.Role
+	MFAIssuer        string
+	PasswordPolicy   passwords.Policy
+	// BcryptCost is used for new hashes; older hashes are upgraded on login
+	BcryptCost int
+}
+
+// ClientInfo describes where a login request comes from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
 }
 
 type authService struct {
-	userRepo repository.UserRepository
-	jwtKey   []byte
+	userRepo    repository.UserRepository
+	resetRepo   repository.PasswordResetRepository
+	mfaRepo     repository.MFARecoveryCodeRepository
+	sessionRepo repository.SessionRepository
+	mailer      mailer.Mailer
+	throttle    *loginThrottle
+	jwtKey      []byte
+	cfg         AuthConfig
+
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
 type Claims struct {
-	UserID uint       `json:"user_id"`
-	Role   user.Role  `json:"role"`
+	UserID       uint      `json:"user_id"`
+	Role         user.Role `json:"role"`
+	TokenVersion int       `json:"token_version"`
+	// Purpose is empty for access tokens and set for restricted MFA tokens
+	Purpose string `json:"purpose,omitempty"`
+	// SessionID links access tokens to the session created at login
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func NewAuthService(userRepo repository.UserRepository) AuthService {
+func NewAuthService(
+	userRepo repository.UserRepository,
+	resetRepo repository.PasswordResetRepository,
+	attemptRepo repository.LoginAttemptRepository,
+	mfaRepo repository.MFARecoveryCodeRepository,
+	sessionRepo repository.SessionRepository,
+	m mailer.Mailer,
+	cfg AuthConfig,
+) AuthService {
+	if cfg.TokenTTL == 0 {
+		cfg.TokenTTL = 24 * time.Hour
+	}
+	if cfg.PasswordResetTTL == 0 {
+		cfg.PasswordResetTTL = time.Hour
+	}
+	if cfg.EmailVerificationTTL == 0 {
+		cfg.EmailVerificationTTL = 48 * time.Hour
+	}
+	if cfg.MFAIssuer == "" {
+		cfg.MFAIssuer = "Medical Center"
+	}
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		cfg.BcryptCost = bcrypt.DefaultCost
+	}
 	return &authService{
-		userRepo: userRepo, 
-		jwtKey:   []byte("your-secret-key-here"), // In production, use environment variables
+		userRepo:    userRepo,
+		resetRepo:   resetRepo,
+		mfaRepo:     mfaRepo,
+		sessionRepo: sessionRepo,
+		mailer:      m,
+		throttle:    newLoginThrottle(attemptRepo, cfg.Throttle),
+		jwtKey:      []byte(cfg.JWTSecret),
+		cfg:         cfg,
 	}
 }
 
-func (s *authService) Register(email, password, name string, role user.Role) (*user.User, error) {
+// Register creates a patient account. Other roles are only assigned by an
+// administrator through the user management API.
+func (s *authService) Register(ctx context.Context, email, password, name string) (*user.User, error) {
 	// Check if user already exists
-	existingUser, err := s.userRepo.GetByEmail(email)
+	existingUser, err := s.userRepo.GetByEmail(ctx, email)
 	if err == nil && existingUser != nil {
 		return nil, errors.New("user with this email already exists")
 	}
-	
+
+	if err := s.cfg.PasswordPolicy.Validate(password, email, name); err != nil {
+		return nil, err
+	}
+
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := passwords.Hash(password, s.cfg.BcryptCost)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	newUser := &user.User{
 		Email:     email,
-		Password:  string(hashedPassword),
+		Password:  hashedPassword,
 		Name:      name,
-		Role:      role,
+		Role:      user.RolePatient,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
-	
-	err = s.userRepo.Create(newUser)
+
+	err = s.userRepo.Create(ctx, newUser)
 	if err != nil {
 		return nil, err
 	}
-	
+
+	if err := s.SendVerificationEmail(ctx, newUser); err != nil {
+		// The user can request a new link later
+		log.Printf("failed to send verification email to user %d: %v", newUser.ID, err)
+	}
+
 	return newUser, nil
 }
 
-func (s *authService) Login(email, password string) (string, error) {
-	user, err := s.userRepo.GetByEmail(email)
+func (s *authService) Login(ctx context.Context, email, password string, client ClientInfo) (*LoginResult, error) {
+	if err := s.throttle.check(ctx, throttleKeys(email, client)...); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
-		return "", errors.New("invalid email or password")
+		// Unknown emails take as long as wrong passwords, so the response
+		// time does not tell which accounts exist
+		passwords.Compare(s.unknownUserHash(), password)
+		s.loginFailed(ctx, email, nil, client)
+		return nil, errors.New("invalid email or password")
 	}
-	
+
 	// Compare passwords
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if !passwords.Compare(user.Password, password) {
+		s.loginFailed(ctx, email, user, client)
+		return nil, errors.New("invalid email or password")
+	}
+	s.upgradeHash(ctx, user, password)
+
+	if user.IsDisabled() {
+		return nil, ErrAccountDisabled
+	}
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	if user.MFAEnabled {
+		// The failures are only cleared once the second factor is verified,
+		// otherwise every login would restart the count of wrong codes
+		mfaToken, err := s.generateRestrictedToken(ctx, user, tokenPurposeMFAChallenge)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFARequired: true, MFAToken: mfaToken}, nil
+	}
+
+	if err := s.throttle.reset(ctx, accountThrottleKey(email)); err != nil {
+		log.Printf("failed to reset login attempts for user %d: %v", user.ID, err)
+	}
+	if s.mfaRequired(user) {
+		mfaToken, err := s.generateRestrictedToken(ctx, user, tokenPurposeMFAEnrollment)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFAEnrollmentRequired: true, MFAToken: mfaToken}, nil
+	}
+
+	token, err := s.generateToken(ctx, user, client)
 	if err != nil {
-		return "", errors.New("invalid email or password")
+		return nil, err
 	}
-	
-	// Generate token
-	expirationTime := time.Now().Add(24 * time.Hour)
+	return &LoginResult{Token: token}, nil
+}
+
+func (s *authService) LoginExternal(ctx context.Context, u *user.User, client ClientInfo) (*LoginResult, error) {
+	if u.IsDisabled() {
+		return nil, ErrAccountDisabled
+	}
+
+	token, err := s.generateToken(ctx, u, client)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Token: token}, nil
+}
+
+// unknownUserHash returns the hash that logins with an unknown email are
+// compared against. It is created on first use with the configured cost.
+func (s *authService) unknownUserHash() string {
+	s.dummyHashOnce.Do(func() {
+		hash, err := passwords.Hash("unknown user", s.cfg.BcryptCost)
+		if err != nil {
+			log.Printf("failed to create the hash for unknown users: %v", err)
+			return
+		}
+		s.dummyHash = hash
+	})
+	return s.dummyHash
+}
+
+// upgradeHash rehashes the password after a successful login when the
+// configured bcrypt cost has changed
+func (s *authService) upgradeHash(ctx context.Context, u *user.User, password string) {
+	if !passwords.NeedsRehash(u.Password, s.cfg.BcryptCost) {
+		return
+	}
+
+	hash, err := passwords.Hash(password, s.cfg.BcryptCost)
+	if err != nil {
+		log.Printf("failed to rehash password of user %d: %v", u.ID, err)
+		return
+	}
+	u.Password = hash
+	if err := s.userRepo.Update(ctx, u); err != nil {
+		log.Printf("failed to store rehashed password of user %d: %v", u.ID, err)
+	}
+}
+
+func throttleKeys(email string, client ClientInfo) []string {
+	keys := []string{accountThrottleKey(email)}
+	if client.IP != "" {
+		keys = append(keys, ipThrottleKey(client.IP))
+	}
+	return keys
+}
+
+// loginFailed counts the failure against the account and the client IP and
+// notifies the account owner when it gets locked
+func (s *authService) loginFailed(ctx context.Context, email string, u *user.User, client ClientInfo) {
+	lockedUntil, err := s.throttle.recordFailure(ctx, accountThrottleKey(email), s.throttle.cfg.MaxAccountFailures)
+	if err != nil {
+		log.Printf("failed to record login failure: %v", err)
+	}
+	if client.IP != "" {
+		if _, err := s.throttle.recordFailure(ctx, ipThrottleKey(client.IP), s.throttle.cfg.MaxIPFailures); err != nil {
+			log.Printf("failed to record login failure: %v", err)
+		}
+	}
+
+	if lockedUntil == nil || u == nil {
+		return
+	}
+
+	msg := mailer.Message{
+		To:      u.Email,
+		Subject: "Your account has been temporarily locked",
+		Purpose: mailer.PurposeTransactional,
+		Body: fmt.Sprintf("Hello %s,\n\nWe locked your account after %d failed login attempts. "+
+			"You can try again after %s.\n\nThe last attempt came from %s. If this was not you, "+
+			"we recommend resetting your password.\n",
+			u.Name, s.throttle.cfg.MaxAccountFailures, lockedUntil.Format(time.RFC1123), client.IP),
+	}
+	if err := s.mailer.Send(msg); err != nil {
+		log.Printf("failed to send lockout notification to user %d: %v", u.ID, err)
+	}
+}
+
+// generateToken starts a new session for the client and issues an access
+// token bound to it
+func (s *authService) generateToken(ctx context.Context, u *user.User, client ClientInfo) (string, error) {
+	sessionID, err := generateSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	// The caller is not authenticated yet, attribute the new session to the
+	// user logging in
+	ctx = audit.WithActor(ctx, audit.Actor{Type: audit.ActorUser, ID: u.ID})
+
+	now := time.Now()
+	session := &user.Session{
+		ID:         sessionID,
+		UserID:     u.ID,
+		Device:     describeDevice(client.UserAgent),
+		UserAgent:  truncate(client.UserAgent, 512),
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.cfg.TokenTTL),
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return "", err
+	}
+
+	return s.signToken(u, "", sessionID, s.cfg.TokenTTL)
+}
+
+func (s *authService) signToken(u *user.User, purpose, sessionID string, ttl time.Duration) (string, error) {
+	expirationTime := time.Now().Add(ttl)
 	claims := &Claims{
-		UserID: user.ID,
-		Role:   user.Role,
+		UserID:       u.ID,
+		Role:         u.Role,
+		TokenVersion: u.TokenVersion,
+		Purpose:      purpose,
+		SessionID:    sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
-	
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(s.jwtKey)
+	return token.SignedString(s.jwtKey)
+}
+
+func (s *authService) ValidateToken(ctx context.Context, tokenString string) (*principal.Principal, error) {
+	claims, user, err := s.parseToken(ctx, tokenString)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	// MFA challenge and enrollment tokens do not grant API access
+	if claims.Purpose != "" {
+		return nil, errors.New("invalid token")
 	}
-	
-	return tokenString, nil
+
+	return s.checkSession(ctx, claims, user)
 }
 
-func (s *authService) ValidateToken(tokenString string) (*user.User, error) {
+// checkSession rejects access tokens whose session was revoked or expired
+// and records activity on the session
+func (s *authService) checkSession(ctx context.Context, claims *Claims, u *user.User) (*principal.Principal, error) {
+	if claims.SessionID == "" {
+		return nil, errors.New("token has been revoked")
+	}
+
+	session, err := s.sessionRepo.GetByID(ctx, claims.SessionID)
+	now := time.Now()
+	if err != nil || session.UserID != u.ID || !session.IsActive(now) {
+		return nil, errors.New("token has been revoked")
+	}
+
+	if now.Sub(session.LastSeenAt) > sessionLastSeenResolution {
+		if err := s.sessionRepo.TouchLastSeen(ctx, session.ID, now); err != nil {
+			log.Printf("failed to update last activity of session %s: %v", session.ID, err)
+		}
+	}
+
+	p := principal.ForUser(u)
+	p.SessionID = session.ID
+	return p, nil
+}
+
+func (s *authService) parseToken(ctx context.Context, tokenString string) (*Claims, *user.User, error) {
 	claims := &Claims{}
-	
+
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return s.jwtKey, nil
 	})
-	
+
 	if err != nil || !token.Valid {
-		return nil, errors.New("invalid token")
+		return nil, nil, errors.New("invalid token")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, nil, errors.New("user not found")
+	}
+
+	// Tokens issued before the last password reset are revoked
+	if claims.TokenVersion != user.TokenVersion {
+		return nil, nil, errors.New("token has been revoked")
+	}
+
+	if user.IsDisabled() {
+		return nil, nil, ErrAccountDisabled
+	}
+
+	return claims, user, nil
+}
+
+func (s *authService) RequestPasswordReset(ctx context.Context, email string) error {
+	u, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		// Unknown accounts are silently ignored so the endpoint cannot be used for enumeration
+		return nil
+	}
+
+	// The link is issued and mailed in the background so that the response
+	// takes as long as for an unknown address
+	go func() {
+		if err := s.sendPasswordReset(context.WithoutCancel(ctx), u); err != nil {
+			log.Printf("failed to send password reset email to user %d: %v", u.ID, err)
+		}
+	}()
+	return nil
+}
+
+func (s *authService) sendPasswordReset(ctx context.Context, u *user.User) error {
+	token, err := generateSecureToken()
+	if err != nil {
+		return err
+	}
+
+	// Only the most recent link stays valid
+	if err := s.resetRepo.InvalidateForUser(ctx, u.ID); err != nil {
+		return err
+	}
+
+	resetToken := &user.PasswordResetToken{
+		UserID:    u.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.cfg.PasswordResetTTL),
+	}
+	if err := s.resetRepo.Create(ctx, resetToken); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mailer.Message{
+		To:      u.Email,
+		Subject: "Password reset",
+		Purpose: mailer.PurposeTransactional,
+		Body: fmt.Sprintf("Hello %s,\n\nTo reset your password open the link below:\n%s/reset-password?token=%s\n\n"+
+			"The link expires in %s and can be used once. If you did not request a reset, ignore this email.\n",
+			u.Name, s.cfg.AppBaseURL, token, s.cfg.PasswordResetTTL),
+	})
+}
+
+func (s *authService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	resetToken, err := s.resetRepo.GetByHash(ctx, hashToken(token))
+	if err != nil || resetToken.UsedAt != nil || time.Now().After(resetToken.ExpiresAt) {
+		return errors.New("invalid or expired reset token")
+	}
+
+	u, err := s.userRepo.GetByID(ctx, resetToken.UserID)
+	if err != nil {
+		return errors.New("invalid or expired reset token")
+	}
+
+	// Checked before consuming the token so the user can pick another password
+	if err := s.cfg.PasswordPolicy.Validate(newPassword, u.Email, u.Name); err != nil {
+		return err
+	}
+
+	if err := s.resetRepo.MarkUsed(ctx, resetToken.ID); err != nil {
+		return errors.New("invalid or expired reset token")
+	}
+
+	hashedPassword, err := passwords.Hash(newPassword, s.cfg.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	u.Password = hashedPassword
+	u.PasswordResetRequired = false
+	u.TokenVersion++
+	if err := s.userRepo.Update(ctx, u); err != nil {
+		return err
+	}
+
+	// The token version already invalidates old tokens, revoking the
+	// sessions keeps the session list accurate
+	return s.sessionRepo.RevokeAllForUser(ctx, u.ID, "", time.Now())
+}
+
+func (s *authService) ChangePassword(ctx context.Context, u *user.User, sessionID, currentPassword, newPassword string, client ClientInfo) error {
+	// Guessing the current password counts towards the login lockout
+	if err := s.throttle.check(ctx, throttleKeys(u.Email, client)...); err != nil {
+		return err
+	}
+	if !passwords.Compare(u.Password, currentPassword) {
+		s.loginFailed(ctx, u.Email, u, client)
+		return errors.New("current password is incorrect")
+	}
+
+	if currentPassword == newPassword {
+		return errors.New("new password must be different from the current one")
+	}
+	if err := s.cfg.PasswordPolicy.Validate(newPassword, u.Email, u.Name); err != nil {
+		return err
+	}
+
+	hashedPassword, err := passwords.Hash(newPassword, s.cfg.BcryptCost)
+	if err != nil {
+		return err
+	}
+	u.Password = hashedPassword
+	if err := s.userRepo.Update(ctx, u); err != nil {
+		return err
+	}
+
+	// Unlike a reset the token version is kept, so the session making the
+	// change stays logged in while all others are revoked
+	if err := s.sessionRepo.RevokeAllForUser(ctx, u.ID, sessionID, time.Now()); err != nil {
+		return err
+	}
+	if err := s.resetRepo.InvalidateForUser(ctx, u.ID); err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      u.Email,
+		Subject: "Your password was changed",
+		Purpose: mailer.PurposeTransactional,
+		Body: fmt.Sprintf("Hello %s,\n\nThe password of your account was changed from %s. "+
+			"Your other sessions have been logged out.\n\nIf this was not you, request a password "+
+			"reset immediately.\n",
+			u.Name, client.IP),
+	}
+	if err := s.mailer.Send(msg); err != nil {
+		log.Printf("failed to send password change notification to user %d: %v", u.ID, err)
+	}
+	return nil
+}
+
+func (s *authService) SendVerificationEmail(ctx context.Context, u *user.User) error {
+	if u.EmailVerified {
+		return errors.New("email is already verified")
+	}
+
+	token := s.signEmailVerification(u.ID, u.Email, time.Now().Add(s.cfg.EmailVerificationTTL))
+	msg := mailer.Message{
+		To:      u.Email,
+		Subject: "Confirm your email address",
+		Purpose: mailer.PurposeTransactional,
+		Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your email address by opening the link below:\n%s/api/v1/auth/verify-email?token=%s\n\n"+
+			"The link expires in %s.\n",
+			u.Name, s.cfg.AppBaseURL, token, s.cfg.EmailVerificationTTL),
+	}
+	return s.mailer.Send(msg)
+}
+
+func (s *authService) VerifyEmail(ctx context.Context, token string) (*user.User, error) {
+	invalid := errors.New("invalid or expired verification link")
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid
+	}
+	userID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, invalid
+	}
+	expiresUnix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().After(time.Unix(expiresUnix, 0)) {
+		return nil, invalid
 	}
-	
-	user, err := s.userRepo.GetByID(claims.UserID)
+
+	u, err := s.userRepo.GetByID(ctx, uint(userID))
 	if err != nil {
-		return nil, errors.New("user not found")
+		return nil, invalid
+	}
+
+	// The signature covers the email so the link dies if the address changes
+	expected := s.signEmailVerification(u.ID, u.Email, time.Unix(expiresUnix, 0))
+	if !hmac.Equal([]byte(expected), []byte(token)) {
+		return nil, invalid
 	}
-	
-	return user, nil
-} 
\ No newline at end of file
+
+	if u.EmailVerified {
+		return u, nil
+	}
+
+	now := time.Now()
+	u.EmailVerified = true
+	u.EmailVerifiedAt = &now
+	if err := s.userRepo.Update(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// signEmailVerification builds a "<user id>.<expiry>.<signature>" token
+func (s *authService) signEmailVerification(userID uint, email string, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%d.%d", userID, expiresAt.Unix())
+	mac := hmac.New(sha256.New, s.jwtKey)
+	mac.Write([]byte("verify-email:" + payload + ":" + strings.ToLower(email)))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// generateSecureToken returns a random URL-safe token
+func generateSecureToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
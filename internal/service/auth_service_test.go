@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"medical-center/internal/models/user"
+	"medical-center/pkg/passwords"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginUnknownEmailComparesPassword(t *testing.T) {
+	ctx := context.Background()
+	hash, err := passwords.Hash("correct horse", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &fakeUserRepo{users: map[uint]*user.User{
+		7: {ID: 7, Email: "doctor@example.com", Role: user.RoleDoctor, Password: hash},
+	}}
+	s := NewAuthService(users, nil, newFakeAttemptRepo(), nil, &fakeSessionRepo{}, &fakeMailer{}, AuthConfig{
+		JWTSecret:  "test-secret",
+		BcryptCost: bcrypt.MinCost,
+	}).(*authService)
+
+	tests := []struct {
+		name  string
+		email string
+	}{
+		{"wrong password", "doctor@example.com"},
+		{"unknown email", "nobody@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Login(ctx, tt.email, "wrong password", ClientInfo{})
+			if err == nil || err.Error() != "invalid email or password" {
+				t.Fatalf("Login() = %v, want invalid email or password", err)
+			}
+		})
+	}
+
+	// The unknown email went through a bcrypt comparison at the same cost
+	if cost, err := bcrypt.Cost([]byte(s.dummyHash)); err != nil || cost != bcrypt.MinCost {
+		t.Errorf("hash for unknown users has cost %d (%v), want %d", cost, err, bcrypt.MinCost)
+	}
+}
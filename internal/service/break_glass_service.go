@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"medical-center/internal/models/breakglass"
+	"medical-center/internal/models/user"
+	"medical-center/internal/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minBreakGlassReason is the shortest justification accepted, to rule out
+// placeholders such as "x"
+const minBreakGlassReason = 10
+
+// BreakGlassService lets users declare an emergency to get elevated read
+// access for a limited time, and lets administrators review what was
+// accessed under it
+type BreakGlassService struct {
+	repo     repository.BreakGlassRepository
+	duration time.Duration
+}
+
+func NewBreakGlassService(repo repository.BreakGlassRepository, duration time.Duration) *BreakGlassService {
+	return &BreakGlassService{repo: repo, duration: duration}
+}
+
+// Declare starts an emergency grant for the user. A user has at most one
+// active grant.
+func (s *BreakGlassService) Declare(ctx context.Context, u *user.User, reason string) (*breakglass.Grant, error) {
+	reason = strings.TrimSpace(reason)
+	if len(reason) < minBreakGlassReason {
+		return nil, errors.New("describe the emergency in at least 10 characters")
+	}
+
+	now := time.Now()
+	active, err := s.repo.GetActiveGrant(ctx, u.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return nil, errors.New("an emergency access is already active until " + active.ExpiresAt.Format(time.RFC3339))
+	}
+
+	grant := &breakglass.Grant{
+		UserID:    u.ID,
+		UserName:  u.Name,
+		Reason:    reason,
+		ExpiresAt: now.Add(s.duration),
+	}
+	if err := s.repo.CreateGrant(ctx, grant); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+// ActiveGrant returns the active grant of the user, or nil
+func (s *BreakGlassService) ActiveGrant(ctx context.Context, userID uint) (*breakglass.Grant, error) {
+	return s.repo.GetActiveGrant(ctx, userID, time.Now())
+}
+
+// End closes the user's active grant before it expires
+func (s *BreakGlassService) End(ctx context.Context, userID uint) error {
+	grant, err := s.repo.GetActiveGrant(ctx, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if grant == nil {
+		return errors.New("no emergency access is active")
+	}
+	return s.repo.EndGrant(ctx, grant.ID, time.Now())
+}
+
+// RecordAccess adds a request for the record entityID of entity made under
+// the grant to the review queue
+func (s *BreakGlassService) RecordAccess(ctx context.Context, grant *breakglass.Grant, method, path, entity, entityID string, status int) error {
+	return s.repo.CreateAccess(ctx, &breakglass.Access{
+		GrantID:      grant.ID,
+		UserID:       grant.UserID,
+		Method:       method,
+		Path:         path,
+		Entity:       entity,
+		EntityID:     entityID,
+		Status:       status,
+		ReviewStatus: breakglass.ReviewPending,
+	})
+}
+
+func (s *BreakGlassService) GetGrants(ctx context.Context, userID uint) ([]breakglass.Grant, error) {
+	return s.repo.GetGrants(ctx, userID)
+}
+
+func (s *BreakGlassService) ListAccesses(ctx context.Context, filter breakglass.AccessFilter) ([]breakglass.Access, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 100 {
+		filter.PageSize = 50
+	}
+	if err := validateAccessFilter(filter); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.ListAccesses(ctx, filter)
+}
+
+// ReviewAccess marks one access as justified or misuse
+func (s *BreakGlassService) ReviewAccess(ctx context.Context, reviewerID, accessID uint, status breakglass.ReviewStatus, note string) (*breakglass.Access, error) {
+	if err := validateReview(status, note); err != nil {
+		return nil, err
+	}
+	access, err := s.repo.GetAccess(ctx, accessID)
+	if err != nil {
+		return nil, err
+	}
+	if access.UserID == reviewerID {
+		return nil, errors.New("you cannot review your own emergency access")
+	}
+
+	now := time.Now()
+	access.ReviewStatus = status
+	access.ReviewedByID = &reviewerID
+	access.ReviewedAt = &now
+	access.ReviewNote = note
+	if err := s.repo.UpdateAccess(ctx, access); err != nil {
+		return nil, err
+	}
+	return access, nil
+}
+
+// ReviewGrant marks every pending access of a grant at once and returns how
+// many were reviewed
+func (s *BreakGlassService) ReviewGrant(ctx context.Context, reviewerID, grantID uint, status breakglass.ReviewStatus, note string) (int64, error) {
+	if err := validateReview(status, note); err != nil {
+		return 0, err
+	}
+	grant, err := s.repo.GetGrant(ctx, grantID)
+	if err != nil {
+		return 0, err
+	}
+	if grant.UserID == reviewerID {
+		return 0, errors.New("you cannot review your own emergency access")
+	}
+	return s.repo.ReviewPendingByGrant(ctx, grantID, status, reviewerID, note, time.Now())
+}
+
+func validateReview(status breakglass.ReviewStatus, note string) error {
+	switch status {
+	case breakglass.ReviewJustified:
+		return nil
+	case breakglass.ReviewMisuse:
+		if strings.TrimSpace(note) == "" {
+			return errors.New("a note is required when reporting misuse")
+		}
+		return nil
+	}
+	return errors.New("review status must be justified or misuse")
+}
+
+func validateAccessFilter(filter breakglass.AccessFilter) error {
+	switch filter.ReviewStatus {
+	case "", breakglass.ReviewPending, breakglass.ReviewJustified, breakglass.ReviewMisuse:
+	default:
+		return errors.New("invalid review status filter")
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return errors.New("from must be before to")
+	}
+	return nil
+}
+
+// ExportCSV writes the accesses matching filter, with the emergency they
+// were made under, as CSV. Used to hand misuse reports to compliance.
+func (s *BreakGlassService) ExportCSV(ctx context.Context, w io.Writer, filter breakglass.AccessFilter) error {
+	if err := validateAccessFilter(filter); err != nil {
+		return err
+	}
+	filter.Page, filter.PageSize = 1, 0
+	accesses, _, err := s.repo.ListAccesses(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	out := csv.NewWriter(w)
+	out.Write([]string{
+		"access_id", "accessed_at", "user_id", "user_name", "grant_id", "emergency_reason",
+		"method", "path", "entity", "entity_id", "status", "review_status", "reviewed_by_id", "reviewed_at", "review_note",
+	})
+
+	grants := map[uint]*breakglass.Grant{}
+	for _, a := range accesses {
+		grant, ok := grants[a.GrantID]
+		if !ok {
+			if grant, err = s.repo.GetGrant(ctx, a.GrantID); err != nil {
+				return err
+			}
+			grants[a.GrantID] = grant
+		}
+		reviewedBy, reviewedAt := "", ""
+		if a.ReviewedByID != nil {
+			reviewedBy = strconv.FormatUint(uint64(*a.ReviewedByID), 10)
+		}
+		if a.ReviewedAt != nil {
+			reviewedAt = a.ReviewedAt.UTC().Format(time.RFC3339)
+		}
+		out.Write([]string{
+			strconv.FormatUint(uint64(a.ID), 10),
+			a.CreatedAt.UTC().Format(time.RFC3339),
+			strconv.FormatUint(uint64(a.UserID), 10),
+			csvSafe(grant.UserName),
+			strconv.FormatUint(uint64(a.GrantID), 10),
+			csvSafe(grant.Reason),
+			a.Method,
+			csvSafe(a.Path),
+			a.Entity,
+			csvSafe(a.EntityID),
+			strconv.Itoa(a.Status),
+			string(a.ReviewStatus),
+			reviewedBy,
+			reviewedAt,
+			csvSafe(a.ReviewNote),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// csvSafe keeps free text from being run as a formula when the report is
+// opened in a spreadsheet
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
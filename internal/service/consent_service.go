@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"medical-center/internal/models/consent"
+	"medical-center/internal/repository"
+	"strings"
+)
+
+type ConsentService struct {
+	repo     repository.ConsentRepository
+	userRepo repository.UserRepository
+}
+
+func NewConsentService(repo repository.ConsentRepository, userRepo repository.UserRepository) *ConsentService {
+	return &ConsentService{repo: repo, userRepo: userRepo}
+}
+
+// GetConsents returns the current choice of the user for every purpose.
+// Purposes the user never answered count as not granted.
+func (s *ConsentService) GetConsents(ctx context.Context, userID uint) ([]consent.Status, error) {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	latest, err := s.repo.GetLatest(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	byPurpose := make(map[consent.Purpose]consent.Record, len(latest))
+	for _, record := range latest {
+		byPurpose[record.Purpose] = record
+	}
+	statuses := make([]consent.Status, 0, len(consent.Purposes))
+	for _, purpose := range consent.Purposes {
+		status := consent.Status{Purpose: purpose}
+		if record, ok := byPurpose[purpose]; ok {
+			at := record.CreatedAt
+			status.Granted = record.Granted
+			status.Version = record.Version
+			status.Channel = record.Channel
+			status.UpdatedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (s *ConsentService) GetHistory(ctx context.Context, userID uint) ([]consent.Record, error) {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetHistory(ctx, userID)
+}
+
+// Record stores a grant or withdrawal of consent made by the user, or by
+// staff on their behalf. version identifies the consent text the user saw.
+func (s *ConsentService) Record(ctx context.Context, actorID, userID uint, purpose consent.Purpose, granted bool, version string, channel consent.Channel) (*consent.Record, error) {
+	if !purpose.IsValid() {
+		return nil, errors.New("unknown consent purpose: " + string(purpose))
+	}
+	if !channel.IsValid() {
+		return nil, errors.New("unknown consent channel: " + string(channel))
+	}
+	version = strings.TrimSpace(version)
+	if granted && version == "" {
+		return nil, errors.New("the version of the consent text is required")
+	}
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	record := &consent.Record{
+		UserID:       userID,
+		Purpose:      purpose,
+		Granted:      granted,
+		Version:      version,
+		Channel:      channel,
+		RecordedByID: actorID,
+	}
+	if err := s.repo.Create(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Allowed reports whether the user currently consents to purpose
+func (s *ConsentService) Allowed(ctx context.Context, userID uint, purpose consent.Purpose) (bool, error) {
+	latest, err := s.repo.GetLatest(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, record := range latest {
+		if record.Purpose == purpose {
+			return record.Granted, nil
+		}
+	}
+	return false, nil
+}
+
+// AllowedForEmail is Allowed for the account with the given email. Without
+// an account nobody could have consented, so the answer is no.
+func (s *ConsentService) AllowedForEmail(ctx context.Context, email string, purpose consent.Purpose) (bool, error) {
+	if email == "" {
+		return false, nil
+	}
+	u, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return false, nil
+	}
+	return s.Allowed(ctx, u.ID, purpose)
+}
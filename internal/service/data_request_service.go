@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"medical-center/internal/models/datarequest"
+	"medical-center/internal/models/patient"
+	"medical-center/internal/models/user"
+	"medical-center/internal/repository"
+	"time"
+)
+
+// erasedName replaces the name of an erased account
+const erasedName = "Erased patient"
+
+// DataRequestService handles the requests of patients for a copy of their
+// data and for its erasure
+type DataRequestService struct {
+	repo             repository.DataRequestRepository
+	userRepo         repository.UserRepository
+	appRepo          repository.AppRepository
+	notificationRepo repository.NotificationRepository
+	sessionRepo      repository.SessionRepository
+	holdRepo         repository.LegalHoldRepository
+	consentRepo      repository.ConsentRepository
+	patientRepo      repository.PatientRepository
+}
+
+func NewDataRequestService(
+	repo repository.DataRequestRepository,
+	userRepo repository.UserRepository,
+	appRepo repository.AppRepository,
+	notificationRepo repository.NotificationRepository,
+	sessionRepo repository.SessionRepository,
+	holdRepo repository.LegalHoldRepository,
+	consentRepo repository.ConsentRepository,
+	patientRepo repository.PatientRepository,
+) *DataRequestService {
+	return &DataRequestService{
+		repo:             repo,
+		userRepo:         userRepo,
+		appRepo:          appRepo,
+		notificationRepo: notificationRepo,
+		sessionRepo:      sessionRepo,
+		holdRepo:         holdRepo,
+		consentRepo:      consentRepo,
+		patientRepo:      patientRepo,
+	}
+}
+
+func (s *DataRequestService) List(ctx context.Context, filter datarequest.ListFilter) ([]datarequest.Request, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 100 {
+		filter.PageSize = 20
+	}
+	return s.repo.List(ctx, filter)
+}
+
+// Export collects everything held about the user. Appointments are matched
+// by the email of the account, patient records by the account or its email. The export is recorded as a completed
+// request of actorID.
+func (s *DataRequestService) Export(ctx context.Context, actorID, userID uint) (*datarequest.Export, error) {
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	req := &datarequest.Request{
+		UserID:        u.ID,
+		Type:          datarequest.TypeExport,
+		Status:        datarequest.StatusCompleted,
+		RequestedByID: actorID,
+		CompletedByID: &actorID,
+		CompletedAt:   &now,
+	}
+	if err := s.repo.Create(ctx, req); err != nil {
+		return nil, err
+	}
+
+	export := &datarequest.Export{GeneratedAt: now, Account: u}
+	if export.Sessions, err = s.sessionRepo.GetActiveByUser(ctx, u.ID, now); err != nil {
+		return nil, err
+	}
+	if export.Appointments, err = s.appRepo.GetByEmail(ctx, u.Email); err != nil {
+		return nil, err
+	}
+	if export.Notifications, err = s.notificationRepo.GetByRecipient(ctx, u.Email); err != nil {
+		return nil, err
+	}
+	if export.Consents, err = s.consentRepo.GetHistory(ctx, u.ID); err != nil {
+		return nil, err
+	}
+	if export.Patients, err = s.patientsOf(ctx, u); err != nil {
+		return nil, err
+	}
+	// Large enough for any account, the list is part of the archive
+	if export.Requests, _, err = s.repo.List(ctx, datarequest.ListFilter{UserID: u.ID, Page: 1, PageSize: 1000}); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// RequestErasure files an erasure request for a patient account. Nothing is
+// erased until an administrator approves it.
+func (s *DataRequestService) RequestErasure(ctx context.Context, actorID, userID uint, reason string) (*datarequest.Request, error) {
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Role != user.RolePatient {
+		return nil, errors.New("erasure can only be requested for patient accounts")
+	}
+
+	pending, _, err := s.repo.List(ctx, datarequest.ListFilter{
+		UserID:   u.ID,
+		Type:     datarequest.TypeErasure,
+		Status:   datarequest.StatusPending,
+		Page:     1,
+		PageSize: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) > 0 {
+		return nil, errors.New("an erasure request is already pending")
+	}
+
+	req := &datarequest.Request{
+		UserID:        u.ID,
+		Type:          datarequest.TypeErasure,
+		Status:        datarequest.StatusPending,
+		Reason:        reason,
+		RequestedByID: actorID,
+	}
+	if err := s.repo.Create(ctx, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ApproveErasure anonymises the patient: appointments keep their
+// department, doctor and time for statistics and legal retention but lose
+// the patient details, notifications lose the address, sessions are
+// deleted and the account is scrubbed, disabled and deleted. Patients under
+// a legal hold cannot be erased until the hold is released.
+func (s *DataRequestService) ApproveErasure(ctx context.Context, actorID, requestID uint, note string) (*datarequest.Request, error) {
+	req, err := s.pendingErasure(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if req.UserID == actorID {
+		return nil, errors.New("you cannot approve the erasure of your own account")
+	}
+	held, err := s.holdRepo.IsHeld(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		return nil, errors.New("the patient is under a legal hold")
+	}
+	u, err := s.userRepo.GetByID(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The account goes last: until then its email still finds the records,
+	// so a failed erasure can be approved again
+	erasedEmail := fmt.Sprintf("erased-%d@erased.invalid", u.ID)
+	if _, err := s.appRepo.AnonymizeByEmail(ctx, u.Email); err != nil {
+		return nil, err
+	}
+	patients, err := s.patientsOf(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range patients {
+		if err := s.patientRepo.Anonymize(ctx, p.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.notificationRepo.AnonymizeRecipient(ctx, u.Email, erasedEmail); err != nil {
+		return nil, err
+	}
+	if err := s.sessionRepo.DeleteByUser(ctx, u.ID); err != nil {
+		return nil, err
+	}
+
+	u.Email = erasedEmail
+	u.Name = erasedName
+	u.Password = ""
+	u.Status = user.StatusDisabled
+	u.TokenVersion++
+	u.EmailVerified = false
+	u.EmailVerifiedAt = nil
+	u.MFAEnabled = false
+	u.MFASecret = ""
+	u.OIDCSubject = nil
+	if err := s.userRepo.Update(ctx, u); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.Delete(ctx, u.ID); err != nil {
+		return nil, err
+	}
+
+	return s.complete(ctx, req, actorID, datarequest.StatusCompleted, note)
+}
+
+// patientsOf returns the patient records linked to the account or
+// registered with its email
+func (s *DataRequestService) patientsOf(ctx context.Context, u *user.User) ([]patient.Patient, error) {
+	linked, err := s.patientRepo.GetByUser(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Large enough for any patient, like the request list of the export
+	byEmail, _, err := s.patientRepo.List(ctx, patient.Filter{Email: u.Email, Page: 1, PageSize: 1000})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool, len(linked))
+	for _, p := range linked {
+		seen[p.ID] = true
+	}
+	for _, p := range byEmail {
+		if !seen[p.ID] {
+			linked = append(linked, p)
+		}
+	}
+	return linked, nil
+}
+
+// RejectErasure closes an erasure request without erasing anything
+func (s *DataRequestService) RejectErasure(ctx context.Context, actorID, requestID uint, note string) (*datarequest.Request, error) {
+	req, err := s.pendingErasure(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	return s.complete(ctx, req, actorID, datarequest.StatusRejected, note)
+}
+
+func (s *DataRequestService) pendingErasure(ctx context.Context, requestID uint) (*datarequest.Request, error) {
+	req, err := s.repo.GetByID(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Type != datarequest.TypeErasure {
+		return nil, errors.New("not an erasure request")
+	}
+	if req.Status != datarequest.StatusPending {
+		return nil, errors.New("request is already " + string(req.Status))
+	}
+	return req, nil
+}
+
+func (s *DataRequestService) complete(ctx context.Context, req *datarequest.Request, actorID uint, status datarequest.Status, note string) (*datarequest.Request, error) {
+	now := time.Now()
+	req.Status = status
+	req.Resolution = note
+	req.CompletedByID = &actorID
+	req.CompletedAt = &now
+	if err := s.repo.Update(ctx, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
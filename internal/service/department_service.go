@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"medical-center/internal/models/department"
 	"medical-center/internal/repository"
@@ -15,7 +16,7 @@ func NewDepartmentService(repo repository.DepartmentRepository) *DepartmentServi
 	return &DepartmentService{repo: repo}
 }
 
-func (s *DepartmentService) CreateDepartment(name string) (*department.Department, error) {
+func (s *DepartmentService) CreateDepartment(ctx context.Context, name string) (*department.Department, error) {
 	if name == "" {
 		return nil, errors.New("department name cannot be empty")
 	}
@@ -24,49 +25,49 @@ func (s *DepartmentService) CreateDepartment(name string) (*department.Departmen
 		Name: name,
 	}
 
-	if err := s.repo.Create(newDept); err != nil {
+	if err := s.repo.Create(ctx, newDept); err != nil {
 		return nil, err
 	}
 	return newDept, nil
 }
 
-func (s *DepartmentService) GetDepartmentByID(id uint) (*department.Department, error) {
-	return s.repo.GetByID(id)
+func (s *DepartmentService) GetDepartmentByID(ctx context.Context, id uint) (*department.Department, error) {
+	return s.repo.GetByID(ctx, id)
 }
 
-func (s *DepartmentService) GetAllDepartments() ([]department.Department, error) {
-	return s.repo.GetAll()
+func (s *DepartmentService) GetAllDepartments(ctx context.Context) ([]department.Department, error) {
+	return s.repo.GetAll(ctx)
 }
 
-func (s *DepartmentService) UpdateDepartment(id uint, name string) (*department.Department, error) {
-	dept, err := s.repo.GetByID(id)
+func (s *DepartmentService) UpdateDepartment(ctx context.Context, id uint, name string) (*department.Department, error) {
+	dept, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
 	dept.Name = name
 
-	if err := s.repo.Update(dept); err != nil {
+	if err := s.repo.Update(ctx, dept); err != nil {
 		return nil, err
 	}
 	return dept, nil
 }
 
-func (s *DepartmentService) DeleteDepartment(id uint) error {
-	return s.repo.Delete(id)
+func (s *DepartmentService) DeleteDepartment(ctx context.Context, id uint) error {
+	return s.repo.Delete(ctx, id)
 }
 
-func (s *DepartmentService) GetWithDoctors(id uint) (*department.Department, error) {
-	return s.repo.GetWithDoctors(id)
+func (s *DepartmentService) GetWithDoctors(ctx context.Context, id uint) (*department.Department, error) {
+	return s.repo.GetWithDoctors(ctx, id)
 }
 
-func (s *DepartmentService) GetAvailableSlots(id uint, date string) ([]string, error) {
+func (s *DepartmentService) GetAvailableSlots(ctx context.Context, id uint, date string) ([]string, error) {
 	parsedDate, err := time.Parse("2006-01-02", date)
 	if err != nil {
 		return nil, errors.New("invalid date format, use YYYY-MM-DD")
 	}
 
-	slots, err := s.repo.GetAvailableSlots(id, parsedDate)
+	slots, err := s.repo.GetAvailableSlots(ctx, id, parsedDate)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"medical-center/internal/models/diagnosis"
+	"medical-center/internal/repository"
+	"strings"
+)
+
+// DiagnosisService manages the ICD-10 catalogue and the diagnoses given at
+// appointments
+type DiagnosisService struct {
+	codes         repository.ICDCodeRepository
+	repo          repository.DiagnosisRepository
+	appRepo       repository.AppRepository
+	encounterRepo repository.EncounterRepository
+}
+
+func NewDiagnosisService(
+	codes repository.ICDCodeRepository,
+	repo repository.DiagnosisRepository,
+	appRepo repository.AppRepository,
+	encounterRepo repository.EncounterRepository,
+) *DiagnosisService {
+	return &DiagnosisService{codes: codes, repo: repo, appRepo: appRepo, encounterRepo: encounterRepo}
+}
+
+func (s *DiagnosisService) ListCodes(ctx context.Context, filter diagnosis.CodeFilter) ([]diagnosis.Code, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+	return s.codes.ListCodes(ctx, filter)
+}
+
+func (s *DiagnosisService) GetCode(ctx context.Context, id uint) (*diagnosis.Code, error) {
+	return s.codes.GetCode(ctx, id)
+}
+
+// Import reads an ICD-10 catalogue as CSV with a header row. The code column
+// is required, with title_ru, title_en or both. The catalogue has tens of
+// thousands of codes, so the existing ones are loaded at once and new codes
+// are inserted in batches. Codes are created, updated or reactivated; with
+// deactivateMissing the active codes missing from the file are deactivated.
+func (s *DiagnosisService) Import(ctx context.Context, r io.Reader, deactivateMissing bool) (*diagnosis.ImportResult, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("the file has no header row")
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		// Exports from spreadsheets start with a byte order mark
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["code"]; !ok {
+		return nil, errors.New("the code column is missing")
+	}
+	_, hasRU := columns["title_ru"]
+	_, hasEN := columns["title_en"]
+	if !hasRU && !hasEN {
+		return nil, errors.New("the title_ru or title_en column is missing")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	all, err := s.codes.AllCodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*diagnosis.Code, len(all))
+	for i := range all {
+		existing[all[i].Code] = &all[i]
+	}
+
+	result := &diagnosis.ImportResult{}
+	failed := func(line int, format string, args ...interface{}) {
+		if len(result.Errors) < maxImportErrors {
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+		}
+	}
+
+	seen := map[string]bool{}
+	var codes []string
+	var created []diagnosis.Code
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			failed(line, "%v", err)
+			continue
+		}
+
+		code := diagnosis.Code{
+			Code:    diagnosis.NormalizeCode(field(record, "code")),
+			TitleRU: field(record, "title_ru"),
+			TitleEN: field(record, "title_en"),
+			Active:  true,
+		}
+		if code.Code == "" {
+			failed(line, "code is required")
+			continue
+		}
+		if !diagnosis.ValidCode(code.Code) {
+			failed(line, "invalid code %s", code.Code)
+			continue
+		}
+		if seen[code.Code] {
+			failed(line, "duplicate code %s", code.Code)
+			continue
+		}
+		seen[code.Code] = true
+		// Listed codes are kept active even when their row is invalid
+		codes = append(codes, code.Code)
+		if code.TitleRU == "" && code.TitleEN == "" {
+			failed(line, "a title is required")
+			continue
+		}
+		code.Category = code.Code[:3]
+
+		current := existing[code.Code]
+		if current == nil {
+			created = append(created, code)
+			continue
+		}
+		// A file with one language keeps the titles of the other
+		if !hasRU {
+			code.TitleRU = current.TitleRU
+		}
+		if !hasEN {
+			code.TitleEN = current.TitleEN
+		}
+		if current.TitleRU == code.TitleRU && current.TitleEN == code.TitleEN && current.Active {
+			result.Unchanged++
+			continue
+		}
+		current.TitleRU, current.TitleEN, current.Active = code.TitleRU, code.TitleEN, true
+		if err := s.codes.UpdateCode(ctx, current); err != nil {
+			failed(line, "%v", err)
+			continue
+		}
+		result.Updated++
+	}
+
+	if len(created) > 0 {
+		if err := s.codes.CreateCodes(ctx, created); err != nil {
+			return nil, err
+		}
+		result.Created = len(created)
+	}
+	if deactivateMissing {
+		if result.Deactivated, err = s.codes.DeactivateExcept(ctx, codes); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// AppointmentDoctor returns the doctor of the appointment, who may give its
+// diagnoses with the ".own" permission
+func (s *DiagnosisService) AppointmentDoctor(ctx context.Context, appointmentID uint) (uint, error) {
+	appt, err := s.appRepo.GetByID(ctx, appointmentID)
+	if err != nil {
+		return 0, err
+	}
+	return appt.DoctorID, nil
+}
+
+func (s *DiagnosisService) Get(ctx context.Context, id uint) (*diagnosis.Diagnosis, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *DiagnosisService) GetByAppointment(ctx context.Context, appointmentID uint) ([]diagnosis.Diagnosis, error) {
+	return s.repo.GetByAppointment(ctx, appointmentID)
+}
+
+// Add gives the diagnosis at the appointment, linked to its encounter note
+// when there is one. A new primary diagnosis makes the previous one
+// secondary.
+func (s *DiagnosisService) Add(ctx context.Context, actorID, appointmentID uint, input diagnosis.Input) (*diagnosis.Diagnosis, error) {
+	appt, err := s.appRepo.GetByID(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	code, err := s.activeCode(ctx, input.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	given, err := s.repo.GetByAppointment(ctx, appt.ID)
+	if err != nil {
+		return nil, err
+	}
+	kind := input.Kind
+	if kind == "" {
+		kind = diagnosis.KindPrimary
+	}
+	for _, d := range given {
+		if d.CodeID == code.ID {
+			return nil, fmt.Errorf("the appointment already has diagnosis %s", code.Code)
+		}
+		if input.Kind == "" && d.Kind == diagnosis.KindPrimary {
+			kind = diagnosis.KindSecondary
+		}
+	}
+	if err := validKind(kind); err != nil {
+		return nil, err
+	}
+
+	note, err := s.encounterRepo.GetByAppointment(ctx, appt.ID)
+	if err != nil {
+		return nil, err
+	}
+	d := &diagnosis.Diagnosis{
+		AppointmentID: appt.ID,
+		CodeID:        code.ID,
+		Code:          code.Code,
+		Kind:          kind,
+		Comment:       strings.TrimSpace(input.Comment),
+		CreatedByID:   actorID,
+		Entry:         code,
+	}
+	if note != nil {
+		d.EncounterNoteID = &note.ID
+	}
+	if err := s.repo.Create(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Update changes the kind and comment of a diagnosis; an empty kind keeps
+// the current one
+func (s *DiagnosisService) Update(ctx context.Context, id uint, kind diagnosis.Kind, comment string) (*diagnosis.Diagnosis, error) {
+	d, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if kind != "" {
+		if err := validKind(kind); err != nil {
+			return nil, err
+		}
+		d.Kind = kind
+	}
+	d.Comment = strings.TrimSpace(comment)
+	if err := s.repo.Save(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *DiagnosisService) Remove(ctx context.Context, id uint) error {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// TopDiagnoses ranks the diagnoses given in each department, ten per
+// department unless the filter asks for another number
+func (s *DiagnosisService) TopDiagnoses(ctx context.Context, filter diagnosis.ReportFilter) ([]diagnosis.TopDiagnosis, error) {
+	if filter.Limit < 1 {
+		filter.Limit = 10
+	}
+	if filter.Limit > 100 {
+		filter.Limit = 100
+	}
+	switch filter.GroupBy {
+	case "":
+		filter.GroupBy = diagnosis.GroupCode
+	case diagnosis.GroupCode, diagnosis.GroupCategory:
+	default:
+		return nil, fmt.Errorf("invalid grouping: %s", filter.GroupBy)
+	}
+	if filter.Kind != "" {
+		if err := validKind(filter.Kind); err != nil {
+			return nil, err
+		}
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, errors.New("from must be before to")
+	}
+	return s.repo.TopByDepartment(ctx, filter)
+}
+
+// activeCode looks up a code that can be given
+func (s *DiagnosisService) activeCode(ctx context.Context, value string) (*diagnosis.Code, error) {
+	code, err := s.codes.GetCodeByCode(ctx, diagnosis.NormalizeCode(value))
+	if err != nil {
+		return nil, err
+	}
+	if code == nil {
+		return nil, fmt.Errorf("unknown ICD-10 code: %s", value)
+	}
+	if !code.Active {
+		return nil, fmt.Errorf("ICD-10 code %s is no longer in use", code.Code)
+	}
+	return code, nil
+}
+
+func validKind(kind diagnosis.Kind) error {
+	switch kind {
+	case diagnosis.KindPrimary, diagnosis.KindSecondary:
+		return nil
+	}
+	return fmt.Errorf("invalid diagnosis kind: %s", kind)
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"medical-center/internal/models/doctor"
 	"medical-center/internal/repository"
@@ -14,7 +15,7 @@ func NewDoctorService(repo repository.DoctorRepository) *DoctorService {
 	return &DoctorService{repo: repo}
 }
 
-func (s *DoctorService) CreateDoctor(name string, departmentID uint) (*doctor.Doctor, error) {
+func (s *DoctorService) CreateDoctor(ctx context.Context, name string, departmentID uint) (*doctor.Doctor, error) {
 	if name == "" {
 		return nil, errors.New("doctor name cannot be empty")
 	}
@@ -25,22 +26,22 @@ func (s *DoctorService) CreateDoctor(name string, departmentID uint) (*doctor.Do
 		Available:    true,
 	}
 
-	if err := s.repo.Create(newDoctor); err != nil {
+	if err := s.repo.Create(ctx, newDoctor); err != nil {
 		return nil, err
 	}
 	return newDoctor, nil
 }
 
-func (s *DoctorService) GetDoctorByID(id uint) (*doctor.Doctor, error) {
-	return s.repo.GetByID(id)
+func (s *DoctorService) GetDoctorByID(ctx context.Context, id uint) (*doctor.Doctor, error) {
+	return s.repo.GetByID(ctx, id)
 }
 
-func (s *DoctorService) GetAllDoctors() ([]doctor.Doctor, error) {
-	return s.repo.GetAll()
+func (s *DoctorService) GetAllDoctors(ctx context.Context) ([]doctor.Doctor, error) {
+	return s.repo.GetAll(ctx)
 }
 
-func (s *DoctorService) UpdateDoctor(id uint, name string, departmentID uint) (*doctor.Doctor, error) {
-	doc, err := s.repo.GetByID(id)
+func (s *DoctorService) UpdateDoctor(ctx context.Context, id uint, name string, departmentID uint) (*doctor.Doctor, error) {
+	doc, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -48,20 +49,20 @@ func (s *DoctorService) UpdateDoctor(id uint, name string, departmentID uint) (*
 	doc.Name = name
 	doc.DepartmentID = departmentID
 
-	if err := s.repo.Update(doc); err != nil {
+	if err := s.repo.Update(ctx, doc); err != nil {
 		return nil, err
 	}
 	return doc, nil
 }
 
-func (s *DoctorService) DeleteDoctor(id uint) error {
-	return s.repo.Delete(id)
+func (s *DoctorService) DeleteDoctor(ctx context.Context, id uint) error {
+	return s.repo.Delete(ctx, id)
 }
 
-func (s *DoctorService) SetAvailability(id uint, available bool) error {
-	return s.repo.SetAvailability(id, available)
+func (s *DoctorService) SetAvailability(ctx context.Context, id uint, available bool) error {
+	return s.repo.SetAvailability(ctx, id, available)
 }
 
-func (s *DoctorService) GetAvailableDoctors() ([]doctor.Doctor, error) {
-	return s.repo.GetAvailable()
+func (s *DoctorService) GetAvailableDoctors(ctx context.Context) ([]doctor.Doctor, error) {
+	return s.repo.GetAvailable(ctx)
 }
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"medical-center/internal/models/encounter"
+	"medical-center/internal/repository"
+	"strings"
+	"time"
+)
+
+// EncounterService keeps the notes doctors write about appointments. Drafts
+// are saved as often as the client likes; signing locks a note and further
+// changes become addenda.
+type EncounterService struct {
+	repo    repository.EncounterRepository
+	appRepo repository.AppRepository
+}
+
+func NewEncounterService(repo repository.EncounterRepository, appRepo repository.AppRepository) *EncounterService {
+	return &EncounterService{repo: repo, appRepo: appRepo}
+}
+
+// DoctorOf returns the treating doctor of the appointment's note, or of the
+// appointment while it has no note
+func (s *EncounterService) DoctorOf(ctx context.Context, appointmentID uint) (uint, error) {
+	note, err := s.repo.GetByAppointment(ctx, appointmentID)
+	if err != nil {
+		return 0, err
+	}
+	if note != nil {
+		return note.DoctorID, nil
+	}
+	appt, err := s.appRepo.GetByID(ctx, appointmentID)
+	if err != nil {
+		return 0, err
+	}
+	return appt.DoctorID, nil
+}
+
+func (s *EncounterService) GetNote(ctx context.Context, appointmentID uint) (*encounter.Note, error) {
+	note, err := s.repo.GetByAppointment(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if note == nil {
+		return nil, errors.New("note not found")
+	}
+	return note, nil
+}
+
+// SaveDraft creates the note of the appointment or saves a new version of
+// it. expectedVersion is the version the caller edited, 0 for a new note.
+// Saving unchanged content does not create a version, so clients can
+// autosave on a timer.
+func (s *EncounterService) SaveDraft(ctx context.Context, authorID, appointmentID uint, content encounter.Content, expectedVersion int) (*encounter.Note, error) {
+	note, err := s.repo.GetByAppointment(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if note == nil {
+		if expectedVersion != 0 {
+			return nil, encounter.ErrVersionConflict
+		}
+		appt, err := s.appRepo.GetByID(ctx, appointmentID)
+		if err != nil {
+			return nil, err
+		}
+		if appt.AppointmentTime.After(time.Now()) {
+			return nil, errors.New("the appointment has not taken place yet")
+		}
+		note = &encounter.Note{
+			AppointmentID: appt.ID,
+			DoctorID:      appt.DoctorID,
+			PatientID:     appt.PatientID,
+			Content:       content,
+			Status:        encounter.StatusDraft,
+			Version:       1,
+			CreatedByID:   authorID,
+			UpdatedByID:   authorID,
+		}
+		if err := s.repo.Create(ctx, note); err != nil {
+			return nil, err
+		}
+		return note, nil
+	}
+
+	if note.IsSigned() {
+		return nil, encounter.ErrSigned
+	}
+	if note.Version != expectedVersion {
+		return nil, encounter.ErrVersionConflict
+	}
+	if note.Content == content {
+		return note, nil
+	}
+	note.Content = content
+	note.UpdatedByID = authorID
+	if err := s.repo.Save(ctx, note, expectedVersion); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// Sign locks the note at expectedVersion. The assessment and plan are
+// required.
+func (s *EncounterService) Sign(ctx context.Context, signerID, appointmentID uint, expectedVersion int) (*encounter.Note, error) {
+	note, err := s.GetNote(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if note.IsSigned() {
+		return nil, errors.New("note is already signed")
+	}
+	if note.Version != expectedVersion {
+		return nil, encounter.ErrVersionConflict
+	}
+	if strings.TrimSpace(note.Assessment) == "" || strings.TrimSpace(note.Plan) == "" {
+		return nil, errors.New("assessment and plan are required to sign a note")
+	}
+
+	now := time.Now()
+	note.Status = encounter.StatusSigned
+	note.SignedByID = &signerID
+	note.SignedAt = &now
+	note.UpdatedByID = signerID
+	if err := s.repo.Save(ctx, note, expectedVersion); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// AddAddendum appends text to a signed note. Drafts are edited directly.
+func (s *EncounterService) AddAddendum(ctx context.Context, authorID, appointmentID uint, text string) (*encounter.Addendum, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, errors.New("text is required")
+	}
+	note, err := s.GetNote(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if !note.IsSigned() {
+		return nil, errors.New("note is still a draft, edit it instead")
+	}
+
+	addendum := &encounter.Addendum{NoteID: note.ID, Text: text, AuthorID: authorID}
+	if err := s.repo.CreateAddendum(ctx, addendum); err != nil {
+		return nil, err
+	}
+	return addendum, nil
+}
+
+// GetVersions returns every saved version of the note, oldest first
+func (s *EncounterService) GetVersions(ctx context.Context, appointmentID uint) ([]encounter.Version, error) {
+	note, err := s.GetNote(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetVersions(ctx, note.ID)
+}
@@ -0,0 +1,577 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"medical-center/internal/models/appointment"
+	"medical-center/internal/models/department"
+	"medical-center/internal/models/doctor"
+	"medical-center/internal/models/schedule"
+	"medical-center/internal/models/user"
+	"medical-center/internal/repository"
+	"medical-center/pkg/fhir"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// appointmentLength is reported as the duration of every appointment in
+// FHIR, appointments only record when they start
+const appointmentLength = 30 * time.Minute
+
+// FHIRSearchResult is a page of the resources matching a search
+type FHIRSearchResult struct {
+	Resources []fhir.Resource
+	Total     int64
+	Page      int
+	Count     int
+}
+
+// FHIRAccess limits an appointment search to what the caller may see
+type FHIRAccess struct {
+	// Owner limits the search to the user's appointments, as the treating
+	// doctor or as the patient
+	Owner *user.User
+	// Keep filters the appointments found, e.g. by the consents given to a
+	// partner. Pages are then cut after filtering.
+	Keep func([]appointment.Appointment) []appointment.Appointment
+}
+
+// FHIRService maps departments, doctors, schedule slots and appointments to
+// FHIR R4 resources:
+//   - a department is an Organization and the HealthcareService it provides
+//   - a doctor is a Practitioner, their PractitionerRole in the department
+//     and the Schedule holding their slots, all with the doctor's ID
+//   - a schedule slot is a Slot
+type FHIRService struct {
+	departments  repository.DepartmentRepository
+	doctors      repository.DoctorRepository
+	schedules    repository.ScheduleRepository
+	appRepo      repository.AppRepository
+	appointments *AppointmentService
+}
+
+func NewFHIRService(
+	departments repository.DepartmentRepository,
+	doctors repository.DoctorRepository,
+	schedules repository.ScheduleRepository,
+	appRepo repository.AppRepository,
+	appointments *AppointmentService,
+) *FHIRService {
+	return &FHIRService{
+		departments:  departments,
+		doctors:      doctors,
+		schedules:    schedules,
+		appRepo:      appRepo,
+		appointments: appointments,
+	}
+}
+
+// paging reads _page and _count, 20 resources per page by default and 100
+// at most
+func paging(q fhir.Query) (int, int, error) {
+	page, err := q.Int("_page", 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	count, err := q.Int("_count", 20)
+	if err != nil {
+		return 0, 0, err
+	}
+	if count > 100 {
+		count = 100
+	}
+	return page, count, nil
+}
+
+// pageBounds returns the bounds of a page within n resources
+func pageBounds(n, page, count int) (int, int) {
+	start := (page - 1) * count
+	if start > n {
+		start = n
+	}
+	end := start + count
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+// matchesString is the FHIR string search: the value starts with the
+// searched text, ignoring case
+func matchesString(value, search string) bool {
+	return search == "" || strings.HasPrefix(strings.ToLower(value), strings.ToLower(search))
+}
+
+// matchesID checks the _id parameter
+func matchesID(q fhir.Query, id uint) bool {
+	ids := q.Tokens("_id")
+	if len(ids) == 0 {
+		return true
+	}
+	for _, want := range ids {
+		if want == fhirID(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *FHIRService) SearchOrganizations(ctx context.Context, q fhir.Query) (*FHIRSearchResult, error) {
+	page, count, err := paging(q)
+	if err != nil {
+		return nil, err
+	}
+	departments, err := s.departments.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []fhir.Resource
+	for _, d := range departments {
+		if matchesID(q, d.ID) && matchesString(d.Name, q.String("name")) {
+			resources = append(resources, organization(&d))
+		}
+	}
+	start, end := pageBounds(len(resources), page, count)
+	return &FHIRSearchResult{Resources: resources[start:end], Total: int64(len(resources)), Page: page, Count: count}, nil
+}
+
+func (s *FHIRService) GetOrganization(ctx context.Context, id uint) (*fhir.Organization, error) {
+	d, err := s.departments.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return organization(d), nil
+}
+
+func (s *FHIRService) SearchHealthcareServices(ctx context.Context, q fhir.Query) (*FHIRSearchResult, error) {
+	page, count, err := paging(q)
+	if err != nil {
+		return nil, err
+	}
+	organizationID, err := q.Reference("organization", "Organization")
+	if err != nil {
+		return nil, err
+	}
+	departments, err := s.departments.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []fhir.Resource
+	for _, d := range departments {
+		if organizationID != nil && d.ID != *organizationID {
+			continue
+		}
+		if matchesID(q, d.ID) && matchesString(d.Name, q.String("name")) {
+			resources = append(resources, healthcareService(&d))
+		}
+	}
+	start, end := pageBounds(len(resources), page, count)
+	return &FHIRSearchResult{Resources: resources[start:end], Total: int64(len(resources)), Page: page, Count: count}, nil
+}
+
+func (s *FHIRService) GetHealthcareService(ctx context.Context, id uint) (*fhir.HealthcareService, error) {
+	d, err := s.departments.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return healthcareService(d), nil
+}
+
+// searchDoctors returns the doctors matching _id, the practitioner
+// reference param and the organization
+func (s *FHIRService) searchDoctors(ctx context.Context, q fhir.Query, practitionerParam string) ([]doctor.Doctor, error) {
+	practitionerID, err := q.Reference(practitionerParam, "Practitioner")
+	if err != nil {
+		return nil, err
+	}
+	organizationID, err := q.Reference("organization", "Organization")
+	if err != nil {
+		return nil, err
+	}
+	active, err := q.Bool("active")
+	if err != nil {
+		return nil, err
+	}
+	doctors, err := s.doctors.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []doctor.Doctor
+	for _, d := range doctors {
+		switch {
+		case !matchesID(q, d.ID):
+		case practitionerID != nil && d.ID != *practitionerID:
+		case organizationID != nil && d.DepartmentID != *organizationID:
+		case active != nil && d.Available != *active:
+		case !matchesString(d.Name, q.String("name")):
+		default:
+			found = append(found, d)
+		}
+	}
+	return found, nil
+}
+
+func (s *FHIRService) SearchPractitioners(ctx context.Context, q fhir.Query) (*FHIRSearchResult, error) {
+	return s.searchDoctorResources(ctx, q, "", func(d *doctor.Doctor) fhir.Resource { return practitioner(d) })
+}
+
+func (s *FHIRService) SearchPractitionerRoles(ctx context.Context, q fhir.Query) (*FHIRSearchResult, error) {
+	return s.searchDoctorResources(ctx, q, "practitioner", func(d *doctor.Doctor) fhir.Resource { return practitionerRole(d) })
+}
+
+func (s *FHIRService) SearchSchedules(ctx context.Context, q fhir.Query) (*FHIRSearchResult, error) {
+	return s.searchDoctorResources(ctx, q, "actor", func(d *doctor.Doctor) fhir.Resource { return scheduleResource(d) })
+}
+
+func (s *FHIRService) searchDoctorResources(ctx context.Context, q fhir.Query, practitionerParam string, resource func(*doctor.Doctor) fhir.Resource) (*FHIRSearchResult, error) {
+	page, count, err := paging(q)
+	if err != nil {
+		return nil, err
+	}
+	doctors, err := s.searchDoctors(ctx, q, practitionerParam)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := pageBounds(len(doctors), page, count)
+	resources := make([]fhir.Resource, 0, end-start)
+	for i := start; i < end; i++ {
+		resources = append(resources, resource(&doctors[i]))
+	}
+	return &FHIRSearchResult{Resources: resources, Total: int64(len(doctors)), Page: page, Count: count}, nil
+}
+
+func (s *FHIRService) GetPractitioner(ctx context.Context, id uint) (*fhir.Practitioner, error) {
+	d, err := s.doctors.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return practitioner(d), nil
+}
+
+func (s *FHIRService) GetPractitionerRole(ctx context.Context, id uint) (*fhir.PractitionerRole, error) {
+	d, err := s.doctors.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return practitionerRole(d), nil
+}
+
+func (s *FHIRService) GetSchedule(ctx context.Context, id uint) (*fhir.Schedule, error) {
+	d, err := s.doctors.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return scheduleResource(d), nil
+}
+
+// SearchSlots supports schedule, start and status (free or busy)
+func (s *FHIRService) SearchSlots(ctx context.Context, q fhir.Query) (*FHIRSearchResult, error) {
+	filter := schedule.SearchFilter{}
+	var err error
+	if filter.Page, filter.PageSize, err = paging(q); err != nil {
+		return nil, err
+	}
+	if filter.DoctorID, err = q.Reference("schedule", "Schedule"); err != nil {
+		return nil, err
+	}
+	if filter.From, filter.To, err = q.Dates("start"); err != nil {
+		return nil, err
+	}
+	if statuses := q.Tokens("status"); len(statuses) == 1 {
+		booked := statuses[0] == fhir.SlotBusy
+		if !booked && statuses[0] != fhir.SlotFree {
+			return nil, fmt.Errorf("%w: status must be free or busy", fhir.ErrInvalidParam)
+		}
+		filter.Booked = &booked
+	}
+
+	slots, total, err := s.schedules.Search(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]fhir.Resource, 0, len(slots))
+	for i := range slots {
+		resources = append(resources, slot(&slots[i]))
+	}
+	return &FHIRSearchResult{Resources: resources, Total: total, Page: filter.Page, Count: filter.PageSize}, nil
+}
+
+func (s *FHIRService) GetSlot(ctx context.Context, id uint) (*fhir.Slot, error) {
+	sl, err := s.schedules.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return slot(sl), nil
+}
+
+// SearchAppointments supports date, practitioner and status (booked,
+// fulfilled or cancelled). An appointment that has not started yet is
+// booked, a past one fulfilled and a deleted one cancelled.
+func (s *FHIRService) SearchAppointments(ctx context.Context, q fhir.Query, access FHIRAccess) (*FHIRSearchResult, error) {
+	filter := appointment.SearchFilter{}
+	page, count, err := paging(q)
+	if err != nil {
+		return nil, err
+	}
+	if filter.DoctorID, err = q.Reference("practitioner", "Practitioner"); err != nil {
+		return nil, err
+	}
+	if filter.From, filter.To, err = q.Dates("date"); err != nil {
+		return nil, err
+	}
+	for _, status := range q.Tokens("status") {
+		switch status {
+		case fhir.AppointmentBooked:
+			filter.States = append(filter.States, appointment.StateUpcoming)
+		case fhir.AppointmentFulfilled:
+			filter.States = append(filter.States, appointment.StatePast)
+		case fhir.AppointmentCancelled:
+			filter.States = append(filter.States, appointment.StateCancelled)
+		default:
+			// No appointment has any other status
+			return &FHIRSearchResult{Page: page, Count: count}, nil
+		}
+	}
+	if access.Owner != nil {
+		filter.OwnerDoctorID = access.Owner.DoctorID
+		filter.OwnerEmail = access.Owner.Email
+	}
+	if access.Keep == nil {
+		filter.Page, filter.PageSize = page, count
+	}
+
+	appointments, total, err := s.appRepo.Search(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if access.Keep != nil {
+		appointments = access.Keep(appointments)
+		total = int64(len(appointments))
+		start, end := pageBounds(len(appointments), page, count)
+		appointments = appointments[start:end]
+	}
+
+	now := time.Now()
+	resources := make([]fhir.Resource, 0, len(appointments))
+	for i := range appointments {
+		resources = append(resources, appointmentResource(&appointments[i], now))
+	}
+	return &FHIRSearchResult{Resources: resources, Total: total, Page: page, Count: count}, nil
+}
+
+// GetAppointment returns the appointment, the caller checks access to it
+// before turning it into a resource with AppointmentResource
+func (s *FHIRService) GetAppointment(ctx context.Context, id uint) (*appointment.Appointment, error) {
+	return s.appRepo.GetByID(ctx, id)
+}
+
+func (s *FHIRService) AppointmentResource(a *appointment.Appointment) *fhir.Appointment {
+	return appointmentResource(a, time.Now())
+}
+
+// IsOwnedBy reports whether the appointment belongs to the user, see
+// AppointmentService.IsOwnedBy
+func (s *FHIRService) IsOwnedBy(a *appointment.Appointment, u *user.User) bool {
+	return s.appointments.IsOwnedBy(a, u)
+}
+
+// CreateAppointment books a FHIR Appointment through the usual booking. It
+// takes a Practitioner participant and a Patient participant, either a
+// reference to the patient index or a contained Patient with name and
+// telecom. With a Slot of the practitioner, the slot is booked as well and
+// start may be left out.
+func (s *FHIRService) CreateAppointment(ctx context.Context, in *fhir.Appointment) (*fhir.Appointment, error) {
+	if in.Status != fhir.AppointmentBooked {
+		return nil, errors.New("only appointments with status booked can be created")
+	}
+
+	practitionerRef := in.Actor("Practitioner")
+	if practitionerRef == nil {
+		return nil, errors.New("a Practitioner participant is required")
+	}
+	doctorID, err := fhir.ParseReference(practitionerRef.Reference, "Practitioner")
+	if err != nil {
+		return nil, err
+	}
+	doc, err := s.doctors.GetByID(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var patientID *uint
+	var patientName, email, phone string
+	patientRef := in.Actor("Patient")
+	switch {
+	case patientRef == nil:
+		return nil, errors.New("a Patient participant is required")
+	case strings.HasPrefix(patientRef.Reference, "#"):
+		p, _ := in.ContainedPatient(patientRef.Reference[1:])
+		if len(p.Name) > 0 {
+			patientName = p.Name[0].Display()
+		}
+		email = p.Contact("email")
+		phone = p.Contact("phone")
+	default:
+		id, err := fhir.ParseReference(patientRef.Reference, "Patient")
+		if err != nil {
+			return nil, err
+		}
+		patientID = &id
+	}
+
+	start := in.Start
+	var sl *schedule.Schedule
+	switch len(in.Slot) {
+	case 0:
+	case 1:
+		slotID, err := fhir.ParseReference(in.Slot[0].Reference, "Slot")
+		if err != nil {
+			return nil, err
+		}
+		if sl, err = s.schedules.GetByID(ctx, slotID); err != nil {
+			return nil, err
+		}
+		if sl.DoctorID != doc.ID {
+			return nil, errors.New("the slot belongs to another practitioner")
+		}
+		if start == nil {
+			start = &sl.StartTime
+		} else if !start.Equal(sl.StartTime) {
+			return nil, errors.New("start does not match the start of the slot")
+		}
+	default:
+		return nil, errors.New("an appointment takes a single slot")
+	}
+	if start == nil {
+		return nil, errors.New("start is required")
+	}
+
+	if sl != nil {
+		if err := s.schedules.BookSlot(ctx, sl.ID); err != nil {
+			return nil, err
+		}
+	}
+	appt, err := s.appointments.CreateAppointment(ctx, patientID, patientName, email, phone, doc.DepartmentID, doc.ID, *start)
+	if err != nil {
+		if sl != nil {
+			if cancelErr := s.schedules.CancelBooking(ctx, sl.ID); cancelErr != nil {
+				log.Printf("failed to release slot %d: %v", sl.ID, cancelErr)
+			}
+		}
+		return nil, err
+	}
+	return appointmentResource(appt, time.Now()), nil
+}
+
+func fhirID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func fhirMeta(updatedAt time.Time) *fhir.Meta {
+	return &fhir.Meta{LastUpdated: &updatedAt}
+}
+
+func fhirReference(resourceType string, id uint) *fhir.Reference {
+	return &fhir.Reference{Reference: resourceType + "/" + fhirID(id)}
+}
+
+func organization(d *department.Department) *fhir.Organization {
+	active := true
+	return &fhir.Organization{
+		Base:   fhir.Base{ResourceType: "Organization", ID: fhirID(d.ID), Meta: fhirMeta(d.UpdatedAt)},
+		Active: &active,
+		Name:   d.Name,
+	}
+}
+
+func healthcareService(d *department.Department) *fhir.HealthcareService {
+	active := true
+	return &fhir.HealthcareService{
+		Base:       fhir.Base{ResourceType: "HealthcareService", ID: fhirID(d.ID), Meta: fhirMeta(d.UpdatedAt)},
+		Active:     &active,
+		ProvidedBy: fhirReference("Organization", d.ID),
+		Name:       d.Name,
+	}
+}
+
+func practitioner(d *doctor.Doctor) *fhir.Practitioner {
+	active := true
+	return &fhir.Practitioner{
+		Base:   fhir.Base{ResourceType: "Practitioner", ID: fhirID(d.ID), Meta: fhirMeta(d.UpdatedAt)},
+		Active: &active,
+		Name:   []fhir.HumanName{{Text: d.Name}},
+	}
+}
+
+// practitionerRole is active while the doctor takes appointments
+func practitionerRole(d *doctor.Doctor) *fhir.PractitionerRole {
+	return &fhir.PractitionerRole{
+		Base:              fhir.Base{ResourceType: "PractitionerRole", ID: fhirID(d.ID), Meta: fhirMeta(d.UpdatedAt)},
+		Active:            &d.Available,
+		Practitioner:      &fhir.Reference{Reference: "Practitioner/" + fhirID(d.ID), Display: d.Name},
+		Organization:      fhirReference("Organization", d.DepartmentID),
+		HealthcareService: []fhir.Reference{*fhirReference("HealthcareService", d.DepartmentID)},
+	}
+}
+
+func scheduleResource(d *doctor.Doctor) *fhir.Schedule {
+	return &fhir.Schedule{
+		Base:   fhir.Base{ResourceType: "Schedule", ID: fhirID(d.ID), Meta: fhirMeta(d.UpdatedAt)},
+		Active: &d.Available,
+		Actor: []fhir.Reference{
+			{Reference: "Practitioner/" + fhirID(d.ID), Display: d.Name},
+			*fhirReference("PractitionerRole", d.ID),
+		},
+	}
+}
+
+func slot(s *schedule.Schedule) *fhir.Slot {
+	status := fhir.SlotFree
+	if s.Booked {
+		status = fhir.SlotBusy
+	}
+	return &fhir.Slot{
+		Base:     fhir.Base{ResourceType: "Slot", ID: fhirID(s.ID), Meta: fhirMeta(s.UpdatedAt)},
+		Schedule: *fhirReference("Schedule", s.DoctorID),
+		Status:   status,
+		Start:    s.StartTime,
+		End:      s.EndTime,
+	}
+}
+
+func appointmentResource(a *appointment.Appointment, now time.Time) *fhir.Appointment {
+	status := fhir.AppointmentBooked
+	switch a.State(now) {
+	case appointment.StatePast:
+		status = fhir.AppointmentFulfilled
+	case appointment.StateCancelled:
+		status = fhir.AppointmentCancelled
+	}
+
+	patientRef := &fhir.Reference{Display: a.PatientName}
+	if a.PatientID != nil {
+		patientRef.Reference = "Patient/" + fhirID(*a.PatientID)
+	}
+	start := a.AppointmentTime
+	end := start.Add(appointmentLength)
+	created := a.CreatedAt
+	return &fhir.Appointment{
+		Base:    fhir.Base{ResourceType: "Appointment", ID: fhirID(a.ID), Meta: fhirMeta(a.UpdatedAt)},
+		Status:  status,
+		Start:   &start,
+		End:     &end,
+		Created: &created,
+		Participant: []fhir.AppointmentParticipant{
+			{Actor: patientRef, Status: "accepted"},
+			{Actor: fhirReference("Practitioner", a.DoctorID), Status: "accepted"},
+			{Actor: fhirReference("HealthcareService", a.DepartmentID), Status: "accepted"},
+		},
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"medical-center/internal/models/prescription"
+	"medical-center/internal/repository"
+	"strings"
+)
+
+// maxImportErrors limits how many error messages an import result keeps
+const maxImportErrors = 20
+
+// FormularyService manages the catalogue of drugs that can be prescribed
+type FormularyService struct {
+	repo repository.FormularyRepository
+}
+
+func NewFormularyService(repo repository.FormularyRepository) *FormularyService {
+	return &FormularyService{repo: repo}
+}
+
+func (s *FormularyService) ListDrugs(ctx context.Context, filter prescription.DrugFilter) ([]prescription.Drug, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+	return s.repo.ListDrugs(ctx, filter)
+}
+
+func (s *FormularyService) GetDrug(ctx context.Context, id uint) (*prescription.Drug, error) {
+	return s.repo.GetDrug(ctx, id)
+}
+
+// Import reads a CSV catalogue with a header row. The code and name columns
+// are required; form, strength and atc_code are optional. Drugs are matched
+// by code and created, updated or reactivated. With deactivateMissing the
+// active drugs missing from the file are deactivated, which makes the file
+// the complete catalogue.
+func (s *FormularyService) Import(ctx context.Context, r io.Reader, deactivateMissing bool) (*prescription.ImportResult, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("the file has no header row")
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["code"]; !ok {
+		return nil, errors.New("the code column is missing")
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New("the name column is missing")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	result := &prescription.ImportResult{}
+	failed := func(line int, format string, args ...interface{}) {
+		if len(result.Errors) < maxImportErrors {
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+		}
+	}
+
+	seen := map[string]bool{}
+	var codes []string
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Anything but a malformed row, such as a body that is too
+			// large, leaves the file incomplete
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			failed(line, "%v", err)
+			continue
+		}
+
+		drug := prescription.Drug{
+			Code:     field(record, "code"),
+			Name:     field(record, "name"),
+			Form:     field(record, "form"),
+			Strength: field(record, "strength"),
+			ATCCode:  strings.ToUpper(field(record, "atc_code")),
+			Active:   true,
+		}
+		if drug.Code == "" {
+			failed(line, "code is required")
+			continue
+		}
+		if seen[drug.Code] {
+			failed(line, "duplicate code %s", drug.Code)
+			continue
+		}
+		seen[drug.Code] = true
+		// Listed codes are kept active even when their row is invalid
+		codes = append(codes, drug.Code)
+		if drug.Name == "" {
+			failed(line, "name is required")
+			continue
+		}
+
+		if err := s.upsert(ctx, &drug, result); err != nil {
+			failed(line, "%v", err)
+		}
+	}
+
+	if deactivateMissing {
+		if result.Deactivated, err = s.repo.DeactivateExcept(ctx, codes); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *FormularyService) upsert(ctx context.Context, drug *prescription.Drug, result *prescription.ImportResult) error {
+	existing, err := s.repo.GetDrugByCode(ctx, drug.Code)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		if err := s.repo.CreateDrug(ctx, drug); err != nil {
+			return err
+		}
+		result.Created++
+		return nil
+	}
+
+	if existing.Name == drug.Name && existing.Form == drug.Form && existing.Strength == drug.Strength &&
+		existing.ATCCode == drug.ATCCode && existing.Active {
+		result.Unchanged++
+		return nil
+	}
+	existing.Name, existing.Form, existing.Strength, existing.ATCCode = drug.Name, drug.Form, drug.Strength, drug.ATCCode
+	existing.Active = true
+	if err := s.repo.UpdateDrug(ctx, existing); err != nil {
+		return err
+	}
+	result.Updated++
+	return nil
+}
@@ -0,0 +1,608 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"medical-center/internal/models/appointment"
+	"medical-center/internal/models/hl7msg"
+	"medical-center/internal/models/patient"
+	"medical-center/internal/repository"
+	"medical-center/pkg/hl7"
+	"strings"
+	"time"
+)
+
+// maxRetryInterval caps the backoff between delivery attempts
+const maxRetryInterval = time.Hour
+
+// HL7Sender delivers an encoded message and returns the acknowledgement;
+// hl7.Client sends over MLLP
+type HL7Sender interface {
+	Send(ctx context.Context, payload []byte) ([]byte, error)
+}
+
+// HL7Config identifies both ends in MSH and sets the delivery retries
+type HL7Config struct {
+	SendingApplication   string
+	SendingFacility      string
+	ReceivingApplication string
+	ReceivingFacility    string
+	// RetryInterval is the wait after the first failed attempt, doubled
+	// after every further one
+	RetryInterval time.Duration
+	// MaxAttempts after which a message is given up as failed
+	MaxAttempts int
+}
+
+// HL7Service exchanges HL7 v2 messages with the hospital information system.
+// Appointment changes are queued as SIU messages in the message log and
+// delivered in order by Deliver; ADT messages received over MLLP create and
+// update patients. Every message in either direction is kept in the log.
+type HL7Service struct {
+	repo        repository.HL7MessageRepository
+	patients    *PatientService
+	doctors     repository.DoctorRepository
+	departments repository.DepartmentRepository
+	// sender is nil when no receiver is configured, appointment changes are
+	// not queued then
+	sender HL7Sender
+	cfg    HL7Config
+	// queued wakes the delivery loop up when a message is queued
+	queued chan struct{}
+}
+
+func NewHL7Service(
+	repo repository.HL7MessageRepository,
+	patients *PatientService,
+	doctors repository.DoctorRepository,
+	departments repository.DepartmentRepository,
+	sender HL7Sender,
+	cfg HL7Config,
+) *HL7Service {
+	return &HL7Service{
+		repo:        repo,
+		patients:    patients,
+		doctors:     doctors,
+		departments: departments,
+		sender:      sender,
+		cfg:         cfg,
+		queued:      make(chan struct{}, 1),
+	}
+}
+
+// AppointmentBooked queues an SIU^S12
+func (s *HL7Service) AppointmentBooked(ctx context.Context, a *appointment.Appointment) error {
+	return s.queueSIU(ctx, "S12", a)
+}
+
+// AppointmentModified queues an SIU^S14
+func (s *HL7Service) AppointmentModified(ctx context.Context, a *appointment.Appointment) error {
+	return s.queueSIU(ctx, "S14", a)
+}
+
+// AppointmentCancelled queues an SIU^S15
+func (s *HL7Service) AppointmentCancelled(ctx context.Context, a *appointment.Appointment) error {
+	return s.queueSIU(ctx, "S15", a)
+}
+
+func (s *HL7Service) queueSIU(ctx context.Context, event string, a *appointment.Appointment) error {
+	if s.sender == nil {
+		return nil
+	}
+	msg, err := s.buildSIU(ctx, event, a)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	entry := &hl7msg.Message{
+		Direction:     hl7msg.Outbound,
+		MessageType:   "SIU^" + event,
+		ControlID:     msg.ControlID(),
+		Status:        hl7msg.StatusPending,
+		Payload:       string(msg.Bytes()),
+		NextAttemptAt: &now,
+		AppointmentID: &a.ID,
+		PatientID:     a.PatientID,
+	}
+	if err := s.repo.Create(ctx, entry); err != nil {
+		return err
+	}
+	s.wake()
+	return nil
+}
+
+func (s *HL7Service) wake() {
+	select {
+	case s.queued <- struct{}{}:
+	default:
+	}
+}
+
+// buildSIU writes the SCH, PID, RGS, AIL and AIP segments of an appointment.
+// The patient is taken from the patient index when the appointment is
+// linked, from the booking details otherwise.
+func (s *HL7Service) buildSIU(ctx context.Context, event string, a *appointment.Appointment) (*hl7.Message, error) {
+	now := time.Now()
+	start := a.AppointmentTime
+	end := start.Add(appointmentLength)
+	minutes := fmt.Sprint(int(appointmentLength / time.Minute))
+	status, action := "Booked", "U"
+	switch event {
+	case "S12":
+		action = "A"
+	case "S15":
+		status = "Cancelled"
+	}
+
+	msg := &hl7.Message{Segments: []hl7.Segment{s.header("SIU", event, "SIU_S12", now)}}
+
+	id := fmt.Sprint(a.ID)
+	sch := hl7.NewSegment("SCH")
+	sch.Set(1, hl7.Components(id, s.cfg.SendingApplication))
+	sch.Set(2, hl7.Components(id, s.cfg.SendingApplication))
+	sch.Set(6, hl7.Components(event, status))
+	sch.Set(9, minutes)
+	sch.Set(10, "MIN")
+	sch.Set(11, hl7.Components("", "", minutes, hl7.FormatTime(start), hl7.FormatTime(end)))
+	sch.Set(25, status)
+	msg.Segments = append(msg.Segments, sch)
+
+	pid := hl7.NewSegment("PID")
+	pid.Set(1, "1")
+	name, email, phone := a.PatientName, a.Email, a.Phone
+	if a.PatientID != nil {
+		p, err := s.patients.GetPatient(ctx, *a.PatientID)
+		if err != nil {
+			return nil, err
+		}
+		identifiers := []string{hl7.Components(p.MRN, "", "", s.cfg.SendingFacility, "MR")}
+		if p.IIN != "" {
+			identifiers = append(identifiers, hl7.Components(p.IIN, "", "", "KZ", "NI"))
+		}
+		pid.Set(3, strings.Join(identifiers, "~"))
+		if p.BirthDate != nil {
+			pid.Set(7, hl7.FormatDate(*p.BirthDate))
+		}
+		name = p.FullName
+		if p.Email != "" {
+			email = p.Email
+		}
+		if p.Phone != "" {
+			phone = p.Phone
+		}
+	}
+	pid.Set(5, personName(name))
+	var telecom []string
+	if phone != "" {
+		telecom = append(telecom, hl7.Components(phone, "PRN", "PH"))
+	}
+	if email != "" {
+		telecom = append(telecom, hl7.Components("", "NET", "Internet", email))
+	}
+	pid.Set(13, strings.Join(telecom, "~"))
+	msg.Segments = append(msg.Segments, pid)
+
+	rgs := hl7.NewSegment("RGS")
+	rgs.Set(1, "1")
+	rgs.Set(2, action)
+	msg.Segments = append(msg.Segments, rgs)
+
+	if dept, err := s.departments.GetByID(ctx, a.DepartmentID); err == nil {
+		ail := hl7.NewSegment("AIL")
+		ail.Set(1, "1")
+		ail.Set(2, action)
+		ail.Set(3, hl7.Components(dept.Name, "", "", s.cfg.SendingFacility))
+		ail.Set(6, hl7.FormatTime(start))
+		ail.Set(9, minutes)
+		ail.Set(10, "MIN")
+		msg.Segments = append(msg.Segments, ail)
+	}
+
+	aip := hl7.NewSegment("AIP")
+	aip.Set(1, "1")
+	aip.Set(2, action)
+	doctorName := ""
+	if doc, err := s.doctors.GetByID(ctx, a.DoctorID); err == nil {
+		doctorName = doc.Name
+	}
+	family, given, middle := splitName(doctorName)
+	aip.Set(3, hl7.Components(fmt.Sprint(a.DoctorID), family, given, middle))
+	aip.Set(4, hl7.Components("D", "Doctor"))
+	aip.Set(6, hl7.FormatTime(start))
+	aip.Set(9, minutes)
+	aip.Set(10, "MIN")
+	msg.Segments = append(msg.Segments, aip)
+
+	return msg, nil
+}
+
+// header writes the MSH of a message from this application
+func (s *HL7Service) header(code, event, structure string, now time.Time) hl7.Segment {
+	msh := hl7.NewSegment("MSH")
+	msh.Set(3, hl7.Escape(s.cfg.SendingApplication))
+	msh.Set(4, hl7.Escape(s.cfg.SendingFacility))
+	msh.Set(5, hl7.Escape(s.cfg.ReceivingApplication))
+	msh.Set(6, hl7.Escape(s.cfg.ReceivingFacility))
+	msh.Set(7, hl7.FormatTime(now))
+	msh.Set(9, hl7.Components(code, event, structure))
+	msh.Set(10, newControlID())
+	msh.Set(11, "P")
+	msh.Set(12, hl7.Version)
+	return msh
+}
+
+// Run delivers queued messages every interval, and as soon as one is
+// queued, until ctx is cancelled. Only one instance of the application
+// should run it, or messages may be sent twice.
+func (s *HL7Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Deliver(ctx); err != nil {
+			log.Printf("hl7 delivery failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.queued:
+		}
+	}
+}
+
+// Deliver sends the pending messages in the order they were queued. A
+// message waiting for a retry holds back the ones after it, so that the
+// receiver never sees a modification before the booking. AA and CA mark a
+// message sent; AR and CR fail it at once, as sending it again would not
+// help; AE, CE, a missing acknowledgement and connection errors are retried
+// with backoff until MaxAttempts.
+func (s *HL7Service) Deliver(ctx context.Context) error {
+	if s.sender == nil {
+		return nil
+	}
+	for ctx.Err() == nil {
+		m, err := s.repo.NextPending(ctx)
+		if err != nil || m == nil {
+			return err
+		}
+		now := time.Now()
+		if m.NextAttemptAt != nil && m.NextAttemptAt.After(now) {
+			return nil
+		}
+
+		m.Attempts++
+		ack, sendErr := s.sender.Send(ctx, []byte(m.Payload))
+		retry := true
+		if sendErr == nil {
+			m.Ack = string(ack)
+			code, text, err := hl7.ReadACK(ack)
+			switch {
+			case err != nil:
+				sendErr = err
+			case code == hl7.AckAccept || code == hl7.AckCommitAccept:
+				m.AckCode, m.LastError = code, ""
+				retry = false
+			case code == hl7.AckReject || code == hl7.AckCommitReject:
+				m.AckCode = code
+				sendErr = fmt.Errorf("rejected: %s", text)
+				retry = false
+			default:
+				m.AckCode = code
+				sendErr = fmt.Errorf("error %s: %s", code, text)
+			}
+		}
+
+		switch {
+		case sendErr == nil:
+			m.Status, m.CompletedAt, m.NextAttemptAt = hl7msg.StatusSent, &now, nil
+		case !retry || m.Attempts >= s.cfg.MaxAttempts:
+			m.Status, m.LastError, m.CompletedAt, m.NextAttemptAt = hl7msg.StatusFailed, sendErr.Error(), &now, nil
+		default:
+			next := now.Add(s.retryInterval(m.Attempts))
+			m.LastError, m.NextAttemptAt = sendErr.Error(), &next
+		}
+		if err := s.repo.Save(ctx, m); err != nil {
+			return err
+		}
+		if m.Status == hl7msg.StatusPending {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *HL7Service) retryInterval(attempts int) time.Duration {
+	interval := s.cfg.RetryInterval
+	for i := 1; i < attempts && interval < maxRetryInterval; i++ {
+		interval *= 2
+	}
+	return min(interval, maxRetryInterval)
+}
+
+// Receive handles a message received over MLLP and returns the encoded
+// acknowledgement. ADT^A04 registers a patient, or updates the one with the
+// same MRN or IIN; ADT^A08 updates a known patient. Messages that cannot be
+// parsed or are of another type are rejected with AR, messages that cannot
+// be applied get AE.
+func (s *HL7Service) Receive(ctx context.Context, payload []byte) []byte {
+	_, ack, err := s.receive(ctx, payload, nil)
+	if err != nil {
+		// The sender retries a message that was not acknowledged, so it is
+		// refused rather than applied without a trace
+		log.Printf("hl7 message log write failed: %v", err)
+	}
+	return ack.Bytes()
+}
+
+// receive applies the message and logs it with its acknowledgement. When
+// the log cannot be written the acknowledgement is changed to AE.
+func (s *HL7Service) receive(ctx context.Context, payload []byte, replayOf *uint) (*hl7msg.Message, *hl7.Message, error) {
+	now := time.Now()
+	entry := &hl7msg.Message{
+		Direction:   hl7msg.Inbound,
+		Payload:     string(payload),
+		ReplayOfID:  replayOf,
+		Attempts:    1,
+		CompletedAt: &now,
+	}
+
+	code := hl7.AckAccept
+	var procErr error
+	msg, err := hl7.Parse(payload)
+	if err != nil {
+		code, procErr = hl7.AckReject, err
+	} else {
+		msgCode, event := msg.Type()
+		entry.MessageType = msgCode + "^" + event
+		entry.ControlID = msg.ControlID()
+
+		var p *patient.Patient
+		switch {
+		case msgCode == "ADT" && (event == "A04" || event == "A08"):
+			p, procErr = s.applyADT(ctx, msg, event == "A04")
+			if procErr != nil {
+				code = hl7.AckError
+			}
+		default:
+			code, procErr = hl7.AckReject, fmt.Errorf("unsupported message type %s", entry.MessageType)
+		}
+		if p != nil {
+			entry.PatientID = &p.ID
+		}
+	}
+
+	text := ""
+	entry.Status = hl7msg.StatusProcessed
+	if procErr != nil {
+		text = procErr.Error()
+		entry.Status, entry.LastError = hl7msg.StatusRejected, text
+	}
+	ack := hl7.NewACK(msg, code, text, newControlID(), now)
+	entry.Ack, entry.AckCode = string(ack.Bytes()), code
+
+	if entry.MessageType == "" {
+		entry.MessageType = "unknown"
+	}
+	if err := s.repo.Create(ctx, entry); err != nil {
+		return nil, hl7.NewACK(msg, hl7.AckError, "message could not be logged", newControlID(), now), err
+	}
+	return entry, ack, nil
+}
+
+// applyADT creates or updates the patient of the PID segment. The patient
+// is looked up by our MRN first, then by IIN. Fields the message leaves
+// empty are kept, "" clears the email and phone.
+func (s *HL7Service) applyADT(ctx context.Context, msg *hl7.Message, register bool) (*patient.Patient, error) {
+	pid := msg.Segment("PID")
+	if pid == nil {
+		return nil, errors.New("PID segment is missing")
+	}
+
+	var mrn, iin string
+	for _, rep := range pid.Repetitions(3) {
+		switch hl7.ComponentOf(rep, 5) {
+		case "MR":
+			// Only our own MRNs, the HIS numbers its patients differently
+			if hl7.ComponentOf(rep, 4) == s.cfg.SendingFacility {
+				mrn = hl7.ComponentOf(rep, 1)
+			}
+		case "NI":
+			iin = hl7.ComponentOf(rep, 1)
+		}
+	}
+
+	existing, err := s.findPatient(ctx, mrn, iin)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil && mrn != "" {
+		return nil, fmt.Errorf("unknown MRN %s", mrn)
+	}
+	if existing == nil && !register {
+		return nil, errors.New("unknown patient")
+	}
+
+	dto := patient.PatientDTO{IIN: iin}
+	if existing != nil {
+		dto = patient.PatientDTO{
+			FullName:  existing.FullName,
+			Email:     existing.Email,
+			Phone:     existing.Phone,
+			IIN:       existing.IIN,
+			BirthDate: existing.BirthDate,
+			UserID:    existing.UserID,
+		}
+		if iin != "" {
+			dto.IIN = iin
+		}
+	}
+
+	if name := joinName(pid.Repetitions(5)); name != "" {
+		dto.FullName = name
+	}
+	if dob := pid.Field(7); dob != "" {
+		t, err := hl7.ParseTime(dob)
+		if err != nil {
+			return nil, fmt.Errorf("PID-7: %v", err)
+		}
+		date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		dto.BirthDate = &date
+	}
+	if pid.Field(13) == `""` {
+		dto.Email, dto.Phone = "", ""
+	}
+	for _, rep := range pid.Repetitions(13) {
+		value := hl7.ComponentOf(rep, 4)
+		if hl7.ComponentOf(rep, 2) == "NET" || hl7.ComponentOf(rep, 3) == "Internet" {
+			if value == "" {
+				value = hl7.ComponentOf(rep, 1)
+			}
+			dto.Email = value
+			continue
+		}
+		if value = hl7.ComponentOf(rep, 1); value == "" {
+			value = hl7.ComponentOf(rep, 12)
+		}
+		if value != "" {
+			dto.Phone = value
+		}
+	}
+
+	if existing == nil {
+		return s.patients.CreatePatient(ctx, dto)
+	}
+	return s.patients.UpdatePatient(ctx, existing.ID, dto)
+}
+
+// findPatient returns the patient with the MRN, or with the IIN, resolving
+// merged patients to the one they were merged into
+func (s *HL7Service) findPatient(ctx context.Context, mrn, iin string) (*patient.Patient, error) {
+	filters := []patient.Filter{}
+	if mrn != "" {
+		filters = append(filters, patient.Filter{MRN: mrn})
+	}
+	if iin != "" {
+		filters = append(filters, patient.Filter{IIN: iin})
+	}
+	for _, filter := range filters {
+		filter.Page, filter.PageSize = 1, 1
+		found, _, err := s.patients.ListPatients(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) > 0 {
+			return s.patients.Resolve(ctx, found[0].ID)
+		}
+	}
+	return nil, nil
+}
+
+func (s *HL7Service) ListMessages(ctx context.Context, filter hl7msg.Filter) ([]hl7msg.Message, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+	return s.repo.List(ctx, filter)
+}
+
+func (s *HL7Service) GetMessage(ctx context.Context, id uint) (*hl7msg.Message, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// Replay logs the message again as a new entry linked to the original. An
+// outbound message is queued for delivery with a new control ID, so that
+// the receiver does not drop it as a duplicate; an inbound one is applied
+// again and its acknowledgement logged.
+func (s *HL7Service) Replay(ctx context.Context, id uint) (*hl7msg.Message, error) {
+	original, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if original.Direction == hl7msg.Inbound {
+		replay, _, err := s.receive(ctx, []byte(original.Payload), &original.ID)
+		return replay, err
+	}
+
+	if s.sender == nil {
+		return nil, errors.New("no HL7 receiver is configured")
+	}
+	msg, err := hl7.Parse([]byte(original.Payload))
+	if err != nil {
+		return nil, err
+	}
+	msg.Segments[0].Set(7, hl7.FormatTime(time.Now()))
+	msg.Segments[0].Set(10, newControlID())
+
+	now := time.Now()
+	replay := &hl7msg.Message{
+		Direction:     hl7msg.Outbound,
+		MessageType:   original.MessageType,
+		ControlID:     msg.ControlID(),
+		Status:        hl7msg.StatusPending,
+		Payload:       string(msg.Bytes()),
+		NextAttemptAt: &now,
+		AppointmentID: original.AppointmentID,
+		PatientID:     original.PatientID,
+		ReplayOfID:    &original.ID,
+	}
+	if err := s.repo.Create(ctx, replay); err != nil {
+		return nil, err
+	}
+	s.wake()
+	return replay, nil
+}
+
+// newControlID returns a random MSH-10, unique across restarts
+func newControlID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprint(time.Now().UnixNano())
+	}
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+// personName writes a full name as an XPN. Names are kept as "family given
+// middle" in the patient index, which is the order of the components.
+func personName(fullName string) string {
+	family, given, middle := splitName(fullName)
+	return hl7.Components(family, given, middle)
+}
+
+func splitName(fullName string) (family, given, middle string) {
+	parts := strings.Fields(fullName)
+	switch len(parts) {
+	case 0:
+	case 1:
+		family = parts[0]
+	case 2:
+		family, given = parts[0], parts[1]
+	default:
+		family, given, middle = parts[0], parts[1], strings.Join(parts[2:], " ")
+	}
+	return family, given, middle
+}
+
+// joinName reads the first XPN as "family given middle"
+func joinName(reps []string) string {
+	if len(reps) == 0 {
+		return ""
+	}
+	var parts []string
+	for c := 1; c <= 3; c++ {
+		if part := hl7.ComponentOf(reps[0], c); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
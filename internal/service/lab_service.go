@@ -0,0 +1,609 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"medical-center/internal/models/lab"
+	"medical-center/internal/models/user"
+	"medical-center/internal/repository"
+	"medical-center/pkg/mailer"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dropSettleTime is how long a dropped file must stay unmodified before it
+// is read, so that files still being copied are left alone
+const dropSettleTime = 10 * time.Second
+
+// LabService handles lab orders from the test catalogue to the results
+type LabService struct {
+	tests    repository.LabTestRepository
+	orders   repository.LabOrderRepository
+	appRepo  repository.AppRepository
+	userRepo repository.UserRepository
+	mailer   mailer.Mailer
+}
+
+func NewLabService(
+	tests repository.LabTestRepository,
+	orders repository.LabOrderRepository,
+	appRepo repository.AppRepository,
+	userRepo repository.UserRepository,
+	m mailer.Mailer,
+) *LabService {
+	return &LabService{tests: tests, orders: orders, appRepo: appRepo, userRepo: userRepo, mailer: m}
+}
+
+func (s *LabService) ListTests(ctx context.Context, filter lab.TestFilter) ([]lab.Test, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+	return s.tests.List(ctx, filter)
+}
+
+func (s *LabService) GetTest(ctx context.Context, id uint) (*lab.Test, error) {
+	return s.tests.GetByID(ctx, id)
+}
+
+func (s *LabService) CreateTest(ctx context.Context, test *lab.Test) error {
+	if err := s.checkTest(ctx, test, 0); err != nil {
+		return err
+	}
+	test.ID = 0
+	return s.tests.Create(ctx, test)
+}
+
+// UpdateTest replaces the test. Orders keep the code, name and reference
+// range the test had when they were placed or resulted.
+func (s *LabService) UpdateTest(ctx context.Context, id uint, input *lab.Test) (*lab.Test, error) {
+	test, err := s.tests.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkTest(ctx, input, id); err != nil {
+		return nil, err
+	}
+	test.Code, test.Name, test.Specimen, test.Unit = input.Code, input.Name, input.Specimen, input.Unit
+	test.RefLow, test.RefHigh, test.RefText = input.RefLow, input.RefHigh, input.RefText
+	test.Active = input.Active
+	if err := s.tests.Update(ctx, test); err != nil {
+		return nil, err
+	}
+	return test, nil
+}
+
+func (s *LabService) checkTest(ctx context.Context, test *lab.Test, id uint) error {
+	test.Code = strings.TrimSpace(test.Code)
+	test.Name = strings.TrimSpace(test.Name)
+	test.Specimen = strings.TrimSpace(test.Specimen)
+	test.Unit = strings.TrimSpace(test.Unit)
+	test.RefText = strings.TrimSpace(test.RefText)
+	switch {
+	case test.Code == "":
+		return errors.New("code is required")
+	case test.Name == "":
+		return errors.New("name is required")
+	case test.RefLow != nil && test.RefHigh != nil && *test.RefLow > *test.RefHigh:
+		return errors.New("ref_low must not be above ref_high")
+	case test.RefText != "" && (test.RefLow != nil || test.RefHigh != nil):
+		return errors.New("a test has either a numeric or a text reference range")
+	}
+
+	existing, err := s.tests.GetByCode(ctx, test.Code)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != id {
+		return fmt.Errorf("a test with code %s already exists", test.Code)
+	}
+	return nil
+}
+
+// AppointmentDoctor returns the doctor of the appointment, who may order
+// its tests with the ".own" permission
+func (s *LabService) AppointmentDoctor(ctx context.Context, appointmentID uint) (uint, error) {
+	appt, err := s.appRepo.GetByID(ctx, appointmentID)
+	if err != nil {
+		return 0, err
+	}
+	return appt.DoctorID, nil
+}
+
+// CreateOrder orders the tests for the appointment on behalf of the doctor
+// doctorID, who is notified of the results
+func (s *LabService) CreateOrder(ctx context.Context, actorID, doctorID, appointmentID uint, testIDs []uint, notes string) (*lab.Order, error) {
+	appt, err := s.appRepo.GetByID(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(testIDs) == 0 {
+		return nil, errors.New("at least one test is required")
+	}
+
+	seen := map[uint]bool{}
+	results := make([]lab.Result, 0, len(testIDs))
+	for _, id := range testIDs {
+		if seen[id] {
+			return nil, fmt.Errorf("test %d is ordered twice", id)
+		}
+		seen[id] = true
+		test, err := s.tests.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !test.Active {
+			return nil, fmt.Errorf("%s is no longer in the catalogue", test.Name)
+		}
+		results = append(results, lab.Result{TestID: test.ID, TestCode: test.Code, TestName: test.Name, Unit: test.Unit})
+	}
+
+	order := &lab.Order{
+		AppointmentID: appt.ID,
+		PatientID:     appt.PatientID,
+		DoctorID:      doctorID,
+		Status:        lab.StatusOrdered,
+		Notes:         strings.TrimSpace(notes),
+		OrderedByID:   actorID,
+		Results:       results,
+	}
+	if err := s.orders.Create(ctx, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (s *LabService) GetOrder(ctx context.Context, id uint) (*lab.Order, error) {
+	return s.orders.GetByID(ctx, id)
+}
+
+func (s *LabService) GetByAppointment(ctx context.Context, appointmentID uint) ([]lab.Order, error) {
+	return s.orders.GetByAppointment(ctx, appointmentID)
+}
+
+func (s *LabService) ListOrders(ctx context.Context, filter lab.OrderFilter) ([]lab.Order, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+	return s.orders.List(ctx, filter)
+}
+
+// Collect records that the specimen was taken. actorID is nil when a
+// service account reports it.
+func (s *LabService) Collect(ctx context.Context, actorID *uint, id uint) (*lab.Order, error) {
+	order, err := s.orders.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != lab.StatusOrdered {
+		return nil, fmt.Errorf("a %s order cannot be collected", order.Status)
+	}
+
+	now := time.Now()
+	order.Status = lab.StatusCollected
+	order.CollectedAt = &now
+	order.CollectedByID = actorID
+	if err := s.orders.Save(ctx, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// Cancel withdraws an order that is not resulted yet. A reason is required
+// once the specimen was collected.
+func (s *LabService) Cancel(ctx context.Context, actorID, id uint, reason string) (*lab.Order, error) {
+	order, err := s.orders.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	reason = strings.TrimSpace(reason)
+	switch order.Status {
+	case lab.StatusOrdered:
+	case lab.StatusCollected:
+		if reason == "" {
+			return nil, errors.New("a reason is required to cancel a collected order")
+		}
+	default:
+		return nil, fmt.Errorf("a %s order cannot be cancelled", order.Status)
+	}
+
+	now := time.Now()
+	order.Status = lab.StatusCancelled
+	order.CancelledAt = &now
+	order.CancelledByID = &actorID
+	order.CancelReason = reason
+	if err := s.orders.Save(ctx, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// History returns the results of the patient, newest first, optionally of a
+// single test
+func (s *LabService) History(ctx context.Context, patientID uint, testCode string) ([]lab.HistoryEntry, error) {
+	return s.orders.GetHistory(ctx, patientID, strings.TrimSpace(testCode))
+}
+
+// resultRow is a result to record, label locates it in error messages
+type resultRow struct {
+	label string
+	input lab.ResultInput
+}
+
+// EnterResults records results of the order typed in by hand
+func (s *LabService) EnterResults(ctx context.Context, actorID *uint, orderID uint, inputs []lab.ResultInput) *lab.IngestReport {
+	rows := make([]resultRow, len(inputs))
+	for i, input := range inputs {
+		input.OrderID = orderID
+		rows[i] = resultRow{label: fmt.Sprintf("result %d", i+1), input: input}
+	}
+	report := &lab.IngestReport{}
+	s.record(ctx, actorID, lab.SourceManual, rows, report)
+	return report
+}
+
+// IngestJSON records the results of a JSON document of the form
+// {"results": [{"order_id": 1, "test_code": "HGB", "value": "13.5", ...}]}
+func (s *LabService) IngestJSON(ctx context.Context, actorID *uint, source lab.Source, r io.Reader) (*lab.IngestReport, error) {
+	var doc struct {
+		Results []lab.ResultInput `json:"results"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	rows := make([]resultRow, len(doc.Results))
+	for i, input := range doc.Results {
+		rows[i] = resultRow{label: fmt.Sprintf("result %d", i+1), input: input}
+	}
+	report := &lab.IngestReport{}
+	s.record(ctx, actorID, source, rows, report)
+	return report, nil
+}
+
+// IngestCSV records the results of a CSV file with a header row. The
+// order_id, test_code and value columns are required; unit, ref_low,
+// ref_high, ref_text, comment and resulted_at (RFC 3339) are optional. The
+// whole file is read before anything is recorded.
+func (s *LabService) IngestCSV(ctx context.Context, actorID *uint, source lab.Source, r io.Reader) (*lab.IngestReport, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("the file has no header row")
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"order_id", "test_code", "value"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("the %s column is missing", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	number := func(record []string, name string) (*float64, error) {
+		value := field(record, name)
+		if value == "" {
+			return nil, nil
+		}
+		n, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a number", name)
+		}
+		return &n, nil
+	}
+
+	report := &lab.IngestReport{}
+	var rows []resultRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		label := fmt.Sprintf("line %d", line)
+		if err != nil {
+			// Anything but a malformed row leaves the file incomplete
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			rejectResult(report, label, err)
+			continue
+		}
+
+		input := lab.ResultInput{
+			TestCode: field(record, "test_code"),
+			Value:    field(record, "value"),
+			Unit:     field(record, "unit"),
+			RefText:  field(record, "ref_text"),
+			Comment:  field(record, "comment"),
+		}
+		orderID, err := strconv.ParseUint(field(record, "order_id"), 10, 64)
+		if err != nil {
+			rejectResult(report, label, errors.New("order_id is not a valid ID"))
+			continue
+		}
+		input.OrderID = uint(orderID)
+		if input.RefLow, err = number(record, "ref_low"); err != nil {
+			rejectResult(report, label, err)
+			continue
+		}
+		if input.RefHigh, err = number(record, "ref_high"); err != nil {
+			rejectResult(report, label, err)
+			continue
+		}
+		if value := field(record, "resulted_at"); value != "" {
+			resultedAt, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				rejectResult(report, label, errors.New("resulted_at is not an RFC 3339 time"))
+				continue
+			}
+			input.ResultedAt = &resultedAt
+		}
+		rows = append(rows, resultRow{label: label, input: input})
+	}
+
+	s.record(ctx, actorID, source, rows, report)
+	return report, nil
+}
+
+// record stores the rows one by one, a rejected row does not stop the
+// others. The ordering doctor of every order that received results is then
+// notified once.
+func (s *LabService) record(ctx context.Context, actorID *uint, source lab.Source, rows []resultRow, report *lab.IngestReport) {
+	orders := map[uint]*lab.Order{}
+	tests := map[uint]*lab.Test{}
+	received := map[uint][]lab.Result{}
+	var notifyOrder []uint
+
+	for _, row := range rows {
+		order, ok := orders[row.input.OrderID]
+		if !ok {
+			var err error
+			if order, err = s.orders.GetByID(ctx, row.input.OrderID); err != nil {
+				rejectResult(report, row.label, fmt.Errorf("order %d: %w", row.input.OrderID, err))
+				continue
+			}
+			orders[order.ID] = order
+		}
+
+		result, err := s.recordOne(ctx, actorID, source, order, tests, row.input)
+		if err != nil {
+			rejectResult(report, row.label, err)
+			continue
+		}
+		report.Accepted++
+		if len(received[order.ID]) == 0 {
+			notifyOrder = append(notifyOrder, order.ID)
+		}
+		received[order.ID] = append(received[order.ID], *result)
+		if order.Status == lab.StatusResulted {
+			report.Completed = append(report.Completed, order.ID)
+		}
+	}
+
+	for _, id := range notifyOrder {
+		s.notifyResults(ctx, orders[id], received[id])
+	}
+}
+
+func (s *LabService) recordOne(ctx context.Context, actorID *uint, source lab.Source, order *lab.Order, tests map[uint]*lab.Test, input lab.ResultInput) (*lab.Result, error) {
+	switch order.Status {
+	case lab.StatusOrdered:
+		return nil, fmt.Errorf("the specimen of order %d has not been collected", order.ID)
+	case lab.StatusResulted:
+		return nil, fmt.Errorf("order %d already has all its results", order.ID)
+	case lab.StatusCancelled:
+		return nil, fmt.Errorf("order %d is cancelled", order.ID)
+	}
+
+	code := strings.TrimSpace(input.TestCode)
+	var row *lab.Result
+	for i := range order.Results {
+		if strings.EqualFold(order.Results[i].TestCode, code) {
+			row = &order.Results[i]
+			break
+		}
+	}
+	if row == nil {
+		return nil, fmt.Errorf("%s was not ordered on order %d", code, order.ID)
+	}
+	value := strings.TrimSpace(input.Value)
+	if value == "" {
+		return nil, fmt.Errorf("%s of order %d has no value", row.TestCode, order.ID)
+	}
+
+	test, ok := tests[row.TestID]
+	if !ok {
+		var err error
+		if test, err = s.tests.GetByID(ctx, row.TestID); err != nil {
+			return nil, err
+		}
+		tests[test.ID] = test
+	}
+
+	result := *row
+	result.Value = value
+	result.Unit = strings.TrimSpace(input.Unit)
+	if result.Unit == "" {
+		result.Unit = test.Unit
+	}
+	result.RefLow, result.RefHigh, result.RefText = input.RefLow, input.RefHigh, strings.TrimSpace(input.RefText)
+	// The catalogue range only applies to values in the catalogue unit
+	if result.RefLow == nil && result.RefHigh == nil && result.RefText == "" && strings.EqualFold(result.Unit, test.Unit) {
+		result.RefLow, result.RefHigh, result.RefText = test.RefLow, test.RefHigh, test.RefText
+	}
+	result.Comment = strings.TrimSpace(input.Comment)
+	result.Source = source
+	result.EnteredByID = actorID
+	resultedAt := time.Now()
+	if input.ResultedAt != nil && input.ResultedAt.Before(resultedAt) {
+		resultedAt = *input.ResultedAt
+	}
+	result.ResultedAt = &resultedAt
+	result.Evaluate()
+
+	completed, err := s.orders.RecordResult(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	*row = result
+	if completed {
+		order.Status = lab.StatusResulted
+	}
+	return &result, nil
+}
+
+// notifyResults emails the accounts of the ordering doctor. The message
+// leaves out the patient and the values, which are only shown after login.
+func (s *LabService) notifyResults(ctx context.Context, order *lab.Order, received []lab.Result) {
+	doctorID := order.DoctorID
+	users, _, err := s.userRepo.List(ctx, user.ListFilter{DoctorID: &doctorID, Status: user.StatusActive, Page: 1, PageSize: 10})
+	if err != nil {
+		log.Printf("failed to find the accounts of doctor %d: %v", doctorID, err)
+		return
+	}
+
+	abnormal := 0
+	for i := range received {
+		if received[i].IsAbnormal() {
+			abnormal++
+		}
+	}
+	pending := 0
+	for i := range order.Results {
+		if order.Results[i].ResultedAt == nil {
+			pending++
+		}
+	}
+	summary := "All results of the order are in."
+	if pending > 0 {
+		summary = fmt.Sprintf("%d result(s) are still pending.", pending)
+	}
+	if abnormal > 0 {
+		summary += fmt.Sprintf(" %d of the new results are outside the reference range.", abnormal)
+	}
+
+	for _, u := range users {
+		msg := mailer.Message{
+			To:      u.Email,
+			Subject: fmt.Sprintf("Lab results for order #%d", order.ID),
+			Purpose: mailer.PurposeStaff,
+			Body: fmt.Sprintf("Hello %s,\n\n%d new result(s) arrived for lab order #%d of appointment #%d. %s\n",
+				u.Name, len(received), order.ID, order.AppointmentID, summary),
+		}
+		if err := s.mailer.Send(msg); err != nil {
+			log.Printf("failed to send lab results notification to user %d: %v", u.ID, err)
+		}
+	}
+}
+
+func rejectResult(report *lab.IngestReport, label string, err error) {
+	report.Rejected++
+	if len(report.Errors) < maxImportErrors {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", label, err))
+	}
+}
+
+// WatchDropDir ingests the files dropped in dir every interval until ctx is
+// cancelled
+func (s *LabService) WatchDropDir(ctx context.Context, dir string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.ScanDropDir(ctx, dir); err != nil {
+				log.Printf("lab drop directory scan failed: %v", err)
+			}
+		}
+	}
+}
+
+// ScanDropDir ingests the .csv and .json files of dir. A file is moved to
+// dir/processed with its report once ingested, or to dir/failed with the
+// error when it cannot be read. Files modified in the last few seconds are
+// left for the next scan.
+func (s *LabService) ScanDropDir(ctx context.Context, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, sub := range []string{"processed", "failed"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o750); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || (ext != ".csv" && ext != ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < dropSettleTime {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		report, err := s.ingestFile(ctx, path, ext)
+		// Prefixing the time keeps files dropped twice under the same name
+		target := time.Now().UTC().Format("20060102T150405Z") + "_" + entry.Name()
+		var note []byte
+		if err != nil {
+			target = filepath.Join(dir, "failed", target)
+			note = []byte(err.Error() + "\n")
+			log.Printf("lab results file %s failed: %v", entry.Name(), err)
+		} else {
+			target = filepath.Join(dir, "processed", target)
+			note, _ = json.MarshalIndent(report, "", "  ")
+			log.Printf("lab results file %s: %d accepted, %d rejected", entry.Name(), report.Accepted, report.Rejected)
+		}
+
+		if err := os.Rename(path, target); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target+".report", note, 0o640); err != nil {
+			log.Printf("failed to write the report of %s: %v", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (s *LabService) ingestFile(ctx context.Context, path, ext string) (*lab.IngestReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if ext == ".json" {
+		return s.IngestJSON(ctx, nil, lab.SourceFile, f)
+	}
+	return s.IngestCSV(ctx, nil, lab.SourceFile, f)
+}
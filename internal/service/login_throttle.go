@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"medical-center/internal/repository"
+	"strings"
+	"time"
+)
+
+type LoginThrottleConfig struct {
+	// Failures allowed before progressive delays kick in
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// Failures after which an account or a client IP is locked out
+	MaxAccountFailures int
+	MaxIPFailures      int
+	LockoutDuration    time.Duration
+	// Failures older than this window no longer count
+	FailureWindow time.Duration
+}
+
+// LoginThrottledError is returned by Login while an account or IP has to wait
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("too many failed login attempts, locked for %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+type loginThrottle struct {
+	repo repository.LoginAttemptRepository
+	cfg  LoginThrottleConfig
+}
+
+func newLoginThrottle(repo repository.LoginAttemptRepository, cfg LoginThrottleConfig) *loginThrottle {
+	if cfg.FreeAttempts == 0 {
+		cfg.FreeAttempts = 2
+	}
+	if cfg.BaseDelay == 0 {
+		cfg.BaseDelay = time.Second
+	}
+	if cfg.MaxDelay == 0 {
+		cfg.MaxDelay = time.Minute
+	}
+	if cfg.MaxAccountFailures == 0 {
+		cfg.MaxAccountFailures = 5
+	}
+	if cfg.MaxIPFailures == 0 {
+		cfg.MaxIPFailures = 20
+	}
+	if cfg.LockoutDuration == 0 {
+		cfg.LockoutDuration = 15 * time.Minute
+	}
+	if cfg.FailureWindow == 0 {
+		cfg.FailureWindow = 15 * time.Minute
+	}
+	return &loginThrottle{repo: repo, cfg: cfg}
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// check returns a LoginThrottledError if any of the keys is locked or still
+// within its progressive delay
+func (t *loginThrottle) check(ctx context.Context, keys ...string) error {
+	now := time.Now()
+	for _, key := range keys {
+		attempt, err := t.repo.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if attempt == nil {
+			continue
+		}
+
+		// A lockout holds for its full duration, however long ago the last
+		// failure was
+		if attempt.IsLocked(now) {
+			return &LoginThrottledError{RetryAfter: attempt.LockedUntil.Sub(now), Locked: true}
+		}
+		if attempt.LockedUntil != nil || attempt.LastFailedAt.Before(now.Add(-t.cfg.FailureWindow)) {
+			// An expired lockout starts the count over on the next failure
+			continue
+		}
+
+		retryAt := attempt.LastFailedAt.Add(t.delay(attempt.Failures))
+		if now.Before(retryAt) {
+			return &LoginThrottledError{RetryAfter: retryAt.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// delay doubles with every failure past the free attempts
+func (t *loginThrottle) delay(failures int) time.Duration {
+	extra := failures - t.cfg.FreeAttempts
+	if extra <= 0 {
+		return 0
+	}
+	d := t.cfg.BaseDelay
+	for i := 1; i < extra && d < t.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > t.cfg.MaxDelay {
+		d = t.cfg.MaxDelay
+	}
+	return d
+}
+
+// recordFailure counts a failure and locks the key once it reaches max.
+// It returns the lockout expiry when this failure triggered a lockout.
+func (t *loginThrottle) recordFailure(ctx context.Context, key string, max int) (*time.Time, error) {
+	now := time.Now()
+	attempt, err := t.repo.RecordFailure(ctx, key, now, now.Add(-t.cfg.FailureWindow))
+	if err != nil {
+		return nil, err
+	}
+	if attempt.Failures < max || attempt.IsLocked(now) {
+		return nil, nil
+	}
+
+	until := now.Add(t.cfg.LockoutDuration)
+	if err := t.repo.Lock(ctx, key, until); err != nil {
+		return nil, err
+	}
+	return &until, nil
+}
+
+// countFailure counts a failure against key without locking it, failures
+// older than window no longer count
+func (t *loginThrottle) countFailure(ctx context.Context, key string, window time.Duration) error {
+	now := time.Now()
+	_, err := t.repo.RecordFailure(ctx, key, now, now.Add(-window))
+	return err
+}
+
+// exhausted reports whether key has reached max failures counted by
+// countFailure
+func (t *loginThrottle) exhausted(ctx context.Context, key string, max int) (bool, error) {
+	attempt, err := t.repo.Get(ctx, key)
+	if err != nil || attempt == nil {
+		return false, err
+	}
+	return attempt.Failures >= max, nil
+}
+
+func (t *loginThrottle) reset(ctx context.Context, key string) error {
+	return t.repo.Reset(ctx, key)
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"medical-center/internal/models/user"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAttemptRepo keeps login attempts in memory with the counting rules of
+// the database implementation
+type fakeAttemptRepo struct {
+	mu       sync.Mutex
+	attempts map[string]user.LoginAttempt
+}
+
+func newFakeAttemptRepo(attempts ...user.LoginAttempt) *fakeAttemptRepo {
+	r := &fakeAttemptRepo{attempts: map[string]user.LoginAttempt{}}
+	for _, a := range attempts {
+		r.attempts[a.Key] = a
+	}
+	return r
+}
+
+func (r *fakeAttemptRepo) Get(ctx context.Context, key string) (*user.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+func (r *fakeAttemptRepo) RecordFailure(ctx context.Context, key string, at, windowStart time.Time) (*user.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.attempts[key]
+	switch {
+	case !ok:
+		a = user.LoginAttempt{Key: key, Failures: 1}
+	case a.LastFailedAt.Before(windowStart) || a.LockedUntil != nil && !at.Before(*a.LockedUntil):
+		a.Failures, a.LockedUntil = 1, nil
+	default:
+		a.Failures++
+	}
+	a.LastFailedAt = at
+	r.attempts[key] = a
+	return &a, nil
+}
+
+func (r *fakeAttemptRepo) Lock(ctx context.Context, key string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a := r.attempts[key]
+	a.LockedUntil = &until
+	r.attempts[key] = a
+	return nil
+}
+
+func (r *fakeAttemptRepo) Reset(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.attempts, key)
+	return nil
+}
+
+func TestLoginThrottleDelay(t *testing.T) {
+	throttle := newLoginThrottle(newFakeAttemptRepo(), LoginThrottleConfig{})
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{8, 32 * time.Second},
+		{9, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := throttle.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottleCheck(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		attempt    *user.LoginAttempt
+		wantLocked bool
+		wantWait   bool
+	}{
+		{"no failures", nil, false, false},
+		{"free attempts", &user.LoginAttempt{Failures: 2, LastFailedAt: now}, false, false},
+		{"within the delay", &user.LoginAttempt{Failures: 4, LastFailedAt: now.Add(-time.Second)}, false, true},
+		{"after the delay", &user.LoginAttempt{Failures: 4, LastFailedAt: now.Add(-3 * time.Second)}, false, false},
+		{"outside the failure window", &user.LoginAttempt{Failures: 50, LastFailedAt: now.Add(-16 * time.Minute)}, false, false},
+		{"locked", &user.LoginAttempt{Failures: 5, LastFailedAt: now, LockedUntil: timePtr(now.Add(10 * time.Minute))}, true, false},
+		{
+			"locked beyond the failure window",
+			&user.LoginAttempt{Failures: 5, LastFailedAt: now.Add(-20 * time.Minute), LockedUntil: timePtr(now.Add(time.Minute))},
+			true, false,
+		},
+		{"expired lockout", &user.LoginAttempt{Failures: 5, LastFailedAt: now.Add(-time.Second), LockedUntil: timePtr(now.Add(-time.Second))}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeAttemptRepo()
+			if tt.attempt != nil {
+				tt.attempt.Key = accountThrottleKey("doctor@example.com")
+				repo = newFakeAttemptRepo(*tt.attempt)
+			}
+			throttle := newLoginThrottle(repo, LoginThrottleConfig{})
+
+			err := throttle.check(context.Background(), accountThrottleKey("Doctor@Example.com "), ipThrottleKey("10.0.0.1"))
+			var throttled *LoginThrottledError
+			if !errors.As(err, &throttled) {
+				if err != nil {
+					t.Fatalf("check() = %v", err)
+				}
+				if tt.wantLocked || tt.wantWait {
+					t.Fatal("check() = nil, want a LoginThrottledError")
+				}
+				return
+			}
+			if !tt.wantLocked && !tt.wantWait {
+				t.Fatalf("check() = %v, want nil", err)
+			}
+			if throttled.Locked != tt.wantLocked || throttled.RetryAfter <= 0 {
+				t.Errorf("check() = %+v, want Locked %v and a positive RetryAfter", throttled, tt.wantLocked)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleRecordFailure(t *testing.T) {
+	ctx := context.Background()
+	key := accountThrottleKey("doctor@example.com")
+
+	tests := []struct {
+		name       string
+		previous   *user.LoginAttempt
+		wantLocked bool
+		wantCount  int
+	}{
+		{"first failure", nil, false, 1},
+		{"below the limit", &user.LoginAttempt{Failures: 3, LastFailedAt: time.Now()}, false, 4},
+		{"reaching the limit", &user.LoginAttempt{Failures: 4, LastFailedAt: time.Now()}, true, 5},
+		{"already locked", &user.LoginAttempt{Failures: 7, LastFailedAt: time.Now(), LockedUntil: timePtr(time.Now().Add(time.Minute))}, false, 8},
+		{"previous failures outside the window", &user.LoginAttempt{Failures: 4, LastFailedAt: time.Now().Add(-time.Hour)}, false, 1},
+		{"after an expired lockout", &user.LoginAttempt{Failures: 5, LastFailedAt: time.Now(), LockedUntil: timePtr(time.Now().Add(-time.Second))}, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeAttemptRepo()
+			if tt.previous != nil {
+				tt.previous.Key = key
+				repo = newFakeAttemptRepo(*tt.previous)
+			}
+			throttle := newLoginThrottle(repo, LoginThrottleConfig{})
+
+			until, err := throttle.recordFailure(ctx, key, throttle.cfg.MaxAccountFailures)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (until != nil) != tt.wantLocked {
+				t.Errorf("recordFailure() locked = %v, want %v", until != nil, tt.wantLocked)
+			}
+			if until != nil && until.Sub(time.Now()) <= 14*time.Minute {
+				t.Errorf("recordFailure() locked until %s, want the lockout duration", until)
+			}
+			attempt, _ := repo.Get(ctx, key)
+			if attempt.Failures != tt.wantCount {
+				t.Errorf("failures = %d, want %d", attempt.Failures, tt.wantCount)
+			}
+			if tt.wantLocked {
+				if err := throttle.check(ctx, key); err == nil {
+					t.Error("check() after a lockout = nil")
+				}
+			}
+		})
+	}
+}
+
+func TestLoginThrottleExhausted(t *testing.T) {
+	ctx := context.Background()
+	throttle := newLoginThrottle(newFakeAttemptRepo(), LoginThrottleConfig{})
+	key := mfaChallengeKey("token")
+
+	for i := 0; i <= 3; i++ {
+		exhausted, err := throttle.exhausted(ctx, key, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i >= 3; exhausted != want {
+			t.Errorf("exhausted() after %d failures = %v, want %v", i, exhausted, want)
+		}
+		if err := throttle.countFailure(ctx, key, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// countFailure never locks, the caller decides what to do once exhausted
+	attempt, _ := throttle.repo.Get(ctx, key)
+	if attempt.LockedUntil != nil {
+		t.Error("countFailure() locked the key")
+	}
+
+	if err := throttle.reset(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if exhausted, _ := throttle.exhausted(ctx, key, 3); exhausted {
+		t.Error("exhausted() after reset = true")
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"medical-center/internal/models/consent"
+	"medical-center/internal/models/notification"
+	"medical-center/internal/repository"
+	"medical-center/pkg/mailer"
+)
+
+// RecordingMailer sends through another mailer and records every message
+// in the notifications table, so that patients can be given a list of what
+// was sent to them
+type RecordingMailer struct {
+	next mailer.Mailer
+	repo repository.NotificationRepository
+}
+
+func NewRecordingMailer(next mailer.Mailer, repo repository.NotificationRepository) *RecordingMailer {
+	return &RecordingMailer{next: next, repo: repo}
+}
+
+func (m *RecordingMailer) Send(msg mailer.Message) error {
+	err := m.next.Send(msg)
+
+	n := &notification.Notification{
+		Recipient: msg.To,
+		Subject:   msg.Subject,
+		Status:    notification.StatusSent,
+	}
+	if errors.Is(err, mailer.ErrNoConsent) {
+		n.Status = notification.StatusSuppressed
+	} else if err != nil {
+		n.Status = notification.StatusFailed
+	}
+	// Failing to record must not fail the email that was already sent
+	if recordErr := m.repo.Create(context.Background(), n); recordErr != nil {
+		log.Printf("failed to record notification: %v", recordErr)
+	}
+	return err
+}
+
+// ConsentMailer drops messages with a Purpose the recipient has not
+// consented to, returning mailer.ErrNoConsent instead of sending them.
+// Only transactional and staff messages are sent without a consent, and
+// messages without a Purpose are never sent.
+type ConsentMailer struct {
+	next     mailer.Mailer
+	consents *ConsentService
+}
+
+func NewConsentMailer(next mailer.Mailer, consents *ConsentService) *ConsentMailer {
+	return &ConsentMailer{next: next, consents: consents}
+}
+
+func (m *ConsentMailer) Send(msg mailer.Message) error {
+	switch msg.Purpose {
+	case mailer.PurposeTransactional, mailer.PurposeStaff:
+		return m.next.Send(msg)
+	case "":
+		return mailer.ErrNoPurpose
+	}
+
+	allowed, err := m.consents.AllowedForEmail(context.Background(), msg.To, consent.Purpose(msg.Purpose))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return mailer.ErrNoConsent
+	}
+	return m.next.Send(msg)
+}
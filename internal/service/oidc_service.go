@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"medical-center/internal/models/audit"
+	"medical-center/internal/models/user"
+	"medical-center/internal/repository"
+	"medical-center/pkg/oidc"
+	"medical-center/pkg/passwords"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrSSONotAllowed = errors.New("your account is not allowed to use single sign-on")
+
+// ErrSSORoleMismatch is returned when the account with the email of the
+// identity has another role than the provider's groups map to. Linking it
+// would change its role, so an administrator has to align the role first.
+var ErrSSORoleMismatch = errors.New("the account with this email has another role, ask an administrator to align it before using single sign-on")
+
+// GroupRole maps an identity provider group to a role
+type GroupRole struct {
+	Group string
+	Role  user.Role
+}
+
+type OIDCConfig struct {
+	// GroupsClaim is the ID token claim listing the groups of the user
+	GroupsClaim string
+	// GroupRoles are checked in order, the first group the user belongs to wins
+	GroupRoles []GroupRole
+	// DefaultRole applies when none of the groups match. When empty such
+	// users cannot sign in.
+	DefaultRole user.Role
+	RequestTTL  time.Duration
+	BcryptCost  int
+}
+
+type OIDCService struct {
+	provider    *oidc.Provider
+	userRepo    repository.UserRepository
+	requestRepo repository.OIDCAuthRequestRepository
+	authService AuthService
+	cfg         OIDCConfig
+}
+
+func NewOIDCService(
+	provider *oidc.Provider,
+	userRepo repository.UserRepository,
+	requestRepo repository.OIDCAuthRequestRepository,
+	authService AuthService,
+	cfg OIDCConfig,
+) *OIDCService {
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.RequestTTL == 0 {
+		cfg.RequestTTL = 10 * time.Minute
+	}
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = bcrypt.DefaultCost
+	}
+	return &OIDCService{
+		provider:    provider,
+		userRepo:    userRepo,
+		requestRepo: requestRepo,
+		authService: authService,
+		cfg:         cfg,
+	}
+}
+
+// BeginLogin stores a new login request and returns the provider URL the
+// browser has to be redirected to
+func (s *OIDCService) BeginLogin(ctx context.Context) (string, error) {
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := s.requestRepo.DeleteExpired(ctx, now); err != nil {
+		log.Printf("failed to delete expired sso login requests: %v", err)
+	}
+	req := &user.OIDCAuthRequest{
+		State:        state,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    now.Add(s.cfg.RequestTTL),
+	}
+	if err := s.requestRepo.Create(ctx, req); err != nil {
+		return "", err
+	}
+
+	return s.provider.AuthCodeURL(state, nonce, oidc.CodeChallengeS256(verifier))
+}
+
+// CompleteLogin handles the provider callback: it redeems the code, verifies
+// the ID token and signs in the matching user, creating it on first login
+func (s *OIDCService) CompleteLogin(ctx context.Context, state, code string, client ClientInfo) (*LoginResult, error) {
+	req, err := s.requestRepo.Consume(ctx, state)
+	if err != nil || time.Now().After(req.ExpiresAt) {
+		return nil, errors.New("invalid or expired sso login request")
+	}
+
+	tokens, err := s.provider.Exchange(code, req.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.provider.VerifyIDToken(tokens.IDToken, req.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	role := s.mapRole(claims.StringsClaim(s.cfg.GroupsClaim))
+	if role == "" {
+		return nil, ErrSSONotAllowed
+	}
+
+	u, err := s.findOrProvision(ctx, claims, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.authService.LoginExternal(ctx, u, client)
+}
+
+func (s *OIDCService) findOrProvision(ctx context.Context, claims *oidc.IDTokenClaims, role user.Role) (*user.User, error) {
+	u, err := s.userRepo.GetByOIDCSubject(ctx, claims.Subject)
+	if err == nil {
+		return s.syncUser(ctx, u, claims, role)
+	}
+
+	// Accounts are only matched by email when the provider vouches for it,
+	// otherwise anyone able to set an email at the provider could take over
+	// an existing account
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errors.New("identity provider did not return a verified email")
+	}
+
+	u, err = s.userRepo.GetByEmail(ctx, claims.Email)
+	if err == nil {
+		if u.OIDCSubject != nil {
+			return nil, errors.New("account is linked to another identity")
+		}
+		if u.Role != role {
+			return nil, ErrSSORoleMismatch
+		}
+		log.Printf("linking user %d to sso subject %s", u.ID, claims.Subject)
+		return s.syncUser(ctx, u, claims, role)
+	}
+
+	return s.provision(ctx, claims, role)
+}
+
+func (s *OIDCService) syncUser(ctx context.Context, u *user.User, claims *oidc.IDTokenClaims, role user.Role) (*user.User, error) {
+	if u.IsDisabled() {
+		return nil, ErrAccountDisabled
+	}
+
+	// The caller is not authenticated yet, attribute the update, including
+	// a role change from the provider's groups, to the user signing in
+	ctx = audit.WithActor(ctx, audit.Actor{Type: audit.ActorUser, ID: u.ID})
+
+	subject := claims.Subject
+	u.OIDCSubject = &subject
+	u.Role = role
+	if !u.EmailVerified && claims.EmailVerified && strings.EqualFold(u.Email, claims.Email) {
+		now := time.Now()
+		u.EmailVerified = true
+		u.EmailVerifiedAt = &now
+	}
+	if err := s.userRepo.Update(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// provision creates the account of a user signing in for the first time.
+// It gets an unusable random password; a local password can be set through
+// the password reset flow.
+func (s *OIDCService) provision(ctx context.Context, claims *oidc.IDTokenClaims, role user.Role) (*user.User, error) {
+	password, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := passwords.Hash(password, s.cfg.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+	subject := claims.Subject
+	now := time.Now()
+	u := &user.User{
+		Email:           claims.Email,
+		Password:        hashedPassword,
+		Name:            name,
+		Role:            role,
+		OIDCSubject:     &subject,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	}
+	if err := s.userRepo.Create(ctx, u); err != nil {
+		return nil, fmt.Errorf("failed to provision sso user: %w", err)
+	}
+	log.Printf("provisioned user %d with role %s from sso subject %s", u.ID, role, subject)
+	return u, nil
+}
+
+func (s *OIDCService) mapRole(groups []string) user.Role {
+	member := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		member[group] = true
+	}
+	for _, mapping := range s.cfg.GroupRoles {
+		if member[mapping.Group] {
+			return mapping.Role
+		}
+	}
+	return s.cfg.DefaultRole
+}
+
+// ParseGroupRoles parses a mapping such as "hospital-admins=admin,doctors=doctor"
+func ParseGroupRoles(list string) ([]GroupRole, error) {
+	var mappings []GroupRole
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(group) == "" || strings.TrimSpace(role) == "" {
+			return nil, fmt.Errorf("invalid group mapping: %s", entry)
+		}
+		mappings = append(mappings, GroupRole{
+			Group: strings.TrimSpace(group),
+			Role:  user.Role(strings.TrimSpace(role)),
+		})
+	}
+	return mappings, nil
+}
@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"medical-center/internal/models/user"
+	"medical-center/internal/repository"
+	"medical-center/pkg/oidc"
+	"medical-center/pkg/oidc/oidctest"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeAuthRequests keeps the pending sso login requests in memory
+type fakeAuthRequests struct {
+	repository.OIDCAuthRequestRepository
+	requests map[string]*user.OIDCAuthRequest
+}
+
+func (r *fakeAuthRequests) Create(ctx context.Context, req *user.OIDCAuthRequest) error {
+	r.requests[req.State] = req
+	return nil
+}
+
+func (r *fakeAuthRequests) Consume(ctx context.Context, state string) (*user.OIDCAuthRequest, error) {
+	req, ok := r.requests[state]
+	if !ok {
+		return nil, errors.New("sso login request not found")
+	}
+	delete(r.requests, state)
+	return req, nil
+}
+
+func (r *fakeAuthRequests) DeleteExpired(ctx context.Context, before time.Time) error {
+	for state, req := range r.requests {
+		if req.ExpiresAt.Before(before) {
+			delete(r.requests, state)
+		}
+	}
+	return nil
+}
+
+// fakeExternalLogins records the users signed in through sso
+type fakeExternalLogins struct {
+	AuthService
+	users []uint
+}
+
+func (a *fakeExternalLogins) LoginExternal(ctx context.Context, u *user.User, client ClientInfo) (*LoginResult, error) {
+	a.users = append(a.users, u.ID)
+	return &LoginResult{Token: "token"}, nil
+}
+
+type oidcTest struct {
+	service  *OIDCService
+	idp      *oidctest.Server
+	users    *fakeUserRepo
+	requests *fakeAuthRequests
+	logins   *fakeExternalLogins
+}
+
+// newOIDCTest wires the sso service to the mock identity provider.
+// hospital-admins map to admins and physicians to doctors.
+func newOIDCTest(t *testing.T, users map[uint]*user.User, defaultRole user.Role) *oidcTest {
+	t.Helper()
+	idp, err := oidctest.NewServer("", "medical-center", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(idp)
+	t.Cleanup(ts.Close)
+	idp.Issuer = ts.URL
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       ts.URL,
+		ClientID:     "medical-center",
+		ClientSecret: "secret",
+		RedirectURL:  "https://clinic.example/api/v1/auth/oidc/callback",
+	})
+	test := &oidcTest{
+		idp:      idp,
+		users:    &fakeUserRepo{users: users},
+		requests: &fakeAuthRequests{requests: map[string]*user.OIDCAuthRequest{}},
+		logins:   &fakeExternalLogins{},
+	}
+	test.service = NewOIDCService(provider, test.users, test.requests, test.logins, OIDCConfig{
+		GroupRoles: []GroupRole{
+			{Group: "hospital-admins", Role: user.RoleAdmin},
+			{Group: "physicians", Role: user.RoleDoctor},
+		},
+		DefaultRole: defaultRole,
+		BcryptCost:  bcrypt.MinCost,
+	})
+	return test
+}
+
+// signIn starts a login and submits the provider login form, returning the
+// state and code the provider redirects back with
+func (o *oidcTest) signIn(t *testing.T, form url.Values) (string, string) {
+	t.Helper()
+	authURL, err := o.service.BeginLogin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback, err := o.idp.Login(authURL, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback.Query().Get("state"), callback.Query().Get("code")
+}
+
+func loginForm(email string, emailVerified bool, groups string) url.Values {
+	form := url.Values{"email": {email}, "name": {"Dr. Mock"}, "groups": {groups}}
+	if emailVerified {
+		form.Set("email_verified", "true")
+	}
+	return form
+}
+
+func subject(s string) *string {
+	return &s
+}
+
+// errAny accepts any error in the table below
+var errAny = errors.New("any error")
+
+func TestCompleteLogin(t *testing.T) {
+	tests := []struct {
+		name        string
+		users       map[uint]*user.User
+		defaultRole user.Role
+		form        url.Values
+		claims      func(claims jwt.MapClaims)
+		wantErr     error
+		wantUser    uint
+		wantRole    user.Role
+	}{
+		{
+			name:     "provisions a new user",
+			users:    map[uint]*user.User{},
+			form:     loginForm("new@hospital.example", true, "physicians"),
+			wantUser: 1,
+			wantRole: user.RoleDoctor,
+		},
+		{
+			name: "signs in the user linked to the subject",
+			users: map[uint]*user.User{
+				7: {ID: 7, Email: "renamed@hospital.example", Role: user.RoleDoctor, OIDCSubject: subject("mock|doctor@hospital.example")},
+			},
+			// The subject identifies the user, the email is not needed
+			form:     loginForm("doctor@hospital.example", false, "physicians"),
+			wantUser: 7,
+			wantRole: user.RoleDoctor,
+		},
+		{
+			name: "role of a linked user follows the groups",
+			users: map[uint]*user.User{
+				7: {ID: 7, Email: "doctor@hospital.example", Role: user.RoleDoctor, OIDCSubject: subject("mock|doctor@hospital.example")},
+			},
+			form:     loginForm("doctor@hospital.example", true, "physicians, hospital-admins"),
+			wantUser: 7,
+			wantRole: user.RoleAdmin,
+		},
+		{
+			name: "links a verified email",
+			users: map[uint]*user.User{
+				7: {ID: 7, Email: "doctor@hospital.example", Role: user.RoleDoctor},
+			},
+			form:     loginForm("doctor@hospital.example", true, "physicians"),
+			wantUser: 7,
+			wantRole: user.RoleDoctor,
+		},
+		{
+			name: "does not link an unverified email",
+			users: map[uint]*user.User{
+				7: {ID: 7, Email: "doctor@hospital.example", Role: user.RoleDoctor},
+			},
+			form:    loginForm("doctor@hospital.example", false, "physicians"),
+			wantErr: errAny,
+		},
+		{
+			name:    "does not provision an unverified email",
+			users:   map[uint]*user.User{},
+			form:    loginForm("new@hospital.example", false, "physicians"),
+			wantErr: errAny,
+		},
+		{
+			name: "refuses an email linked to another subject",
+			users: map[uint]*user.User{
+				7: {ID: 7, Email: "doctor@hospital.example", Role: user.RoleDoctor, OIDCSubject: subject("other|doctor")},
+			},
+			form:    loginForm("doctor@hospital.example", true, "physicians"),
+			wantErr: errAny,
+		},
+		{
+			name: "refuses an email whose account has another role",
+			users: map[uint]*user.User{
+				7: {ID: 7, Email: "doctor@hospital.example", Role: user.RoleReceptionist},
+			},
+			form:    loginForm("doctor@hospital.example", true, "physicians"),
+			wantErr: ErrSSORoleMismatch,
+		},
+		{
+			name: "refuses a disabled user",
+			users: map[uint]*user.User{
+				7: {ID: 7, Email: "doctor@hospital.example", Role: user.RoleDoctor, Status: user.StatusDisabled, OIDCSubject: subject("mock|doctor@hospital.example")},
+			},
+			form:    loginForm("doctor@hospital.example", true, "physicians"),
+			wantErr: ErrAccountDisabled,
+		},
+		{
+			name:     "first mapping in the configured order wins",
+			users:    map[uint]*user.User{},
+			form:     loginForm("chief@hospital.example", true, "physicians,hospital-admins"),
+			wantUser: 1,
+			wantRole: user.RoleAdmin,
+		},
+		{
+			name:        "default role without a mapped group",
+			users:       map[uint]*user.User{},
+			defaultRole: user.RolePatient,
+			form:        loginForm("visitor@hospital.example", true, "visitors"),
+			wantUser:    1,
+			wantRole:    user.RolePatient,
+		},
+		{
+			name:    "refused without a mapped group or default role",
+			users:   map[uint]*user.User{},
+			form:    loginForm("visitor@hospital.example", true, "visitors"),
+			wantErr: ErrSSONotAllowed,
+		},
+		{
+			name:    "refuses a token issued to another client",
+			users:   map[uint]*user.User{},
+			form:    loginForm("new@hospital.example", true, "physicians"),
+			claims:  func(claims jwt.MapClaims) { claims["aud"] = "another-client" },
+			wantErr: errAny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOIDCTest(t, tt.users, tt.defaultRole)
+			o.idp.Claims = tt.claims
+			before := map[uint]user.User{}
+			for id, u := range tt.users {
+				before[id] = *u
+			}
+
+			state, code := o.signIn(t, tt.form)
+			_, err := o.service.CompleteLogin(context.Background(), state, code, ClientInfo{})
+
+			if tt.wantErr != nil {
+				if err == nil || (tt.wantErr != errAny && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("CompleteLogin() error = %v, want %v", err, tt.wantErr)
+				}
+				if len(o.logins.users) != 0 {
+					t.Errorf("signed in %v", o.logins.users)
+				}
+				if len(o.users.users) != len(before) {
+					t.Errorf("users = %d, want %d", len(o.users.users), len(before))
+				}
+				for id, u := range before {
+					if !reflect.DeepEqual(*o.users.users[id], u) {
+						t.Errorf("user %d changed to %+v", id, *o.users.users[id])
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompleteLogin() error = %v", err)
+			}
+			if !reflect.DeepEqual(o.logins.users, []uint{tt.wantUser}) {
+				t.Fatalf("signed in %v, want %d", o.logins.users, tt.wantUser)
+			}
+			u := o.users.users[tt.wantUser]
+			if u.Role != tt.wantRole {
+				t.Errorf("role = %s, want %s", u.Role, tt.wantRole)
+			}
+			if u.OIDCSubject == nil || *u.OIDCSubject != "mock|"+tt.form.Get("email") {
+				t.Errorf("subject = %v", u.OIDCSubject)
+			}
+		})
+	}
+}
+
+func TestCompleteLoginRequest(t *testing.T) {
+	ctx := context.Background()
+	form := loginForm("new@hospital.example", true, "physicians")
+
+	t.Run("state is used once", func(t *testing.T) {
+		o := newOIDCTest(t, map[uint]*user.User{}, "")
+		state, code := o.signIn(t, form)
+		if _, err := o.service.CompleteLogin(ctx, state, code, ClientInfo{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := o.service.CompleteLogin(ctx, state, code, ClientInfo{}); err == nil {
+			t.Error("state replayed")
+		}
+	})
+
+	t.Run("unknown state", func(t *testing.T) {
+		o := newOIDCTest(t, map[uint]*user.User{}, "")
+		_, code := o.signIn(t, form)
+		if _, err := o.service.CompleteLogin(ctx, "forged", code, ClientInfo{}); err == nil {
+			t.Error("unknown state accepted")
+		}
+	})
+
+	t.Run("expired request", func(t *testing.T) {
+		o := newOIDCTest(t, map[uint]*user.User{}, "")
+		state, code := o.signIn(t, form)
+		o.requests.requests[state].ExpiresAt = time.Now().Add(-time.Second)
+		if _, err := o.service.CompleteLogin(ctx, state, code, ClientInfo{}); err == nil {
+			t.Error("expired request accepted")
+		}
+	})
+
+	// The code of one login redeemed with the code verifier of another
+	t.Run("code of another login", func(t *testing.T) {
+		o := newOIDCTest(t, map[uint]*user.User{}, "")
+		_, code := o.signIn(t, form)
+		state, _ := o.signIn(t, form)
+		if _, err := o.service.CompleteLogin(ctx, state, code, ClientInfo{}); err == nil {
+			t.Error("code accepted with the verifier of another login")
+		}
+	})
+
+	t.Run("nonce of another login", func(t *testing.T) {
+		o := newOIDCTest(t, map[uint]*user.User{}, "")
+		state, code := o.signIn(t, form)
+		o.requests.requests[state].Nonce = "another-nonce"
+		if _, err := o.service.CompleteLogin(ctx, state, code, ClientInfo{}); err == nil {
+			t.Error("id token accepted with another nonce")
+		}
+	})
+}
+
+func TestParseGroupRoles(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []GroupRole
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"hospital-admins=admin", []GroupRole{{"hospital-admins", user.RoleAdmin}}, false},
+		{" hospital-admins = admin , doctors=doctor,", []GroupRole{{"hospital-admins", user.RoleAdmin}, {"doctors", user.RoleDoctor}}, false},
+		{"hospital-admins", nil, true},
+		{"=admin", nil, true},
+		{"doctors=", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			got, err := ParseGroupRoles(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGroupRoles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseGroupRoles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"medical-center/internal/models/appointment"
+	"medical-center/internal/models/patient"
+	"medical-center/internal/repository"
+	"sort"
+	"strings"
+	"time"
+)
+
+// duplicateThreshold is the score from which a patient is reported as a
+// possible duplicate
+const duplicateThreshold = 0.5
+
+type PatientService struct {
+	repo    repository.PatientRepository
+	appRepo repository.AppRepository
+}
+
+func NewPatientService(repo repository.PatientRepository, appRepo repository.AppRepository) *PatientService {
+	return &PatientService{repo: repo, appRepo: appRepo}
+}
+
+func (s *PatientService) CreatePatient(ctx context.Context, dto patient.PatientDTO) (*patient.Patient, error) {
+	p := &patient.Patient{}
+	if err := s.apply(ctx, p, dto); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *PatientService) GetPatient(ctx context.Context, id uint) (*patient.Patient, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *PatientService) ListPatients(ctx context.Context, filter patient.Filter) ([]patient.Patient, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+	return s.repo.List(ctx, filter)
+}
+
+func (s *PatientService) UpdatePatient(ctx context.Context, id uint, dto patient.PatientDTO) (*patient.Patient, error) {
+	p, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.IsMerged() {
+		return nil, fmt.Errorf("patient was merged into patient %d", *p.MergedIntoID)
+	}
+	if err := s.apply(ctx, p, dto); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// apply validates dto and copies it onto p. The date of birth is taken from
+// the IIN when not given.
+func (s *PatientService) apply(ctx context.Context, p *patient.Patient, dto patient.PatientDTO) error {
+	dto.FullName = strings.Join(strings.Fields(dto.FullName), " ")
+	dto.Email = strings.TrimSpace(dto.Email)
+	dto.Phone = strings.TrimSpace(dto.Phone)
+	dto.IIN = strings.TrimSpace(dto.IIN)
+	if dto.FullName == "" {
+		return errors.New("full name is required")
+	}
+	if dto.BirthDate != nil && dto.BirthDate.After(time.Now()) {
+		return errors.New("date of birth cannot be in the future")
+	}
+
+	if dto.IIN != "" {
+		if err := patient.ValidateIIN(dto.IIN); err != nil {
+			return err
+		}
+		if encoded, ok := patient.IINBirthDate(dto.IIN); ok {
+			if dto.BirthDate == nil {
+				dto.BirthDate = &encoded
+			} else if !sameDay(*dto.BirthDate, encoded) {
+				return errors.New("date of birth does not match the IIN")
+			}
+		}
+		if dto.IIN != p.IIN {
+			existing, _, err := s.repo.List(ctx, patient.Filter{IIN: dto.IIN, Page: 1, PageSize: 1})
+			if err != nil {
+				return err
+			}
+			if len(existing) > 0 && existing[0].ID != p.ID {
+				return fmt.Errorf("IIN already belongs to patient %s", existing[0].MRN)
+			}
+		}
+	}
+
+	p.FullName = dto.FullName
+	p.Email = dto.Email
+	p.Phone = dto.Phone
+	p.IIN = dto.IIN
+	p.BirthDate = dto.BirthDate
+	p.UserID = dto.UserID
+	return nil
+}
+
+// Resolve returns the patient an appointment should be linked to: the one
+// with id, or the patient it was merged into
+func (s *PatientService) Resolve(ctx context.Context, id uint) (*patient.Patient, error) {
+	p, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.IsMerged() {
+		return s.repo.GetByID(ctx, *p.MergedIntoID)
+	}
+	return p, nil
+}
+
+// FindOrCreate returns the patient with exactly this name and the same
+// email or phone, creating one from the details when there is none.
+// Near matches are left to the duplicate detector.
+func (s *PatientService) FindOrCreate(ctx context.Context, name, email, phone string) (*patient.Patient, error) {
+	p, err := s.repo.FindMatch(ctx, name, email, phone)
+	if err != nil || p != nil {
+		return p, err
+	}
+	return s.CreatePatient(ctx, patient.PatientDTO{FullName: name, Email: email, Phone: phone})
+}
+
+func (s *PatientService) GetAppointments(ctx context.Context, id uint) ([]appointment.Appointment, error) {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.appRepo.GetByPatientID(ctx, id)
+}
+
+// FindDuplicates returns the patients that may be the same person as the
+// patient id, most likely first
+func (s *PatientService) FindDuplicates(ctx context.Context, id uint) ([]patient.Duplicate, error) {
+	p, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := s.repo.FindCandidates(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	duplicates := []patient.Duplicate{}
+	for _, candidate := range candidates {
+		score, reasons := matchScore(p, &candidate)
+		if score >= duplicateThreshold {
+			duplicates = append(duplicates, patient.Duplicate{Patient: candidate, Score: score, Reasons: reasons})
+		}
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Score > duplicates[j].Score
+	})
+	return duplicates, nil
+}
+
+// Merge folds the patient mergedID into survivorID. The survivor keeps its
+// details and gains the ones it is missing, the appointments of the merged
+// patient move to it. The merged patient is kept, pointing at the survivor.
+func (s *PatientService) Merge(ctx context.Context, actorID, survivorID, mergedID uint) (*patient.Merge, error) {
+	if survivorID == mergedID {
+		return nil, errors.New("cannot merge a patient into itself")
+	}
+	survivor, err := s.repo.GetByID(ctx, survivorID)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := s.repo.GetByID(ctx, mergedID)
+	if err != nil {
+		return nil, err
+	}
+	if survivor.IsMerged() || merged.IsMerged() {
+		return nil, errors.New("patient is already merged")
+	}
+
+	// Different identifiers mean different people
+	if survivor.IIN != "" && merged.IIN != "" && survivor.IIN != merged.IIN {
+		return nil, errors.New("patients have different IINs")
+	}
+	if survivor.BirthDate != nil && merged.BirthDate != nil && !sameDay(*survivor.BirthDate, *merged.BirthDate) {
+		return nil, errors.New("patients have different dates of birth")
+	}
+	if survivor.UserID != nil && merged.UserID != nil && *survivor.UserID != *merged.UserID {
+		return nil, errors.New("patients are linked to different accounts")
+	}
+
+	var filled []string
+	if survivor.Email == "" && merged.Email != "" {
+		survivor.Email = merged.Email
+		filled = append(filled, "email")
+	}
+	if survivor.Phone == "" && merged.Phone != "" {
+		survivor.Phone = merged.Phone
+		filled = append(filled, "phone")
+	}
+	if survivor.IIN == "" && merged.IIN != "" {
+		survivor.IIN = merged.IIN
+		filled = append(filled, "iin")
+	}
+	if survivor.BirthDate == nil && merged.BirthDate != nil {
+		survivor.BirthDate = merged.BirthDate
+		filled = append(filled, "birth_date")
+	}
+	if survivor.UserID == nil && merged.UserID != nil {
+		survivor.UserID = merged.UserID
+		filled = append(filled, "user_id")
+	}
+
+	merge := &patient.Merge{
+		SurvivorID: survivor.ID,
+		MergedID:   merged.ID,
+		MergedMRN:  merged.MRN,
+		Fields:     strings.Join(filled, ","),
+		MergedByID: actorID,
+	}
+	if err := s.repo.Merge(ctx, survivor, merged, merge); err != nil {
+		return nil, err
+	}
+	return merge, nil
+}
+
+func (s *PatientService) GetMerges(ctx context.Context, id uint) ([]patient.Merge, error) {
+	return s.repo.GetMerges(ctx, id)
+}
+
+// matchScore rates how likely a and b are the same person. A shared IIN is
+// conclusive and different IINs rule a match out; otherwise contact
+// details, the name and the date of birth add up.
+func matchScore(a, b *patient.Patient) (float64, []string) {
+	if a.IIN != "" && b.IIN != "" {
+		if a.IIN == b.IIN {
+			return 1, []string{"iin"}
+		}
+		return 0, nil
+	}
+
+	var score float64
+	var reasons []string
+	if email := patient.NormalizeEmail(a.Email); email != "" && email == patient.NormalizeEmail(b.Email) {
+		score += 0.35
+		reasons = append(reasons, "email")
+	}
+	if phone := patient.NormalizePhone(a.Phone); phone != "" && phone == patient.NormalizePhone(b.Phone) {
+		score += 0.35
+		reasons = append(reasons, "phone")
+	}
+	if similarity := nameSimilarity(a.FullName, b.FullName); similarity >= 0.8 {
+		score += 0.4 * similarity
+		reasons = append(reasons, "name")
+	}
+	if a.BirthDate != nil && b.BirthDate != nil {
+		if sameDay(*a.BirthDate, *b.BirthDate) {
+			score += 0.2
+			reasons = append(reasons, "birth_date")
+		} else {
+			score -= 0.3
+		}
+	}
+
+	if score < 0 {
+		score = 0
+	}
+	if score > 1 {
+		score = 1
+	}
+	return float64(int(score*100+0.5)) / 100, reasons
+}
+
+// nameSimilarity compares normalised names with the Levenshtein distance,
+// also trying the words in sorted order so "Ivanov Ivan" matches
+// "Ivan Ivanov". 1 means equal.
+func nameSimilarity(a, b string) float64 {
+	a, b = patient.NormalizeName(a), patient.NormalizeName(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	sorted := func(name string) string {
+		words := strings.Fields(name)
+		sort.Strings(words)
+		return strings.Join(words, " ")
+	}
+	similarity := levenshteinRatio(a, b)
+	if reordered := levenshteinRatio(sorted(a), sorted(b)); reordered > similarity {
+		similarity = reordered
+	}
+	return similarity
+}
+
+func levenshteinRatio(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return 1 - float64(previous[len(rb)])/float64(longest)
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/models/principal"
+	"medical-center/internal/models/user"
+	"medical-center/internal/repository"
+	"strings"
+)
+
+type PermissionService struct {
+	repo repository.PermissionRepository
+}
+
+func NewPermissionService(repo repository.PermissionRepository) *PermissionService {
+	return &PermissionService{repo: repo}
+}
+
+func (s *PermissionService) GetAllPermissions(ctx context.Context) ([]permission.Permission, error) {
+	return s.repo.GetAll(ctx)
+}
+
+func (s *PermissionService) GetRoles(ctx context.Context) ([]permission.Role, error) {
+	roles, err := s.repo.GetRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range roles {
+		perms, err := s.repo.GetRolePermissions(ctx, roles[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		roles[i].Permissions = perms
+	}
+	return roles, nil
+}
+
+func (s *PermissionService) CreateRole(ctx context.Context, name user.Role, description string) (*permission.Role, error) {
+	name = user.Role(strings.ToLower(strings.TrimSpace(string(name))))
+	if name == "" {
+		return nil, errors.New("role name cannot be empty")
+	}
+	if len(name) > 20 {
+		return nil, errors.New("role name cannot be longer than 20 characters")
+	}
+	if existing, err := s.repo.GetRole(ctx, name); err == nil && existing != nil {
+		return nil, errors.New("role already exists")
+	}
+
+	role := &permission.Role{
+		Name:        name,
+		Description: description,
+		Permissions: []string{},
+	}
+	if err := s.repo.CreateRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (s *PermissionService) GetRolePermissions(ctx context.Context, role user.Role) ([]string, error) {
+	if _, err := s.repo.GetRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return s.repo.GetRolePermissions(ctx, role)
+}
+
+// SetRolePermissions replaces the permissions granted to the role
+func (s *PermissionService) SetRolePermissions(ctx context.Context, role user.Role, names []string) ([]string, error) {
+	if _, err := s.repo.GetRole(ctx, role); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(names))
+	if len(names) > 0 {
+		perms, err := s.repo.GetByNames(ctx, names)
+		if err != nil {
+			return nil, err
+		}
+
+		known := make(map[string]uint, len(perms))
+		for _, p := range perms {
+			known[p.Name] = p.ID
+		}
+		// A name listed twice is granted once
+		granted := make(map[uint]bool, len(names))
+		for _, name := range names {
+			id, ok := known[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown permission: %s", name)
+			}
+			if !granted[id] {
+				granted[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	if err := s.repo.SetRolePermissions(ctx, role, ids); err != nil {
+		return nil, err
+	}
+	return s.repo.GetRolePermissions(ctx, role)
+}
+
+// GetEffectivePermissions resolves the permissions granted to the user through their role
+func (s *PermissionService) GetEffectivePermissions(ctx context.Context, u *user.User) (permission.Set, error) {
+	names, err := s.repo.GetRolePermissions(ctx, u.Role)
+	if err != nil {
+		return nil, err
+	}
+	return permission.NewSet(names), nil
+}
+
+// GetPrincipalPermissions resolves role permissions for users and key scopes
+// for service accounts
+func (s *PermissionService) GetPrincipalPermissions(ctx context.Context, p *principal.Principal) (permission.Set, error) {
+	if p.IsUser() {
+		return s.GetEffectivePermissions(ctx, p.User)
+	}
+
+	set := permission.NewSet(p.Scopes)
+	for scope := range nonDelegableScopes {
+		delete(set, scope)
+	}
+	return set, nil
+}
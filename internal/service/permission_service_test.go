@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/models/user"
+	"medical-center/internal/repository"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// fakePermissionRepo keeps the permissions of each role in memory and, like
+// the role_permissions primary key, refuses a permission granted twice
+type fakePermissionRepo struct {
+	repository.PermissionRepository
+	permissions []permission.Permission
+	roles       map[user.Role][]string
+}
+
+func newFakePermissionRepo(roles map[user.Role][]string) *fakePermissionRepo {
+	r := &fakePermissionRepo{roles: roles}
+	known := map[string]bool{}
+	for _, names := range roles {
+		for _, name := range names {
+			if !known[name] {
+				known[name] = true
+				r.permissions = append(r.permissions, permission.Permission{ID: uint(len(r.permissions) + 1), Name: name})
+			}
+		}
+	}
+	return r
+}
+
+func (r *fakePermissionRepo) GetByNames(ctx context.Context, names []string) ([]permission.Permission, error) {
+	var perms []permission.Permission
+	for _, p := range r.permissions {
+		for _, name := range names {
+			if p.Name == name {
+				perms = append(perms, p)
+				break
+			}
+		}
+	}
+	return perms, nil
+}
+
+func (r *fakePermissionRepo) GetRole(ctx context.Context, name user.Role) (*permission.Role, error) {
+	if _, ok := r.roles[name]; !ok {
+		return nil, errors.New("role not found")
+	}
+	return &permission.Role{Name: name}, nil
+}
+
+func (r *fakePermissionRepo) GetRolePermissions(ctx context.Context, role user.Role) ([]string, error) {
+	names := append([]string{}, r.roles[role]...)
+	sort.Strings(names)
+	return names, nil
+}
+
+func (r *fakePermissionRepo) SetRolePermissions(ctx context.Context, role user.Role, permissionIDs []uint) error {
+	names := make([]string, 0, len(permissionIDs))
+	seen := map[uint]bool{}
+	for _, id := range permissionIDs {
+		if seen[id] {
+			return fmt.Errorf("duplicate key value violates unique constraint: permission %d", id)
+		}
+		seen[id] = true
+		names = append(names, r.permissions[id-1].Name)
+	}
+	r.roles[role] = names
+	return nil
+}
+
+func TestSetRolePermissions(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		want    []string
+		wantErr bool
+	}{
+		{"replaces the permissions", []string{permission.PatientsRead}, []string{permission.PatientsRead}, false},
+		{"duplicate names", []string{permission.PatientsRead, permission.PatientsWrite, permission.PatientsRead}, []string{permission.PatientsRead, permission.PatientsWrite}, false},
+		{"no permissions", nil, []string{}, false},
+		{"unknown permission", []string{permission.PatientsRead, "patients.fly"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakePermissionRepo(map[user.Role][]string{
+				user.RoleReceptionist: {permission.PatientsRead, permission.PatientsWrite},
+			})
+			s := NewPermissionService(repo)
+
+			got, err := s.SetRolePermissions(context.Background(), user.RoleReceptionist, tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetRolePermissions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SetRolePermissions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
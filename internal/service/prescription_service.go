@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"medical-center/internal/models/allergy"
+	"medical-center/internal/models/prescription"
+	"medical-center/internal/repository"
+	"strings"
+	"time"
+)
+
+// maxPrescriptionDays is the longest duration of a medication line
+const maxPrescriptionDays = 365
+
+// PrescriptionService handles prescriptions from the draft to the
+// dispensing pharmacy
+type PrescriptionService struct {
+	repo          repository.PrescriptionRepository
+	formulary     repository.FormularyRepository
+	appRepo       repository.AppRepository
+	encounterRepo repository.EncounterRepository
+	allergies     repository.AllergyRepository
+}
+
+func NewPrescriptionService(
+	repo repository.PrescriptionRepository,
+	formulary repository.FormularyRepository,
+	appRepo repository.AppRepository,
+	encounterRepo repository.EncounterRepository,
+	allergies repository.AllergyRepository,
+) *PrescriptionService {
+	return &PrescriptionService{repo: repo, formulary: formulary, appRepo: appRepo, encounterRepo: encounterRepo, allergies: allergies}
+}
+
+// AppointmentDoctor returns the doctor of the appointment, who may write its
+// prescriptions with the ".own" permission
+func (s *PrescriptionService) AppointmentDoctor(ctx context.Context, appointmentID uint) (uint, error) {
+	appt, err := s.appRepo.GetByID(ctx, appointmentID)
+	if err != nil {
+		return 0, err
+	}
+	return appt.DoctorID, nil
+}
+
+// Create writes a draft prescription of the doctor doctorID for the
+// appointment. The drugs are checked against the patient's allergies and
+// every warning must be acknowledged in acks.
+func (s *PrescriptionService) Create(ctx context.Context, actorID, doctorID, appointmentID uint, notes string, lines []prescription.Line, acks []allergy.AckInput) (*prescription.Prescription, error) {
+	appt, err := s.appRepo.GetByID(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	note, err := s.encounterRepo.GetByAppointment(ctx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if lines, err = s.checkLines(ctx, lines); err != nil {
+		return nil, err
+	}
+	acknowledgements, err := s.checkAllergies(ctx, appt.PatientID, actorID, lines, acks)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &prescription.Prescription{
+		AppointmentID:    appt.ID,
+		PatientID:        appt.PatientID,
+		DoctorID:         doctorID,
+		Status:           prescription.StatusDraft,
+		Notes:            strings.TrimSpace(notes),
+		CreatedByID:      actorID,
+		Lines:            lines,
+		Acknowledgements: acknowledgements,
+	}
+	if note != nil {
+		p.EncounterNoteID = &note.ID
+	}
+	if err := s.repo.Create(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *PrescriptionService) Get(ctx context.Context, id uint) (*prescription.Prescription, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *PrescriptionService) GetByAppointment(ctx context.Context, appointmentID uint) ([]prescription.Prescription, error) {
+	return s.repo.GetByAppointment(ctx, appointmentID)
+}
+
+// Update replaces the notes and lines of a draft, checking the allergies
+// like Create
+func (s *PrescriptionService) Update(ctx context.Context, actorID, id uint, notes string, lines []prescription.Line, acks []allergy.AckInput) (*prescription.Prescription, error) {
+	p, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != prescription.StatusDraft {
+		return nil, errors.New("only draft prescriptions can be edited")
+	}
+	if p.Lines, err = s.checkLines(ctx, lines); err != nil {
+		return nil, err
+	}
+	if p.Acknowledgements, err = s.checkAllergies(ctx, p.PatientID, actorID, p.Lines, acks); err != nil {
+		return nil, err
+	}
+	p.Notes = strings.TrimSpace(notes)
+	if err := s.repo.ReplaceLines(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Issue makes a draft valid for dispensing and assigns its verification
+// code
+func (s *PrescriptionService) Issue(ctx context.Context, id uint) (*prescription.Prescription, error) {
+	p, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != prescription.StatusDraft {
+		return nil, errors.New("only draft prescriptions can be issued")
+	}
+	// Drugs may have left the formulary since the draft was written
+	if _, err := s.checkLines(ctx, p.Lines); err != nil {
+		return nil, err
+	}
+
+	code, err := generateVerificationCode()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	p.Status = prescription.StatusIssued
+	p.VerificationCode = &code
+	p.IssuedAt = &now
+	if err := s.repo.Save(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Cancel withdraws a draft or an issued prescription. A reason is required
+// once it was issued, since a pharmacy may ask for it.
+func (s *PrescriptionService) Cancel(ctx context.Context, actorID, id uint, reason string) (*prescription.Prescription, error) {
+	p, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	reason = strings.TrimSpace(reason)
+	switch p.Status {
+	case prescription.StatusDraft:
+	case prescription.StatusIssued:
+		if reason == "" {
+			return nil, errors.New("a reason is required to cancel an issued prescription")
+		}
+	default:
+		return nil, fmt.Errorf("a %s prescription cannot be cancelled", p.Status)
+	}
+
+	now := time.Now()
+	p.Status = prescription.StatusCancelled
+	p.CancelledAt = &now
+	p.CancelledByID = &actorID
+	p.CancelReason = reason
+	if err := s.repo.Save(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Renew issues a copy of an issued prescription written by the doctor
+// doctorID. The original is marked as renewed and can no longer be
+// dispensed. Allergies recorded since are checked like in Create.
+func (s *PrescriptionService) Renew(ctx context.Context, actorID, doctorID, id uint, acks []allergy.AckInput) (*prescription.Prescription, error) {
+	original, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if original.Status != prescription.StatusIssued {
+		return nil, errors.New("only issued prescriptions can be renewed")
+	}
+
+	lines := make([]prescription.Line, len(original.Lines))
+	for i, line := range original.Lines {
+		line.ID, line.PrescriptionID = 0, 0
+		lines[i] = line
+	}
+	if lines, err = s.checkLines(ctx, lines); err != nil {
+		return nil, err
+	}
+	acknowledgements, err := s.checkAllergies(ctx, original.PatientID, actorID, lines, acks)
+	if err != nil {
+		return nil, err
+	}
+	code, err := generateVerificationCode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	renewal := &prescription.Prescription{
+		AppointmentID:    original.AppointmentID,
+		EncounterNoteID:  original.EncounterNoteID,
+		PatientID:        original.PatientID,
+		DoctorID:         doctorID,
+		Status:           prescription.StatusIssued,
+		VerificationCode: &code,
+		Notes:            original.Notes,
+		CreatedByID:      actorID,
+		IssuedAt:         &now,
+		RenewedFromID:    &original.ID,
+		Lines:            lines,
+		Acknowledgements: acknowledgements,
+	}
+	if err := s.repo.Renew(ctx, original, renewal); err != nil {
+		return nil, err
+	}
+	return renewal, nil
+}
+
+// Verify looks up a prescription by the code printed on it
+func (s *PrescriptionService) Verify(ctx context.Context, code string) (*prescription.Verification, error) {
+	p, err := s.repo.GetByVerificationCode(ctx, normalizeVerificationCode(code))
+	if err != nil {
+		return nil, err
+	}
+	return &prescription.Verification{
+		VerificationCode: *p.VerificationCode,
+		Status:           p.Status,
+		Valid:            p.Status == prescription.StatusIssued,
+		DoctorID:         p.DoctorID,
+		IssuedAt:         p.IssuedAt,
+		CancelledAt:      p.CancelledAt,
+		Lines:            p.Lines,
+	}, nil
+}
+
+// ActiveMedications returns the lines of the patient's issued prescriptions
+// whose duration has not run out, newest first
+func (s *PrescriptionService) ActiveMedications(ctx context.Context, patientID uint) ([]prescription.ActiveMedication, error) {
+	prescriptions, err := s.repo.GetIssuedByPatient(ctx, patientID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := []prescription.ActiveMedication{}
+	for _, p := range prescriptions {
+		for _, line := range p.Lines {
+			endsAt := p.IssuedAt.AddDate(0, 0, line.DurationDays)
+			if endsAt.Before(now) {
+				continue
+			}
+			active = append(active, prescription.ActiveMedication{
+				Line:             line,
+				VerificationCode: *p.VerificationCode,
+				DoctorID:         p.DoctorID,
+				IssuedAt:         *p.IssuedAt,
+				EndsAt:           endsAt,
+			})
+		}
+	}
+	return active, nil
+}
+
+// checkLines validates the lines and fills in the drug names from the
+// formulary
+func (s *PrescriptionService) checkLines(ctx context.Context, lines []prescription.Line) ([]prescription.Line, error) {
+	if len(lines) == 0 {
+		return nil, errors.New("at least one medication is required")
+	}
+	for i := range lines {
+		line := &lines[i]
+		line.Dose = strings.TrimSpace(line.Dose)
+		line.Frequency = strings.TrimSpace(line.Frequency)
+		line.Instructions = strings.TrimSpace(line.Instructions)
+		switch {
+		case line.Dose == "":
+			return nil, fmt.Errorf("line %d: dose is required", i+1)
+		case !line.Route.IsValid():
+			return nil, fmt.Errorf("line %d: unknown route %q", i+1, line.Route)
+		case line.Frequency == "":
+			return nil, fmt.Errorf("line %d: frequency is required", i+1)
+		case line.DurationDays < 1 || line.DurationDays > maxPrescriptionDays:
+			return nil, fmt.Errorf("line %d: duration must be between 1 and %d days", i+1, maxPrescriptionDays)
+		case line.Quantity < 1:
+			return nil, fmt.Errorf("line %d: quantity must be at least 1", i+1)
+		}
+
+		drug, err := s.formulary.GetDrug(ctx, line.DrugID)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if !drug.Active {
+			return nil, fmt.Errorf("line %d: %s is no longer in the formulary", i+1, drug.Label())
+		}
+		line.DrugName = drug.Label()
+	}
+	return lines, nil
+}
+
+// checkAllergies checks the drugs of the lines against the allergies of the
+// patient and returns the acknowledgements by actorID of the warnings, to be
+// stored with the prescription. It returns an allergy.UnacknowledgedError
+// when a warning is missing from acks.
+func (s *PrescriptionService) checkAllergies(ctx context.Context, patientID *uint, actorID uint, lines []prescription.Line, acks []allergy.AckInput) ([]allergy.Acknowledgement, error) {
+	if patientID == nil {
+		return nil, nil
+	}
+	allergies, err := s.allergies.ListAllergies(ctx, *patientID)
+	if err != nil || len(allergies) == 0 {
+		return nil, err
+	}
+
+	agents := make([]allergy.Agent, 0, len(lines))
+	for _, line := range lines {
+		drug, err := s.formulary.GetDrug(ctx, line.DrugID)
+		if err != nil {
+			return nil, err
+		}
+		agents = append(agents, allergy.Agent{Name: drug.Label(), ATCCode: drug.ATCCode})
+	}
+	return allergy.Acknowledge(*patientID, actorID, allergy.Check(allergies, agents), acks)
+}
+
+// generateVerificationCode returns a random code formatted as
+// XXXX-XXXX-XXXX, using the unambiguous alphabet of the recovery codes
+func generateVerificationCode() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = recoveryCodeAlphabet[int(b[i])%len(recoveryCodeAlphabet)]
+	}
+	return string(b[:4]) + "-" + string(b[4:8]) + "-" + string(b[8:]), nil
+}
+
+// normalizeVerificationCode accepts codes typed in lower case or without
+// the dashes
+func normalizeVerificationCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != 12 {
+		return code
+	}
+	return code[:4] + "-" + code[4:8] + "-" + code[8:]
+}
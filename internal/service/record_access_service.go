@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"medical-center/internal/models/consent"
+	"medical-center/internal/repository"
+)
+
+// RecordAccessService decides whose medical records a caller may read. The
+// read permissions without a scope cover every patient; their ".own"
+// variants cover the patients who have an appointment with the caller's
+// doctor profile. External partners also need the patient's consent.
+type RecordAccessService struct {
+	appRepo     repository.AppRepository
+	patientRepo repository.PatientRepository
+	consents    *ConsentService
+}
+
+func NewRecordAccessService(appRepo repository.AppRepository, patientRepo repository.PatientRepository, consents *ConsentService) *RecordAccessService {
+	return &RecordAccessService{appRepo: appRepo, patientRepo: patientRepo, consents: consents}
+}
+
+// Reader is the caller of a read of medical records
+type Reader struct {
+	// All is set when the caller holds the permissions for every patient
+	All bool
+	// DoctorID is the doctor profile of the caller, if any
+	DoctorID *uint
+	// Purpose is set for external partners, which only see the records of
+	// patients who consented to it
+	Purpose consent.Purpose
+}
+
+// CanReadPatient reports whether the reader may see the records of the
+// patient
+func (s *RecordAccessService) CanReadPatient(ctx context.Context, r Reader, patientID uint) (bool, error) {
+	if !r.All {
+		if r.DoctorID == nil {
+			return false, nil
+		}
+		own, err := s.appRepo.IsPatientOf(ctx, patientID, *r.DoctorID)
+		if err != nil || !own {
+			return false, err
+		}
+	}
+	return s.consented(ctx, r, patientID)
+}
+
+// CanReadAppointment reports whether the reader may see the records of the
+// appointment: its doctor may, and so may whoever may see its patient
+func (s *RecordAccessService) CanReadAppointment(ctx context.Context, r Reader, appointmentID uint) (bool, error) {
+	if r.All && r.Purpose == "" {
+		return true, nil
+	}
+	if !r.All && r.DoctorID == nil {
+		return false, nil
+	}
+	appt, err := s.appRepo.GetByID(ctx, appointmentID)
+	if err != nil {
+		return false, err
+	}
+	if !r.All {
+		own := appt.DoctorID == *r.DoctorID
+		if !own && appt.PatientID != nil {
+			own, err = s.appRepo.IsPatientOf(ctx, *appt.PatientID, *r.DoctorID)
+		}
+		if err != nil || !own {
+			return false, err
+		}
+	}
+	if r.Purpose != "" && appt.PatientID == nil {
+		// Appointments not linked to the patient index yet are shared
+		// like the appointments themselves, by the email they were
+		// booked with
+		return s.consents.AllowedForEmail(ctx, appt.Email, r.Purpose)
+	}
+	if appt.PatientID == nil {
+		return true, nil
+	}
+	return s.consented(ctx, r, *appt.PatientID)
+}
+
+// consented reports whether the patient agreed to share their records
+// with the reader. Only external partners need consent.
+func (s *RecordAccessService) consented(ctx context.Context, r Reader, patientID uint) (bool, error) {
+	if r.Purpose == "" {
+		return true, nil
+	}
+	p, err := s.patientRepo.GetByID(ctx, patientID)
+	if err != nil {
+		return false, err
+	}
+	if p.UserID == nil {
+		// Without an account nobody could have consented
+		return false, nil
+	}
+	return s.consents.Allowed(ctx, *p.UserID, r.Purpose)
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"medical-center/internal/models/retention"
+	"medical-center/internal/repository"
+	"time"
+)
+
+// maxReportErrors limits how many error messages a rule report keeps
+const maxReportErrors = 5
+
+// RetentionService enforces the retention rules and manages legal holds
+type RetentionService struct {
+	ruleRepo repository.RetentionRuleRepository
+	holdRepo repository.LegalHoldRepository
+	repo     repository.RetentionRepository
+	userRepo repository.UserRepository
+}
+
+func NewRetentionService(
+	ruleRepo repository.RetentionRuleRepository,
+	holdRepo repository.LegalHoldRepository,
+	repo repository.RetentionRepository,
+	userRepo repository.UserRepository,
+) *RetentionService {
+	return &RetentionService{ruleRepo: ruleRepo, holdRepo: holdRepo, repo: repo, userRepo: userRepo}
+}
+
+func (s *RetentionService) GetRules(ctx context.Context) ([]retention.Rule, error) {
+	return s.ruleRepo.GetAll(ctx)
+}
+
+func (s *RetentionService) CreateRule(ctx context.Context, rule *retention.Rule) error {
+	if err := validateRule(rule); err != nil {
+		return err
+	}
+	rules, err := s.ruleRepo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, existing := range rules {
+		if existing.Entity == rule.Entity && existing.Action == rule.Action {
+			return fmt.Errorf("a %s rule for %s already exists", rule.Action, rule.Entity)
+		}
+	}
+	return s.ruleRepo.Create(ctx, rule)
+}
+
+// UpdateRule changes the age and the enabled flag of a rule
+func (s *RetentionService) UpdateRule(ctx context.Context, id uint, afterDays int, enabled bool) (*retention.Rule, error) {
+	rule, err := s.ruleRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	rule.AfterDays = afterDays
+	rule.Enabled = enabled
+	if err := validateRule(rule); err != nil {
+		return nil, err
+	}
+	if err := s.ruleRepo.Update(ctx, rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *RetentionService) DeleteRule(ctx context.Context, id uint) error {
+	if _, err := s.ruleRepo.GetByID(ctx, id); err != nil {
+		return err
+	}
+	return s.ruleRepo.Delete(ctx, id)
+}
+
+func validateRule(rule *retention.Rule) error {
+	if !retention.Supports(rule.Entity, rule.Action) {
+		return fmt.Errorf("action %s is not supported for %s", rule.Action, rule.Entity)
+	}
+	if rule.AfterDays < 1 {
+		return errors.New("after_days must be at least 1")
+	}
+	return nil
+}
+
+func (s *RetentionService) GetHolds(ctx context.Context, activeOnly bool) ([]retention.LegalHold, error) {
+	return s.holdRepo.GetAll(ctx, activeOnly)
+}
+
+// PlaceHold keeps the records of the user out of the retention rules and
+// blocks erasure of their data
+func (s *RetentionService) PlaceHold(ctx context.Context, actorID, userID uint, reason string) (*retention.LegalHold, error) {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	held, err := s.holdRepo.IsHeld(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		return nil, errors.New("user is already under a legal hold")
+	}
+
+	hold := &retention.LegalHold{UserID: userID, Reason: reason, PlacedByID: actorID}
+	if err := s.holdRepo.Create(ctx, hold); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+func (s *RetentionService) ReleaseHold(ctx context.Context, actorID, id uint) (*retention.LegalHold, error) {
+	hold, err := s.holdRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !hold.IsActive() {
+		return nil, errors.New("legal hold is already released")
+	}
+
+	now := time.Now()
+	hold.ReleasedAt = &now
+	hold.ReleasedByID = &actorID
+	if err := s.holdRepo.Update(ctx, hold); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// Run applies every enabled rule. With dryRun nothing is changed and the
+// report tells what would have been.
+func (s *RetentionService) Run(ctx context.Context, dryRun bool) (*retention.Report, error) {
+	report := &retention.Report{DryRun: dryRun, StartedAt: time.Now(), Rules: []retention.RuleReport{}}
+
+	rules, err := s.ruleRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	heldEmails, err := s.heldEmails(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		result, err := s.apply(ctx, rule, report.StartedAt, heldEmails, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		report.Rules = append(report.Rules, *result)
+	}
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// heldEmails returns the emails of the patients under a legal hold. A hold
+// whose account cannot be loaded fails the run rather than being ignored.
+func (s *RetentionService) heldEmails(ctx context.Context) ([]string, error) {
+	holds, err := s.holdRepo.GetAll(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	emails := make([]string, 0, len(holds))
+	for _, hold := range holds {
+		u, err := s.userRepo.GetByID(ctx, hold.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("legal hold %d: %w", hold.ID, err)
+		}
+		emails = append(emails, u.Email)
+	}
+	return emails, nil
+}
+
+func (s *RetentionService) apply(ctx context.Context, rule retention.Rule, now time.Time, heldEmails []string, dryRun bool) (*retention.RuleReport, error) {
+	result := &retention.RuleReport{
+		RuleID: rule.ID,
+		Entity: rule.Entity,
+		Action: rule.Action,
+		Cutoff: now.AddDate(0, 0, -rule.AfterDays),
+	}
+
+	ids, held, err := s.repo.FindExpired(ctx, rule, result.Cutoff, heldEmails)
+	if err != nil {
+		return nil, err
+	}
+	result.Matched, result.Held = len(ids), held
+	if dryRun {
+		return result, nil
+	}
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if rule.Action == retention.ActionAnonymize {
+			err = s.repo.Anonymize(ctx, id)
+		} else {
+			err = s.repo.Purge(ctx, rule.Entity, id)
+		}
+		switch {
+		case err == nil:
+			result.Processed++
+		case errors.Is(err, retention.ErrStillReferenced):
+			result.Referenced++
+		default:
+			result.Failed++
+			if len(result.Errors) < maxReportErrors {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s %d: %v", rule.Entity, id, err))
+			}
+		}
+	}
+	return result, nil
+}
+
+// Schedule runs the rules every interval until ctx is cancelled
+func (s *RetentionService) Schedule(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.Run(ctx, false)
+			if err != nil {
+				log.Printf("retention run failed: %v", err)
+				continue
+			}
+			for _, r := range report.Rules {
+				log.Printf("retention rule %d (%s %s): %d matched, %d processed, %d held, %d referenced, %d failed",
+					r.RuleID, r.Action, r.Entity, r.Matched, r.Processed, r.Held, r.Referenced, r.Failed)
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"medical-center/internal/models/schedule"
 	"medical-center/internal/repository"
@@ -15,7 +16,7 @@ func NewScheduleService(repo repository.ScheduleRepository) *ScheduleService {
 	return &ScheduleService{repo: repo}
 }
 
-func (s *ScheduleService) CreateSlot(doctorID uint, start, end time.Time) (*schedule.Schedule, error) {
+func (s *ScheduleService) CreateSlot(ctx context.Context, doctorID uint, start, end time.Time) (*schedule.Schedule, error) {
 	if start.After(end) {
 		return nil, errors.New("start time cannot be after end time")
 	}
@@ -27,22 +28,22 @@ func (s *ScheduleService) CreateSlot(doctorID uint, start, end time.Time) (*sche
 		Booked:    false,
 	}
 
-	if err := s.repo.Create(newSlot); err != nil {
+	if err := s.repo.Create(ctx, newSlot); err != nil {
 		return nil, err
 	}
 	return newSlot, nil
 }
 
-func (s *ScheduleService) GetSlotByID(id uint) (*schedule.Schedule, error) {
-	return s.repo.GetByID(id)
+func (s *ScheduleService) GetSlotByID(ctx context.Context, id uint) (*schedule.Schedule, error) {
+	return s.repo.GetByID(ctx, id)
 }
 
-func (s *ScheduleService) GetDoctorSlots(doctorID uint) ([]schedule.Schedule, error) {
-	return s.repo.GetByDoctor(doctorID)
+func (s *ScheduleService) GetDoctorSlots(ctx context.Context, doctorID uint) ([]schedule.Schedule, error) {
+	return s.repo.GetByDoctor(ctx, doctorID)
 }
 
-func (s *ScheduleService) UpdateSlot(id uint, start, end time.Time) (*schedule.Schedule, error) {
-	slot, err := s.repo.GetByID(id)
+func (s *ScheduleService) UpdateSlot(ctx context.Context, id uint, start, end time.Time) (*schedule.Schedule, error) {
+	slot, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -50,24 +51,24 @@ func (s *ScheduleService) UpdateSlot(id uint, start, end time.Time) (*schedule.S
 	slot.StartTime = start
 	slot.EndTime = end
 
-	if err := s.repo.Update(slot); err != nil {
+	if err := s.repo.Update(ctx, slot); err != nil {
 		return nil, err
 	}
 	return slot, nil
 }
 
-func (s *ScheduleService) DeleteSlot(id uint) error {
-	return s.repo.Delete(id)
+func (s *ScheduleService) DeleteSlot(ctx context.Context, id uint) error {
+	return s.repo.Delete(ctx, id)
 }
 
-func (s *ScheduleService) BookSlot(id uint) error {
-	return s.repo.BookSlot(id)
+func (s *ScheduleService) BookSlot(ctx context.Context, id uint) error {
+	return s.repo.BookSlot(ctx, id)
 }
 
-func (s *ScheduleService) CancelBooking(id uint) error {
-	return s.repo.CancelBooking(id)
+func (s *ScheduleService) CancelBooking(ctx context.Context, id uint) error {
+	return s.repo.CancelBooking(ctx, id)
 }
 
-func (s *ScheduleService) GetAvailableSlots(doctorID uint, date time.Time) ([]schedule.Schedule, error) {
-	return s.repo.GetAvailable(doctorID, date)
+func (s *ScheduleService) GetAvailableSlots(ctx context.Context, doctorID uint, date time.Time) ([]schedule.Schedule, error) {
+	return s.repo.GetAvailable(ctx, doctorID, date)
 }
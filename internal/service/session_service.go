@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"medical-center/internal/models/user"
+	"medical-center/internal/repository"
+	"strings"
+	"time"
+)
+
+// sessionLastSeenResolution limits how often last_seen_at is written for
+// active sessions
+const sessionLastSeenResolution = time.Minute
+
+type SessionService struct {
+	repo     repository.SessionRepository
+	userRepo repository.UserRepository
+}
+
+func NewSessionService(repo repository.SessionRepository, userRepo repository.UserRepository) *SessionService {
+	return &SessionService{repo: repo, userRepo: userRepo}
+}
+
+// GetSessions lists the active sessions of a user, flagging currentID
+func (s *SessionService) GetSessions(ctx context.Context, userID uint, currentID string) ([]user.Session, error) {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.repo.GetActiveByUser(ctx, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// Revoke ends a session of the given user
+func (s *SessionService) Revoke(ctx context.Context, userID uint, sessionID string) error {
+	session, err := s.repo.GetByID(ctx, sessionID)
+	if err != nil || session.UserID != userID {
+		return errors.New("session not found")
+	}
+	return s.repo.Revoke(ctx, session.ID, time.Now())
+}
+
+// RevokeOthers ends every session of the user except keepID. With an empty
+// keepID all sessions are revoked.
+func (s *SessionService) RevokeOthers(ctx context.Context, userID uint, keepID string) error {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return err
+	}
+	return s.repo.RevokeAllForUser(ctx, userID, keepID, time.Now())
+}
+
+func generateSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// describeDevice turns a user agent into a short label such as
+// "Chrome on Windows". It only needs to help users recognise their devices.
+func describeDevice(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, candidate := range []struct{ token, name string }{
+		// Order matters: Edge and Opera also report Chrome, Chrome reports Safari
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"okhttp", "Android app"},
+		{"CFNetwork", "iOS app"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+
+	platform := ""
+	for _, candidate := range []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			platform = candidate.name
+			break
+		}
+	}
+
+	if platform == "" {
+		return browser
+	}
+	return browser + " on " + platform
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	// Do not leave half of a multi-byte character behind
+	return strings.ToValidUTF8(s[:max], "")
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/models/user"
+	"medical-center/internal/repository"
+	"time"
+)
+
+// ErrRoleNotAssignable is returned when a role grants more than the actor
+// holds
+var ErrRoleNotAssignable = errors.New("you cannot assign a role with permissions you do not hold")
+
+// ErrUserNotManageable is returned when the user's role grants more than the
+// actor holds
+var ErrUserNotManageable = errors.New("you cannot manage a user whose role has permissions you do not hold")
+
+type UserService struct {
+	repo           repository.UserRepository
+	doctorRepo     repository.DoctorRepository
+	attemptRepo    repository.LoginAttemptRepository
+	permissionRepo repository.PermissionRepository
+	sessionRepo    repository.SessionRepository
+	authService    AuthService
+}
+
+func NewUserService(
+	repo repository.UserRepository,
+	doctorRepo repository.DoctorRepository,
+	attemptRepo repository.LoginAttemptRepository,
+	permissionRepo repository.PermissionRepository,
+	sessionRepo repository.SessionRepository,
+	authService AuthService,
+) *UserService {
+	return &UserService{
+		repo:           repo,
+		doctorRepo:     doctorRepo,
+		attemptRepo:    attemptRepo,
+		permissionRepo: permissionRepo,
+		sessionRepo:    sessionRepo,
+		authService:    authService,
+	}
+}
+
+func (s *UserService) ListUsers(ctx context.Context, filter user.ListFilter) ([]user.User, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 100 {
+		filter.PageSize = 20
+	}
+	if filter.Status != "" && filter.Status != user.StatusActive && filter.Status != user.StatusDisabled {
+		return nil, 0, errors.New("invalid status filter")
+	}
+	return s.repo.List(ctx, filter)
+}
+
+func (s *UserService) GetUserByID(ctx context.Context, id uint) (*user.User, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// LinkDoctor attaches the account to a doctor profile so that ".own"
+// permissions apply to that doctor's schedule and appointments.
+// Passing nil removes the link.
+func (s *UserService) LinkDoctor(ctx context.Context, userID uint, doctorID *uint) (*user.User, error) {
+	u, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if doctorID != nil {
+		if _, err := s.doctorRepo.GetByID(ctx, *doctorID); err != nil {
+			return nil, err
+		}
+	}
+
+	u.DoctorID = doctorID
+	if err := s.repo.Update(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// VerifyEmail marks the user's email as verified without the emailed link
+func (s *UserService) VerifyEmail(ctx context.Context, userID uint) (*user.User, error) {
+	u, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.EmailVerified {
+		return u, nil
+	}
+
+	now := time.Now()
+	u.EmailVerified = true
+	u.EmailVerifiedAt = &now
+	if err := s.repo.Update(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Unlock clears the failed login counter and any lockout of the account
+func (s *UserService) Unlock(ctx context.Context, userID uint) error {
+	u, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.attemptRepo.Reset(ctx, accountThrottleKey(u.Email))
+}
+
+// ChangeRole assigns a role to the user. Unless the actor's role holds
+// roles.manage, both the user's current role and the new one must not grant
+// anything the actor's own role does not.
+func (s *UserService) ChangeRole(ctx context.Context, actor *user.User, userID uint, role user.Role) (*user.User, error) {
+	if actor.ID == userID {
+		return nil, errors.New("you cannot change your own role")
+	}
+	if _, err := s.permissionRepo.GetRole(ctx, role); err != nil {
+		return nil, err
+	}
+
+	u, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkRoles(ctx, actor, ErrRoleNotAssignable, u.Role, role); err != nil {
+		return nil, err
+	}
+
+	u.Role = role
+	if err := s.repo.Update(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// checkRoles returns refused unless the actor's role holds roles.manage or
+// every permission granted by the roles
+func (s *UserService) checkRoles(ctx context.Context, actor *user.User, refused error, roles ...user.Role) error {
+	actorPermissions, err := s.permissionRepo.GetRolePermissions(ctx, actor.Role)
+	if err != nil {
+		return err
+	}
+	held := permission.NewSet(actorPermissions)
+	if held.Has(permission.RolesManage) {
+		return nil
+	}
+	for _, r := range roles {
+		names, err := s.permissionRepo.GetRolePermissions(ctx, r)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if !held.Has(name) {
+				return fmt.Errorf("%w: role %s grants %s", refused, r, name)
+			}
+		}
+	}
+	return nil
+}
+
+// manageable returns the user if the actor may manage them: the user's role
+// must not grant anything the actor's own role does not, unless the actor
+// holds roles.manage
+func (s *UserService) manageable(ctx context.Context, actor *user.User, userID uint) (*user.User, error) {
+	u, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkRoles(ctx, actor, ErrUserNotManageable, u.Role); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// SetStatus disables or re-enables an account. Tokens of a disabled user
+// stop working immediately because ValidateToken checks the status.
+func (s *UserService) SetStatus(ctx context.Context, actor *user.User, userID uint, status user.Status) (*user.User, error) {
+	if actor.ID == userID {
+		return nil, errors.New("you cannot change the status of your own account")
+	}
+
+	u, err := s.manageable(ctx, actor, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Status = status
+	if err := s.repo.Update(ctx, u); err != nil {
+		return nil, err
+	}
+	if status == user.StatusDisabled {
+		if err := s.sessionRepo.RevokeAllForUser(ctx, u.ID, "", time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// ForcePasswordReset logs the user out everywhere, blocks login until the
+// password is changed and emails a reset link
+func (s *UserService) ForcePasswordReset(ctx context.Context, actor *user.User, userID uint) error {
+	u, err := s.manageable(ctx, actor, userID)
+	if err != nil {
+		return err
+	}
+
+	u.PasswordResetRequired = true
+	u.TokenVersion++
+	if err := s.repo.Update(ctx, u); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.RevokeAllForUser(ctx, u.ID, "", time.Now()); err != nil {
+		return err
+	}
+
+	return s.authService.RequestPasswordReset(ctx, u.Email)
+}
+
+// DeleteUser soft-deletes the account
+func (s *UserService) DeleteUser(ctx context.Context, actor *user.User, userID uint) error {
+	if actor.ID == userID {
+		return errors.New("you cannot delete your own account")
+	}
+	if _, err := s.manageable(ctx, actor, userID); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.RevokeAllForUser(ctx, userID, "", time.Now()); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, userID)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"medical-center/internal/models/permission"
+	"medical-center/internal/models/user"
+	"testing"
+)
+
+// fakeResetRequests records the password reset links requested for users
+type fakeResetRequests struct {
+	AuthService
+	emails []string
+}
+
+func (a *fakeResetRequests) RequestPasswordReset(ctx context.Context, email string) error {
+	a.emails = append(a.emails, email)
+	return nil
+}
+
+// newUserTestService returns a user service where the receptionist 1 holds
+// users.manage without roles.manage, next to a patient 2, a doctor 3 and an
+// admin 4
+func newUserTestService() (*UserService, *fakeUserRepo, *fakeSessionRepo) {
+	users := &fakeUserRepo{users: map[uint]*user.User{
+		1: {ID: 1, Email: "reception@example.com", Role: user.RoleReceptionist},
+		2: {ID: 2, Email: "patient@example.com", Role: user.RolePatient},
+		3: {ID: 3, Email: "doctor@example.com", Role: user.RoleDoctor},
+		4: {ID: 4, Email: "admin@example.com", Role: user.RoleAdmin},
+	}}
+	permissions := newFakePermissionRepo(map[user.Role][]string{
+		user.RoleReceptionist: {permission.UsersManage, permission.PatientsRead, permission.AppointmentsReadAll, permission.AppointmentsReadOwn},
+		user.RolePatient:      {permission.AppointmentsReadOwn},
+		user.RoleDoctor:       {permission.PatientsReadOwn, permission.AppointmentsReadOwn, permission.EncountersWriteOwn},
+		user.RoleAdmin:        {permission.UsersManage, permission.RolesManage, permission.PatientsRead},
+	})
+	sessions := &fakeSessionRepo{}
+	s := NewUserService(users, nil, nil, permissions, sessions, &fakeResetRequests{})
+	return s, users, sessions
+}
+
+func TestUserManagementRefusesMorePrivilegedUsers(t *testing.T) {
+	ctx := context.Background()
+
+	actions := []struct {
+		name string
+		do   func(s *UserService, actor *user.User, userID uint) error
+	}{
+		{"disable", func(s *UserService, actor *user.User, userID uint) error {
+			_, err := s.SetStatus(ctx, actor, userID, user.StatusDisabled)
+			return err
+		}},
+		{"enable", func(s *UserService, actor *user.User, userID uint) error {
+			_, err := s.SetStatus(ctx, actor, userID, user.StatusActive)
+			return err
+		}},
+		{"force password reset", func(s *UserService, actor *user.User, userID uint) error {
+			return s.ForcePasswordReset(ctx, actor, userID)
+		}},
+		{"delete", func(s *UserService, actor *user.User, userID uint) error {
+			return s.DeleteUser(ctx, actor, userID)
+		}},
+	}
+	targets := []struct {
+		name    string
+		actorID uint
+		userID  uint
+		refused bool
+	}{
+		{"patient by receptionist", 1, 2, false},
+		{"doctor by receptionist", 1, 3, true},
+		{"admin by receptionist", 1, 4, true},
+		{"doctor by admin", 4, 3, false},
+	}
+	for _, action := range actions {
+		for _, tt := range targets {
+			t.Run(action.name+" "+tt.name, func(t *testing.T) {
+				s, users, sessions := newUserTestService()
+				before := *users.users[tt.userID]
+				actor, _ := users.GetByID(ctx, tt.actorID)
+
+				err := action.do(s, actor, tt.userID)
+				if got := errors.Is(err, ErrUserNotManageable); got != tt.refused {
+					t.Fatalf("error = %v, want refused %v", err, tt.refused)
+				}
+				if !tt.refused {
+					if err != nil {
+						t.Fatalf("error = %v", err)
+					}
+					return
+				}
+				if after, ok := users.users[tt.userID]; !ok || *after != before {
+					t.Errorf("refused action changed the user: %+v", after)
+				}
+				if len(sessions.revokedUsers) != 0 {
+					t.Errorf("refused action revoked the sessions of %v", sessions.revokedUsers)
+				}
+			})
+		}
+	}
+}
+
+func TestChangeRole(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		actorID uint
+		userID  uint
+		role    user.Role
+		refused bool
+	}{
+		{"patient to receptionist", 1, 2, user.RoleReceptionist, false},
+		{"patient to doctor", 1, 2, user.RoleDoctor, true},
+		{"doctor to patient", 1, 3, user.RolePatient, true},
+		{"patient to admin by admin", 4, 2, user.RoleAdmin, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, users, _ := newUserTestService()
+			before := users.users[tt.userID].Role
+			actor, _ := users.GetByID(ctx, tt.actorID)
+
+			_, err := s.ChangeRole(ctx, actor, tt.userID, tt.role)
+			if got := errors.Is(err, ErrRoleNotAssignable); got != tt.refused {
+				t.Fatalf("ChangeRole() = %v, want refused %v", err, tt.refused)
+			}
+			want := tt.role
+			if tt.refused {
+				want = before
+			}
+			if got := users.users[tt.userID].Role; got != want {
+				t.Errorf("role = %s, want %s", got, want)
+			}
+		})
+	}
+}
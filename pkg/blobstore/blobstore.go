@@ -0,0 +1,33 @@
+// Package blobstore stores file contents under opaque keys, on the local
+// filesystem or in an S3-compatible object store.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for keys that hold nothing
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps blobs under keys made of slash separated segments, such
+// as "attachments/2024/05/3f9c..."
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing what was there
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns the blob, or ErrNotFound. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// checkKey rejects keys that could escape the store, such as "../x"
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return errors.New("invalid blob key: " + key)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package blobstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxClockSkew is how far the request date may be from the stub's clock
+const maxClockSkew = 15 * time.Minute
+
+type stubObject struct {
+	data        []byte
+	contentType string
+}
+
+// S3Stub is an in-memory stand-in for an S3-compatible store, in the spirit
+// of a local MinIO. It serves path-style PUT, GET, HEAD and DELETE of
+// objects and checks the Signature Version 4 of every request, so that
+// S3Store can be exercised without a real bucket.
+type S3Stub struct {
+	accessKey string
+	secretKey string
+	region    string
+
+	mu      sync.Mutex
+	objects map[string]stubObject
+}
+
+func NewS3Stub(accessKey, secretKey, region string) *S3Stub {
+	return &S3Stub{accessKey: accessKey, secretKey: secretKey, region: region, objects: map[string]stubObject{}}
+}
+
+func (s *S3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if code, message := s.authenticate(r); code != "" {
+		stubError(w, http.StatusForbidden, code, message)
+		return
+	}
+	// Objects are keyed by "bucket/key"
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.Contains(name, "/") {
+		stubError(w, http.StatusNotImplemented, "NotImplemented", "only object requests are supported")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			stubError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		if hash := r.Header.Get("X-Amz-Content-Sha256"); hash != unsignedPayload {
+			sum := sha256.Sum256(data)
+			if hash != hex.EncodeToString(sum[:]) {
+				stubError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "the payload does not match its hash")
+				return
+			}
+		}
+		s.mu.Lock()
+		s.objects[name] = stubObject{data: data, contentType: r.Header.Get("Content-Type")}
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		s.mu.Lock()
+		object, ok := s.objects[name]
+		s.mu.Unlock()
+		if !ok {
+			stubError(w, http.StatusNotFound, "NoSuchKey", "the specified key does not exist")
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Content-Length", fmt.Sprint(len(object.data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(object.data)
+		}
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, name)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		stubError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" is not supported")
+	}
+}
+
+// authenticate checks the Authorization header and returns an S3 error code
+// and message when it is not valid
+func (s *S3Stub) authenticate(r *http.Request) (string, string) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, sigAlgorithm+" ") {
+		return "AccessDenied", "a Signature Version 4 is required"
+	}
+	fields := map[string]string{}
+	for _, field := range strings.Split(strings.TrimPrefix(auth, sigAlgorithm+" "), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		fields[name] = value
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	date, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil {
+		return "AccessDenied", "X-Amz-Date is missing or invalid"
+	}
+	if skew := time.Since(date); skew > maxClockSkew || skew < -maxClockSkew {
+		return "RequestTimeTooSkewed", "the request time is too far from the server time"
+	}
+	if fields["Credential"] != s.accessKey+"/"+credentialScope(amzDate, s.region) {
+		return "InvalidAccessKeyId", "unknown access key or wrong credential scope"
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	expected := signature(r, signed, s.secretKey, s.region, amzDate)
+	if !hmac.Equal([]byte(expected), []byte(fields["Signature"])) {
+		return "SignatureDoesNotMatch", "the request signature does not match"
+	}
+	return "", ""
+}
+
+func stubError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Error><Code>%s</Code><Message>%s</Message></Error>\n", code, message)
+}
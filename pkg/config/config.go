@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -12,6 +14,102 @@ type Config struct {
 	DBPassword string
 	DBName     string
 	JWTSecret  string
+
+	// Public URL of the application, used to build links sent by email
+	AppBaseURL string
+
+	// MailDriver selects the mailer: "smtp" or "file"
+	MailDriver   string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+
+	PasswordMinLength    int
+	PasswordMinClasses   int
+	PasswordRejectCommon bool
+	BcryptCost           int
+
+	LoginMaxFailures   int
+	LoginMaxIPFailures int
+	LoginLockout       time.Duration
+	LoginFailureWindow time.Duration
+
+	// Comma separated roles that must use two-factor authentication
+	MFARequiredRoles string
+	MFAIssuer        string
+
+	// Single sign-on is enabled when OIDCIssuer is set
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       string
+	OIDCGroupsClaim  string
+	// Comma separated group=role pairs, for example "it-admins=admin,physicians=doctor"
+	OIDCGroupRoles  string
+	OIDCDefaultRole string
+
+	// Keys for encrypting patient details: comma separated id:base64 pairs,
+	// the first one encrypts new values
+	EncryptionKeys string
+	BlindIndexKey  string
+
+	// How often the retention rules are enforced, 0 disables the job
+	RetentionInterval time.Duration
+
+	// How often the end of the audit log is checkpointed, 0 disables the job
+	AuditCheckpointInterval time.Duration
+
+	// How long emergency access lasts once declared
+	BreakGlassDuration time.Duration
+
+	// Lab results dropped as files in LabDropDir are ingested every
+	// LabDropInterval, an empty directory disables the job
+	LabDropDir      string
+	LabDropInterval time.Duration
+
+	// AttachmentStore selects the blob store: "local" or "s3"
+	AttachmentStore string
+	AttachmentDir   string
+	S3Endpoint      string
+	S3Region        string
+	S3Bucket        string
+	S3AccessKey     string
+	S3SecretKey     string
+	// S3PathStyle puts the bucket in the path, as MinIO and the stub expect
+	S3PathStyle bool
+	// Largest accepted attachment in bytes
+	AttachmentMaxSize int
+	// Comma separated content types accepted as attachments
+	AttachmentContentTypes string
+	AttachmentURLTTL       time.Duration
+	// Uploads are scanned by clamd when ClamdAddr is set
+	ClamdAddr string
+	// AttachmentRequireScan refuses to serve files stored without a scan
+	AttachmentRequireScan bool
+
+	// SIU messages are sent over MLLP to HL7SendAddr, ADT messages are
+	// received on HL7ListenAddr; either is disabled when empty
+	HL7SendAddr   string
+	HL7ListenAddr string
+	// MSH-3 to MSH-6 of the messages sent
+	HL7SendingApplication   string
+	HL7SendingFacility      string
+	HL7ReceivingApplication string
+	HL7ReceivingFacility    string
+	// HL7AckTimeout bounds the wait for an acknowledgement; failed
+	// deliveries are retried after HL7RetryInterval, doubling every time,
+	// up to HL7MaxAttempts
+	HL7AckTimeout       time.Duration
+	HL7RetryInterval    time.Duration
+	HL7MaxAttempts      int
+	HL7DeliveryInterval time.Duration
 }
 
 func NewConfig() *Config {
@@ -22,6 +120,78 @@ func NewConfig() *Config {
 		DBPassword: getEnv("DB_PASSWORD", "mypassword"),
 		DBName:     getEnv("DB_NAME", "mydatabase"),
 		JWTSecret:  getEnv("JWT_SECRET", "your-secret-key"),
+
+		AppBaseURL: getEnv("APP_BASE_URL", "http://localhost:8080"),
+
+		MailDriver:   getEnv("MAIL_DRIVER", "file"),
+		MailFrom:     getEnv("MAIL_FROM", "no-reply@medical-center.local"),
+		MailDir:      getEnv("MAIL_DIR", "./mail"),
+		SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:     getEnv("SMTP_PORT", "25"),
+		SMTPUser:     getEnv("SMTP_USER", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+
+		PasswordResetTTL:     getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		EmailVerificationTTL: getEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+
+		PasswordMinLength:    getEnvInt("PASSWORD_MIN_LENGTH", 10),
+		PasswordMinClasses:   getEnvInt("PASSWORD_MIN_CLASSES", 3),
+		PasswordRejectCommon: getEnvBool("PASSWORD_REJECT_COMMON", true),
+		BcryptCost:           getEnvInt("BCRYPT_COST", 12),
+
+		LoginMaxFailures:   getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginMaxIPFailures: getEnvInt("LOGIN_MAX_IP_FAILURES", 20),
+		LoginLockout:       getEnvDuration("LOGIN_LOCKOUT", 15*time.Minute),
+		LoginFailureWindow: getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+
+		MFARequiredRoles: getEnv("MFA_REQUIRED_ROLES", ""),
+		MFAIssuer:        getEnv("MFA_ISSUER", "Medical Center"),
+
+		OIDCIssuer:       getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:       getEnv("OIDC_SCOPES", "openid email profile groups"),
+		OIDCGroupsClaim:  getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCGroupRoles:   getEnv("OIDC_GROUP_ROLES", ""),
+		OIDCDefaultRole:  getEnv("OIDC_DEFAULT_ROLE", ""),
+
+		EncryptionKeys: getEnv("ENCRYPTION_KEYS", ""),
+		BlindIndexKey:  getEnv("BLIND_INDEX_KEY", ""),
+
+		RetentionInterval: getEnvDuration("RETENTION_INTERVAL", 24*time.Hour),
+
+		AuditCheckpointInterval: getEnvDuration("AUDIT_CHECKPOINT_INTERVAL", time.Hour),
+
+		BreakGlassDuration: getEnvDuration("BREAK_GLASS_DURATION", time.Hour),
+
+		LabDropDir:      getEnv("LAB_DROP_DIR", ""),
+		LabDropInterval: getEnvDuration("LAB_DROP_INTERVAL", time.Minute),
+
+		AttachmentStore:        getEnv("ATTACHMENT_STORE", "local"),
+		AttachmentDir:          getEnv("ATTACHMENT_DIR", "./attachments"),
+		S3Endpoint:             getEnv("S3_ENDPOINT", ""),
+		S3Region:               getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:               getEnv("S3_BUCKET", ""),
+		S3AccessKey:            getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:            getEnv("S3_SECRET_KEY", ""),
+		S3PathStyle:            getEnvBool("S3_PATH_STYLE", false),
+		AttachmentMaxSize:      getEnvInt("ATTACHMENT_MAX_SIZE", 20<<20),
+		AttachmentContentTypes: getEnv("ATTACHMENT_CONTENT_TYPES", "application/pdf,image/jpeg,image/png,image/webp"),
+		AttachmentURLTTL:       getEnvDuration("ATTACHMENT_URL_TTL", 5*time.Minute),
+		ClamdAddr:              getEnv("CLAMD_ADDR", ""),
+		AttachmentRequireScan:  getEnvBool("ATTACHMENT_REQUIRE_SCAN", false),
+
+		HL7SendAddr:             getEnv("HL7_SEND_ADDR", ""),
+		HL7ListenAddr:           getEnv("HL7_LISTEN_ADDR", ""),
+		HL7SendingApplication:   getEnv("HL7_SENDING_APPLICATION", "MEDCENTER"),
+		HL7SendingFacility:      getEnv("HL7_SENDING_FACILITY", "MEDCENTER"),
+		HL7ReceivingApplication: getEnv("HL7_RECEIVING_APPLICATION", "HIS"),
+		HL7ReceivingFacility:    getEnv("HL7_RECEIVING_FACILITY", "HOSPITAL"),
+		HL7AckTimeout:           getEnvDuration("HL7_ACK_TIMEOUT", 10*time.Second),
+		HL7RetryInterval:        getEnvDuration("HL7_RETRY_INTERVAL", 30*time.Second),
+		HL7MaxAttempts:          getEnvInt("HL7_MAX_ATTEMPTS", 10),
+		HL7DeliveryInterval:     getEnvDuration("HL7_DELIVERY_INTERVAL", 5*time.Second),
 	}
 }
 
@@ -37,3 +207,27 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
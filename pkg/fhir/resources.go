@@ -0,0 +1,275 @@
+// Package fhir holds the FHIR R4 resources the application exposes, limited
+// to the elements it fills in, and the parsing of FHIR search parameters.
+package fhir
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// ContentType of FHIR JSON requests and responses
+const ContentType = "application/fhir+json"
+
+// Version is the FHIR version the resources follow
+const Version = "4.0.1"
+
+// Resource is implemented by every resource through Base
+type Resource interface {
+	// Reference returns the relative reference, e.g. "Appointment/12"
+	Reference() string
+}
+
+// Base holds the elements shared by all resources
+type Base struct {
+	ResourceType string `json:"resourceType"`
+	ID           string `json:"id,omitempty"`
+	Meta         *Meta  `json:"meta,omitempty"`
+}
+
+func (b Base) Reference() string {
+	return b.ResourceType + "/" + b.ID
+}
+
+type Meta struct {
+	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+type HumanName struct {
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+}
+
+// Display returns the text of the name, or the given and family names
+func (n HumanName) Display() string {
+	if n.Text != "" {
+		return n.Text
+	}
+	return strings.TrimSpace(strings.Join(append(append([]string{}, n.Given...), n.Family), " "))
+}
+
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Use    string `json:"use,omitempty"`
+}
+
+type Organization struct {
+	Base
+	Active *bool  `json:"active,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+type HealthcareService struct {
+	Base
+	Active     *bool      `json:"active,omitempty"`
+	ProvidedBy *Reference `json:"providedBy,omitempty"`
+	Name       string     `json:"name,omitempty"`
+}
+
+type Practitioner struct {
+	Base
+	Active *bool       `json:"active,omitempty"`
+	Name   []HumanName `json:"name,omitempty"`
+}
+
+type PractitionerRole struct {
+	Base
+	Active            *bool       `json:"active,omitempty"`
+	Practitioner      *Reference  `json:"practitioner,omitempty"`
+	Organization      *Reference  `json:"organization,omitempty"`
+	HealthcareService []Reference `json:"healthcareService,omitempty"`
+}
+
+type Schedule struct {
+	Base
+	Active *bool       `json:"active,omitempty"`
+	Actor  []Reference `json:"actor"`
+}
+
+// Slot statuses
+const (
+	SlotFree = "free"
+	SlotBusy = "busy"
+)
+
+type Slot struct {
+	Base
+	Schedule Reference `json:"schedule"`
+	Status   string    `json:"status"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+// Appointment statuses
+const (
+	AppointmentBooked    = "booked"
+	AppointmentFulfilled = "fulfilled"
+	AppointmentCancelled = "cancelled"
+)
+
+type Appointment struct {
+	Base
+	// Contained resources are kept raw, only a contained Patient is read
+	Contained   []json.RawMessage        `json:"contained,omitempty"`
+	Status      string                   `json:"status"`
+	Start       *time.Time               `json:"start,omitempty"`
+	End         *time.Time               `json:"end,omitempty"`
+	Slot        []Reference              `json:"slot,omitempty"`
+	Created     *time.Time               `json:"created,omitempty"`
+	Participant []AppointmentParticipant `json:"participant"`
+}
+
+type AppointmentParticipant struct {
+	Actor  *Reference `json:"actor,omitempty"`
+	Status string     `json:"status"`
+}
+
+// Actor returns the first participant that is a resourceType, either by a
+// reference such as "Patient/3" or by a local reference to a contained
+// resource, or nil
+func (a *Appointment) Actor(resourceType string) *Reference {
+	for _, p := range a.Participant {
+		if p.Actor == nil {
+			continue
+		}
+		if strings.HasPrefix(p.Actor.Reference, resourceType+"/") {
+			return p.Actor
+		}
+		if strings.HasPrefix(p.Actor.Reference, "#") {
+			if c := a.ContainedResource(p.Actor.Reference[1:]); c != nil && c.ResourceType == resourceType {
+				return p.Actor
+			}
+		}
+	}
+	return nil
+}
+
+// ContainedResource returns the base of the contained resource id, or nil
+func (a *Appointment) ContainedResource(id string) *Base {
+	for _, raw := range a.Contained {
+		var b Base
+		if err := json.Unmarshal(raw, &b); err == nil && b.ID == id {
+			return &b
+		}
+	}
+	return nil
+}
+
+// ContainedPatient decodes the contained Patient id
+func (a *Appointment) ContainedPatient(id string) (*Patient, bool) {
+	for _, raw := range a.Contained {
+		var p Patient
+		if err := json.Unmarshal(raw, &p); err == nil && p.ResourceType == "Patient" && p.ID == id {
+			return &p, true
+		}
+	}
+	return nil, false
+}
+
+// Patient is only read from appointments being created, patients are not
+// served
+type Patient struct {
+	Base
+	Name    []HumanName    `json:"name,omitempty"`
+	Telecom []ContactPoint `json:"telecom,omitempty"`
+}
+
+// Contact returns the value of the first contact point of the system, such
+// as "email" or "phone"
+func (p *Patient) Contact(system string) string {
+	for _, t := range p.Telecom {
+		if t.System == system {
+			return t.Value
+		}
+	}
+	return ""
+}
+
+type Bundle struct {
+	Base
+	Type  string        `json:"type"`
+	Total *int64        `json:"total,omitempty"`
+	Link  []BundleLink  `json:"link,omitempty"`
+	Entry []BundleEntry `json:"entry,omitempty"`
+}
+
+type BundleLink struct {
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+type BundleEntry struct {
+	FullURL  string             `json:"fullUrl,omitempty"`
+	Resource Resource           `json:"resource"`
+	Search   *BundleEntrySearch `json:"search,omitempty"`
+}
+
+type BundleEntrySearch struct {
+	Mode string `json:"mode"`
+}
+
+// Issue codes of an OperationOutcome
+const (
+	IssueInvalid   = "invalid"
+	IssueNotFound  = "not-found"
+	IssueForbidden = "forbidden"
+	IssueConflict  = "conflict"
+	IssueException = "exception"
+)
+
+type OperationOutcome struct {
+	Base
+	Issue []Issue `json:"issue"`
+}
+
+type Issue struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics,omitempty"`
+}
+
+// NewOperationOutcome reports a single error
+func NewOperationOutcome(code, diagnostics string) *OperationOutcome {
+	return &OperationOutcome{
+		Base:  Base{ResourceType: "OperationOutcome"},
+		Issue: []Issue{{Severity: "error", Code: code, Diagnostics: diagnostics}},
+	}
+}
+
+// CapabilityStatement describes what the server supports
+type CapabilityStatement struct {
+	Base
+	Status      string           `json:"status"`
+	Date        time.Time        `json:"date"`
+	Kind        string           `json:"kind"`
+	FHIRVersion string           `json:"fhirVersion"`
+	Format      []string         `json:"format"`
+	Rest        []CapabilityRest `json:"rest"`
+}
+
+type CapabilityRest struct {
+	Mode     string               `json:"mode"`
+	Resource []CapabilityResource `json:"resource"`
+}
+
+type CapabilityResource struct {
+	Type        string                  `json:"type"`
+	Interaction []CapabilityInteraction `json:"interaction"`
+	SearchParam []CapabilitySearchParam `json:"searchParam,omitempty"`
+}
+
+type CapabilityInteraction struct {
+	Code string `json:"code"`
+}
+
+type CapabilitySearchParam struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
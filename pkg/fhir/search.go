@@ -0,0 +1,161 @@
+package fhir
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidParam is wrapped by every error about a search parameter
+var ErrInvalidParam = errors.New("invalid search parameter")
+
+// Query holds the search parameters of a request
+type Query url.Values
+
+// String returns the first value of the parameter
+func (q Query) String(name string) string {
+	if values := q[name]; len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// Tokens returns the values of the parameter, which may be repeated or
+// comma separated
+func (q Query) Tokens(name string) []string {
+	var tokens []string
+	for _, value := range q[name] {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// Int returns the parameter as a positive number, or def when it is absent
+func (q Query) Int(name string, def int) (int, error) {
+	value := q.String(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%w: %s must be a positive number", ErrInvalidParam, name)
+	}
+	return n, nil
+}
+
+// Bool returns the parameter as true or false, or nil when it is absent
+func (q Query) Bool(name string) (*bool, error) {
+	switch q.String(name) {
+	case "":
+		return nil, nil
+	case "true":
+		b := true
+		return &b, nil
+	case "false":
+		b := false
+		return &b, nil
+	default:
+		return nil, fmt.Errorf("%w: %s must be true or false", ErrInvalidParam, name)
+	}
+}
+
+// Reference returns the ID of a reference parameter to resourceType, given
+// as "Practitioner/12" or "12", or nil when it is absent
+func (q Query) Reference(name, resourceType string) (*uint, error) {
+	value := q.String(name)
+	if value == "" {
+		return nil, nil
+	}
+	id, err := ParseReference(value, resourceType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidParam, name, err)
+	}
+	return &id, nil
+}
+
+// ParseReference returns the ID of a reference to resourceType. A bare ID
+// is accepted as well.
+func ParseReference(ref, resourceType string) (uint, error) {
+	ref = strings.TrimPrefix(ref, resourceType+"/")
+	id, err := strconv.ParseUint(ref, 10, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("not a %s reference: %s", resourceType, ref)
+	}
+	return uint(id), nil
+}
+
+// Dates combines every value of a date parameter into a range, from
+// inclusive and to exclusive; either end is nil when unbounded. A value
+// covers the period of its precision, so "2024-05" is all of May, and may
+// carry the prefix eq (the default), lt, le, gt or ge. Dates without a time
+// zone are in the server's time zone.
+func (q Query) Dates(name string) (from, to *time.Time, err error) {
+	for _, value := range q[name] {
+		prefix := "eq"
+		if len(value) > 2 && value[0] >= 'a' && value[0] <= 'z' {
+			prefix, value = value[:2], value[2:]
+		}
+		start, end, err := parseDate(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s: %v", ErrInvalidParam, name, err)
+		}
+
+		switch prefix {
+		case "eq":
+			from, to = later(from, start), earlier(to, end)
+		case "ge":
+			from = later(from, start)
+		case "gt":
+			from = later(from, end)
+		case "le":
+			to = earlier(to, end)
+		case "lt":
+			to = earlier(to, start)
+		default:
+			return nil, nil, fmt.Errorf("%w: %s: unsupported prefix %s", ErrInvalidParam, name, prefix)
+		}
+	}
+	return from, to, nil
+}
+
+// parseDate returns the period covered by a FHIR date or dateTime
+func parseDate(value string) (time.Time, time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, t.Add(time.Second), nil
+	}
+	layouts := []struct {
+		layout string
+		next   func(time.Time) time.Time
+	}{
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l.layout, value, time.Local); err == nil {
+			return t, l.next(t), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("not a date: %s", value)
+}
+
+func later(current *time.Time, t time.Time) *time.Time {
+	if current == nil || t.After(*current) {
+		return &t
+	}
+	return current
+}
+
+func earlier(current *time.Time, t time.Time) *time.Time {
+	if current == nil || t.Before(*current) {
+		return &t
+	}
+	return current
+}
@@ -0,0 +1,228 @@
+// Package fieldcrypt encrypts individual column values with envelope
+// encryption and computes blind indexes for looking them up.
+//
+// Every value gets its own random data key. The value is sealed with the
+// data key using AES-256-GCM and the data key is sealed with a key
+// encryption key (KEK) from the keyring. Rotating the KEK only requires
+// re-wrapping the data keys, see Rewrap.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix marks encrypted values: "enc1:<key id>:<wrapped data key>:<ciphertext>"
+const prefix = "enc1:"
+
+const keySize = 32
+
+var encoding = base64.RawURLEncoding
+
+// Cipher encrypts with the first key of the keyring and decrypts with any of
+// them
+type Cipher struct {
+	activeID string
+	keys     map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// New parses a keyring such as "2024-06:<base64 key>,2023-01:<base64 key>"
+// and the base64 blind index key. Keys are 32 random bytes; the first key
+// of the ring encrypts new values.
+func New(keyring, indexKey string) (*Cipher, error) {
+	c := &Cipher{keys: map[string]cipher.AEAD{}}
+
+	for _, entry := range strings.Split(keyring, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || strings.Contains(id, ":") {
+			return nil, errors.New("invalid encryption key entry, expected id:base64key")
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+		if _, exists := c.keys[id]; exists {
+			return nil, fmt.Errorf("duplicate encryption key id %s", id)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		c.keys[id] = aead
+		if c.activeID == "" {
+			c.activeID = id
+		}
+	}
+	if c.activeID == "" {
+		return nil, errors.New("no encryption keys configured")
+	}
+
+	key, err := decodeKey(indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("blind index key: %w", err)
+	}
+	c.indexKey = key
+	return c, nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.New("not valid base64")
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsEncrypted reports whether value was produced by Encrypt. Other values
+// are plaintext written before encryption was enabled.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt seals value with a new data key wrapped by the active key
+func (c *Cipher) Encrypt(value string) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(value), nil)
+	if err != nil {
+		return "", err
+	}
+	return c.wrap(c.activeID, dataKey, sealed)
+}
+
+// Decrypt opens a value produced by Encrypt. Plaintext values are returned
+// unchanged so that rows can be read while they are being migrated.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	_, dataKey, sealed, err := c.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(aead, sealed, nil)
+	if err != nil {
+		return "", errors.New("fieldcrypt: value cannot be decrypted")
+	}
+	return string(plain), nil
+}
+
+// NeedsRewrap reports whether value is plaintext or wrapped by a key other
+// than the active one
+func (c *Cipher) NeedsRewrap(value string) bool {
+	if !IsEncrypted(value) {
+		return true
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id != c.activeID
+}
+
+// Rewrap wraps the data key of value with the active key without touching
+// the ciphertext. Plaintext values are encrypted.
+func (c *Cipher) Rewrap(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return c.Encrypt(value)
+	}
+	id, dataKey, sealed, err := c.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+	if id == c.activeID {
+		return value, nil
+	}
+	return c.wrap(c.activeID, dataKey, sealed)
+}
+
+// BlindIndex returns a keyed hash of value for equality lookups. The
+// purpose, usually the column name, keeps equal values in different
+// columns from having the same index. Callers normalise value first.
+func (c *Cipher) BlindIndex(purpose, value string) string {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *Cipher) wrap(id string, dataKey, sealed []byte) (string, error) {
+	// The key ID is authenticated so a wrapped key cannot be relabelled
+	wrapped, err := seal(c.keys[id], dataKey, []byte(id))
+	if err != nil {
+		return "", err
+	}
+	return prefix + id + ":" + encoding.EncodeToString(wrapped) + ":" + encoding.EncodeToString(sealed), nil
+}
+
+func (c *Cipher) unwrap(value string) (id string, dataKey, sealed []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("fieldcrypt: malformed value")
+	}
+	id = parts[0]
+	kek, ok := c.keys[id]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("fieldcrypt: unknown key %s", id)
+	}
+	wrapped, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, errors.New("fieldcrypt: malformed value")
+	}
+	if sealed, err = encoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, errors.New("fieldcrypt: malformed value")
+	}
+	if dataKey, err = open(kek, wrapped, []byte(id)); err != nil {
+		return "", nil, nil, errors.New("fieldcrypt: data key cannot be unwrapped")
+	}
+	return id, dataKey, sealed, nil
+}
+
+// seal prepends the random nonce to the ciphertext
+func seal(aead cipher.AEAD, plain, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
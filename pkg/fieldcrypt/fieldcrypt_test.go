@@ -0,0 +1,194 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, keySize))
+}
+
+func mustNew(t *testing.T, keyring string) *Cipher {
+	t.Helper()
+	c, err := New(keyring, testKey(9))
+	if err != nil {
+		t.Fatalf("New(%q): %v", keyring, err)
+	}
+	return c
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		keyring  string
+		indexKey string
+		wantErr  bool
+	}{
+		{"single key", "k1:" + testKey(1), testKey(9), false},
+		{"key ring", "k2:" + testKey(2) + ", k1:" + testKey(1), testKey(9), false},
+		{"empty ring", "", testKey(9), true},
+		{"missing id", ":" + testKey(1), testKey(9), true},
+		{"missing separator", testKey(1), testKey(9), true},
+		{"short key", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), testKey(9), true},
+		{"invalid base64", "k1:***", testKey(9), true},
+		{"duplicate id", "k1:" + testKey(1) + ",k1:" + testKey(2), testKey(9), true},
+		{"missing index key", "k1:" + testKey(1), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.keyring, tt.indexKey)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	c := mustNew(t, "k1:"+testKey(1))
+	for _, value := range []string{"", "040101500123", "Иванов Иван", "a:b:c"} {
+		encrypted, err := c.Encrypt(value)
+		if err != nil {
+			t.Fatalf("Encrypt(%q): %v", value, err)
+		}
+		if !IsEncrypted(encrypted) || value != "" && strings.Contains(encrypted, value) {
+			t.Errorf("Encrypt(%q) = %q, not an encrypted value", value, encrypted)
+		}
+		got, err := c.Decrypt(encrypted)
+		if err != nil {
+			t.Fatalf("Decrypt(%q): %v", encrypted, err)
+		}
+		if got != value {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q", value, got)
+		}
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	c := mustNew(t, "k1:"+testKey(1))
+	encrypted, err := c.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimPrefix(encrypted, prefix), ":")
+
+	// Same key material under another ID must not open the value
+	relabelled := mustNew(t, "k2:"+testKey(1)+",k1:"+testKey(1))
+
+	tests := []struct {
+		name    string
+		cipher  *Cipher
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"plaintext is returned unchanged", c, "legacy value", "legacy value", false},
+		{"encrypted", c, encrypted, "secret", false},
+		{"unknown key", c, prefix + "k9:" + parts[1] + ":" + parts[2], "", true},
+		{"malformed", c, prefix + "k1:" + parts[1], "", true},
+		{"tampered ciphertext", c, prefix + "k1:" + parts[1] + ":" + parts[1], "", true},
+		{"relabelled key", relabelled, prefix + "k2:" + parts[1] + ":" + parts[2], "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cipher.Decrypt(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decrypt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Decrypt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	old := mustNew(t, "k1:"+testKey(1))
+	rotated := mustNew(t, "k2:"+testKey(2)+",k1:"+testKey(1))
+
+	byOld, err := old.Encrypt("040101500123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byRotated, err := rotated.Encrypt("040101500123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		value         string
+		needsRewrap   bool
+		wantUnchanged bool
+	}{
+		{"wrapped by a previous key", byOld, true, false},
+		{"wrapped by the active key", byRotated, false, true},
+		{"plaintext", "040101500123", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rotated.NeedsRewrap(tt.value); got != tt.needsRewrap {
+				t.Errorf("NeedsRewrap() = %v, want %v", got, tt.needsRewrap)
+			}
+			rewrapped, err := rotated.Rewrap(tt.value)
+			if err != nil {
+				t.Fatalf("Rewrap(): %v", err)
+			}
+			if (rewrapped == tt.value) != tt.wantUnchanged {
+				t.Errorf("Rewrap() changed = %v, want %v", rewrapped != tt.value, !tt.wantUnchanged)
+			}
+			if rotated.NeedsRewrap(rewrapped) {
+				t.Errorf("Rewrap() = %q, still needs a rewrap", rewrapped)
+			}
+			got, err := rotated.Decrypt(rewrapped)
+			if err != nil || got != "040101500123" {
+				t.Errorf("Decrypt(Rewrap()) = %q, %v", got, err)
+			}
+		})
+	}
+
+	// The ciphertext is kept, only the wrapped data key changes
+	rewrapped, err := rotated.Rewrap(byOld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldParts := strings.Split(byOld, ":")
+	newParts := strings.Split(rewrapped, ":")
+	if oldParts[len(oldParts)-1] != newParts[len(newParts)-1] {
+		t.Error("Rewrap() re-encrypted the value instead of re-wrapping its data key")
+	}
+	if _, err := old.Decrypt(rewrapped); err == nil {
+		t.Error("a value re-wrapped with the new key opens without it")
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	c := mustNew(t, "k1:"+testKey(1))
+	other, err := New("k1:"+testKey(1), testKey(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := c.BlindIndex("iin", "040101500123")
+
+	tests := []struct {
+		name  string
+		got   string
+		equal bool
+	}{
+		{"same purpose and value", c.BlindIndex("iin", "040101500123"), true},
+		{"other value", c.BlindIndex("iin", "040101500124"), false},
+		{"other purpose", c.BlindIndex("phone", "040101500123"), false},
+		{"other index key", other.BlindIndex("iin", "040101500123"), false},
+		{"purpose and value boundary", c.BlindIndex("iin0", "40101500123"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.got == base) != tt.equal {
+				t.Errorf("BlindIndex() equal = %v, want %v", tt.got == base, tt.equal)
+			}
+		})
+	}
+}
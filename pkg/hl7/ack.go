@@ -0,0 +1,62 @@
+package hl7
+
+import (
+	"errors"
+	"time"
+)
+
+// Acknowledgement codes of MSA-1, in original and enhanced mode
+const (
+	AckAccept       = "AA"
+	AckError        = "AE"
+	AckReject       = "AR"
+	AckCommitAccept = "CA"
+	AckCommitError  = "CE"
+	AckCommitReject = "CR"
+)
+
+// NewACK answers msg with the code and an optional text. The sending and
+// receiving applications of msg are swapped; when msg could not be parsed
+// it is nil and they are left empty.
+func NewACK(msg *Message, code, text, controlID string, now time.Time) *Message {
+	var in Segment
+	if msg != nil {
+		in = msg.Segment("MSH")
+	}
+
+	msh := NewSegment("MSH")
+	msh.Set(3, in.Field(5))
+	msh.Set(4, in.Field(6))
+	msh.Set(5, in.Field(3))
+	msh.Set(6, in.Field(4))
+	msh.Set(7, FormatTime(now))
+	msh.Set(9, Components("ACK", in.Component(9, 2), "ACK"))
+	msh.Set(10, Escape(controlID))
+	processingID := in.Field(11)
+	if processingID == "" {
+		processingID = "P"
+	}
+	msh.Set(11, processingID)
+	msh.Set(12, Version)
+
+	msa := NewSegment("MSA")
+	msa.Set(1, code)
+	msa.Set(2, in.Field(10))
+	if text != "" {
+		msa.Set(3, Escape(text))
+	}
+	return &Message{Segments: []Segment{msh, msa}}
+}
+
+// ReadACK returns the code and text of an acknowledgement
+func ReadACK(data []byte) (string, string, error) {
+	ack, err := Parse(data)
+	if err != nil {
+		return "", "", err
+	}
+	msa := ack.Segment("MSA")
+	if msa == nil || msa.Field(1) == "" {
+		return "", "", errors.New("acknowledgement without an MSA segment")
+	}
+	return msa.Field(1), Unescape(msa.Field(3)), nil
+}
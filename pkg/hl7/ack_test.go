@@ -0,0 +1,89 @@
+package hl7
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewACK(t *testing.T) {
+	in, err := Parse([]byte(adtA04))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 6, 1, 12, 0, 5, 0, time.FixedZone("", 5*3600))
+
+	tests := []struct {
+		name string
+		msg  *Message
+		code string
+		text string
+		want string
+	}{
+		{
+			"accept",
+			in, AckAccept, "",
+			"MSH|^~\\&|MC|CLINIC|LIS|LAB|20240601120005+0500||ACK^A04^ACK|ACK0001|P|2.5\rMSA|AA|MSG0001\r",
+		},
+		{
+			"error with escaped text",
+			in, AckError, "PID-3 missing | invalid",
+			"MSH|^~\\&|MC|CLINIC|LIS|LAB|20240601120005+0500||ACK^A04^ACK|ACK0001|P|2.5\rMSA|AE|MSG0001|PID-3 missing \\F\\ invalid\r",
+		},
+		{
+			"unparsable message",
+			nil, AckReject, "cannot parse",
+			"MSH|^~\\&|||||20240601120005+0500||ACK^^ACK|ACK0001|P|2.5\rMSA|AR||cannot parse\r",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(NewACK(tt.msg, tt.code, tt.text, "ACK0001", now).Bytes())
+			if got != tt.want {
+				t.Errorf("NewACK() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadACK(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantCode string
+		wantText string
+		wantErr  bool
+	}{
+		{"accept", "MSH|^~\\&|MC||LIS||20240601120005||ACK^A04^ACK|1|P|2.5\rMSA|AA|MSG0001\r", AckAccept, "", false},
+		{"error with text", "MSH|^~\\&|MC||LIS||20240601120005||ACK|1|P|2.5\rMSA|AE|MSG0001|bad \\S\\ value\r", AckError, "bad ^ value", false},
+		{"commit accept", "MSH|^~\\&|MC||LIS||20240601120005||ACK|1|P|2.5\nMSA|CA|MSG0001\n", AckCommitAccept, "", false},
+		{"no MSA", "MSH|^~\\&|MC||LIS||20240601120005||ACK|1|P|2.5\r", "", "", true},
+		{"empty MSA-1", "MSH|^~\\&|MC||LIS||20240601120005||ACK|1|P|2.5\rMSA||MSG0001\r", "", "", true},
+		{"not HL7", "HTTP/1.1 400 Bad Request\r\n", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, text, err := ReadACK([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadACK() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if code != tt.wantCode || text != tt.wantText {
+				t.Errorf("ReadACK() = %q, %q, want %q, %q", code, text, tt.wantCode, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestACKRoundTrip(t *testing.T) {
+	in, err := Parse([]byte(adtA04))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack := NewACK(in, AckError, "unknown patient ^ id", "ACK0002", time.Now())
+	code, text, err := ReadACK(ack.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != AckError || text != "unknown patient ^ id" {
+		t.Errorf("ReadACK(NewACK()) = %q, %q", code, text)
+	}
+}
@@ -0,0 +1,234 @@
+// Package hl7 reads and writes HL7 v2 messages in the usual pipe and hat
+// encoding and carries them over MLLP. Only the standard encoding
+// characters |^~\& are supported.
+package hl7
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EncodingCharacters is MSH-2 of every message
+const EncodingCharacters = `^~\&`
+
+// Version written to MSH-12
+const Version = "2.5"
+
+// Message is a list of segments, the first one being MSH
+type Message struct {
+	Segments []Segment
+}
+
+// Segment holds the fields of a segment still encoded; Segment[0] is the
+// segment name, so that Segment[n] is field n. For MSH, Segment[1] is the
+// field separator as in the standard numbering.
+type Segment []string
+
+// NewSegment starts a segment; fields are set with Set
+func NewSegment(name string) Segment {
+	if name == "MSH" {
+		return Segment{"MSH", "|", EncodingCharacters}
+	}
+	return Segment{name}
+}
+
+func (s Segment) Name() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
+
+// Field returns field n still encoded, or "" when it is absent
+func (s Segment) Field(n int) string {
+	if n < 1 || n >= len(s) {
+		return ""
+	}
+	return s[n]
+}
+
+// Repetitions returns the repetitions of field n still encoded
+func (s Segment) Repetitions(n int) []string {
+	field := s.Field(n)
+	if field == "" {
+		return nil
+	}
+	return strings.Split(field, "~")
+}
+
+// Component returns component c of the first repetition of field n,
+// unescaped
+func (s Segment) Component(n, c int) string {
+	reps := s.Repetitions(n)
+	if len(reps) == 0 {
+		return ""
+	}
+	return ComponentOf(reps[0], c)
+}
+
+// ComponentOf returns component c of an encoded field repetition,
+// unescaped. Subcomponents are left joined.
+func ComponentOf(rep string, c int) string {
+	components := strings.Split(rep, "^")
+	if c < 1 || c > len(components) {
+		return ""
+	}
+	return Unescape(components[c-1])
+}
+
+// Set stores an encoded value in field n, adding empty fields as needed
+func (s *Segment) Set(n int, value string) {
+	for len(*s) <= n {
+		*s = append(*s, "")
+	}
+	(*s)[n] = value
+}
+
+func (s Segment) encode() string {
+	if s.Name() == "MSH" {
+		return "MSH|" + strings.Join(s[2:], "|")
+	}
+	return strings.Join(s, "|")
+}
+
+// Segment returns the first segment with the name, or nil
+func (m *Message) Segment(name string) Segment {
+	for _, s := range m.Segments {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Type returns the message code and trigger event of MSH-9, e.g. "ADT"
+// and "A04"
+func (m *Message) Type() (string, string) {
+	msh := m.Segment("MSH")
+	return msh.Component(9, 1), msh.Component(9, 2)
+}
+
+// ControlID returns MSH-10
+func (m *Message) ControlID() string {
+	return Unescape(m.Segment("MSH").Field(10))
+}
+
+// Bytes encodes the message with segments ended by a carriage return
+func (m *Message) Bytes() []byte {
+	var b strings.Builder
+	for _, s := range m.Segments {
+		b.WriteString(s.encode())
+		b.WriteByte('\r')
+	}
+	return []byte(b.String())
+}
+
+// Parse reads a message. Segments may also be separated by line feeds,
+// which is how messages are usually kept in files.
+func Parse(data []byte) (*Message, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\r")
+	text = strings.ReplaceAll(text, "\n", "\r")
+
+	m := &Message{}
+	for _, line := range strings.Split(text, "\r") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(m.Segments) == 0 {
+			if !strings.HasPrefix(line, "MSH|") {
+				return nil, errors.New("message does not start with an MSH segment")
+			}
+			fields := strings.Split(line, "|")
+			if len(fields) < 2 || fields[1] != EncodingCharacters {
+				return nil, fmt.Errorf("unsupported encoding characters: %q", fields[1])
+			}
+			m.Segments = append(m.Segments, append(Segment{"MSH", "|"}, fields[1:]...))
+			continue
+		}
+		m.Segments = append(m.Segments, Segment(strings.Split(line, "|")))
+	}
+	if len(m.Segments) == 0 {
+		return nil, errors.New("empty message")
+	}
+	return m, nil
+}
+
+var escaper = strings.NewReplacer(
+	`\`, `\E\`,
+	"|", `\F\`,
+	"^", `\S\`,
+	"&", `\T\`,
+	"~", `\R\`,
+	"\r\n", " ",
+	"\r", " ",
+	"\n", " ",
+)
+
+var unescaper = strings.NewReplacer(
+	`\E\`, `\`,
+	`\F\`, "|",
+	`\S\`, "^",
+	`\T\`, "&",
+	`\R\`, "~",
+)
+
+// Escape encodes text for use in a field or component
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// Unescape decodes a field or component
+func Unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return unescaper.Replace(s)
+}
+
+// Components escapes the parts and joins them into a field, leaving out
+// trailing empty components
+func Components(parts ...string) string {
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	escaped := make([]string, len(parts))
+	for i, p := range parts {
+		escaped[i] = Escape(p)
+	}
+	return strings.Join(escaped, "^")
+}
+
+// FormatTime writes a timestamp to the second with its UTC offset
+func FormatTime(t time.Time) string {
+	return t.Format("20060102150405-0700")
+}
+
+// FormatDate writes a date
+func FormatDate(t time.Time) string {
+	return t.Format("20060102")
+}
+
+// ParseTime reads a timestamp of any precision from the year to fractions
+// of a second, with an optional UTC offset. Timestamps without an offset
+// are in the server's time zone.
+func ParseTime(s string) (time.Time, error) {
+	value, offset := s, ""
+	if i := strings.IndexAny(s, "+-"); i >= 0 {
+		value, offset = s[:i], s[i:]
+	}
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		value = value[:i]
+	}
+
+	layouts := map[int]string{4: "2006", 6: "200601", 8: "20060102", 10: "2006010215", 12: "200601021504", 14: "20060102150405"}
+	layout, ok := layouts[len(value)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("not a timestamp: %s", s)
+	}
+	if offset != "" {
+		return time.Parse(layout+"-0700", value+offset)
+	}
+	return time.ParseInLocation(layout, value, time.Local)
+}
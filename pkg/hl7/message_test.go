@@ -0,0 +1,164 @@
+package hl7
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const adtA04 = "MSH|^~\\&|LIS|LAB|MC|CLINIC|20240601120000+0500||ADT^A04^ADT_A01|MSG0001|P|2.5\r" +
+	"PID|1||040101500123^^^KZ^NI~P-17^^^MC^MR||Doe^John^Q||20040101|M\r" +
+	"NTE|1||Line\\F\\with\\S\\escapes\\E\\\r"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		segments []string
+		wantErr  bool
+	}{
+		{"carriage returns", adtA04, []string{"MSH", "PID", "NTE"}, false},
+		{"line feeds", strings.ReplaceAll(adtA04, "\r", "\n"), []string{"MSH", "PID", "NTE"}, false},
+		{"crlf and blank lines", strings.ReplaceAll(adtA04, "\r", "\r\n\r\n"), []string{"MSH", "PID", "NTE"}, false},
+		{"empty", "", nil, true},
+		{"blank lines only", "\r\n\r\n", nil, true},
+		{"no MSH first", "PID|1\rMSH|^~\\&|A\r", nil, true},
+		{"other encoding characters", "MSH|^~\\#|A\r", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var names []string
+			for _, s := range m.Segments {
+				names = append(names, s.Name())
+			}
+			if strings.Join(names, ",") != strings.Join(tt.segments, ",") {
+				t.Errorf("Parse() segments = %v, want %v", names, tt.segments)
+			}
+		})
+	}
+}
+
+func TestMessageFields(t *testing.T) {
+	m, err := Parse([]byte(adtA04))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, event := m.Type()
+	pid := m.Segment("PID")
+	reps := pid.Repetitions(3)
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"MSH-1 field separator", m.Segment("MSH").Field(1), "|"},
+		{"MSH-2 encoding characters", m.Segment("MSH").Field(2), EncodingCharacters},
+		{"MSH-3 sending application", m.Segment("MSH").Field(3), "LIS"},
+		{"message code", code, "ADT"},
+		{"trigger event", event, "A04"},
+		{"control ID", m.ControlID(), "MSG0001"},
+		{"first identifier", pid.Component(3, 1), "040101500123"},
+		{"identifier type", pid.Component(3, 5), "NI"},
+		{"second repetition", ComponentOf(reps[1], 1), "P-17"},
+		{"family name", pid.Component(5, 1), "Doe"},
+		{"missing component", pid.Component(5, 9), ""},
+		{"missing field", pid.Field(30), ""},
+		{"escaped text", m.Segment("NTE").Field(3), `Line\F\with\S\escapes\E\`},
+		{"unescaped text", m.Segment("NTE").Component(3, 1), `Line|with^escapes\`},
+		{"missing segment", m.Segment("OBX").Field(1), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+	if len(reps) != 2 {
+		t.Errorf("Repetitions(3) = %v, want 2 repetitions", reps)
+	}
+}
+
+func TestBytesRoundTrip(t *testing.T) {
+	m, err := Parse([]byte(adtA04))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(m.Bytes()); got != adtA04 {
+		t.Errorf("Bytes() = %q, want %q", got, adtA04)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{`a|b^c&d~e\f`, `a\F\b\S\c\T\d\R\e\E\f`},
+		{"two\r\nlines\nhere", "two lines here"},
+	}
+	for _, tt := range tests {
+		got := Escape(tt.in)
+		if got != tt.want {
+			t.Errorf("Escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if !strings.ContainsAny(tt.in, "\r\n") && Unescape(got) != tt.in {
+			t.Errorf("Unescape(Escape(%q)) = %q", tt.in, Unescape(got))
+		}
+	}
+}
+
+func TestComponents(t *testing.T) {
+	tests := []struct {
+		parts []string
+		want  string
+	}{
+		{[]string{"ACK", "A04", "ACK"}, "ACK^A04^ACK"},
+		{[]string{"ACK", "", "ACK"}, "ACK^^ACK"},
+		{[]string{"Doe", "John", "", ""}, "Doe^John"},
+		{[]string{"", ""}, ""},
+		{[]string{"a^b"}, `a\S\b`},
+	}
+	for _, tt := range tests {
+		if got := Components(tt.parts...); got != tt.want {
+			t.Errorf("Components(%q) = %q, want %q", tt.parts, got, tt.want)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	plus5 := time.FixedZone("", 5*3600)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2024", time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), false},
+		{"20240601", time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local), false},
+		{"202406011230", time.Date(2024, 6, 1, 12, 30, 0, 0, time.Local), false},
+		{"20240601123045+0500", time.Date(2024, 6, 1, 12, 30, 45, 0, plus5), false},
+		{"20240601123045.1234-0000", time.Date(2024, 6, 1, 12, 30, 45, 0, time.UTC), false},
+		{"2024060", time.Time{}, true},
+		{"", time.Time{}, true},
+		{"20241301", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTime(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
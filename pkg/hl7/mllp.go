@@ -0,0 +1,211 @@
+package hl7
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// MLLP frame delimiters
+const (
+	startBlock     = 0x0b
+	endBlock       = 0x1c
+	carriageReturn = 0x0d
+)
+
+// MaxFrameSize bounds the messages read from a connection
+const MaxFrameSize = 1 << 20
+
+// ErrFrameTooLarge is returned for frames over MaxFrameSize
+var ErrFrameTooLarge = errors.New("mllp frame too large")
+
+// WriteFrame writes a payload in an MLLP frame
+func WriteFrame(w io.Writer, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+3)
+	frame = append(frame, startBlock)
+	frame = append(frame, payload...)
+	frame = append(frame, endBlock, carriageReturn)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadFrame reads the payload of the next MLLP frame. Bytes before the
+// start block are skipped.
+func ReadFrame(r *bufio.Reader) ([]byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == startBlock {
+			break
+		}
+	}
+
+	var payload []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if b == endBlock {
+			next, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if next != carriageReturn {
+				return nil, fmt.Errorf("mllp end block followed by 0x%02x", next)
+			}
+			return payload, nil
+		}
+		if len(payload) >= MaxFrameSize {
+			return nil, ErrFrameTooLarge
+		}
+		payload = append(payload, b)
+	}
+}
+
+// Client sends messages to an MLLP receiver over a single connection, which
+// is opened on first use and again after any error
+type Client struct {
+	addr string
+	// timeout bounds connecting, sending and waiting for the acknowledgement
+	timeout time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewClient(addr string, timeout time.Duration) *Client {
+	return &Client{addr: addr, timeout: timeout}
+}
+
+// Send delivers the message and returns the acknowledgement payload. The
+// caller reads the acknowledgement code with ReadACK.
+func (c *Client) Send(ctx context.Context, payload []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	if c.conn == nil {
+		dialer := net.Dialer{Deadline: deadline}
+		conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+		if err != nil {
+			return nil, err
+		}
+		c.conn, c.reader = conn, bufio.NewReader(conn)
+	}
+
+	ack, err := c.exchange(payload, deadline)
+	if err != nil {
+		c.closeLocked()
+		return nil, err
+	}
+	return ack, nil
+}
+
+func (c *Client) exchange(payload []byte, deadline time.Time) ([]byte, error) {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if err := WriteFrame(c.conn, payload); err != nil {
+		return nil, err
+	}
+	return ReadFrame(c.reader)
+}
+
+// Close closes the connection, the next Send opens a new one
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeLocked()
+}
+
+func (c *Client) closeLocked() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.reader = nil, nil
+	return err
+}
+
+// HandlerFunc processes a received message and returns the acknowledgement
+// to send back, or nil to send none
+type HandlerFunc func(ctx context.Context, payload []byte) []byte
+
+// Server accepts MLLP connections and hands every frame to its handler
+type Server struct {
+	Handler HandlerFunc
+	// IdleTimeout closes connections that send nothing for that long
+	IdleTimeout time.Duration
+}
+
+// ListenAndServe listens on addr until ctx is done
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on ln until ctx is done
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(ctx, conn)
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		if s.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
+		payload, err := ReadFrame(reader)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("mllp: %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		ack := s.Handler(ctx, payload)
+		if ack == nil {
+			continue
+		}
+		if err := WriteFrame(conn, ack); err != nil {
+			log.Printf("mllp: %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
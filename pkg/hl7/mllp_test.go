@@ -0,0 +1,60 @@
+package hl7
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr error
+	}{
+		{"frame", "\x0bMSH|^~\\&\r\x1c\r", "MSH|^~\\&\r", nil},
+		{"noise before the start block", "\r\n\x0bPID|1\x1c\r", "PID|1", nil},
+		{"empty frame", "\x0b\x1c\r", "", nil},
+		{"nothing", "", "", io.EOF},
+		{"truncated payload", "\x0bMSH|", "", io.ErrUnexpectedEOF},
+		{"too large", "\x0b" + strings.Repeat("x", MaxFrameSize+1) + "\x1c\r", "", ErrFrameTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadFrame(bufio.NewReader(strings.NewReader(tt.data)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadFrame() error = %v, want %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ReadFrame() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ReadFrame(bufio.NewReader(strings.NewReader("\x0bMSH\x1cX"))); err == nil {
+		t.Error("ReadFrame() accepted an end block without a carriage return")
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, payload := range []string{adtA04, "MSH|^~\\&|A\rMSA|AA|1\r"} {
+		if err := WriteFrame(&buf, []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := bufio.NewReader(&buf)
+	for _, want := range []string{adtA04, "MSH|^~\\&|A\rMSA|AA|1\r"} {
+		got, err := ReadFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("ReadFrame() = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer writes every message as an .eml file into a directory instead
+// of delivering it. Useful for local development.
+type FileMailer struct {
+	dir     string
+	from    string
+	counter uint64
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	n := atomic.AddUint64(&m.counter, 1)
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().Format("20060102T150405.000000000"), n)
+	return os.WriteFile(filepath.Join(m.dir, name), format(m.from, msg), 0o644)
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	// Purpose names the consent the recipient must have given, such as
+	// "marketing", or one of the purposes exempt from consent below. It is
+	// required: a message without one is not sent.
+	Purpose string
+}
+
+// Purposes of messages that are sent without asking for consent
+const (
+	// PurposeTransactional is for mail about the recipient's own account,
+	// such as verification and password reset links
+	PurposeTransactional = "transactional"
+	// PurposeStaff is for work notifications to staff accounts, such as lab
+	// results for the ordering doctor
+	PurposeStaff = "staff"
+)
+
+// ErrNoConsent is returned for messages the recipient has not consented to.
+// Nothing was sent; callers should not treat it as a delivery failure.
+var ErrNoConsent = errors.New("recipient has not consented to this message")
+
+// ErrNoPurpose is returned for messages sent without a Purpose. Nothing was
+// sent.
+var ErrNoPurpose = errors.New("message has no purpose")
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// format renders the message as an RFC 5322 email
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,89 @@
+// Package malware scans uploaded files before they are stored.
+package malware
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Scanner inspects file contents. Scan returns the name of the threat
+// found, or an empty string for a clean file. An error means the file could
+// not be scanned and must not be trusted.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (string, error)
+}
+
+// chunkSize is the size of the chunks streamed to clamd
+const chunkSize = 64 << 10
+
+// ClamdScanner scans with a ClamAV daemon over TCP using the INSTREAM
+// command. The daemon's StreamMaxLength must be at least the largest
+// accepted upload.
+type ClamdScanner struct {
+	addr    string
+	timeout time.Duration
+}
+
+func NewClamdScanner(addr string, timeout time.Duration) *ClamdScanner {
+	return &ClamdScanner{addr: addr, timeout: timeout}
+}
+
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return "", fmt.Errorf("connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+	// Each chunk is prefixed with its length, a zero length ends the stream
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, writeErr := conn.Write(buf[:4+n]); writeErr != nil {
+				return "", writeErr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return "", err
+	}
+	// Replies look like "stream: OK" or "stream: Eicar-Signature FOUND"
+	result := strings.TrimSpace(string(bytes.TrimRight(reply, "\x00")))
+	result = strings.TrimPrefix(result, "stream: ")
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	default:
+		return "", fmt.Errorf("clamd: %s", result)
+	}
+}
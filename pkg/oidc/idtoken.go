@@ -0,0 +1,89 @@
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IDTokenClaims are the ID token claims used for sign-in. Extra holds every
+// claim so that provider specific ones, such as groups, can be read.
+type IDTokenClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Extra         jwt.MapClaims
+}
+
+// clockSkew tolerated when checking exp, iat and nbf
+const clockSkew = time.Minute
+
+// VerifyIDToken checks the signature of an ID token against the provider
+// JWKS as well as its issuer, audience, expiry and nonce
+func (p *Provider) VerifyIDToken(raw, nonce string) (*IDTokenClaims, error) {
+	if _, err := p.Metadata(); err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.key(kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	// With several audiences the token must be issued to us
+	if azp, ok := claims["azp"].(string); ok && azp != p.cfg.ClientID {
+		return nil, errors.New("invalid id token: authorized party mismatch")
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce == "" || tokenNonce != nonce {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("invalid id token: missing subject")
+	}
+
+	result := &IDTokenClaims{Subject: subject, Extra: claims}
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string:
+		// Some providers send the flag as a string
+		result.EmailVerified = v == "true"
+	}
+	return result, nil
+}
+
+// StringsClaim reads a claim holding a list of strings, such as groups
+func (c *IDTokenClaims) StringsClaim(name string) []string {
+	switch v := c.Extra[name].(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case string:
+		return []string{v}
+	default:
+		return nil
+	}
+}
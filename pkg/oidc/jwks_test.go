@@ -0,0 +1,75 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+)
+
+// fakeJWKS serves a key set and counts how often it is fetched
+type fakeJWKS struct {
+	set     JWKS
+	fetches int
+}
+
+func (f *fakeJWKS) getJSON(url string, v interface{}) error {
+	f.fetches++
+	*v.(*JWKS) = f.set
+	return nil
+}
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestNewRSAJWK(t *testing.T) {
+	key := newTestKey(t)
+	got, err := NewRSAJWK("k1", &key.PublicKey).publicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(&key.PublicKey) {
+		t.Error("decoded key differs from the encoded one")
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	first, second := newTestKey(t), newTestKey(t)
+	encryption := NewRSAJWK("enc", &second.PublicKey)
+	encryption.Use = "enc"
+	jwks := &fakeJWKS{set: JWKS{Keys: []JWK{NewRSAJWK("k1", &first.PublicKey), encryption}}}
+	keys := newKeySet("https://idp.example/jwks", jwks.getJSON)
+
+	key, err := keys.key("k1")
+	if err != nil || !key.Equal(&first.PublicKey) {
+		t.Fatalf("key(k1) = %v, %v", key, err)
+	}
+	if _, err := keys.key("k1"); err != nil || jwks.fetches != 1 {
+		t.Errorf("known key refetched: fetches = %d, err = %v", jwks.fetches, err)
+	}
+
+	if _, err := keys.key("enc"); err == nil {
+		t.Error("encryption key used to verify signatures")
+	}
+
+	// The provider rotates its key, unknown kids are refetched at most once
+	// per minute
+	jwks.set = JWKS{Keys: []JWK{NewRSAJWK("k2", &second.PublicKey)}}
+	if _, err := keys.key("k2"); err == nil {
+		t.Error("unknown key refetched within a minute")
+	}
+	keys.fetchedAt = time.Now().Add(-minRefreshInterval)
+	key, err = keys.key("k2")
+	if err != nil || !key.Equal(&second.PublicKey) {
+		t.Fatalf("key(k2) after rotation = %v, %v", key, err)
+	}
+	if jwks.fetches != 2 {
+		t.Errorf("fetches = %d, want 2", jwks.fetches)
+	}
+}
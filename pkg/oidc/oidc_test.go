@@ -0,0 +1,196 @@
+package oidc_test
+
+import (
+	"medical-center/pkg/oidc"
+	"medical-center/pkg/oidc/oidctest"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	clientID     = "medical-center"
+	clientSecret = "secret"
+	redirectURL  = "https://clinic.example/auth/oidc/callback"
+)
+
+// newTestProvider starts the mock identity provider and returns a client
+// configured for it
+func newTestProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+	idp, err := oidctest.NewServer("", clientID, clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(idp)
+	t.Cleanup(ts.Close)
+	idp.Issuer = ts.URL
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       ts.URL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	})
+	return idp, provider
+}
+
+func validClaims(issuer string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            issuer,
+		"sub":            "mock|doctor@hospital.example",
+		"aud":            clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          "nonce",
+		"email":          "doctor@hospital.example",
+		"email_verified": true,
+		"groups":         []string{"physicians", "surgeons"},
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp, provider := newTestProvider(t)
+	other, err := oidctest.NewServer(idp.Issuer, clientID, clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		change  func(claims jwt.MapClaims)
+		signer  *oidctest.Server
+		nonce   string
+		wantErr bool
+	}{
+		{"valid", nil, idp, "nonce", false},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }, idp, "nonce", true},
+		{"one of several audiences", func(c jwt.MapClaims) { c["aud"] = []string{"another-client", clientID}; c["azp"] = clientID }, idp, "nonce", false},
+		{"issued to another party", func(c jwt.MapClaims) { c["aud"] = []string{"another-client", clientID}; c["azp"] = "another-client" }, idp, "nonce", true},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, idp, "nonce", true},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() }, idp, "nonce", true},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, idp, "nonce", true},
+		{"issued in the future", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }, idp, "nonce", true},
+		{"nonce mismatch", nil, idp, "another-nonce", true},
+		{"no nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, idp, "", true},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, idp, "nonce", true},
+		{"signed with another key", nil, other, "nonce", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims(idp.Issuer)
+			if tt.change != nil {
+				tt.change(claims)
+			}
+			raw, err := tt.signer.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := provider.VerifyIDToken(raw, tt.nonce)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyIDToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Subject != "mock|doctor@hospital.example" || got.Email != "doctor@hospital.example" || !got.EmailVerified {
+				t.Errorf("VerifyIDToken() = %+v", got)
+			}
+			if groups := got.StringsClaim("groups"); len(groups) != 2 || groups[1] != "surgeons" {
+				t.Errorf("groups = %v", groups)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRefusesOtherAlgorithms(t *testing.T) {
+	idp, provider := newTestProvider(t)
+
+	// A token signed with the client secret, as if the provider used HS256
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims(idp.Issuer))
+	token.Header["kid"] = oidctest.KeyID
+	raw, err := token.SignedString([]byte(clientSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.VerifyIDToken(raw, "nonce"); err == nil {
+		t.Error("HS256 token accepted")
+	}
+
+	// A valid token whose payload is changed afterwards
+	raw, err = idp.Sign(validClaims(idp.Issuer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(raw, ".")
+	tampered := validClaims(idp.Issuer)
+	tampered["sub"] = "mock|admin@hospital.example"
+	forged, err := idp.Sign(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts[1] = strings.Split(forged, ".")[1]
+	if _, err := provider.VerifyIDToken(strings.Join(parts, "."), "nonce"); err == nil {
+		t.Error("token with a changed payload accepted")
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp, provider := newTestProvider(t)
+
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := func(t *testing.T) string {
+		t.Helper()
+		authURL, err := provider.AuthCodeURL("state", "nonce", oidc.CodeChallengeS256(verifier))
+		if err != nil {
+			t.Fatal(err)
+		}
+		callback, err := idp.Login(authURL, url.Values{"email": {"doctor@hospital.example"}, "email_verified": {"true"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if callback.Query().Get("state") != "state" {
+			t.Fatalf("state = %q", callback.Query().Get("state"))
+		}
+		return callback.Query().Get("code")
+	}
+
+	t.Run("exchange", func(t *testing.T) {
+		code := login(t)
+		token, err := provider.Exchange(code, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := provider.VerifyIDToken(token.IDToken, "nonce")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Email != "doctor@hospital.example" {
+			t.Errorf("email = %q", claims.Email)
+		}
+
+		if _, err := provider.Exchange(code, verifier); err == nil {
+			t.Error("code redeemed twice")
+		}
+	})
+
+	t.Run("wrong code verifier", func(t *testing.T) {
+		code := login(t)
+		other, err := oidc.NewCodeVerifier()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := provider.Exchange(code, other); err == nil {
+			t.Error("code redeemed with another verifier")
+		}
+	})
+}
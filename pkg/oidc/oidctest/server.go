@@ -0,0 +1,299 @@
+// Package oidctest is a minimal OpenID provider for trying single sign-on
+// locally and for tests. It shows a form where any email, name and group
+// list can be entered and signs ID tokens for them. Never expose it outside
+// a development machine.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"medical-center/pkg/oidc"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyID is the kid of the signing key
+const KeyID = "mock-idp-1"
+
+type authCode struct {
+	ClientID      string
+	RedirectURI   string
+	CodeChallenge string
+	Nonce         string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+	ExpiresAt     time.Time
+}
+
+// Server is the provider. Issuer may be set after the server is started,
+// before the first request, when its URL is only known then.
+type Server struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Claims, when set, may change the claims of an ID token before it is
+	// signed
+	Claims func(claims jwt.MapClaims)
+
+	key *rsa.PrivateKey
+	mux *http.ServeMux
+
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+// NewServer returns a provider with a new signing key
+func NewServer(issuer, clientID, clientSecret string) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		mux:          http.NewServeMux(),
+		codes:        make(map[string]authCode),
+	}
+	s.mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	s.mux.HandleFunc("/jwks", s.jwks)
+	s.mux.HandleFunc("/authorize", s.authorize)
+	s.mux.HandleFunc("/token", s.token)
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Sign signs the claims with the provider key
+func (s *Server) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+	return token.SignedString(s.key)
+}
+
+// Login submits the login form for the authorization URL built by the
+// client with the given form values, such as email, email_verified and
+// groups, and returns the URL the browser is redirected back to
+func (s *Server) Login(authCodeURL string, form url.Values) (*url.URL, error) {
+	authURL, err := url.Parse(authCodeURL)
+	if err != nil {
+		return nil, err
+	}
+	values := authURL.Query()
+	for name, value := range form {
+		values[name] = value
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		return nil, fmt.Errorf("login: %d %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	return url.Parse(rec.Header().Get("Location"))
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Issuer,
+		"authorization_endpoint":                s.Issuer + "/authorize",
+		"token_endpoint":                        s.Issuer + "/token",
+		"jwks_uri":                              s.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile", "groups"},
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.JWKS{Keys: []oidc.JWK{oidc.NewRSAJWK(KeyID, &s.key.PublicKey)}})
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Mock identity provider</title></head>
+<body>
+<h1>Mock identity provider</h1>
+<form method="POST" action="/authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{index $value 0}}">
+{{end}}<p><label>Email <input name="email" value="doctor@hospital.example" size="40"></label></p>
+<p><label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label></p>
+<p><label>Name <input name="name" value="Dr. Mock" size="40"></label></p>
+<p><label>Groups (comma separated) <input name="groups" value="physicians" size="40"></label></p>
+<p><button type="submit">Sign in</button></p>
+</form>
+</body>
+</html>
+`))
+
+// authorize shows the login form on GET and issues the code on POST
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := r.Form
+
+	if params.Get("client_id") != s.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(params.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if params.Get("response_type") != "code" || params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "" {
+		http.Error(w, "only the code flow with S256 PKCE is supported", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		oauthParams := url.Values{}
+		for _, name := range []string{"client_id", "redirect_uri", "response_type", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+			oauthParams.Set(name, params.Get(name))
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		loginPage.Execute(w, map[string]interface{}{"Params": oauthParams})
+		return
+	}
+
+	email := strings.TrimSpace(params.Get("email"))
+	if email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+	var groups []string
+	for _, group := range strings.Split(params.Get("groups"), ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+
+	code, err := oidc.RandomString(24)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	s.codes[code] = authCode{
+		ClientID:      s.ClientID,
+		RedirectURI:   redirectURI.String(),
+		CodeChallenge: params.Get("code_challenge"),
+		Nonce:         params.Get("nonce"),
+		Email:         email,
+		EmailVerified: params.Get("email_verified") == "true",
+		Name:          params.Get("name"),
+		Groups:        groups,
+		ExpiresAt:     time.Now().Add(time.Minute),
+	}
+	s.mu.Unlock()
+
+	query := redirectURI.Query()
+	query.Set("code", code)
+	query.Set("state", params.Get("state"))
+	redirectURI.RawQuery = query.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != s.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.ClientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	s.mu.Lock()
+	code, found := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	if !found || time.Now().After(code.ExpiresAt) || code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	if oidc.CodeChallengeS256(r.PostForm.Get("code_verifier")) != code.CodeChallenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.Issuer,
+		"sub":            "mock|" + strings.ToLower(code.Email),
+		"aud":            code.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          code.Nonce,
+		"email":          code.Email,
+		"email_verified": code.EmailVerified,
+		"name":           code.Name,
+		"groups":         code.Groups,
+	}
+	if s.Claims != nil {
+		s.Claims(claims)
+	}
+	signed, err := s.Sign(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, _ := oidc.RandomString(24)
+	writeJSON(w, http.StatusOK, oidc.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		IDToken:     signed,
+		ExpiresIn:   300,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
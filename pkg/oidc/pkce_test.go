@@ -0,0 +1,29 @@
+package oidc
+
+import "testing"
+
+func TestCodeChallengeS256(t *testing.T) {
+	// Example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	if got, want := CodeChallengeS256(verifier), "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("CodeChallengeS256() = %s, want %s", got, want)
+	}
+}
+
+func TestNewCodeVerifier(t *testing.T) {
+	first, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 7636 requires 43 to 128 characters
+	if len(first) < 43 || len(first) > 128 {
+		t.Errorf("verifier length = %d", len(first))
+	}
+	if first == second {
+		t.Error("two verifiers are equal")
+	}
+}
@@ -0,0 +1,140 @@
+// Package passwords implements the password policy and bcrypt hashing with
+// a configurable cost.
+package passwords
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxLength is the bcrypt input limit in bytes
+const MaxLength = 72
+
+//go:embed common.txt
+var commonList string
+
+// common holds the bundled common and breached passwords, lower-cased
+var common = func() map[string]bool {
+	set := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(commonList))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			set[strings.ToLower(line)] = true
+		}
+	}
+	return set
+}()
+
+type Policy struct {
+	MinLength int
+	// MinClasses is how many of lowercase, uppercase, digits and symbols a
+	// password must contain
+	MinClasses int
+	// RejectCommon rejects passwords found in the bundled list
+	RejectCommon bool
+}
+
+// PolicyError lists every rule a password breaks
+type PolicyError struct {
+	Reasons []string
+}
+
+func (e *PolicyError) Error() string {
+	return "password does not meet the policy: " + strings.Join(e.Reasons, "; ")
+}
+
+// Validate checks the password against the policy. Personal values such as
+// the email or name of the user must not be part of the password.
+func (p Policy) Validate(password string, personal ...string) error {
+	var reasons []string
+
+	if len([]rune(password)) < p.MinLength {
+		reasons = append(reasons, "must be at least "+strconv.Itoa(p.MinLength)+" characters long")
+	}
+	if len(password) > MaxLength {
+		reasons = append(reasons, "must be at most "+strconv.Itoa(MaxLength)+" bytes long")
+	}
+	if classes := countClasses(password); classes < p.MinClasses {
+		reasons = append(reasons, "must contain at least "+strconv.Itoa(p.MinClasses)+
+			" of: lowercase letters, uppercase letters, digits, symbols")
+	}
+	if p.RejectCommon && IsCommon(password) {
+		reasons = append(reasons, "is too common")
+	}
+
+	lower := strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if at := strings.IndexByte(value, '@'); at >= 0 {
+			value = value[:at]
+		}
+		if len(value) >= 4 && strings.Contains(lower, value) {
+			reasons = append(reasons, "must not contain your name or email")
+			break
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &PolicyError{Reasons: reasons}
+	}
+	return nil
+}
+
+// IsCommon reports whether the password is in the bundled list
+func IsCommon(password string) bool {
+	return common[strings.ToLower(password)]
+}
+
+func countClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// Hash hashes the password with the given bcrypt cost
+func Hash(password string, cost int) (string, error) {
+	if len(password) > MaxLength {
+		return "", errors.New("password is too long")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Compare reports whether the password matches the hash
+func Compare(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NeedsRehash reports whether the hash was created with a different cost
+func NeedsRehash(hash string, cost int) bool {
+	hashCost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || hashCost != cost
+}
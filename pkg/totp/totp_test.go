@@ -0,0 +1,93 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 test vectors in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		// RFC 6238 appendix B, truncated to six digits
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+	code := func(step int64) string {
+		c, err := CodeAt(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfcSecret, code(current), 1, current, true},
+		{"surrounding spaces", rfcSecret, " " + code(current) + " ", 1, current, true},
+		{"previous step within skew", rfcSecret, code(current - 1), 1, current - 1, true},
+		{"next step within skew", rfcSecret, code(current + 1), 1, current + 1, true},
+		{"previous step without skew", rfcSecret, code(current - 1), 0, 0, false},
+		{"outside skew", rfcSecret, code(current - 2), 1, 0, false},
+		{"wrong code", rfcSecret, "000000", 1, 0, false},
+		{"too short", rfcSecret, code(current)[:5], 1, 0, false},
+		{"too long", rfcSecret, code(current) + "0", 1, 0, false},
+		{"invalid secret", "not base32!", code(current), 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.secret, tt.code, now, tt.skew)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate() = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("GenerateSecret returned the same secret twice")
+	}
+	code, err := Code(a, time.Now())
+	if err != nil {
+		t.Fatalf("Code with a generated secret: %v", err)
+	}
+	if _, ok := Validate(a, code, time.Now(), 1); !ok {
+		t.Error("code of a generated secret does not validate")
+	}
+}